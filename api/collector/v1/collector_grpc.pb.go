@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: api/collector/v1/collector.proto
+
+package collectorv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	CollectorService_GetKlines_FullMethodName    = "/poloniex.collector.v1.CollectorService/GetKlines"
+	CollectorService_GetTrades_FullMethodName    = "/poloniex.collector.v1.CollectorService/GetTrades"
+	CollectorService_StreamTrades_FullMethodName = "/poloniex.collector.v1.CollectorService/StreamTrades"
+	CollectorService_StreamKlines_FullMethodName = "/poloniex.collector.v1.CollectorService/StreamKlines"
+)
+
+// CollectorServiceClient is the client API for CollectorService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CollectorService gives typed access to the collected trades and klines.
+// Times are unix milliseconds, timeframes accept both the Poloniex names
+// (MINUTE_1, HOUR_1, ...) and the short aliases (1m, 1h, ...).
+type CollectorServiceClient interface {
+	// GetKlines returns a page of stored klines.
+	GetKlines(ctx context.Context, in *GetKlinesRequest, opts ...grpc.CallOption) (*GetKlinesResponse, error)
+	// GetTrades returns a page of stored trades, oldest first.
+	GetTrades(ctx context.Context, in *GetTradesRequest, opts ...grpc.CallOption) (*GetTradesResponse, error)
+	// StreamTrades streams live trades as the collector stores them.
+	StreamTrades(ctx context.Context, in *StreamTradesRequest, opts ...grpc.CallOption) (CollectorService_StreamTradesClient, error)
+	// StreamKlines streams every change of the candles of one pair and
+	// timeframe, including the final state of every candle.
+	StreamKlines(ctx context.Context, in *StreamKlinesRequest, opts ...grpc.CallOption) (CollectorService_StreamKlinesClient, error)
+}
+
+type collectorServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCollectorServiceClient(cc grpc.ClientConnInterface) CollectorServiceClient {
+	return &collectorServiceClient{cc}
+}
+
+func (c *collectorServiceClient) GetKlines(ctx context.Context, in *GetKlinesRequest, opts ...grpc.CallOption) (*GetKlinesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetKlinesResponse)
+	err := c.cc.Invoke(ctx, CollectorService_GetKlines_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *collectorServiceClient) GetTrades(ctx context.Context, in *GetTradesRequest, opts ...grpc.CallOption) (*GetTradesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetTradesResponse)
+	err := c.cc.Invoke(ctx, CollectorService_GetTrades_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *collectorServiceClient) StreamTrades(ctx context.Context, in *StreamTradesRequest, opts ...grpc.CallOption) (CollectorService_StreamTradesClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CollectorService_ServiceDesc.Streams[0], CollectorService_StreamTrades_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &collectorServiceStreamTradesClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CollectorService_StreamTradesClient interface {
+	Recv() (*Trade, error)
+	grpc.ClientStream
+}
+
+type collectorServiceStreamTradesClient struct {
+	grpc.ClientStream
+}
+
+func (x *collectorServiceStreamTradesClient) Recv() (*Trade, error) {
+	m := new(Trade)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *collectorServiceClient) StreamKlines(ctx context.Context, in *StreamKlinesRequest, opts ...grpc.CallOption) (CollectorService_StreamKlinesClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CollectorService_ServiceDesc.Streams[1], CollectorService_StreamKlines_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &collectorServiceStreamKlinesClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CollectorService_StreamKlinesClient interface {
+	Recv() (*KlineUpdate, error)
+	grpc.ClientStream
+}
+
+type collectorServiceStreamKlinesClient struct {
+	grpc.ClientStream
+}
+
+func (x *collectorServiceStreamKlinesClient) Recv() (*KlineUpdate, error) {
+	m := new(KlineUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CollectorServiceServer is the server API for CollectorService service.
+// All implementations must embed UnimplementedCollectorServiceServer
+// for forward compatibility
+//
+// CollectorService gives typed access to the collected trades and klines.
+// Times are unix milliseconds, timeframes accept both the Poloniex names
+// (MINUTE_1, HOUR_1, ...) and the short aliases (1m, 1h, ...).
+type CollectorServiceServer interface {
+	// GetKlines returns a page of stored klines.
+	GetKlines(context.Context, *GetKlinesRequest) (*GetKlinesResponse, error)
+	// GetTrades returns a page of stored trades, oldest first.
+	GetTrades(context.Context, *GetTradesRequest) (*GetTradesResponse, error)
+	// StreamTrades streams live trades as the collector stores them.
+	StreamTrades(*StreamTradesRequest, CollectorService_StreamTradesServer) error
+	// StreamKlines streams every change of the candles of one pair and
+	// timeframe, including the final state of every candle.
+	StreamKlines(*StreamKlinesRequest, CollectorService_StreamKlinesServer) error
+	mustEmbedUnimplementedCollectorServiceServer()
+}
+
+// UnimplementedCollectorServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCollectorServiceServer struct {
+}
+
+func (UnimplementedCollectorServiceServer) GetKlines(context.Context, *GetKlinesRequest) (*GetKlinesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetKlines not implemented")
+}
+func (UnimplementedCollectorServiceServer) GetTrades(context.Context, *GetTradesRequest) (*GetTradesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrades not implemented")
+}
+func (UnimplementedCollectorServiceServer) StreamTrades(*StreamTradesRequest, CollectorService_StreamTradesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTrades not implemented")
+}
+func (UnimplementedCollectorServiceServer) StreamKlines(*StreamKlinesRequest, CollectorService_StreamKlinesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamKlines not implemented")
+}
+func (UnimplementedCollectorServiceServer) mustEmbedUnimplementedCollectorServiceServer() {}
+
+// UnsafeCollectorServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CollectorServiceServer will
+// result in compilation errors.
+type UnsafeCollectorServiceServer interface {
+	mustEmbedUnimplementedCollectorServiceServer()
+}
+
+func RegisterCollectorServiceServer(s grpc.ServiceRegistrar, srv CollectorServiceServer) {
+	s.RegisterService(&CollectorService_ServiceDesc, srv)
+}
+
+func _CollectorService_GetKlines_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetKlinesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CollectorServiceServer).GetKlines(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CollectorService_GetKlines_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CollectorServiceServer).GetKlines(ctx, req.(*GetKlinesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CollectorService_GetTrades_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTradesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CollectorServiceServer).GetTrades(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CollectorService_GetTrades_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CollectorServiceServer).GetTrades(ctx, req.(*GetTradesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CollectorService_StreamTrades_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTradesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CollectorServiceServer).StreamTrades(m, &collectorServiceStreamTradesServer{ServerStream: stream})
+}
+
+type CollectorService_StreamTradesServer interface {
+	Send(*Trade) error
+	grpc.ServerStream
+}
+
+type collectorServiceStreamTradesServer struct {
+	grpc.ServerStream
+}
+
+func (x *collectorServiceStreamTradesServer) Send(m *Trade) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CollectorService_StreamKlines_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamKlinesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CollectorServiceServer).StreamKlines(m, &collectorServiceStreamKlinesServer{ServerStream: stream})
+}
+
+type CollectorService_StreamKlinesServer interface {
+	Send(*KlineUpdate) error
+	grpc.ServerStream
+}
+
+type collectorServiceStreamKlinesServer struct {
+	grpc.ServerStream
+}
+
+func (x *collectorServiceStreamKlinesServer) Send(m *KlineUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// CollectorService_ServiceDesc is the grpc.ServiceDesc for CollectorService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CollectorService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "poloniex.collector.v1.CollectorService",
+	HandlerType: (*CollectorServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetKlines",
+			Handler:    _CollectorService_GetKlines_Handler,
+		},
+		{
+			MethodName: "GetTrades",
+			Handler:    _CollectorService_GetTrades_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTrades",
+			Handler:       _CollectorService_StreamTrades_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamKlines",
+			Handler:       _CollectorService_StreamKlines_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/collector/v1/collector.proto",
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Zmey56/poloniex-collector/internal/config"
+	"github.com/Zmey56/poloniex-collector/internal/delivery/httpapi"
+	"github.com/Zmey56/poloniex-collector/internal/delivery/udf"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/clickhouse"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/postgres"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	log.Println("Starting Poloniex query API...")
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		cfg.Database.User,
+		cfg.Database.Password,
+		cfg.Database.Host,
+		cfg.Database.Port,
+		cfg.Database.Name,
+		cfg.Database.SSLMode,
+	)
+
+	pool, err := pgxpool.Connect(context.Background(), dbURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	settings, err := cfg.ExchangeSettings()
+	if err != nil {
+		log.Fatalf("Invalid exchange: %v", err)
+	}
+
+	timeframes, err := timeframe.ParseList(settings.TimeFrames)
+	if err != nil {
+		log.Fatalf("Invalid %s.timeframes: %v", cfg.Exchange, err)
+	}
+
+	repoOpts := []postgres.Option{postgres.WithExchange(cfg.Exchange)}
+	if cfg.Database.Timescale {
+		repoOpts = append(repoOpts, postgres.WithTimescale())
+	}
+	var klineRepo repository.KlineRepository = postgres.NewKlineRepository(pool, repoOpts...)
+	var tradeRepo repository.TradeRepository = postgres.NewTradeRepository(pool, postgres.WithExchange(cfg.Exchange))
+	// Data is read from the first sink the collector writes to.
+	if len(cfg.Sinks) > 0 && cfg.Sinks[0] == "clickhouse" {
+		chClient := clickhouse.NewClient(cfg.ClickHouse.Address,
+			clickhouse.WithDatabase(cfg.ClickHouse.Database),
+			clickhouse.WithCredentials(cfg.ClickHouse.User, cfg.ClickHouse.Password),
+			clickhouse.WithTimeout(cfg.ClickHouse.Timeout),
+		)
+		klineRepo = clickhouse.NewKlineRepository(chClient, clickhouse.WithExchange(cfg.Exchange))
+		tradeRepo = clickhouse.NewTradeRepository(chClient, clickhouse.WithExchange(cfg.Exchange))
+	}
+	api := httpapi.NewServer(query.NewService(klineRepo, tradeRepo))
+	datafeed := udf.NewServer(klineRepo, settings.Pairs, timeframes)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", api.Handler())
+	mux.Handle("/udf/", http.StripPrefix("/udf", datafeed.Handler()))
+
+	httpServer := &http.Server{
+		Addr:              cfg.API.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errChan := make(chan error, 1)
+	go func() {
+		log.Printf("Starting HTTP API on %s", cfg.API.Address)
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("Received shutdown signal")
+	case err := <-errChan:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP API error: %v", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP API shutdown error: %v", err)
+	}
+
+	log.Println("Shutdown complete")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Zmey56/poloniex-collector/internal/config"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/clickhouse"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/fanout"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/postgres"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/sinks"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange"
+	"github.com/Zmey56/poloniex-collector/internal/service"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/backfill"
+)
+
+var (
+	flags      = flag.NewFlagSet("backfill", flag.ExitOnError)
+	pairs      = flags.String("pairs", "", "comma-separated pairs, defaults to the pairs of the configured exchange")
+	timeframes = flags.String("timeframes", "", "comma-separated timeframes, defaults to the timeframes of the configured exchange")
+	from       = flags.String("from", "", "start of the range, YYYY-MM-DD or RFC3339 (required)")
+	to         = flags.String("to", "", "end of the range, YYYY-MM-DD or RFC3339, defaults to now")
+	workers    = flags.Int("workers", 4, "number of pair/timeframe tasks loaded in parallel")
+	chunk      = flags.Int("chunk", 5000, "number of candles saved per checkpoint")
+	rollup     = flags.Bool("rollup", false, "recompute the timeframes from stored 1m candles instead of loading them")
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	flags.Parse(os.Args[1:])
+
+	if *from == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	settings, err := cfg.ExchangeSettings()
+	if err != nil {
+		log.Fatalf("Invalid exchange: %v", err)
+	}
+
+	job := backfill.Job{
+		Pairs:      splitList(*pairs, settings.Pairs),
+		TimeFrames: splitList(*timeframes, settings.TimeFrames),
+		To:         time.Now(),
+	}
+
+	if cfg.Database.Timescale {
+		// The candles of the aggregated timeframes are read from the
+		// continuous aggregates, stored ones would never be served.
+		tfs, err := timeframe.ParseList(job.TimeFrames)
+		if err != nil {
+			log.Fatalf("Invalid --timeframes: %v", err)
+		}
+		job.TimeFrames = timeframe.Names(postgres.WithoutAggregates(tfs))
+		if len(job.TimeFrames) == 0 {
+			log.Println("Every timeframe is built by the continuous aggregates, nothing to backfill")
+			return
+		}
+	}
+
+	if job.From, err = parseTime(*from); err != nil {
+		log.Fatalf("Invalid --from: %v", err)
+	}
+	if *to != "" {
+		if job.To, err = parseTime(*to); err != nil {
+			log.Fatalf("Invalid --to: %v", err)
+		}
+	}
+
+	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		cfg.Database.User,
+		cfg.Database.Password,
+		cfg.Database.Host,
+		cfg.Database.Port,
+		cfg.Database.Name,
+		cfg.Database.SSLMode,
+	)
+
+	pool, err := pgxpool.Connect(context.Background(), dbURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	client, err := exchange.New(cfg.Exchange, exchange.Settings{WSURL: settings.WSURL, RestURL: settings.RestURL})
+	if err != nil {
+		log.Fatalf("Failed to create exchange client: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Candles are written to the same sinks as the collector writes to and
+	// read from the first one.
+	repoOpts := []postgres.Option{postgres.WithExchange(client.Name())}
+	opened, err := sinks.Open(ctx, cfg.Sinks, sinks.Stores{
+		PostgresTrades: postgres.NewTradeRepository(pool, repoOpts...),
+		PostgresKlines: postgres.NewKlineRepository(pool, repoOpts...),
+		ClickHouse: clickhouse.NewClient(cfg.ClickHouse.Address,
+			clickhouse.WithDatabase(cfg.ClickHouse.Database),
+			clickhouse.WithCredentials(cfg.ClickHouse.User, cfg.ClickHouse.Password),
+			clickhouse.WithTimeout(cfg.ClickHouse.Timeout),
+		),
+		ClickHouseOptions: []clickhouse.Option{clickhouse.WithExchange(client.Name())},
+	})
+	if err != nil {
+		log.Fatalf("Failed to open sinks: %v", err)
+	}
+	klineRepo := fanout.NewKlineRepository(opened.Klines...)
+
+	if *rollup {
+		tfs, err := timeframe.ParseList(job.TimeFrames)
+		if err != nil {
+			log.Fatalf("Invalid --timeframes: %v", err)
+		}
+
+		log.Printf("Rolling up %s %v %v from %s to %s", client.Name(), job.Pairs, job.TimeFrames, job.From.UTC(), job.To.UTC())
+		for _, pair := range job.Pairs {
+			if err := service.RecomputeTimeFrames(ctx, klineRepo, pair, tfs, job.From.UnixMilli(), job.To.UnixMilli()); err != nil {
+				log.Printf("Rollup of %s failed: %v", pair, err)
+				pool.Close()
+				os.Exit(1)
+			}
+		}
+
+		log.Println("Rollup complete")
+		return
+	}
+
+	backfillService := backfill.NewService(
+		client,
+		klineRepo,
+		postgres.NewCheckpointRepository(pool, postgres.WithExchange(client.Name())),
+		backfill.WithWorkers(*workers),
+		backfill.WithChunkSize(*chunk),
+	)
+
+	log.Printf("Backfilling %s %v %v from %s to %s", client.Name(), job.Pairs, job.TimeFrames, job.From.UTC(), job.To.UTC())
+	if err := backfillService.Run(ctx, job); err != nil {
+		log.Printf("Backfill finished with errors: %v", err)
+		pool.Close()
+		os.Exit(1)
+	}
+
+	log.Println("Backfill complete")
+}
+
+func splitList(value string, defaults []string) []string {
+	if value == "" {
+		return append([]string(nil), defaults...)
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -2,18 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 
 	"github.com/Zmey56/poloniex-collector/internal/config"
+	"github.com/Zmey56/poloniex-collector/internal/delivery/grpcapi"
+	"github.com/Zmey56/poloniex-collector/internal/delivery/wsapi"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/clickhouse"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/fanout"
 	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/postgres"
-	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/poloniex"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/sinks"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/spool"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/wal"
+	"github.com/Zmey56/poloniex-collector/internal/service"
 	"github.com/Zmey56/poloniex-collector/internal/usecase/collector"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
 )
 
 func main() {
@@ -40,35 +63,290 @@ func main() {
 	}
 	defer pool.Close()
 
-	tradeRepo := postgres.NewTradeRepository(pool)
-	klineRepo := postgres.NewKlineRepository(pool)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m := metrics.NewMetrics(registry)
+
+	settings, err := cfg.ExchangeSettings()
+	if err != nil {
+		log.Fatalf("Invalid exchange: %v", err)
+	}
+
+	timeframes, err := timeframe.ParseList(settings.TimeFrames)
+	if err != nil {
+		log.Fatalf("Invalid %s.timeframes: %v", cfg.Exchange, err)
+	}
+
+	exchangePolicy, err := queue.ParsePolicy(settings.OverflowPolicy)
+	if err != nil {
+		log.Fatalf("Invalid %s.overflow_policy: %v", cfg.Exchange, err)
+	}
+	workerPolicy, err := queue.ParsePolicy(cfg.Worker.OverflowPolicy)
+	if err != nil {
+		log.Fatalf("Invalid worker.overflow_policy: %v", err)
+	}
+
+	client, err := exchange.New(cfg.Exchange, exchange.Settings{
+		WSURL:           settings.WSURL,
+		RestURL:         settings.RestURL,
+		TradeBufferSize: settings.BufferSize,
+		OverflowPolicy:  exchangePolicy,
+		SpillDir:        cfg.Spill.Dir,
+		DropCounter:     m.DroppedCounter(metrics.StageExchange),
+		Metrics:         m,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create exchange client: %v", err)
+	}
+	log.Printf("Collecting from %s", client.Name())
+
+	repoOpts := []postgres.Option{postgres.WithMetrics(m), postgres.WithExchange(client.Name())}
+	if cfg.Database.Timescale {
+		// The continuous aggregates build the higher timeframes from the
+		// stored trades; 1m candles are still built here for live updates.
+		repoOpts = append(repoOpts, postgres.WithTimescale())
+		timeframes = postgres.WithoutAggregates(timeframes)
+		if len(timeframes) == 0 {
+			timeframes = timeframe.MustParseList([]string{"MINUTE_1"})
+		}
+		log.Printf("TimescaleDB mode, building %v", timeframe.Names(timeframes))
+	}
+	var tradeRepo repository.TradeRepository = postgres.NewTradeRepository(pool, repoOpts...)
+	var klineRepo repository.KlineRepository = postgres.NewKlineRepository(pool, repoOpts...)
+
+	var spooledTrades *spool.TradeRepository
+	var spooledKlines *spool.KlineRepository
+	if cfg.Spool.Dir != "" && slices.Contains(cfg.Sinks, "postgres") {
+		fsync, err := wal.ParseSyncPolicy(cfg.Spool.Fsync)
+		if err != nil {
+			log.Fatalf("Invalid spool.fsync: %v", err)
+		}
+		// The size cap is shared by the trade and the kline spool.
+		walOpts := []wal.Option{
+			wal.WithMaxSize(cfg.Spool.MaxSizeMB << 20 / 2),
+			wal.WithSegmentSize(cfg.Spool.SegmentSizeMB << 20),
+			wal.WithSync(fsync, cfg.Spool.FsyncInterval),
+		}
+
+		tradeLog, err := wal.Open(filepath.Join(cfg.Spool.Dir, client.Name(), "trades"), walOpts...)
+		if err != nil {
+			log.Fatalf("Failed to open trade spool: %v", err)
+		}
+		defer tradeLog.Close()
+		klineLog, err := wal.Open(filepath.Join(cfg.Spool.Dir, client.Name(), "klines"), walOpts...)
+		if err != nil {
+			log.Fatalf("Failed to open kline spool: %v", err)
+		}
+		defer klineLog.Close()
+
+		spooledTrades = spool.NewTradeRepository(tradeRepo, tradeLog, spool.WithRetryInterval(cfg.Spool.RetryInterval))
+		spooledKlines = spool.NewKlineRepository(klineRepo, klineLog, spool.WithRetryInterval(cfg.Spool.RetryInterval))
+		tradeRepo, klineRepo = spooledTrades, spooledKlines
+
+		// Klines spooled before a restart must be stored before the
+		// collector restores the open klines.
+		if err := spooledKlines.Replay(context.Background()); err != nil {
+			log.Printf("Failed to replay spooled klines: %v", err)
+		}
+		if err := spooledTrades.Replay(context.Background()); err != nil {
+			log.Printf("Failed to replay spooled trades: %v", err)
+		}
+	}
+
+	var fanoutTrades *fanout.TradeRepository
+	opened, err := sinks.Open(context.Background(), cfg.Sinks, sinks.Stores{
+		PostgresTrades: tradeRepo,
+		PostgresKlines: klineRepo,
+		ClickHouse: clickhouse.NewClient(cfg.ClickHouse.Address,
+			clickhouse.WithDatabase(cfg.ClickHouse.Database),
+			clickhouse.WithCredentials(cfg.ClickHouse.User, cfg.ClickHouse.Password),
+			clickhouse.WithTimeout(cfg.ClickHouse.Timeout),
+		),
+		ClickHouseOptions: []clickhouse.Option{clickhouse.WithMetrics(m), clickhouse.WithExchange(client.Name())},
+	})
+	if err != nil {
+		log.Fatalf("Failed to open sinks: %v", err)
+	}
+	if len(opened.Trades) == 1 {
+		tradeRepo, klineRepo = opened.Trades[0].Repository, opened.Klines[0].Repository
+	} else {
+		fanoutTrades = fanout.NewTradeRepository(opened.Trades,
+			service.WithTradeFlushInterval(cfg.Worker.FlushInterval),
+			service.WithTradeBatchSize(cfg.Worker.BatchSize),
+			service.WithMaxPendingTrades(cfg.Worker.MaxPending),
+			service.WithWriterMetrics(m),
+		)
+		tradeRepo, klineRepo = fanoutTrades, fanout.NewKlineRepository(opened.Klines...)
+	}
+	log.Printf("Writing to %v", cfg.Sinks)
 
-	exchange := poloniex.NewClient(cfg.Poloniex.WSURL, cfg.Poloniex.RestURL)
+	tickerRepo := postgres.NewTickerRepository(pool, postgres.WithMetrics(m))
 
-	service := collector.NewService(
+	collectorOpts := []collector.Option{
+		collector.WithPairs(settings.Pairs),
+		collector.WithTimeFrames(timeframes),
+		collector.WithFlushInterval(cfg.Worker.FlushInterval),
+		collector.WithBatchSize(cfg.Worker.BatchSize),
+		collector.WithMaxPendingTrades(cfg.Worker.MaxPending),
+		collector.WithWorkerPoolOptions(
+			service.WithQueueSize(cfg.Worker.QueueSize),
+			service.WithOverflowPolicy(workerPolicy, cfg.Spill.Dir),
+			service.WithDropCounter(m.DroppedCounter(metrics.StageWorker)),
+		),
+		collector.WithMetrics(m),
+	}
+	if cfg.Worker.Cascade {
+		collectorOpts = append(collectorOpts, collector.WithCascade())
+	}
+
+	var streamHub *wsapi.Hub
+	if cfg.Stream.Address != "" {
+		streamHub = wsapi.NewHub(wsapi.WithSendBuffer(cfg.Stream.SendBuffer), wsapi.WithMetrics(m))
+		collectorOpts = append(collectorOpts, collector.WithKlineListener(streamHub))
+	}
+
+	var grpcAPI *grpcapi.Server
+	if cfg.GRPC.Address != "" {
+		grpcAPI = grpcapi.NewServer(
+			query.NewService(klineRepo, tradeRepo),
+			grpcapi.WithStreamBuffer(cfg.GRPC.StreamBuffer),
+		)
+		collectorOpts = append(collectorOpts,
+			collector.WithTradeListener(grpcAPI),
+			collector.WithKlineListener(grpcAPI),
+		)
+	}
+
+	collectorService := collector.NewService(
 		tradeRepo,
 		klineRepo,
-		exchange,
+		tickerRepo,
+		client,
 		cfg.Worker.PoolSize,
+		collectorOpts...,
 	)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	go postgres.MonitorPool(ctx, pool, m, 15*time.Second)
+
+	if cfg.Partitions.Enabled {
+		go postgres.NewTradePartitions(pool,
+			postgres.WithPremakeMonths(cfg.Partitions.PremakeMonths),
+			postgres.WithRetentionMonths(cfg.Partitions.RetentionMonths),
+			postgres.WithDetach(cfg.Partitions.Detach),
+			postgres.WithMaintenanceInterval(cfg.Partitions.CheckInterval),
+		).Run(ctx)
+	} else if slices.Contains(cfg.Sinks, "postgres") {
+		partitioned, err := postgres.TradesPartitioned(ctx, pool)
+		if err != nil {
+			log.Fatalf("Failed to check the trades table: %v", err)
+		}
+		if partitioned {
+			log.Fatal("Trades are partitioned by month, enable partitions so that the partitions of new months are created")
+		}
+	}
+
+	if spooledTrades != nil {
+		go spooledTrades.Run(ctx)
+		go spooledKlines.Run(ctx)
+	}
+
+	if fanoutTrades != nil {
+		go fanoutTrades.Run(ctx)
+		defer func() {
+			if err := fanoutTrades.Flush(context.Background()); err != nil {
+				log.Printf("Error writing trades to the other sinks on shutdown: %v", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	httpServer := &http.Server{
+		Addr:              cfg.Metrics.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Starting HTTP server on %s", cfg.Metrics.Address)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+	}()
+
+	if streamHub != nil {
+		streamMux := http.NewServeMux()
+		streamMux.Handle("/v1/stream", streamHub)
+		streamServer := &http.Server{
+			Addr:              cfg.Stream.Address,
+			Handler:           streamMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			log.Printf("Starting candle stream on %s", cfg.Stream.Address)
+			if err := streamServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Candle stream server error: %v", err)
+			}
+		}()
+		defer func() {
+			// Shutdown does not close hijacked WebSocket connections.
+			streamHub.Close()
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer shutdownCancel()
+			if err := streamServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Candle stream shutdown error: %v", err)
+			}
+		}()
+	}
+
+	if grpcAPI != nil {
+		lis, err := net.Listen("tcp", cfg.GRPC.Address)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", cfg.GRPC.Address, err)
+		}
+		grpcServer := grpc.NewServer()
+		grpcAPI.Register(grpcServer)
+
+		go func() {
+			log.Printf("Starting gRPC server on %s", cfg.GRPC.Address)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Printf("gRPC server error: %v", err)
+			}
+		}()
+		defer func() {
+			// GracefulStop waits for open streams, so end them first.
+			grpcAPI.Close()
+			grpcServer.GracefulStop()
+		}()
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	errChan := make(chan error, 1)
 	go func() {
-		if err := service.Run(ctx); err != nil {
-			errChan <- err
-		}
+		errChan <- collectorService.Run(ctx)
 	}()
 
 	select {
 	case <-sigChan:
 		log.Println("Received shutdown signal")
 		cancel()
+		<-errChan
 	case err := <-errChan:
 		log.Printf("Service error: %v", err)
 		cancel()
@@ -12,6 +12,7 @@ import (
 var (
 	flags = flag.NewFlagSet("goose", flag.ExitOnError)
 	dir   = flags.String("dir", "migrations", "directory with migration files")
+	table = flags.String("table", "goose_db_version", "table keeping the applied migrations")
 )
 
 func main() {
@@ -36,6 +37,7 @@ func main() {
 		}
 	}()
 
+	goose.SetTableName(*table)
 	if err := goose.Run(command, db, *dir, args[2:]...); err != nil {
 		log.Fatalf("goose %v: %v", command, err)
 	}
@@ -2,13 +2,27 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
 )
 
+// ExchangeConfig holds the settings of one exchange. Pairs are written
+// BASE_QUOTE whatever the exchange.
+type ExchangeConfig struct {
+	WSURL          string   `mapstructure:"ws_url"`
+	RestURL        string   `mapstructure:"rest_url"`
+	Pairs          []string `mapstructure:"pairs"`
+	TimeFrames     []string `mapstructure:"timeframes"`
+	BufferSize     int      `mapstructure:"buffer_size"`
+	OverflowPolicy string   `mapstructure:"overflow_policy"`
+}
+
 type Config struct {
 	Database struct {
 		Host     string `mapstructure:"host"`
@@ -17,20 +31,83 @@ type Config struct {
 		Password string `mapstructure:"password"`
 		Name     string `mapstructure:"name"`
 		SSLMode  string `mapstructure:"sslmode"`
+		// Timescale reads the higher timeframes from the continuous
+		// aggregates of migrations/timescale instead of building them in
+		// the collector.
+		Timescale bool `mapstructure:"timescale"`
 	} `mapstructure:"database"`
 
-	Poloniex struct {
-		WSURL      string   `mapstructure:"ws_url"`
-		RestURL    string   `mapstructure:"rest_url"`
-		Pairs      []string `mapstructure:"pairs"`
-		TimeFrames []string `mapstructure:"timeframes"`
-	} `mapstructure:"poloniex"`
+	// Sinks are the stores trades and klines are written to: postgres,
+	// clickhouse or both. Reads go to the first one.
+	Sinks []string `mapstructure:"sinks"`
+
+	ClickHouse struct {
+		Address  string        `mapstructure:"address"`
+		Database string        `mapstructure:"database"`
+		User     string        `mapstructure:"user"`
+		Password string        `mapstructure:"password"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"clickhouse"`
+
+	// Exchange is the exchange collected from and served: poloniex, binance,
+	// kraken or coinbase.
+	Exchange string `mapstructure:"exchange"`
+
+	Poloniex ExchangeConfig `mapstructure:"poloniex"`
+	Binance  ExchangeConfig `mapstructure:"binance"`
+	Kraken   ExchangeConfig `mapstructure:"kraken"`
+	Coinbase ExchangeConfig `mapstructure:"coinbase"`
 
 	Worker struct {
-		PoolSize      int           `mapstructure:"pool_size"`
-		BatchSize     int           `mapstructure:"batch_size"`
-		FlushInterval time.Duration `mapstructure:"flush_interval"`
+		PoolSize       int           `mapstructure:"pool_size"`
+		BatchSize      int           `mapstructure:"batch_size"`
+		FlushInterval  time.Duration `mapstructure:"flush_interval"`
+		QueueSize      int           `mapstructure:"queue_size"`
+		OverflowPolicy string        `mapstructure:"overflow_policy"`
+		Cascade        bool          `mapstructure:"cascade"`
+		MaxPending     int           `mapstructure:"max_pending_trades"`
 	} `mapstructure:"worker"`
+
+	Spill struct {
+		Dir string `mapstructure:"dir"`
+	} `mapstructure:"spill"`
+
+	Spool struct {
+		Dir           string        `mapstructure:"dir"`
+		MaxSizeMB     int64         `mapstructure:"max_size_mb"`
+		SegmentSizeMB int64         `mapstructure:"segment_size_mb"`
+		Fsync         string        `mapstructure:"fsync"`
+		FsyncInterval time.Duration `mapstructure:"fsync_interval"`
+		RetryInterval time.Duration `mapstructure:"retry_interval"`
+	} `mapstructure:"spool"`
+
+	// Partitions maintains the monthly partitions of trades created by the
+	// migrations in migrations/partitioned.
+	Partitions struct {
+		Enabled         bool          `mapstructure:"enabled"`
+		PremakeMonths   int           `mapstructure:"premake_months"`
+		RetentionMonths int           `mapstructure:"retention_months"`
+		Detach          bool          `mapstructure:"detach"`
+		CheckInterval   time.Duration `mapstructure:"check_interval"`
+	} `mapstructure:"partitions"`
+
+	Metrics struct {
+		Address string `mapstructure:"address"`
+	} `mapstructure:"metrics"`
+
+	API struct {
+		Address string `mapstructure:"address"`
+	} `mapstructure:"api"`
+
+	Stream struct {
+		Address    string `mapstructure:"address"`
+		SendBuffer int    `mapstructure:"send_buffer"`
+	} `mapstructure:"stream"`
+
+	GRPC struct {
+		Address      string `mapstructure:"address"`
+		StreamBuffer int    `mapstructure:"stream_buffer"`
+	} `mapstructure:"grpc"`
 }
 
 func Load() (*Config, error) {
@@ -46,15 +123,77 @@ func Load() (*Config, error) {
 	viper.SetDefault("database.password", "postgres")
 	viper.SetDefault("database.name", "poloniex")
 	viper.SetDefault("database.sslmode", "disable")
+	viper.SetDefault("database.timescale", false)
+
+	viper.SetDefault("sinks", []string{"postgres"})
+	viper.SetDefault("clickhouse.address", "http://localhost:8123")
+	viper.SetDefault("clickhouse.database", "default")
+	viper.SetDefault("clickhouse.user", "default")
+	viper.SetDefault("clickhouse.password", "")
+	viper.SetDefault("clickhouse.timeout", "30s")
 
 	viper.SetDefault("poloniex.ws_url", "wss://ws.poloniex.com/ws/public")
 	viper.SetDefault("poloniex.rest_url", "https://api.poloniex.com")
 	viper.SetDefault("poloniex.pairs", []string{"BTC_USDT", "ETH_USDT", "TRX_USDT", "DOGE_USDT", "BCH_USDT"})
-	viper.SetDefault("poloniex.timeframes", []string{"MINUTE_1", "MINUTE_15", "HOUR_1", "DAY_1"})
+	viper.SetDefault("poloniex.timeframes", timeframe.Default)
+	viper.SetDefault("poloniex.buffer_size", 1000)
+	viper.SetDefault("poloniex.overflow_policy", "block")
+
+	viper.SetDefault("exchange", "poloniex")
+
+	viper.SetDefault("binance.ws_url", "wss://stream.binance.com:9443/ws")
+	viper.SetDefault("binance.rest_url", "https://api.binance.com")
+	viper.SetDefault("binance.pairs", []string{"BTC_USDT", "ETH_USDT"})
+	viper.SetDefault("binance.timeframes", timeframe.Default)
+	viper.SetDefault("binance.buffer_size", 1000)
+	viper.SetDefault("binance.overflow_policy", "block")
+
+	viper.SetDefault("kraken.ws_url", "wss://ws.kraken.com/v2")
+	viper.SetDefault("kraken.rest_url", "https://api.kraken.com")
+	viper.SetDefault("kraken.pairs", []string{"BTC_USD", "ETH_USD"})
+	viper.SetDefault("kraken.timeframes", timeframe.Default)
+	viper.SetDefault("kraken.buffer_size", 1000)
+	viper.SetDefault("kraken.overflow_policy", "block")
+
+	viper.SetDefault("coinbase.ws_url", "wss://ws-feed.exchange.coinbase.com")
+	viper.SetDefault("coinbase.rest_url", "https://api.exchange.coinbase.com")
+	viper.SetDefault("coinbase.pairs", []string{"BTC_USD", "ETH_USD"})
+	viper.SetDefault("coinbase.timeframes", timeframe.Default)
+	viper.SetDefault("coinbase.buffer_size", 1000)
+	viper.SetDefault("coinbase.overflow_policy", "block")
 
 	viper.SetDefault("worker.pool_size", 10)
 	viper.SetDefault("worker.batch_size", 1000)
 	viper.SetDefault("worker.flush_interval", "5s")
+	viper.SetDefault("worker.queue_size", 1000)
+	viper.SetDefault("worker.overflow_policy", "block")
+	viper.SetDefault("worker.cascade", false)
+	viper.SetDefault("worker.max_pending_trades", 100000)
+
+	viper.SetDefault("spill.dir", "data/spill")
+
+	viper.SetDefault("spool.dir", "data/spool")
+	viper.SetDefault("spool.max_size_mb", 1024)
+	viper.SetDefault("spool.segment_size_mb", 64)
+	viper.SetDefault("spool.fsync", "interval")
+	viper.SetDefault("spool.fsync_interval", "1s")
+	viper.SetDefault("spool.retry_interval", "5s")
+
+	viper.SetDefault("partitions.enabled", false)
+	viper.SetDefault("partitions.premake_months", 3)
+	viper.SetDefault("partitions.retention_months", 0)
+	viper.SetDefault("partitions.detach", false)
+	viper.SetDefault("partitions.check_interval", "1h")
+
+	viper.SetDefault("metrics.address", ":9090")
+
+	viper.SetDefault("api.address", ":8080")
+
+	viper.SetDefault("stream.address", ":8081")
+	viper.SetDefault("stream.send_buffer", 256)
+
+	viper.SetDefault("grpc.address", ":50051")
+	viper.SetDefault("grpc.stream_buffer", 256)
 
 	log.Printf("Environment variables:")
 	log.Printf("DATABASE_HOST=%s", os.Getenv("DATABASE_HOST"))
@@ -93,6 +232,11 @@ func Load() (*Config, error) {
 		log.Println("Failed to bind environment variable DATABASE_SSLMODE")
 		return nil, err
 	}
+	err = viper.BindEnv("database.timescale", "DATABASE_TIMESCALE")
+	if err != nil {
+		log.Println("Failed to bind environment variable DATABASE_TIMESCALE")
+		return nil, err
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		var configFileNotFoundError viper.ConfigFileNotFoundError
@@ -115,3 +259,19 @@ func Load() (*Config, error) {
 
 	return &config, nil
 }
+
+// ExchangeSettings returns the settings of the configured exchange.
+func (c *Config) ExchangeSettings() (ExchangeConfig, error) {
+	switch c.Exchange {
+	case "poloniex":
+		return c.Poloniex, nil
+	case "binance":
+		return c.Binance, nil
+	case "kraken":
+		return c.Kraken, nil
+	case "coinbase":
+		return c.Coinbase, nil
+	default:
+		return ExchangeConfig{}, fmt.Errorf("unsupported exchange %q", c.Exchange)
+	}
+}
@@ -0,0 +1,70 @@
+package grpcapi
+
+import "sync"
+
+// broker fans published values out to subscribers without blocking the
+// publisher. A subscriber whose buffer is full is dropped: its dropped
+// channel is closed and it gets no more values.
+type broker[T any] struct {
+	buffer int
+
+	mu   sync.RWMutex
+	subs map[*subscriber[T]]struct{}
+}
+
+type subscriber[T any] struct {
+	ch      chan T
+	match   func(T) bool
+	dropped chan struct{}
+	once    sync.Once
+}
+
+func newBroker[T any](buffer int) *broker[T] {
+	return &broker[T]{
+		buffer: buffer,
+		subs:   make(map[*subscriber[T]]struct{}),
+	}
+}
+
+// subscribe registers a subscriber receiving the published values match
+// accepts.
+func (b *broker[T]) subscribe(match func(T) bool) *subscriber[T] {
+	sub := &subscriber[T]{
+		ch:      make(chan T, b.buffer),
+		match:   match,
+		dropped: make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *broker[T]) unsubscribe(sub *subscriber[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
+
+func (b *broker[T]) publish(v T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !sub.match(v) {
+			continue
+		}
+		select {
+		case sub.ch <- v:
+		default:
+			sub.once.Do(func() { close(sub.dropped) })
+		}
+	}
+}
+
+func (b *broker[T]) len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
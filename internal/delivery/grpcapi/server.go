@@ -0,0 +1,240 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	collectorv1 "github.com/Zmey56/poloniex-collector/api/collector/v1"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+const defaultStreamBuffer = 256
+
+type klineEvent struct {
+	kline  models.Kline
+	closed bool
+}
+
+// Server implements collectorv1.CollectorService. Queries are served by the
+// query service; the streams are fed by OnTrade and OnKline, so the server is
+// meant to be registered as a trade and kline listener of the collector.
+//
+// Every stream has its own bounded buffer. A stream that falls behind is
+// ended with ResourceExhausted instead of slowing down the collector.
+type Server struct {
+	collectorv1.UnimplementedCollectorServiceServer
+
+	queries *query.Service
+	health  *health.Server
+	trades  *broker[models.RecentTrade]
+	klines  *broker[klineEvent]
+	done    chan struct{}
+}
+
+type Option func(*options)
+
+type options struct {
+	streamBuffer int
+}
+
+// WithStreamBuffer sets the number of messages buffered for every stream
+// before it is considered too slow.
+func WithStreamBuffer(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.streamBuffer = size
+		}
+	}
+}
+
+func NewServer(queries *query.Service, opts ...Option) *Server {
+	o := options{streamBuffer: defaultStreamBuffer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Server{
+		queries: queries,
+		health:  health.NewServer(),
+		trades:  newBroker[models.RecentTrade](o.streamBuffer),
+		klines:  newBroker[klineEvent](o.streamBuffer),
+		done:    make(chan struct{}),
+	}
+}
+
+// Register adds the collector, health and reflection services to gs.
+func (s *Server) Register(gs *grpc.Server) {
+	collectorv1.RegisterCollectorServiceServer(gs, s)
+	healthpb.RegisterHealthServer(gs, s.health)
+	reflection.Register(gs)
+
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.health.SetServingStatus(collectorv1.CollectorService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+}
+
+// Close reports the server as not serving and ends all open streams, so that
+// grpc.Server.GracefulStop does not wait for them.
+func (s *Server) Close() {
+	s.health.Shutdown()
+	close(s.done)
+}
+
+// OnTrade implements collector.TradeListener.
+func (s *Server) OnTrade(trade models.RecentTrade) {
+	s.trades.publish(trade)
+}
+
+// OnKline implements service.KlineListener.
+func (s *Server) OnKline(kline models.Kline, closed bool) {
+	s.klines.publish(klineEvent{kline: kline, closed: closed})
+}
+
+func (s *Server) GetKlines(ctx context.Context, req *collectorv1.GetKlinesRequest) (*collectorv1.GetKlinesResponse, error) {
+	page, err := s.queries.Klines(ctx, query.KlineQuery{
+		Pair:      req.GetPair(),
+		TimeFrame: req.GetTimeframe(),
+		From:      req.GetFrom(),
+		To:        req.GetTo(),
+		Limit:     int(req.GetLimit()),
+		Cursor:    req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, queryError("load klines", err)
+	}
+
+	resp := &collectorv1.GetKlinesResponse{
+		Klines:        make([]*collectorv1.Kline, len(page.Klines)),
+		NextPageToken: page.NextCursor,
+	}
+	for i, k := range page.Klines {
+		resp.Klines[i] = klineToProto(k)
+	}
+	return resp, nil
+}
+
+func (s *Server) GetTrades(ctx context.Context, req *collectorv1.GetTradesRequest) (*collectorv1.GetTradesResponse, error) {
+	page, err := s.queries.Trades(ctx, query.TradeQuery{
+		Pair:   req.GetPair(),
+		From:   req.GetFrom(),
+		To:     req.GetTo(),
+		Limit:  int(req.GetLimit()),
+		Cursor: req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, queryError("load trades", err)
+	}
+
+	resp := &collectorv1.GetTradesResponse{
+		Trades:        make([]*collectorv1.Trade, len(page.Trades)),
+		NextPageToken: page.NextCursor,
+	}
+	for i, t := range page.Trades {
+		resp.Trades[i] = tradeToProto(t)
+	}
+	return resp, nil
+}
+
+func (s *Server) StreamTrades(req *collectorv1.StreamTradesRequest, stream collectorv1.CollectorService_StreamTradesServer) error {
+	pairs := make(map[string]struct{}, len(req.GetPairs()))
+	for _, pair := range req.GetPairs() {
+		pairs[pair] = struct{}{}
+	}
+
+	sub := s.trades.subscribe(func(t models.RecentTrade) bool {
+		if len(pairs) == 0 {
+			return true
+		}
+		_, ok := pairs[t.Pair]
+		return ok
+	})
+	defer s.trades.unsubscribe(sub)
+
+	return serveStream(stream.Context(), s.done, sub, func(t models.RecentTrade) error {
+		return stream.Send(tradeToProto(t))
+	})
+}
+
+func (s *Server) StreamKlines(req *collectorv1.StreamKlinesRequest, stream collectorv1.CollectorService_StreamKlinesServer) error {
+	if req.GetPair() == "" {
+		return status.Error(codes.InvalidArgument, "pair is required")
+	}
+	tf, err := timeframe.Parse(req.GetTimeframe())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sub := s.klines.subscribe(func(e klineEvent) bool {
+		return e.kline.Pair == req.GetPair() && e.kline.TimeFrame == tf.Name
+	})
+	defer s.klines.unsubscribe(sub)
+
+	return serveStream(stream.Context(), s.done, sub, func(e klineEvent) error {
+		return stream.Send(&collectorv1.KlineUpdate{Kline: klineToProto(e.kline), Closed: e.closed})
+	})
+}
+
+// serveStream sends the values received by sub until the client goes away,
+// the server closes or the subscriber is dropped for being too slow.
+func serveStream[T any](ctx context.Context, done <-chan struct{}, sub *subscriber[T], send func(T) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-sub.dropped:
+			return status.Error(codes.ResourceExhausted, "stream consumer is too slow")
+		case v := <-sub.ch:
+			if err := send(v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func queryError(op string, err error) error {
+	if query.IsInvalidArgument(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("Failed to %s: %v", op, err)
+	return status.Error(codes.Internal, "failed to "+op)
+}
+
+// klineToProto converts a candle. The proto carries doubles, so the values
+// are rounded to the nearest float64.
+func klineToProto(k models.Kline) *collectorv1.Kline {
+	return &collectorv1.Kline{
+		Pair:      k.Pair,
+		Timeframe: k.TimeFrame,
+		Open:      k.O.InexactFloat64(),
+		High:      k.H.InexactFloat64(),
+		Low:       k.L.InexactFloat64(),
+		Close:     k.C.InexactFloat64(),
+		BeginTime: k.UtcBegin,
+		EndTime:   k.UtcEnd,
+		BuyBase:   k.VolumeBS.BuyBase.InexactFloat64(),
+		SellBase:  k.VolumeBS.SellBase.InexactFloat64(),
+		BuyQuote:  k.VolumeBS.BuyQuote.InexactFloat64(),
+		SellQuote: k.VolumeBS.SellQuote.InexactFloat64(),
+	}
+}
+
+func tradeToProto(t models.RecentTrade) *collectorv1.Trade {
+	return &collectorv1.Trade{
+		Id:        t.Tid,
+		Pair:      t.Pair,
+		Price:     t.Price.String(),
+		Amount:    t.Amount.String(),
+		Side:      t.Side,
+		Timestamp: t.Timestamp,
+	}
+}
@@ -0,0 +1,302 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	collectorv1 "github.com/Zmey56/poloniex-collector/api/collector/v1"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+type fakeKlines struct {
+	klines []models.Kline
+	err    error
+}
+
+func (f *fakeKlines) GetKlinesByTimeRange(_ context.Context, pair, timeFrame string, startTime, endTime int64) ([]models.Kline, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var result []models.Kline
+	for _, k := range f.klines {
+		if k.Pair == pair && k.TimeFrame == timeFrame && k.UtcBegin >= startTime && k.UtcEnd <= endTime {
+			result = append(result, k)
+		}
+	}
+	return result, nil
+}
+
+type fakeTrades struct {
+	trades []models.RecentTrade
+}
+
+func (f *fakeTrades) GetTradesByTimeRange(_ context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error) {
+	var result []models.RecentTrade
+	for _, t := range f.trades {
+		if t.Pair == pair && t.Timestamp <= endTime &&
+			(t.Timestamp > startTime || (t.Timestamp == startTime && t.Tid > afterTid)) {
+			result = append(result, t)
+		}
+	}
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+var testNow = time.Date(2024, 1, 1, 0, 10, 30, 0, time.UTC)
+
+func startServer(t *testing.T, klines query.KlineReader, trades query.TradeReader, opts ...Option) (*Server, *grpc.ClientConn) {
+	t.Helper()
+
+	queries := query.NewService(klines, trades, query.WithClock(func() time.Time { return testNow }))
+	srv := NewServer(queries, opts...)
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	srv.Register(gs)
+	go func() { _ = gs.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		gs.Stop()
+	})
+	return srv, conn
+}
+
+func minuteKline(pair string, begin time.Time) models.Kline {
+	return models.Kline{
+		Pair:      pair,
+		TimeFrame: "MINUTE_1",
+		O:         decimal.NewFromInt(1),
+		H:         decimal.NewFromInt(2),
+		L:         decimal.RequireFromString("0.5"),
+		C:         decimal.RequireFromString("1.5"),
+		UtcBegin:  begin.UnixMilli(),
+		UtcEnd:    begin.Add(time.Minute).UnixMilli() - 1,
+	}
+}
+
+// waitSubscribers waits until a stream has subscribed, so that values
+// published afterwards are not missed.
+func waitSubscribers[T any](t *testing.T, b *broker[T], n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return b.len() == n }, time.Second, 5*time.Millisecond)
+}
+
+func TestServer_GetKlines(t *testing.T) {
+	start := testNow.Truncate(time.Hour)
+	klines := &fakeKlines{}
+	for i := 0; i < 10; i++ {
+		klines.klines = append(klines.klines, minuteKline("BTC_USDT", start.Add(time.Duration(i)*time.Minute)))
+	}
+	_, conn := startServer(t, klines, &fakeTrades{})
+	client := collectorv1.NewCollectorServiceClient(conn)
+	ctx := context.Background()
+
+	resp, err := client.GetKlines(ctx, &collectorv1.GetKlinesRequest{
+		Pair:      "BTC_USDT",
+		Timeframe: "1m",
+		From:      start.UnixMilli(),
+		Limit:     6,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Klines, 6)
+	assert.Equal(t, "MINUTE_1", resp.Klines[0].Timeframe)
+	assert.Equal(t, start.UnixMilli(), resp.Klines[0].BeginTime)
+	assert.Equal(t, 1.5, resp.Klines[0].Close)
+	require.NotEmpty(t, resp.NextPageToken)
+
+	resp, err = client.GetKlines(ctx, &collectorv1.GetKlinesRequest{
+		Pair:      "BTC_USDT",
+		Timeframe: "1m",
+		Limit:     6,
+		PageToken: resp.NextPageToken,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Klines, 4)
+	assert.Empty(t, resp.NextPageToken)
+}
+
+func TestServer_GetKlines_Errors(t *testing.T) {
+	_, conn := startServer(t, &fakeKlines{err: errors.New("db is down")}, &fakeTrades{})
+	client := collectorv1.NewCollectorServiceClient(conn)
+	ctx := context.Background()
+
+	_, err := client.GetKlines(ctx, &collectorv1.GetKlinesRequest{Pair: "BTC_USDT", Timeframe: "2m"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.GetKlines(ctx, &collectorv1.GetKlinesRequest{Pair: "BTC_USDT", Timeframe: "1m"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.NotContains(t, err.Error(), "db is down")
+}
+
+func TestServer_GetTrades(t *testing.T) {
+	trades := &fakeTrades{trades: []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(100), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1000},
+		{Tid: "2", Pair: "BTC_USDT", Price: decimal.NewFromInt(101), Amount: decimal.NewFromInt(2), Side: "sell", Timestamp: 2000},
+		{Tid: "3", Pair: "BTC_USDT", Price: decimal.NewFromInt(102), Amount: decimal.NewFromInt(3), Side: "buy", Timestamp: 3000},
+	}}
+	_, conn := startServer(t, &fakeKlines{}, trades)
+	client := collectorv1.NewCollectorServiceClient(conn)
+	ctx := context.Background()
+
+	resp, err := client.GetTrades(ctx, &collectorv1.GetTradesRequest{Pair: "BTC_USDT", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, resp.Trades, 2)
+	assert.Equal(t, "1", resp.Trades[0].Id)
+	assert.Equal(t, "sell", resp.Trades[1].Side)
+	require.NotEmpty(t, resp.NextPageToken)
+
+	resp, err = client.GetTrades(ctx, &collectorv1.GetTradesRequest{Pair: "BTC_USDT", Limit: 2, PageToken: resp.NextPageToken})
+	require.NoError(t, err)
+	require.Len(t, resp.Trades, 1)
+	assert.Equal(t, "3", resp.Trades[0].Id)
+	assert.Empty(t, resp.NextPageToken)
+
+	_, err = client.GetTrades(ctx, &collectorv1.GetTradesRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_StreamTrades(t *testing.T) {
+	srv, conn := startServer(t, &fakeKlines{}, &fakeTrades{})
+	client := collectorv1.NewCollectorServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamTrades(ctx, &collectorv1.StreamTradesRequest{Pairs: []string{"ETH_USDT"}})
+	require.NoError(t, err)
+	waitSubscribers(t, srv.trades, 1)
+
+	srv.OnTrade(models.RecentTrade{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(100)})
+	srv.OnTrade(models.RecentTrade{Tid: "2", Pair: "ETH_USDT", Price: decimal.NewFromInt(10)})
+
+	trade, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "2", trade.Id)
+	assert.Equal(t, "ETH_USDT", trade.Pair)
+
+	cancel()
+	assert.Eventually(t, func() bool { return srv.trades.len() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestServer_StreamKlines(t *testing.T) {
+	srv, conn := startServer(t, &fakeKlines{}, &fakeTrades{})
+	client := collectorv1.NewCollectorServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamKlines(ctx, &collectorv1.StreamKlinesRequest{Pair: "BTC_USDT", Timeframe: "1m"})
+	require.NoError(t, err)
+	waitSubscribers(t, srv.klines, 1)
+
+	begin := testNow.Truncate(time.Minute)
+	other := minuteKline("BTC_USDT", begin)
+	other.TimeFrame = "MINUTE_5"
+	srv.OnKline(other, false)
+	srv.OnKline(minuteKline("BTC_USDT", begin), true)
+
+	update, err := stream.Recv()
+	require.NoError(t, err)
+	assert.True(t, update.Closed)
+	assert.Equal(t, "MINUTE_1", update.Kline.Timeframe)
+	assert.Equal(t, begin.UnixMilli(), update.Kline.BeginTime)
+
+	stream, err = client.StreamKlines(ctx, &collectorv1.StreamKlinesRequest{Pair: "BTC_USDT", Timeframe: "bogus"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_StreamDropsSlowConsumer(t *testing.T) {
+	srv, conn := startServer(t, &fakeKlines{}, &fakeTrades{}, WithStreamBuffer(1))
+	client := collectorv1.NewCollectorServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamTrades(ctx, &collectorv1.StreamTradesRequest{})
+	require.NoError(t, err)
+	waitSubscribers(t, srv.trades, 1)
+
+	// The stream's buffer holds a single trade; everything beyond what the
+	// transport absorbs overflows it.
+	for i := 0; i < 10000; i++ {
+		srv.OnTrade(models.RecentTrade{Tid: "t", Pair: "BTC_USDT", Price: decimal.NewFromInt(1)})
+	}
+
+	for {
+		_, err = stream.Recv()
+		if err != nil {
+			break
+		}
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServer_CloseEndsStreams(t *testing.T) {
+	srv, conn := startServer(t, &fakeKlines{}, &fakeTrades{})
+	client := collectorv1.NewCollectorServiceClient(conn)
+	ctx := context.Background()
+
+	health := healthpb.NewHealthClient(conn)
+	resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: collectorv1.CollectorService_ServiceDesc.ServiceName})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	stream, err := client.StreamTrades(ctx, &collectorv1.StreamTradesRequest{})
+	require.NoError(t, err)
+	waitSubscribers(t, srv.trades, 1)
+
+	srv.Close()
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	resp, err = health.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+func TestServer_Reflection(t *testing.T) {
+	_, conn := startServer(t, &fakeKlines{}, &fakeTrades{})
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	var names []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	assert.Contains(t, names, collectorv1.CollectorService_ServiceDesc.ServiceName)
+}
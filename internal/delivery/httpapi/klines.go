@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+// handleKlines serves GET /v1/klines.
+//
+// Query parameters: pair and timeframe (required), from and to in unix ms,
+// limit and cursor. to defaults to the end of the last closed candle and from
+// to limit candles before to.
+//
+// A page covers the time span of limit candles starting at from (or at the
+// cursor), so a page over a gap in the data may be short or even empty while
+// next_cursor is still set; clients keep following next_cursor until it is
+// absent.
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	kq := query.KlineQuery{
+		Pair:      q.Get("pair"),
+		TimeFrame: q.Get("timeframe"),
+		Cursor:    q.Get("cursor"),
+	}
+	var err error
+	if kq.From, err = optionalMillis(q, "from"); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+	if kq.To, err = optionalMillis(q, "to"); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+	if kq.Limit, err = parseLimit(q); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+
+	page, err := s.queries.Klines(r.Context(), kq)
+	if err != nil {
+		writeQueryError(w, "load klines", err)
+		return
+	}
+	writePage(w, page.Klines, page.NextCursor)
+}
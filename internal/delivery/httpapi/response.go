@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+const (
+	codeInvalidArgument = "invalid_argument"
+	codeNotFound        = "not_found"
+	codeInternal        = "internal"
+)
+
+// page is the envelope of every successful list response. NextCursor is
+// empty on the last page.
+type page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// errorResponse is the envelope of every error response.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writePage[T any](w http.ResponseWriter, data []T, nextCursor string) {
+	if data == nil {
+		data = []T{}
+	}
+	writeJSON(w, http.StatusOK, page[T]{Data: data, NextCursor: nextCursor})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorResponse{Error: errorBody{Code: code, Message: message}})
+}
+
+func writeInvalid(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusBadRequest, codeInvalidArgument, err.Error())
+}
+
+// writeQueryError replies with invalid_argument for a bad query and hides
+// other errors behind a generic internal error.
+func writeQueryError(w http.ResponseWriter, op string, err error) {
+	if query.IsInvalidArgument(err) {
+		writeInvalid(w, err)
+		return
+	}
+	log.Printf("Failed to %s: %v", op, err)
+	writeError(w, http.StatusInternalServerError, codeInternal, "failed to "+op)
+}
@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+// Server serves the read-only query API over the stored klines and trades.
+type Server struct {
+	queries *query.Service
+}
+
+func NewServer(queries *query.Service) *Server {
+	return &Server{queries: queries}
+}
+
+// Register adds the API routes to mux.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/klines", s.handleKlines)
+	mux.HandleFunc("GET /v1/trades", s.handleTrades)
+}
+
+// Handler returns an http.Handler serving only the API routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.Register(mux)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, codeNotFound, "unknown endpoint "+r.URL.Path)
+	})
+	return mux
+}
+
+// optionalMillis parses a unix timestamp in milliseconds, returning 0 when
+// the parameter is absent.
+func optionalMillis(q url.Values, name string) (int64, error) {
+	value := q.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("%s must be a unix timestamp in milliseconds", name)
+	}
+	return ms, nil
+}
+
+func parseLimit(q url.Values) (int, error) {
+	value := q.Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("limit must be between 1 and %d", query.MaxLimit)
+	}
+	return limit, nil
+}
@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+type fakeKlines struct {
+	klines []models.Kline
+	err    error
+}
+
+func (f *fakeKlines) GetKlinesByTimeRange(_ context.Context, pair, timeFrame string, startTime, endTime int64) ([]models.Kline, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var result []models.Kline
+	for _, k := range f.klines {
+		if k.Pair == pair && k.TimeFrame == timeFrame && k.UtcBegin >= startTime && k.UtcEnd <= endTime {
+			result = append(result, k)
+		}
+	}
+	return result, nil
+}
+
+type fakeTrades struct {
+	trades []models.RecentTrade
+}
+
+func (f *fakeTrades) GetTradesByTimeRange(_ context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error) {
+	var result []models.RecentTrade
+	for _, t := range f.trades {
+		if t.Pair != pair || t.Timestamp > endTime {
+			continue
+		}
+		if t.Timestamp > startTime || (t.Timestamp == startTime && t.Tid > afterTid) {
+			result = append(result, t)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Timestamp != result[j].Timestamp {
+			return result[i].Timestamp < result[j].Timestamp
+		}
+		return result[i].Tid < result[j].Tid
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+type klinePage struct {
+	Data       []models.Kline `json:"data"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+type tradePage struct {
+	Data       []trade `json:"data"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+func newTestServer(klines query.KlineReader, trades query.TradeReader, now time.Time) http.Handler {
+	queries := query.NewService(klines, trades, query.WithClock(func() time.Time { return now }))
+	return NewServer(queries).Handler()
+}
+
+func get(t *testing.T, h http.Handler, target string, out any) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+	return rec.Code
+}
+
+func minuteKlines(pair string, start int64, n int) []models.Kline {
+	klines := make([]models.Kline, n)
+	for i := range klines {
+		begin := start + int64(i)*60_000
+		klines[i] = models.Kline{Pair: pair, TimeFrame: "MINUTE_1", UtcBegin: begin, UtcEnd: begin + 60_000}
+	}
+	return klines
+}
+
+func TestKlines_Pagination(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	h := newTestServer(&fakeKlines{klines: minuteKlines("BTC_USDT", start, 5)}, &fakeTrades{}, time.UnixMilli(start+10*60_000))
+
+	var got []int64
+	target := "/v1/klines?pair=BTC_USDT&timeframe=1m&limit=2&from=" + itoa(start) + "&to=" + itoa(start+5*60_000)
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "pagination does not terminate")
+
+		var page klinePage
+		require.Equal(t, http.StatusOK, get(t, h, target, &page))
+		assert.LessOrEqual(t, len(page.Data), 2)
+		for _, k := range page.Data {
+			got = append(got, k.UtcBegin)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		target = "/v1/klines?pair=BTC_USDT&timeframe=MINUTE_1&limit=2&to=" + itoa(start+5*60_000) + "&cursor=" + page.NextCursor
+	}
+
+	expected := make([]int64, 5)
+	for i := range expected {
+		expected[i] = start + int64(i)*60_000
+	}
+	assert.Equal(t, expected, got)
+}
+
+func TestKlines_DefaultRangeEndsNow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	now := time.UnixMilli(start + 5*60_000 + 30_000)
+	h := newTestServer(&fakeKlines{klines: minuteKlines("BTC_USDT", start, 6)}, &fakeTrades{}, now)
+
+	var page klinePage
+	require.Equal(t, http.StatusOK, get(t, h, "/v1/klines?pair=BTC_USDT&timeframe=1m&limit=3", &page))
+
+	require.Len(t, page.Data, 3)
+	assert.Equal(t, start+2*60_000, page.Data[0].UtcBegin)
+	assert.Equal(t, start+4*60_000, page.Data[2].UtcBegin)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestKlines_EmptyPageIsArray(t *testing.T) {
+	rec := httptest.NewRecorder()
+	h := newTestServer(&fakeKlines{}, &fakeTrades{}, time.UnixMilli(10_000_000))
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/klines?pair=BTC_USDT&timeframe=1m", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[]}`, rec.Body.String())
+}
+
+func TestTrades_Pagination(t *testing.T) {
+	trades := []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(100), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1000},
+		{Tid: "2", Pair: "BTC_USDT", Price: decimal.NewFromInt(101), Amount: decimal.NewFromInt(1), Side: "sell", Timestamp: 1000},
+		{Tid: "3", Pair: "BTC_USDT", Price: decimal.NewFromInt(102), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1000},
+		{Tid: "4", Pair: "BTC_USDT", Price: decimal.NewFromInt(103), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 2000},
+		{Tid: "5", Pair: "ETH_USDT", Price: decimal.NewFromInt(10), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1500},
+	}
+	h := newTestServer(&fakeKlines{}, &fakeTrades{trades: trades}, time.UnixMilli(5000))
+
+	var first tradePage
+	require.Equal(t, http.StatusOK, get(t, h, "/v1/trades?pair=BTC_USDT&limit=2", &first))
+	require.Len(t, first.Data, 2)
+	assert.Equal(t, trade{ID: "1", Pair: "BTC_USDT", Price: "100", Amount: "1", Side: "buy", Timestamp: 1000}, first.Data[0])
+	assert.Equal(t, "2", first.Data[1].ID)
+	require.NotEmpty(t, first.NextCursor)
+
+	var second tradePage
+	require.Equal(t, http.StatusOK, get(t, h, "/v1/trades?pair=BTC_USDT&limit=2&cursor="+first.NextCursor, &second))
+	require.Len(t, second.Data, 2)
+	assert.Equal(t, "3", second.Data[0].ID)
+	assert.Equal(t, "4", second.Data[1].ID)
+	assert.Empty(t, second.NextCursor)
+}
+
+func TestErrors(t *testing.T) {
+	h := newTestServer(&fakeKlines{err: errors.New("connection refused")}, &fakeTrades{}, time.UnixMilli(10_000_000))
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		code   string
+	}{
+		{"missing pair", "/v1/klines?timeframe=1m", http.StatusBadRequest, codeInvalidArgument},
+		{"missing timeframe", "/v1/klines?pair=BTC_USDT", http.StatusBadRequest, codeInvalidArgument},
+		{"unknown timeframe", "/v1/klines?pair=BTC_USDT&timeframe=MINUTE_2", http.StatusBadRequest, codeInvalidArgument},
+		{"bad limit", "/v1/trades?pair=BTC_USDT&limit=5000", http.StatusBadRequest, codeInvalidArgument},
+		{"bad time", "/v1/trades?pair=BTC_USDT&from=yesterday", http.StatusBadRequest, codeInvalidArgument},
+		{"bad cursor", "/v1/trades?pair=BTC_USDT&cursor=!!!", http.StatusBadRequest, codeInvalidArgument},
+		{"inverted range", "/v1/trades?pair=BTC_USDT&from=2000&to=1000", http.StatusBadRequest, codeInvalidArgument},
+		{"repository error", "/v1/klines?pair=BTC_USDT&timeframe=1m", http.StatusInternalServerError, codeInternal},
+		{"unknown endpoint", "/v1/orders", http.StatusNotFound, codeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp errorResponse
+			assert.Equal(t, tt.status, get(t, h, tt.target, &resp))
+			assert.Equal(t, tt.code, resp.Error.Code)
+			assert.NotEmpty(t, resp.Error.Message)
+		})
+	}
+}
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/usecase/query"
+)
+
+// trade is the API representation of a stored trade.
+type trade struct {
+	ID        string `json:"id"`
+	Pair      string `json:"pair"`
+	Price     string `json:"price"`
+	Amount    string `json:"amount"`
+	Side      string `json:"side"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func newTrade(t models.RecentTrade) trade {
+	return trade{
+		ID:        t.Tid,
+		Pair:      t.Pair,
+		Price:     t.Price.String(),
+		Amount:    t.Amount.String(),
+		Side:      t.Side,
+		Timestamp: t.Timestamp,
+	}
+}
+
+// handleTrades serves GET /v1/trades.
+//
+// Query parameters: pair (required), from and to in unix ms, limit and
+// cursor. from defaults to the first stored trade and to to now. Trades are
+// returned oldest first; the cursor points right after the last trade of
+// the page.
+func (s *Server) handleTrades(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	tq := query.TradeQuery{
+		Pair:   q.Get("pair"),
+		Cursor: q.Get("cursor"),
+	}
+	var err error
+	if tq.From, err = optionalMillis(q, "from"); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+	if tq.To, err = optionalMillis(q, "to"); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+	if tq.Limit, err = parseLimit(q); err != nil {
+		writeInvalid(w, err)
+		return
+	}
+
+	page, err := s.queries.Trades(r.Context(), tq)
+	if err != nil {
+		writeQueryError(w, "load trades", err)
+		return
+	}
+
+	data := make([]trade, len(page.Trades))
+	for i, t := range page.Trades {
+		data[i] = newTrade(t)
+	}
+	writePage(w, data, page.NextCursor)
+}
@@ -0,0 +1,52 @@
+package udf
+
+import (
+	"fmt"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+// resolutions maps timeframe names to TradingView resolutions.
+var resolutions = map[string]string{
+	"MINUTE_1":  "1",
+	"MINUTE_5":  "5",
+	"MINUTE_10": "10",
+	"MINUTE_15": "15",
+	"MINUTE_30": "30",
+	"HOUR_1":    "60",
+	"HOUR_2":    "120",
+	"HOUR_4":    "240",
+	"HOUR_6":    "360",
+	"HOUR_12":   "720",
+	"DAY_1":     "1D",
+	"DAY_3":     "3D",
+	"WEEK_1":    "1W",
+	"MONTH_1":   "1M",
+}
+
+// shortResolutions are the forms TradingView also uses for single days,
+// weeks and months.
+var shortResolutions = map[string]string{
+	"D": "1D",
+	"W": "1W",
+	"M": "1M",
+}
+
+// Resolution returns the TradingView resolution of a timeframe.
+func Resolution(tf timeframe.TimeFrame) string {
+	return resolutions[tf.Name]
+}
+
+// parseResolution returns the timeframe of a TradingView resolution among
+// the given timeframes.
+func parseResolution(resolution string, timeframes []timeframe.TimeFrame) (timeframe.TimeFrame, error) {
+	if full, ok := shortResolutions[resolution]; ok {
+		resolution = full
+	}
+	for _, tf := range timeframes {
+		if Resolution(tf) == resolution {
+			return tf, nil
+		}
+	}
+	return timeframe.TimeFrame{}, fmt.Errorf("unsupported resolution %q", resolution)
+}
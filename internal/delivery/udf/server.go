@@ -0,0 +1,372 @@
+// Package udf implements the TradingView UDF datafeed protocol on top of the
+// stored klines, so the collected data can be charted with the TradingView
+// charting library.
+package udf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+const (
+	exchangeName = "POLONIEX"
+
+	defaultSearchLimit = 30
+
+	// priceScale gives prices eight decimal places, the precision Poloniex
+	// quotes the smallest pairs with.
+	priceScale = 100_000_000
+)
+
+// KlineReader is the part of repository.KlineRepository used by the datafeed.
+type KlineReader interface {
+	GetKlinesByTimeRange(ctx context.Context, pair, timeFrame string, startTime, endTime int64) ([]models.Kline, error)
+	GetLastKlineBefore(ctx context.Context, pair, timeFrame string, before int64) (*models.Kline, error)
+}
+
+// Server serves the UDF endpoints for the collected pairs and timeframes.
+type Server struct {
+	klines     KlineReader
+	pairs      []string
+	timeframes []timeframe.TimeFrame
+	now        func() time.Time
+}
+
+func NewServer(klines KlineReader, pairs []string, timeframes []timeframe.TimeFrame) *Server {
+	return &Server{
+		klines:     klines,
+		pairs:      pairs,
+		timeframes: timeframes,
+		now:        time.Now,
+	}
+}
+
+// Handler returns the UDF endpoints. The charting library runs in the
+// browser, so every response allows cross-origin requests.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /config", s.handleConfig)
+	mux.HandleFunc("GET /symbols", s.handleSymbols)
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /history", s.handleHistory)
+	mux.HandleFunc("GET /time", s.handleTime)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		mux.ServeHTTP(w, r)
+	})
+}
+
+type exchange struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+	Desc  string `json:"desc"`
+}
+
+type symbolType struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type configResponse struct {
+	SupportedResolutions   []string     `json:"supported_resolutions"`
+	SupportsGroupRequest   bool         `json:"supports_group_request"`
+	SupportsMarks          bool         `json:"supports_marks"`
+	SupportsSearch         bool         `json:"supports_search"`
+	SupportsTimescaleMarks bool         `json:"supports_timescale_marks"`
+	SupportsTime           bool         `json:"supports_time"`
+	Exchanges              []exchange   `json:"exchanges"`
+	SymbolsTypes           []symbolType `json:"symbols_types"`
+}
+
+type symbolInfo struct {
+	Name                 string   `json:"name"`
+	Ticker               string   `json:"ticker"`
+	Description          string   `json:"description"`
+	Type                 string   `json:"type"`
+	Session              string   `json:"session"`
+	Exchange             string   `json:"exchange"`
+	ListedExchange       string   `json:"listed_exchange"`
+	Timezone             string   `json:"timezone"`
+	Format               string   `json:"format"`
+	MinMov               int      `json:"minmov"`
+	PriceScale           int      `json:"pricescale"`
+	HasIntraday          bool     `json:"has_intraday"`
+	HasDaily             bool     `json:"has_daily"`
+	HasWeeklyAndMonthly  bool     `json:"has_weekly_and_monthly"`
+	IntradayMultipliers  []string `json:"intraday_multipliers,omitempty"`
+	SupportedResolutions []string `json:"supported_resolutions"`
+	VolumePrecision      int      `json:"volume_precision"`
+	DataStatus           string   `json:"data_status"`
+}
+
+type searchResult struct {
+	Symbol      string `json:"symbol"`
+	FullName    string `json:"full_name"`
+	Description string `json:"description"`
+	Exchange    string `json:"exchange"`
+	Ticker      string `json:"ticker"`
+	Type        string `json:"type"`
+}
+
+// historyResponse holds the bars in columns; times are unix seconds.
+type historyResponse struct {
+	Status   string    `json:"s"`
+	Time     []int64   `json:"t,omitempty"`
+	Open     []float64 `json:"o,omitempty"`
+	High     []float64 `json:"h,omitempty"`
+	Low      []float64 `json:"l,omitempty"`
+	Close    []float64 `json:"c,omitempty"`
+	Volume   []float64 `json:"v,omitempty"`
+	NextTime *int64    `json:"nextTime,omitempty"`
+}
+
+// errorResponse is the UDF error reply. Following the protocol it is sent
+// with status 200; the datafeed only looks at s.
+type errorResponse struct {
+	Status string `json:"s"`
+	ErrMsg string `json:"errmsg"`
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, configResponse{
+		SupportedResolutions: s.resolutions(),
+		SupportsSearch:       true,
+		SupportsTime:         true,
+		Exchanges: []exchange{
+			{Value: "", Name: "All Exchanges", Desc: ""},
+			{Value: exchangeName, Name: "Poloniex", Desc: "Poloniex"},
+		},
+		SymbolsTypes: []symbolType{{Name: "Crypto", Value: "crypto"}},
+	})
+}
+
+func (s *Server) handleSymbols(w http.ResponseWriter, r *http.Request) {
+	pair, ok := s.lookupPair(r.URL.Query().Get("symbol"))
+	if !ok {
+		writeError(w, "unknown_symbol")
+		return
+	}
+	writeJSON(w, s.symbolInfo(pair))
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultSearchLimit
+	if value := q.Get("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	results := []searchResult{}
+	if (q.Get("type") != "" && q.Get("type") != "crypto") ||
+		(q.Get("exchange") != "" && !strings.EqualFold(q.Get("exchange"), exchangeName)) {
+		writeJSON(w, results)
+		return
+	}
+
+	query := strings.ToUpper(strings.NewReplacer("/", "_", "-", "_").Replace(q.Get("query")))
+	for _, pair := range s.pairs {
+		if len(results) == limit {
+			break
+		}
+		if !strings.Contains(pair, query) {
+			continue
+		}
+		results = append(results, searchResult{
+			Symbol:      pair,
+			FullName:    exchangeName + ":" + pair,
+			Description: description(pair),
+			Exchange:    exchangeName,
+			Ticker:      pair,
+			Type:        "crypto",
+		})
+	}
+	writeJSON(w, results)
+}
+
+// handleHistory returns the bars that begin in [from, to). With countback
+// set, the range is extended back to hold at least countback bars and only
+// the last countback bars are returned. An empty range is answered with
+// no_data and, when older data exists, nextTime pointing at the last bar
+// before from.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	pair, ok := s.lookupPair(q.Get("symbol"))
+	if !ok {
+		writeError(w, "unknown_symbol")
+		return
+	}
+	tf, err := parseResolution(q.Get("resolution"), s.timeframes)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	from, err := strconv.ParseInt(q.Get("from"), 10, 64)
+	if err != nil {
+		writeError(w, "from must be a unix timestamp in seconds")
+		return
+	}
+	to, err := strconv.ParseInt(q.Get("to"), 10, 64)
+	if err != nil {
+		writeError(w, "to must be a unix timestamp in seconds")
+		return
+	}
+	var countback int64
+	if value := q.Get("countback"); value != "" {
+		if countback, err = strconv.ParseInt(value, 10, 64); err != nil || countback < 0 {
+			writeError(w, "countback must be a non-negative number")
+			return
+		}
+	}
+
+	fromMs, toMs := from*1000, to*1000
+	if countback > 0 {
+		fromMs = min(fromMs, toMs-countback*tf.Duration.Milliseconds())
+	}
+	if fromMs >= toMs {
+		writeError(w, "from must be before to")
+		return
+	}
+
+	// Stored candles are selected by their end, so ask for everything up to
+	// the end of the candle in progress at to and drop what begins later.
+	_, end := tf.Bounds(toMs - 1)
+	klines, err := s.klines.GetKlinesByTimeRange(r.Context(), pair, tf.Name, fromMs, end)
+	if err != nil {
+		log.Printf("Failed to load klines for %s %s: %v", pair, tf.Name, err)
+		writeError(w, "failed to load bars")
+		return
+	}
+
+	bars := klines[:0]
+	for _, k := range klines {
+		if k.UtcBegin < toMs {
+			bars = append(bars, k)
+		}
+	}
+	if countback > 0 && int64(len(bars)) > countback {
+		bars = bars[int64(len(bars))-countback:]
+	}
+
+	if len(bars) == 0 {
+		resp := historyResponse{Status: "no_data"}
+		prev, err := s.klines.GetLastKlineBefore(r.Context(), pair, tf.Name, fromMs)
+		if err != nil {
+			log.Printf("Failed to load kline before %d for %s %s: %v", fromMs, pair, tf.Name, err)
+		} else if prev != nil {
+			nextTime := prev.UtcBegin / 1000
+			resp.NextTime = &nextTime
+		}
+		writeJSON(w, resp)
+		return
+	}
+
+	resp := historyResponse{
+		Status: "ok",
+		Time:   make([]int64, len(bars)),
+		Open:   make([]float64, len(bars)),
+		High:   make([]float64, len(bars)),
+		Low:    make([]float64, len(bars)),
+		Close:  make([]float64, len(bars)),
+		Volume: make([]float64, len(bars)),
+	}
+	for i, k := range bars {
+		resp.Time[i] = k.UtcBegin / 1000
+		resp.Open[i] = k.O.InexactFloat64()
+		resp.High[i] = k.H.InexactFloat64()
+		resp.Low[i] = k.L.InexactFloat64()
+		resp.Close[i] = k.C.InexactFloat64()
+		resp.Volume[i] = k.VolumeBS.BuyBase.Add(k.VolumeBS.SellBase).InexactFloat64()
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleTime(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, s.now().Unix())
+}
+
+func (s *Server) resolutions() []string {
+	result := make([]string, 0, len(s.timeframes))
+	for _, tf := range s.timeframes {
+		result = append(result, Resolution(tf))
+	}
+	return result
+}
+
+func (s *Server) symbolInfo(pair string) symbolInfo {
+	info := symbolInfo{
+		Name:                 pair,
+		Ticker:               pair,
+		Description:          description(pair),
+		Type:                 "crypto",
+		Session:              "24x7",
+		Exchange:             exchangeName,
+		ListedExchange:       exchangeName,
+		Timezone:             "Etc/UTC",
+		Format:               "price",
+		MinMov:               1,
+		PriceScale:           priceScale,
+		SupportedResolutions: s.resolutions(),
+		VolumePrecision:      8,
+		DataStatus:           "streaming",
+	}
+
+	for _, tf := range s.timeframes {
+		switch {
+		case tf.Duration < 24*time.Hour:
+			info.HasIntraday = true
+			info.IntradayMultipliers = append(info.IntradayMultipliers, Resolution(tf))
+		case tf.Name == "WEEK_1" || tf.Name == "MONTH_1":
+			info.HasWeeklyAndMonthly = true
+		default:
+			info.HasDaily = true
+		}
+	}
+	return info
+}
+
+// lookupPair finds a collected pair by a UDF symbol, which may carry the
+// exchange prefix ("POLONIEX:BTC_USDT").
+func (s *Server) lookupPair(symbol string) (string, bool) {
+	if exchange, name, ok := strings.Cut(symbol, ":"); ok {
+		if !strings.EqualFold(exchange, exchangeName) {
+			return "", false
+		}
+		symbol = name
+	}
+	for _, pair := range s.pairs {
+		if strings.EqualFold(pair, symbol) {
+			return pair, true
+		}
+	}
+	return "", false
+}
+
+func description(pair string) string {
+	return strings.ReplaceAll(pair, "_", "/")
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write UDF response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, message string) {
+	writeJSON(w, errorResponse{Status: "error", ErrMsg: message})
+}
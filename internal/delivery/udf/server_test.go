@@ -0,0 +1,186 @@
+package udf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+type fakeKlines struct {
+	klines []models.Kline
+}
+
+func (f *fakeKlines) GetKlinesByTimeRange(_ context.Context, pair, timeFrame string, startTime, endTime int64) ([]models.Kline, error) {
+	var result []models.Kline
+	for _, k := range f.klines {
+		if k.Pair == pair && k.TimeFrame == timeFrame && k.UtcBegin >= startTime && k.UtcEnd <= endTime {
+			result = append(result, k)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeKlines) GetLastKlineBefore(_ context.Context, pair, timeFrame string, before int64) (*models.Kline, error) {
+	var last *models.Kline
+	for i, k := range f.klines {
+		if k.Pair == pair && k.TimeFrame == timeFrame && k.UtcBegin < before {
+			last = &f.klines[i]
+		}
+	}
+	return last, nil
+}
+
+var hour = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+func testServer() http.Handler {
+	klines := &fakeKlines{}
+	for i := int64(0); i < 5; i++ {
+		begin := hour + i*60_000
+		klines.klines = append(klines.klines, models.Kline{
+			Pair: "BTC_USDT", TimeFrame: "MINUTE_1",
+			O: decimal.NewFromInt(1), H: decimal.NewFromInt(2), L: decimal.RequireFromString("0.5"), C: decimal.NewFromInt(i),
+			UtcBegin: begin, UtcEnd: begin + 60_000,
+			VolumeBS: models.VBS{BuyBase: decimal.NewFromInt(1), SellBase: decimal.NewFromInt(2)},
+		})
+	}
+
+	s := NewServer(klines, []string{"BTC_USDT", "ETH_USDT"}, timeframe.MustParseList([]string{"1m", "1h", "1d", "1w"}))
+	s.now = func() time.Time { return time.Unix(1704067200, 0) }
+	return s.Handler()
+}
+
+func get(t *testing.T, target string, out any) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	testServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+}
+
+func TestResolution_CoversRegistry(t *testing.T) {
+	for _, tf := range timeframe.All() {
+		res := Resolution(tf)
+		require.NotEmpty(t, res, tf.Name)
+
+		parsed, err := parseResolution(res, timeframe.All())
+		require.NoError(t, err)
+		assert.Equal(t, tf.Name, parsed.Name)
+	}
+
+	tf, err := parseResolution("D", timeframe.All())
+	require.NoError(t, err)
+	assert.Equal(t, "DAY_1", tf.Name)
+
+	_, err = parseResolution("5", timeframe.MustParseList([]string{"1m"}))
+	assert.Error(t, err)
+}
+
+func TestConfig(t *testing.T) {
+	var cfg configResponse
+	get(t, "/config", &cfg)
+
+	assert.Equal(t, []string{"1", "60", "1D", "1W"}, cfg.SupportedResolutions)
+	assert.True(t, cfg.SupportsSearch)
+	assert.True(t, cfg.SupportsTime)
+}
+
+func TestSymbols(t *testing.T) {
+	var info symbolInfo
+	get(t, "/symbols?symbol=POLONIEX:btc_usdt", &info)
+
+	assert.Equal(t, "BTC_USDT", info.Name)
+	assert.Equal(t, "BTC/USDT", info.Description)
+	assert.Equal(t, "24x7", info.Session)
+	assert.True(t, info.HasIntraday)
+	assert.True(t, info.HasDaily)
+	assert.True(t, info.HasWeeklyAndMonthly)
+	assert.Equal(t, []string{"1", "60"}, info.IntradayMultipliers)
+
+	var unknown errorResponse
+	get(t, "/symbols?symbol=XRP_USDT", &unknown)
+	assert.Equal(t, "error", unknown.Status)
+	assert.Equal(t, "unknown_symbol", unknown.ErrMsg)
+}
+
+func TestSearch(t *testing.T) {
+	var results []searchResult
+	get(t, "/search?query=eth/&type=crypto&exchange=&limit=10", &results)
+	require.Len(t, results, 1)
+	assert.Equal(t, "ETH_USDT", results[0].Symbol)
+	assert.Equal(t, "POLONIEX:ETH_USDT", results[0].FullName)
+
+	get(t, "/search?query=&limit=1", &results)
+	assert.Len(t, results, 1)
+
+	get(t, "/search?query=btc&type=stock", &results)
+	assert.Empty(t, results)
+}
+
+func TestHistory(t *testing.T) {
+	from := hour / 1000
+	var resp historyResponse
+
+	// to falls inside the fourth candle, which is still returned.
+	get(t, "/history?symbol=BTC_USDT&resolution=1&from="+itoa(from+60)+"&to="+itoa(from+200), &resp)
+	assert.Equal(t, "ok", resp.Status)
+	assert.Equal(t, []int64{from + 60, from + 120, from + 180}, resp.Time)
+	assert.Equal(t, []float64{1, 2, 3}, resp.Close)
+	assert.Equal(t, []float64{3, 3, 3}, resp.Volume)
+	assert.Nil(t, resp.NextTime)
+
+	resp = historyResponse{}
+	get(t, "/history?symbol=BTC_USDT&resolution=1&from="+itoa(from+240)+"&to="+itoa(from+300)+"&countback=2", &resp)
+	assert.Equal(t, []int64{from + 180, from + 240}, resp.Time)
+}
+
+func TestHistory_NoData(t *testing.T) {
+	from := hour / 1000
+	var resp historyResponse
+
+	get(t, "/history?symbol=BTC_USDT&resolution=1&from="+itoa(from+3600)+"&to="+itoa(from+7200), &resp)
+	assert.Equal(t, "no_data", resp.Status)
+	require.NotNil(t, resp.NextTime)
+	assert.Equal(t, from+240, *resp.NextTime)
+
+	resp = historyResponse{}
+	get(t, "/history?symbol=BTC_USDT&resolution=1&from="+itoa(from-7200)+"&to="+itoa(from-3600), &resp)
+	assert.Equal(t, "no_data", resp.Status)
+	assert.Nil(t, resp.NextTime)
+}
+
+func TestHistory_Errors(t *testing.T) {
+	for _, target := range []string{
+		"/history?symbol=XRP_USDT&resolution=1&from=0&to=60",
+		"/history?symbol=BTC_USDT&resolution=5&from=0&to=60",
+		"/history?symbol=BTC_USDT&resolution=1&from=x&to=60",
+		"/history?symbol=BTC_USDT&resolution=1&from=60&to=0",
+	} {
+		var resp errorResponse
+		get(t, target, &resp)
+		assert.Equal(t, "error", resp.Status, target)
+		assert.NotEmpty(t, resp.ErrMsg, target)
+	}
+}
+
+func TestTime(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/time", nil))
+	assert.Equal(t, "1704067200", rec.Body.String())
+}
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
@@ -0,0 +1,71 @@
+package wsapi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// client is one stream connection. Messages are written by writeLoop only;
+// close asks it to send a close frame and drop the connection.
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+	done chan struct{}
+
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+
+	// topics is guarded by Hub.mu.
+	topics map[topic]struct{}
+}
+
+// close stops the client with the given close code and reports whether this
+// call was the one that stopped it.
+func (c *client) close(code int, text string) bool {
+	closed := false
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+		closed = true
+	})
+	return closed
+}
+
+func (c *client) remoteAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+func (c *client) writeLoop() {
+	pingTicker := time.NewTicker(pingInterval)
+	defer pingTicker.Stop()
+	// Closing the connection also unblocks readLoop.
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(c.closeCode, c.closeText),
+				time.Now().Add(writeWait))
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-pingTicker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
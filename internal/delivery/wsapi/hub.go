@@ -0,0 +1,280 @@
+package wsapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+const (
+	defaultSendBuffer = 256
+
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingInterval   = 30 * time.Second
+	maxRequestSize = 4096
+)
+
+type topic struct {
+	pair      string
+	timeframe string
+}
+
+// Hub fans candle updates out to WebSocket clients subscribed to
+// (pair, timeframe) topics. It implements service.KlineListener.
+//
+// Every client has its own bounded send buffer. Publishing never blocks: a
+// client whose buffer is full is disconnected with a policy violation close
+// frame instead of slowing down trade processing or other clients.
+type Hub struct {
+	upgrader   websocket.Upgrader
+	sendBuffer int
+	metrics    *metrics.Metrics
+
+	mu      sync.RWMutex
+	topics  map[topic]map[*client]struct{}
+	clients map[*client]struct{}
+	closed  bool
+}
+
+type Option func(*Hub)
+
+// WithSendBuffer sets the number of messages buffered for every client
+// before it is considered too slow.
+func WithSendBuffer(size int) Option {
+	return func(h *Hub) {
+		if size > 0 {
+			h.sendBuffer = size
+		}
+	}
+}
+
+// WithMetrics sets the metrics updated for connected and dropped clients.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(h *Hub) {
+		h.metrics = m
+	}
+}
+
+func NewHub(opts ...Option) *Hub {
+	h := &Hub{
+		upgrader: websocket.Upgrader{
+			// The stream only carries public market data, so browser
+			// dashboards on any origin may connect.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		sendBuffer: defaultSendBuffer,
+		topics:     make(map[topic]map[*client]struct{}),
+		clients:    make(map[*client]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// OnKline sends the candle to the clients subscribed to its pair and timeframe.
+func (h *Hub) OnKline(kline models.Kline, closed bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	subscribers := h.topics[topic{pair: kline.Pair, timeframe: kline.TimeFrame}]
+	if len(subscribers) == 0 {
+		return
+	}
+
+	msg, err := json.Marshal(klineMessage{
+		Type:      typeKline,
+		Pair:      kline.Pair,
+		TimeFrame: kline.TimeFrame,
+		Closed:    closed,
+		Kline:     kline,
+	})
+	if err != nil {
+		log.Printf("Failed to encode kline message: %v", err)
+		return
+	}
+
+	for c := range subscribers {
+		h.deliver(c, msg)
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and serves the
+// client until it disconnects.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error.
+		return
+	}
+
+	c := &client{
+		conn:   conn,
+		send:   make(chan []byte, h.sendBuffer),
+		done:   make(chan struct{}),
+		topics: make(map[topic]struct{}),
+	}
+	if !h.register(c) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+
+	go c.writeLoop()
+	h.readLoop(c)
+}
+
+// Close disconnects all clients and rejects new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for c := range h.clients {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (h *Hub) register(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	h.metrics.StreamClientConnected()
+	return true
+}
+
+func (h *Hub) unregister(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	for t := range c.topics {
+		h.removeLocked(c, t)
+	}
+	delete(h.clients, c)
+	h.metrics.StreamClientDisconnected()
+}
+
+func (h *Hub) subscribe(c *client, t topic) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscribers := h.topics[t]
+	if subscribers == nil {
+		subscribers = make(map[*client]struct{})
+		h.topics[t] = subscribers
+	}
+	subscribers[c] = struct{}{}
+	c.topics[t] = struct{}{}
+}
+
+func (h *Hub) unsubscribe(c *client, t topic) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(c, t)
+}
+
+func (h *Hub) removeLocked(c *client, t topic) {
+	delete(c.topics, t)
+	subscribers := h.topics[t]
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		delete(h.topics, t)
+	}
+}
+
+// deliver queues msg for the client without blocking and disconnects the
+// client when its send buffer is full.
+func (h *Hub) deliver(c *client, msg []byte) {
+	select {
+	case c.send <- msg:
+	default:
+		if c.close(websocket.ClosePolicyViolation, "client too slow") {
+			log.Printf("Disconnecting slow stream client %s", c.remoteAddr())
+			h.metrics.StreamClientDropped()
+		}
+	}
+}
+
+func (h *Hub) readLoop(c *client) {
+	defer h.unregister(c)
+	defer c.close(websocket.CloseNormalClosure, "")
+
+	c.conn.SetReadLimit(maxRequestSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Stream client %s error: %v", c.remoteAddr(), err)
+			}
+			return
+		}
+
+		h.handleRequest(c, data)
+	}
+}
+
+func (h *Hub) handleRequest(c *client, data []byte) {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		h.reply(c, errorMessage("invalid request: "+err.Error()))
+		return
+	}
+
+	if req.Pair == "" {
+		h.reply(c, errorMessage("pair is required"))
+		return
+	}
+	tf, err := timeframe.Parse(req.TimeFrame)
+	if err != nil {
+		h.reply(c, errorMessage(err.Error()))
+		return
+	}
+	t := topic{pair: req.Pair, timeframe: tf.Name}
+
+	switch req.Op {
+	case opSubscribe:
+		h.subscribe(c, t)
+		h.reply(c, topicMessage{Type: typeSubscribed, Pair: t.pair, TimeFrame: t.timeframe})
+	case opUnsubscribe:
+		h.unsubscribe(c, t)
+		h.reply(c, topicMessage{Type: typeUnsubscribed, Pair: t.pair, TimeFrame: t.timeframe})
+	default:
+		h.reply(c, errorMessage("unknown op "+req.Op))
+	}
+}
+
+func (h *Hub) reply(c *client, v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode stream reply: %v", err)
+		return
+	}
+	h.deliver(c, msg)
+}
@@ -0,0 +1,130 @@
+package wsapi
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+func dialHub(t *testing.T, h *Hub) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]any
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func kline(pair, tf string, begin int64, close int64) models.Kline {
+	return models.Kline{Pair: pair, TimeFrame: tf, C: decimal.NewFromInt(close), UtcBegin: begin, UtcEnd: begin + 60_000}
+}
+
+func TestHub_SubscribeAndReceive(t *testing.T) {
+	h := NewHub()
+	conn := dialHub(t, h)
+
+	require.NoError(t, conn.WriteJSON(request{Op: opSubscribe, Pair: "BTC_USDT", TimeFrame: "1m"}))
+	ack := readMessage(t, conn)
+	assert.Equal(t, typeSubscribed, ack["type"])
+	assert.Equal(t, "MINUTE_1", ack["timeframe"])
+
+	h.OnKline(kline("ETH_USDT", "MINUTE_1", 0, 1), false)
+	h.OnKline(kline("BTC_USDT", "HOUR_1", 0, 2), false)
+	h.OnKline(kline("BTC_USDT", "MINUTE_1", 0, 3), false)
+	h.OnKline(kline("BTC_USDT", "MINUTE_1", 0, 4), true)
+
+	update := readMessage(t, conn)
+	assert.Equal(t, typeKline, update["type"])
+	assert.Equal(t, false, update["closed"])
+	assert.Equal(t, "3", update["kline"].(map[string]any)["c"])
+
+	final := readMessage(t, conn)
+	assert.Equal(t, true, final["closed"])
+	assert.Equal(t, "4", final["kline"].(map[string]any)["c"])
+
+	require.NoError(t, conn.WriteJSON(request{Op: opUnsubscribe, Pair: "BTC_USDT", TimeFrame: "MINUTE_1"}))
+	assert.Equal(t, typeUnsubscribed, readMessage(t, conn)["type"])
+
+	h.mu.RLock()
+	assert.Empty(t, h.topics)
+	h.mu.RUnlock()
+}
+
+func TestHub_InvalidRequest(t *testing.T) {
+	conn := dialHub(t, NewHub())
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	assert.Equal(t, typeError, readMessage(t, conn)["type"])
+
+	require.NoError(t, conn.WriteJSON(request{Op: opSubscribe, Pair: "BTC_USDT", TimeFrame: "MINUTE_2"}))
+	assert.Equal(t, typeError, readMessage(t, conn)["type"])
+
+	require.NoError(t, conn.WriteJSON(request{Op: "replay", Pair: "BTC_USDT", TimeFrame: "1m"}))
+	assert.Equal(t, typeError, readMessage(t, conn)["type"])
+}
+
+func TestHub_SlowClientIsDropped(t *testing.T) {
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	h := NewHub(WithSendBuffer(2), WithMetrics(m))
+
+	// A client without a writer never drains its buffer.
+	slow := &client{send: make(chan []byte, 2), done: make(chan struct{}), topics: make(map[topic]struct{})}
+	fast := &client{send: make(chan []byte, 100), done: make(chan struct{}), topics: make(map[topic]struct{})}
+	for _, c := range []*client{slow, fast} {
+		require.True(t, h.register(c))
+		h.subscribe(c, topic{pair: "BTC_USDT", timeframe: "MINUTE_1"})
+	}
+
+	for i := 0; i < 5; i++ {
+		h.OnKline(kline("BTC_USDT", "MINUTE_1", 0, int64(i)), false)
+	}
+
+	select {
+	case <-slow.done:
+	default:
+		t.Fatal("slow client was not disconnected")
+	}
+	assert.Equal(t, websocket.ClosePolicyViolation, slow.closeCode)
+	assert.Len(t, fast.send, 5)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.StreamSlowDrops))
+
+	h.unregister(slow)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.StreamClients))
+}
+
+func TestHub_CloseDisconnectsClients(t *testing.T) {
+	h := NewHub()
+	conn := dialHub(t, h)
+
+	require.NoError(t, conn.WriteJSON(request{Op: opSubscribe, Pair: "BTC_USDT", TimeFrame: "1m"}))
+	readMessage(t, conn)
+
+	h.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error: %v", err)
+}
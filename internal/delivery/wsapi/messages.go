@@ -0,0 +1,47 @@
+package wsapi
+
+import "github.com/Zmey56/poloniex-collector/internal/domain/models"
+
+const (
+	opSubscribe   = "subscribe"
+	opUnsubscribe = "unsubscribe"
+
+	typeKline        = "kline"
+	typeSubscribed   = "subscribed"
+	typeUnsubscribed = "unsubscribed"
+	typeError        = "error"
+)
+
+// request is a message sent by a client, e.g.
+//
+//	{"op":"subscribe","pair":"BTC_USDT","timeframe":"1m"}
+type request struct {
+	Op        string `json:"op"`
+	Pair      string `json:"pair"`
+	TimeFrame string `json:"timeframe"`
+}
+
+// klineMessage carries the current state of a candle. Closed is set on the
+// final state of the candle.
+type klineMessage struct {
+	Type      string       `json:"type"`
+	Pair      string       `json:"pair"`
+	TimeFrame string       `json:"timeframe"`
+	Closed    bool         `json:"closed"`
+	Kline     models.Kline `json:"kline"`
+}
+
+type topicMessage struct {
+	Type      string `json:"type"`
+	Pair      string `json:"pair"`
+	TimeFrame string `json:"timeframe"`
+}
+
+type errorReply struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func errorMessage(message string) errorReply {
+	return errorReply{Type: typeError, Message: message}
+}
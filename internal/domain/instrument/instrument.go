@@ -0,0 +1,63 @@
+// Package instrument is the exchange-independent model of a spot market.
+// Instruments are written BASE_QUOTE in upper case (BTC_USDT); that is the
+// form stored in the database and used in the config. Exchange adapters
+// translate it to and from the symbols of their venue.
+package instrument
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Instrument is a spot market of Base priced in Quote.
+type Instrument struct {
+	Base  string
+	Quote string
+}
+
+// New returns the instrument of base and quote in their canonical case.
+func New(base, quote string) Instrument {
+	return Instrument{Base: strings.ToUpper(base), Quote: strings.ToUpper(quote)}
+}
+
+// Parse reads an instrument written as BASE_QUOTE. BASE-QUOTE and
+// BASE/QUOTE are accepted as well, in any case.
+func Parse(symbol string) (Instrument, error) {
+	i := strings.IndexAny(symbol, "_-/")
+	if i <= 0 || i == len(symbol)-1 || strings.ContainsAny(symbol[i+1:], "_-/") {
+		return Instrument{}, fmt.Errorf("invalid instrument %q, want BASE_QUOTE", symbol)
+	}
+	return New(symbol[:i], symbol[i+1:]), nil
+}
+
+// ParseList parses every symbol and drops duplicates, keeping the order.
+func ParseList(symbols []string) ([]Instrument, error) {
+	instruments := make([]Instrument, 0, len(symbols))
+	seen := make(map[Instrument]struct{}, len(symbols))
+	for _, symbol := range symbols {
+		inst, err := Parse(symbol)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[inst]; ok {
+			continue
+		}
+		seen[inst] = struct{}{}
+		instruments = append(instruments, inst)
+	}
+	return instruments, nil
+}
+
+// Strings returns the canonical names of the instruments.
+func Strings(instruments []Instrument) []string {
+	names := make([]string, len(instruments))
+	for i, inst := range instruments {
+		names[i] = inst.String()
+	}
+	return names
+}
+
+// String returns the canonical name, e.g. BTC_USDT.
+func (i Instrument) String() string {
+	return i.Base + "_" + i.Quote
+}
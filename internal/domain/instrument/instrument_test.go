@@ -0,0 +1,31 @@
+package instrument
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, symbol := range []string{"BTC_USDT", "btc_usdt", "BTC-USDT", "BTC/USDT"} {
+		inst, err := Parse(symbol)
+		require.NoError(t, err, symbol)
+		assert.Equal(t, Instrument{Base: "BTC", Quote: "USDT"}, inst, symbol)
+		assert.Equal(t, "BTC_USDT", inst.String(), symbol)
+	}
+
+	for _, symbol := range []string{"", "BTCUSDT", "_USDT", "BTC_", "BTC_USDT_X"} {
+		_, err := Parse(symbol)
+		assert.Error(t, err, symbol)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	instruments, err := ParseList([]string{"BTC_USDT", "eth_usdt", "btc-usdt"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BTC_USDT", "ETH_USDT"}, Strings(instruments))
+
+	_, err = ParseList([]string{"BTC_USDT", "BTCUSDT"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,11 @@
+package models
+
+// BackfillCheckpoint records the progress of a historical backfill: every
+// candle of Pair and TimeFrame beginning in [StartTime, DoneUntil) has been
+// saved. Both bounds are unix milliseconds.
+type BackfillCheckpoint struct {
+	Pair      string `json:"pair"`
+	TimeFrame string `json:"timeFrame"`
+	StartTime int64  `json:"startTime"`
+	DoneUntil int64  `json:"doneUntil"`
+}
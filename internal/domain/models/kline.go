@@ -1,17 +1,37 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type Kline struct {
-	Pair      string    `json:"pair"`
-	TimeFrame string    `json:"timeFrame"`
-	O         float64   `json:"o"`
-	H         float64   `json:"h"`
-	L         float64   `json:"l"`
-	C         float64   `json:"c"`
-	UtcBegin  int64     `json:"utcBegin"`
-	UtcEnd    int64     `json:"utcEnd"`
-	BeginDt   time.Time `json:"beginDt"`
-	EndDt     time.Time `json:"endDt"`
-	VolumeBS  VBS       `json:"volumeBS"`
+	Exchange  string          `json:"exchange"`
+	Pair      string          `json:"pair"`
+	TimeFrame string          `json:"timeFrame"`
+	O         decimal.Decimal `json:"o"`
+	H         decimal.Decimal `json:"h"`
+	L         decimal.Decimal `json:"l"`
+	C         decimal.Decimal `json:"c"`
+	UtcBegin  int64           `json:"utcBegin"`
+	UtcEnd    int64           `json:"utcEnd"`
+	BeginDt   time.Time       `json:"beginDt"`
+	EndDt     time.Time       `json:"endDt"`
+	VolumeBS  VBS             `json:"volumeBS"`
+
+	// BaseVolume and QuoteVolume are the total traded volume in the base
+	// and the quote currency, VWAP their ratio.
+	TradeCount  int64           `json:"tradeCount"`
+	VWAP        decimal.Decimal `json:"vwap"`
+	BaseVolume  decimal.Decimal `json:"baseVolume"`
+	QuoteVolume decimal.Decimal `json:"quoteVolume"`
+
+	// FirstTradeID and LastTradeID are empty for candles loaded from the
+	// exchange history, which does not report them.
+	FirstTradeID string `json:"firstTradeId"`
+	LastTradeID  string `json:"lastTradeId"`
+
+	// IsClosed is set once the time of the candle is over.
+	IsClosed bool `json:"isClosed"`
 }
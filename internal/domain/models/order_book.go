@@ -0,0 +1,15 @@
+package models
+
+type PriceLevel struct {
+	Price  float64 `json:"price"`
+	Amount float64 `json:"amount"`
+}
+
+// OrderBook is a snapshot of the top levels of a local order book.
+type OrderBook struct {
+	Pair      string       `json:"pair"`
+	Bids      []PriceLevel `json:"bids"`
+	Asks      []PriceLevel `json:"asks"`
+	Sequence  int64        `json:"sequence"`
+	Timestamp int64        `json:"timestamp"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// Ticker holds the rolling 24h statistics of a pair. Volume is in the base
+// currency and QuoteVolume in the quote currency; Change is the relative
+// price change over the window (0.01 means +1%).
+type Ticker struct {
+	Pair        string  `json:"pair"`
+	Last        float64 `json:"last"`
+	Bid         float64 `json:"bid"`
+	Ask         float64 `json:"ask"`
+	Open        float64 `json:"open"`
+	High        float64 `json:"high"`
+	Low         float64 `json:"low"`
+	Volume      float64 `json:"volume"`
+	QuoteVolume float64 `json:"quoteVolume"`
+	Change      float64 `json:"change"`
+	TradeCount  int64   `json:"tradeCount"`
+	Timestamp   int64   `json:"timestamp"`
+}
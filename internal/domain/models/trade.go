@@ -1,14 +1,21 @@
 package models
 
+import "github.com/shopspring/decimal"
+
 type RecentTrade struct {
-	Tid       string `json:"id"`
-	Pair      string `json:"pair"`
-	Price     string `json:"price"`
-	Amount    string `json:"amount"`
-	Side      string `json:"taker_side"`
-	Timestamp int64  `json:"timestamp"`
-
-	Symbol     string  `json:"symbol"`
-	Quantity   float64 `json:"quantity"`
-	CreateTime int64   `json:"create_time"`
+	Exchange  string          `json:"exchange"`
+	Tid       string          `json:"id"`
+	Pair      string          `json:"pair"`
+	Price     decimal.Decimal `json:"price"`
+	Amount    decimal.Decimal `json:"amount"` // volume in the quote currency
+	Side      string          `json:"taker_side"`
+	Timestamp int64           `json:"timestamp"`
+
+	Symbol     string          `json:"symbol"`
+	Quantity   decimal.Decimal `json:"quantity"` // volume in the base currency
+	CreateTime int64           `json:"create_time"`
+
+	// Reconnected marks the first trade of the pair received after the trade
+	// stream (re)connected; trades made before it may have been missed.
+	Reconnected bool `json:"reconnected,omitempty"`
 }
@@ -1,8 +1,10 @@
 package models
 
+import "github.com/shopspring/decimal"
+
 type VBS struct {
-	BuyBase   float64 `json:"buyBase"`
-	SellBase  float64 `json:"sellBase"`
-	BuyQuote  float64 `json:"buyQuote"`
-	SellQuote float64 `json:"sellQuote"`
+	BuyBase   decimal.Decimal `json:"buyBase"`
+	SellBase  decimal.Decimal `json:"sellBase"`
+	BuyQuote  decimal.Decimal `json:"buyQuote"`
+	SellQuote decimal.Decimal `json:"sellQuote"`
 }
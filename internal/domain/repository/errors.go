@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+)
+
+// TradeWriteError reports the trades of a batch that were rejected while the
+// rest of the batch was stored.
+type TradeWriteError struct {
+	Failed []models.RecentTrade
+	// Err is the error of the last rejected trade.
+	Err error
+}
+
+func (e *TradeWriteError) Error() string {
+	return fmt.Sprintf("%d trades rejected: %v", len(e.Failed), e.Err)
+}
+
+func (e *TradeWriteError) Unwrap() error {
+	return e.Err
+}
+
+// IncompleteTradesError is returned by ExchangeClient.GetHistoricalTrades
+// together with the trades it could load when the trades made between From
+// and Oldest are no longer served by the exchange.
+type IncompleteTradesError struct {
+	Pair string
+	From int64
+	// Oldest is the time of the oldest trade the exchange still serves.
+	Oldest int64
+}
+
+func (e *IncompleteTradesError) Error() string {
+	return fmt.Sprintf("trades of %s made between %d and %d are no longer served", e.Pair, e.From, e.Oldest)
+}
@@ -3,22 +3,66 @@ package repository
 import (
 	"context"
 
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
 )
 
 type TradeRepository interface {
 	SaveTrade(ctx context.Context, trade models.RecentTrade) error
+	// SaveTrades stores the trades, ignoring the ones already stored. When the
+	// database rejects some of them the others are still stored and a
+	// *TradeWriteError lists the rejected ones; any other error means none of
+	// the trades may have been stored.
 	SaveTrades(ctx context.Context, trades []models.RecentTrade) error
+	GetLastTradeTime(ctx context.Context, pair string) (int64, error)
+	// GetTradesByTimeRange returns up to limit trades of the pair made between
+	// startTime and endTime (unix ms), ordered by timestamp and tid. Trades
+	// made exactly at startTime are only returned if their tid sorts after
+	// afterTid, which lets callers resume after the last trade they have seen.
+	GetTradesByTimeRange(ctx context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error)
 }
 
 type KlineRepository interface {
 	SaveKline(ctx context.Context, kline models.Kline) error
+	SaveKlines(ctx context.Context, klines []models.Kline) error
 	GetLastKline(ctx context.Context, pair, timeframe string) (*models.Kline, error)
+	GetLastKlineBefore(ctx context.Context, pair, timeframe string, before int64) (*models.Kline, error)
 	GetKlinesByTimeRange(ctx context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error)
 	GetKlineByInterval(ctx context.Context, pair, timeframe string, beginTime int64) (*models.Kline, error)
 }
 
+type TickerRepository interface {
+	SaveTicker(ctx context.Context, ticker models.Ticker) error
+	GetLastTicker(ctx context.Context, pair string) (*models.Ticker, error)
+}
+
+type CheckpointRepository interface {
+	GetCheckpoint(ctx context.Context, pair, timeframe string) (*models.BackfillCheckpoint, error)
+	SaveCheckpoint(ctx context.Context, checkpoint models.BackfillCheckpoint) error
+}
+
+// ExchangeClient is an adapter to the market data of one exchange. It takes
+// and returns instruments and timeframes in their canonical form and stamps
+// the data it returns with Name. All times are unix milliseconds.
 type ExchangeClient interface {
-	GetHistoricalKlines(ctx context.Context, pair string, timeframe string, startTime, endTime int64) ([]models.Kline, error)
-	SubscribeToTrades(ctx context.Context, pairs []string) (<-chan models.RecentTrade, error)
+	// Name identifies the exchange, e.g. "poloniex".
+	Name() string
+	// GetHistoricalKlines returns the candles that begin between startTime
+	// and endTime, oldest first.
+	GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error)
+	// GetHistoricalTrades returns the trades made between from and to, oldest
+	// first. If the oldest trades of the range are no longer served, it
+	// returns the rest with an *IncompleteTradesError.
+	GetHistoricalTrades(ctx context.Context, inst instrument.Instrument, from, to int64) ([]models.RecentTrade, error)
+	SubscribeToTrades(ctx context.Context, instruments []instrument.Instrument) (<-chan models.RecentTrade, error)
+}
+
+// TickerClient is implemented by the exchange clients that stream tickers.
+type TickerClient interface {
+	SubscribeToTickers(ctx context.Context, pairs []string) (<-chan models.Ticker, error)
+}
+
+type OrderBookClient interface {
+	SubscribeToOrderBook(ctx context.Context, pairs []string, depth int) (<-chan models.OrderBook, error)
 }
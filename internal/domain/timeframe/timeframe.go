@@ -0,0 +1,148 @@
+// Package timeframe is the registry of the candle intervals supported by the
+// collector. Timeframes are identified by canonical names (MINUTE_1, HOUR_4,
+// ...), which the exchange adapters translate to their own intervals; the
+// short aliases used in the config (1m, 4h, ...) are accepted as well.
+package timeframe
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type kind int
+
+const (
+	fixed kind = iota
+	week
+	month
+)
+
+// TimeFrame is a candle interval.
+type TimeFrame struct {
+	// Name is the Poloniex interval name, e.g. MINUTE_1.
+	Name string
+	// Alias is the short name, e.g. 1m.
+	Alias string
+	// Duration is the length of a bucket. Months are taken as 31 days, the
+	// longest possible month.
+	Duration time.Duration
+
+	kind kind
+}
+
+var registry = []TimeFrame{
+	{Name: "MINUTE_1", Alias: "1m", Duration: time.Minute},
+	{Name: "MINUTE_5", Alias: "5m", Duration: 5 * time.Minute},
+	{Name: "MINUTE_10", Alias: "10m", Duration: 10 * time.Minute},
+	{Name: "MINUTE_15", Alias: "15m", Duration: 15 * time.Minute},
+	{Name: "MINUTE_30", Alias: "30m", Duration: 30 * time.Minute},
+	{Name: "HOUR_1", Alias: "1h", Duration: time.Hour},
+	{Name: "HOUR_2", Alias: "2h", Duration: 2 * time.Hour},
+	{Name: "HOUR_4", Alias: "4h", Duration: 4 * time.Hour},
+	{Name: "HOUR_6", Alias: "6h", Duration: 6 * time.Hour},
+	{Name: "HOUR_12", Alias: "12h", Duration: 12 * time.Hour},
+	{Name: "DAY_1", Alias: "1d", Duration: 24 * time.Hour},
+	{Name: "DAY_3", Alias: "3d", Duration: 3 * 24 * time.Hour},
+	{Name: "WEEK_1", Alias: "1w", Duration: 7 * 24 * time.Hour, kind: week},
+	{Name: "MONTH_1", Alias: "1M", Duration: 31 * 24 * time.Hour, kind: month},
+}
+
+// Default is the list of timeframes used when none are configured.
+var Default = []string{"MINUTE_1", "MINUTE_15", "HOUR_1", "DAY_1"}
+
+// All returns every supported timeframe from the shortest to the longest.
+func All() []TimeFrame {
+	return append([]TimeFrame(nil), registry...)
+}
+
+// Parse looks a timeframe up by its Poloniex name or its alias.
+func Parse(name string) (TimeFrame, error) {
+	for _, tf := range registry {
+		if tf.Alias == name || strings.EqualFold(tf.Name, name) {
+			return tf, nil
+		}
+	}
+	return TimeFrame{}, fmt.Errorf("unsupported timeframe %q", name)
+}
+
+// ParseList parses every name and drops duplicates, keeping the order.
+func ParseList(names []string) ([]TimeFrame, error) {
+	timeframes := make([]TimeFrame, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		tf, err := Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[tf.Name]; ok {
+			continue
+		}
+		seen[tf.Name] = struct{}{}
+		timeframes = append(timeframes, tf)
+	}
+	return timeframes, nil
+}
+
+// MustParseList is like ParseList but panics on an unsupported name. It is
+// meant for lists known at compile time.
+func MustParseList(names []string) []TimeFrame {
+	timeframes, err := ParseList(names)
+	if err != nil {
+		panic(err)
+	}
+	return timeframes
+}
+
+// Names returns the Poloniex names of the timeframes.
+func Names(timeframes []TimeFrame) []string {
+	names := make([]string, len(timeframes))
+	for i, tf := range timeframes {
+		names[i] = tf.Name
+	}
+	return names
+}
+
+// Bounds returns the beginning and the end (exclusive) of the bucket that
+// contains ts, all in unix milliseconds UTC. Intervals up to DAY_3 are
+// aligned to the unix epoch, weeks start on Monday and months on the first
+// day of the calendar month.
+func (tf TimeFrame) Bounds(ts int64) (int64, int64) {
+	switch tf.kind {
+	case week:
+		t := time.UnixMilli(ts).UTC()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		begin := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return begin.UnixMilli(), begin.AddDate(0, 0, 7).UnixMilli()
+	case month:
+		t := time.UnixMilli(ts).UTC()
+		begin := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return begin.UnixMilli(), begin.AddDate(0, 1, 0).UnixMilli()
+	default:
+		d := tf.Duration.Milliseconds()
+		begin := ts / d * d
+		if ts < 0 && ts%d != 0 {
+			begin -= d
+		}
+		return begin, begin + d
+	}
+}
+
+// Divides reports whether every bucket of higher is made of whole buckets of
+// tf, so that candles of higher can be built from candles of tf.
+func (tf TimeFrame) Divides(higher TimeFrame) bool {
+	if tf.kind != fixed {
+		return tf.Name == higher.Name
+	}
+	switch higher.kind {
+	case week, month:
+		// Weeks and months start at midnight UTC.
+		return (24*time.Hour)%tf.Duration == 0
+	default:
+		return higher.Duration%tf.Duration == 0
+	}
+}
+
+func (tf TimeFrame) String() string {
+	return tf.Name
+}
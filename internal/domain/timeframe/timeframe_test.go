@@ -0,0 +1,123 @@
+package timeframe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ms(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func TestParse(t *testing.T) {
+	for _, name := range []string{"MINUTE_5", "MINUTE_30", "HOUR_2", "HOUR_4", "HOUR_6", "HOUR_12", "DAY_3", "WEEK_1", "MONTH_1"} {
+		tf, err := Parse(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, name, tf.Name)
+	}
+
+	tf, err := Parse("15m")
+	require.NoError(t, err)
+	assert.Equal(t, "MINUTE_15", tf.Name)
+
+	tf, err = Parse("1M")
+	require.NoError(t, err)
+	assert.Equal(t, "MONTH_1", tf.Name)
+
+	_, err = Parse("MINUTE_2")
+	assert.Error(t, err)
+}
+
+func TestParseList(t *testing.T) {
+	timeframes, err := ParseList([]string{"1m", "MINUTE_1", "HOUR_4", "1w"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"MINUTE_1", "HOUR_4", "WEEK_1"}, Names(timeframes))
+
+	_, err = ParseList([]string{"1m", "7m"})
+	assert.Error(t, err)
+}
+
+func TestBounds(t *testing.T) {
+	ts := time.Date(2024, 2, 29, 13, 47, 12, 345e6, time.UTC) // Thursday
+
+	testCases := []struct {
+		name  string
+		begin time.Time
+		end   time.Time
+	}{
+		{"MINUTE_1", time.Date(2024, 2, 29, 13, 47, 0, 0, time.UTC), time.Date(2024, 2, 29, 13, 48, 0, 0, time.UTC)},
+		{"MINUTE_5", time.Date(2024, 2, 29, 13, 45, 0, 0, time.UTC), time.Date(2024, 2, 29, 13, 50, 0, 0, time.UTC)},
+		{"MINUTE_30", time.Date(2024, 2, 29, 13, 30, 0, 0, time.UTC), time.Date(2024, 2, 29, 14, 0, 0, 0, time.UTC)},
+		{"HOUR_4", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 16, 0, 0, 0, time.UTC)},
+		{"HOUR_12", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"DAY_1", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"DAY_3", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"WEEK_1", time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"MONTH_1", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tf, err := Parse(tc.name)
+			require.NoError(t, err)
+
+			begin, end := tf.Bounds(ms(ts))
+			assert.Equal(t, tc.begin, time.UnixMilli(begin).UTC())
+			assert.Equal(t, tc.end, time.UnixMilli(end).UTC())
+		})
+	}
+}
+
+func TestBounds_WeekAndMonthEdges(t *testing.T) {
+	week, err := Parse("WEEK_1")
+	require.NoError(t, err)
+
+	// A Sunday late at night still belongs to the week that began on Monday.
+	begin, end := week.Bounds(ms(time.Date(2024, 3, 3, 23, 59, 59, 0, time.UTC)))
+	assert.Equal(t, ms(time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC)), begin)
+	assert.Equal(t, ms(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)), end)
+
+	// Monday midnight opens a new week, across a year boundary.
+	begin, _ = week.Bounds(ms(time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, ms(time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)), begin)
+
+	month, err := Parse("MONTH_1")
+	require.NoError(t, err)
+
+	begin, end = month.Bounds(ms(time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)))
+	assert.Equal(t, ms(time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)), begin)
+	assert.Equal(t, ms(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), end)
+
+	begin, end = month.Bounds(ms(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, ms(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)), begin)
+	assert.Equal(t, ms(time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)), end)
+}
+
+func TestDivides(t *testing.T) {
+	tests := []struct {
+		lower, higher string
+		want          bool
+	}{
+		{"1m", "15m", true},
+		{"10m", "15m", false},
+		{"15m", "1h", true},
+		{"1h", "1d", true},
+		{"1d", "3d", true},
+		{"1d", "1w", true},
+		{"1d", "1M", true},
+		{"3d", "1w", false},
+		{"1w", "1M", false},
+		{"1h", "1h", true},
+		{"1M", "1M", true},
+	}
+	for _, tc := range tests {
+		lower, err := Parse(tc.lower)
+		require.NoError(t, err)
+		higher, err := Parse(tc.higher)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, lower.Divides(higher), "%s divides %s", tc.lower, tc.higher)
+	}
+}
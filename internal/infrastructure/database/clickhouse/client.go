@@ -0,0 +1,164 @@
+// Package clickhouse stores trades and klines in ClickHouse through its HTTP
+// interface.
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Client runs queries over the ClickHouse HTTP interface.
+type Client struct {
+	address  string
+	database string
+	user     string
+	password string
+	client   *http.Client
+}
+
+type ClientOption func(*Client)
+
+// WithDatabase sets the database queries run in.
+func WithDatabase(database string) ClientOption {
+	return func(c *Client) {
+		if database != "" {
+			c.database = database
+		}
+	}
+}
+
+// WithCredentials sets the user and the password queries run as.
+func WithCredentials(user, password string) ClientOption {
+	return func(c *Client) {
+		c.user = user
+		c.password = password
+	}
+}
+
+// WithTimeout sets the timeout of a query.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.client.Timeout = timeout
+		}
+	}
+}
+
+// NewClient returns a client of the server at address, e.g.
+// http://localhost:8123.
+func NewClient(address string, opts ...ClientOption) *Client {
+	c := &Client{
+		address:  strings.TrimRight(address, "/"),
+		database: "default",
+		client:   &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Exception is an error reported by the server.
+type Exception struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Exception) Error() string {
+	return fmt.Sprintf("clickhouse: %d: %s", e.StatusCode, e.Message)
+}
+
+// Exec runs a statement that returns no rows.
+func (c *Client) Exec(ctx context.Context, query string) error {
+	resp, err := c.do(ctx, url.Values{}, strings.NewReader(query))
+	if err != nil {
+		return err
+	}
+	return resp.Close()
+}
+
+// insert inserts rows, each encoded as one JSON object, into table. Inserts
+// are asynchronous on the server, which merges the small ones into larger
+// parts, but the call returns only once the rows are written.
+func insert[T any](ctx context.Context, c *Client, table string, columns []string, rows []T) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("encode row: %w", err)
+		}
+	}
+
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("INSERT INTO %s (%s) FORMAT JSONEachRow", table, strings.Join(columns, ", ")))
+	params.Set("async_insert", "1")
+	params.Set("wait_for_async_insert", "1")
+	params.Set("async_insert_deduplicate", "1")
+
+	resp, err := c.do(ctx, params, &body)
+	if err != nil {
+		return err
+	}
+	return resp.Close()
+}
+
+// query runs a SELECT and decodes every row into a T. Values of args are
+// bound to the {name:Type} placeholders of the query.
+func query[T any](ctx context.Context, c *Client, q string, args map[string]string) ([]T, error) {
+	params := url.Values{}
+	for name, value := range args {
+		params.Set("param_"+name, value)
+	}
+	params.Set("output_format_json_quote_decimals", "1")
+	params.Set("output_format_json_quote_64bit_integers", "0")
+
+	resp, err := c.do(ctx, params, strings.NewReader(q+" FORMAT JSONEachRow"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	var rows []T
+	dec := json.NewDecoder(resp)
+	for dec.More() {
+		var row T
+		if err := dec.Decode(&row); err != nil {
+			return nil, fmt.Errorf("decode row: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (c *Client) do(ctx context.Context, params url.Values, body io.Reader) (io.ReadCloser, error) {
+	params.Set("database", c.database)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.address+"/?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		req.Header.Set("X-ClickHouse-User", c.user)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Exception{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp.Body, nil
+}
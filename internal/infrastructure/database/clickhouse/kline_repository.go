@@ -0,0 +1,200 @@
+package clickhouse
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+type klineRow struct {
+	Exchange     string          `json:"exchange"`
+	Pair         string          `json:"pair"`
+	Interval     string          `json:"interval"`
+	Open         decimal.Decimal `json:"open"`
+	High         decimal.Decimal `json:"high"`
+	Low          decimal.Decimal `json:"low"`
+	Close        decimal.Decimal `json:"close"`
+	UtcBegin     int64           `json:"utc_begin"`
+	UtcEnd       int64           `json:"utc_end"`
+	BuyBase      decimal.Decimal `json:"buy_base"`
+	SellBase     decimal.Decimal `json:"sell_base"`
+	BuyQuote     decimal.Decimal `json:"buy_quote"`
+	SellQuote    decimal.Decimal `json:"sell_quote"`
+	TradeCount   int64           `json:"trade_count"`
+	VWAP         decimal.Decimal `json:"vwap"`
+	BaseVolume   decimal.Decimal `json:"base_volume"`
+	QuoteVolume  decimal.Decimal `json:"quote_volume"`
+	FirstTradeID string          `json:"first_trade_id"`
+	LastTradeID  string          `json:"last_trade_id"`
+	IsClosed     bool            `json:"is_closed"`
+	Version      int64           `json:"version,omitempty"`
+}
+
+var klineColumns = []string{
+	"exchange", "pair", "interval", "open", "high", "low", "close", "utc_begin", "utc_end",
+	"buy_base", "sell_base", "buy_quote", "sell_quote", "trade_count", "vwap",
+	"base_volume", "quote_volume", "first_trade_id", "last_trade_id", "is_closed", "version",
+}
+
+const selectKlines = `SELECT exchange, pair, interval, open, high, low, close, utc_begin, utc_end,
+                buy_base, sell_base, buy_quote, sell_quote, trade_count, vwap,
+                base_volume, quote_volume, first_trade_id, last_trade_id, is_closed
+         FROM klines FINAL
+         WHERE exchange = {exchange:String} AND pair = {pair:String} AND interval = {interval:String}`
+
+type KlineRepository struct {
+	client   *Client
+	metrics  *metrics.Metrics
+	exchange string
+}
+
+func NewKlineRepository(client *Client, opts ...Option) *KlineRepository {
+	o := newOptions(opts)
+	return &KlineRepository{
+		client:   client,
+		metrics:  o.metrics,
+		exchange: o.exchange,
+	}
+}
+
+func (r *KlineRepository) SaveKline(ctx context.Context, kline models.Kline) error {
+	return r.SaveKlines(ctx, []models.Kline{kline})
+}
+
+// SaveKlines inserts the klines in one batch as their latest version.
+func (r *KlineRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	defer r.metrics.ObserveDB("clickhouse_save_klines", time.Now())
+	if len(klines) == 0 {
+		return nil
+	}
+
+	version := time.Now().UnixNano()
+	rows := make([]klineRow, len(klines))
+	for i, kline := range klines {
+		rows[i] = klineRow{
+			Exchange:     r.exchange,
+			Pair:         kline.Pair,
+			Interval:     kline.TimeFrame,
+			Open:         kline.O,
+			High:         kline.H,
+			Low:          kline.L,
+			Close:        kline.C,
+			UtcBegin:     kline.UtcBegin,
+			UtcEnd:       kline.UtcEnd,
+			BuyBase:      kline.VolumeBS.BuyBase,
+			SellBase:     kline.VolumeBS.SellBase,
+			BuyQuote:     kline.VolumeBS.BuyQuote,
+			SellQuote:    kline.VolumeBS.SellQuote,
+			TradeCount:   kline.TradeCount,
+			VWAP:         kline.VWAP,
+			BaseVolume:   kline.BaseVolume,
+			QuoteVolume:  kline.QuoteVolume,
+			FirstTradeID: kline.FirstTradeID,
+			LastTradeID:  kline.LastTradeID,
+			IsClosed:     kline.IsClosed,
+			Version:      version,
+		}
+	}
+	return insert(ctx, r.client, "klines", klineColumns, rows)
+}
+
+// ReplaceKlines overwrites the stored klines. Every insert is the latest
+// version of its klines, so it is the same as SaveKlines.
+func (r *KlineRepository) ReplaceKlines(ctx context.Context, klines []models.Kline) error {
+	return r.SaveKlines(ctx, klines)
+}
+
+func (r *KlineRepository) GetLastKline(ctx context.Context, pair, timeframe string) (*models.Kline, error) {
+	defer r.metrics.ObserveDB("clickhouse_get_last_kline", time.Now())
+	return r.one(ctx, selectKlines+`
+         ORDER BY utc_begin DESC
+         LIMIT 1`, r.args(pair, timeframe, nil))
+}
+
+// GetLastKlineBefore returns the latest kline that begins before the given
+// time, or nil when there is none.
+func (r *KlineRepository) GetLastKlineBefore(ctx context.Context, pair, timeframe string, before int64) (*models.Kline, error) {
+	defer r.metrics.ObserveDB("clickhouse_get_last_kline_before", time.Now())
+	return r.one(ctx, selectKlines+`
+           AND utc_begin < {before:Int64}
+         ORDER BY utc_begin DESC
+         LIMIT 1`, r.args(pair, timeframe, map[string]int64{"before": before}))
+}
+
+// GetKlineByInterval returns the first kline that begins at or after
+// beginTime, or nil when there is none.
+func (r *KlineRepository) GetKlineByInterval(ctx context.Context, pair, timeframe string, beginTime int64) (*models.Kline, error) {
+	defer r.metrics.ObserveDB("clickhouse_get_kline_by_interval", time.Now())
+	return r.one(ctx, selectKlines+`
+           AND utc_begin >= {begin:Int64}
+         ORDER BY utc_begin
+         LIMIT 1`, r.args(pair, timeframe, map[string]int64{"begin": beginTime}))
+}
+
+func (r *KlineRepository) GetKlinesByTimeRange(ctx context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error) {
+	defer r.metrics.ObserveDB("clickhouse_get_klines_by_time_range", time.Now())
+	rows, err := query[klineRow](ctx, r.client, selectKlines+`
+           AND utc_begin >= {start:Int64}
+           AND utc_end <= {end:Int64}
+         ORDER BY utc_begin`, r.args(pair, timeframe, map[string]int64{"start": startTime, "end": endTime}))
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []models.Kline
+	for _, row := range rows {
+		klines = append(klines, r.kline(row))
+	}
+	return klines, nil
+}
+
+func (r *KlineRepository) one(ctx context.Context, q string, args map[string]string) (*models.Kline, error) {
+	rows, err := query[klineRow](ctx, r.client, q, args)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	kline := r.kline(rows[0])
+	return &kline, nil
+}
+
+func (r *KlineRepository) args(pair, timeframe string, times map[string]int64) map[string]string {
+	args := map[string]string{"exchange": r.exchange, "pair": pair, "interval": timeframe}
+	for name, t := range times {
+		args[name] = strconv.FormatInt(t, 10)
+	}
+	return args
+}
+
+func (r *KlineRepository) kline(row klineRow) models.Kline {
+	return models.Kline{
+		Exchange:  r.exchange,
+		Pair:      row.Pair,
+		TimeFrame: row.Interval,
+		O:         row.Open,
+		H:         row.High,
+		L:         row.Low,
+		C:         row.Close,
+		UtcBegin:  row.UtcBegin,
+		UtcEnd:    row.UtcEnd,
+		BeginDt:   time.UnixMilli(row.UtcBegin).UTC(),
+		EndDt:     time.UnixMilli(row.UtcEnd).UTC(),
+		VolumeBS: models.VBS{
+			BuyBase:   row.BuyBase,
+			SellBase:  row.SellBase,
+			BuyQuote:  row.BuyQuote,
+			SellQuote: row.SellQuote,
+		},
+		TradeCount:   row.TradeCount,
+		VWAP:         row.VWAP,
+		BaseVolume:   row.BaseVolume,
+		QuoteVolume:  row.QuoteVolume,
+		FirstTradeID: row.FirstTradeID,
+		LastTradeID:  row.LastTradeID,
+		IsClosed:     row.IsClosed,
+	}
+}
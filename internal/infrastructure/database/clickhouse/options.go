@@ -0,0 +1,38 @@
+package clickhouse
+
+import "github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+
+// DefaultExchange is the exchange repositories are scoped to unless
+// WithExchange says otherwise.
+const DefaultExchange = "poloniex"
+
+type options struct {
+	metrics  *metrics.Metrics
+	exchange string
+}
+
+type Option func(*options)
+
+// WithExchange scopes a repository to the data of one exchange.
+func WithExchange(exchange string) Option {
+	return func(o *options) {
+		if exchange != "" {
+			o.exchange = exchange
+		}
+	}
+}
+
+// WithMetrics sets the metrics used to record query latency.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{exchange: DefaultExchange}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,130 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+)
+
+// fakeServer records the requests made to it and answers with response.
+type fakeServer struct {
+	queries  []string
+	params   []map[string]string
+	bodies   []string
+	response string
+	status   int
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	params := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		params[name] = values[0]
+	}
+	s.params = append(s.params, params)
+	if q := params["query"]; q != "" {
+		s.queries = append(s.queries, q)
+		s.bodies = append(s.bodies, string(body))
+	} else {
+		s.queries = append(s.queries, string(body))
+	}
+
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+	_, _ = io.WriteString(w, s.response)
+}
+
+func newTestClient(t *testing.T, server *fakeServer) *Client {
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return NewClient(ts.URL, WithDatabase("market"), WithCredentials("collector", "secret"))
+}
+
+func TestTradeRepository_SaveTrades(t *testing.T) {
+	server := &fakeServer{}
+	repo := NewTradeRepository(newTestClient(t, server), WithExchange("binance"))
+
+	err := repo.SaveTrades(context.Background(), []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.RequireFromString("50000.123456789"), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1000},
+		{Tid: "2", Pair: "BTC_USDT", Price: decimal.NewFromInt(50001), Amount: decimal.RequireFromString("0.5"), Side: "sell", Timestamp: 2000},
+	})
+	require.NoError(t, err)
+
+	// One insert for the whole batch.
+	require.Len(t, server.queries, 1)
+	assert.Equal(t, "INSERT INTO trades (exchange, pair, tid, price, amount, quantity, side, timestamp) FORMAT JSONEachRow", server.queries[0])
+	assert.Equal(t, "market", server.params[0]["database"])
+	assert.Equal(t, "1", server.params[0]["async_insert"])
+
+	var rows []tradeRow
+	scanner := bufio.NewScanner(strings.NewReader(server.bodies[0]))
+	for scanner.Scan() {
+		var row tradeRow
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		rows = append(rows, row)
+	}
+	require.Len(t, rows, 2)
+	assert.Equal(t, "binance", rows[0].Exchange)
+	assert.Equal(t, "50000.123456789", rows[0].Price.String())
+	assert.Equal(t, int64(2000), rows[1].Timestamp)
+}
+
+func TestTradeRepository_GetTradesByTimeRange(t *testing.T) {
+	server := &fakeServer{response: `{"exchange":"poloniex","pair":"BTC_USDT","tid":"7","price":"50000.5","amount":"0.1","quantity":"5000.05","side":"buy","timestamp":3000}` + "\n"}
+	repo := NewTradeRepository(newTestClient(t, server))
+
+	trades, err := repo.GetTradesByTimeRange(context.Background(), "BTC_USDT", 1000, 5000, "5", 100)
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	assert.Equal(t, "7", trades[0].Tid)
+	assert.Equal(t, "50000.5", trades[0].Price.String())
+	assert.Equal(t, "poloniex", trades[0].Exchange)
+
+	assert.Equal(t, "1000", server.params[0]["param_start"])
+	assert.Equal(t, "5", server.params[0]["param_after"])
+	assert.Contains(t, server.queries[0], "FORMAT JSONEachRow")
+}
+
+func TestKlineRepository_GetLastKline(t *testing.T) {
+	server := &fakeServer{response: `{"exchange":"poloniex","pair":"BTC_USDT","interval":"MINUTE_1","open":"1","high":"3","low":"0.5","close":"2",` +
+		`"utc_begin":60000,"utc_end":120000,"buy_base":"1.5","sell_base":"2","buy_quote":"3","sell_quote":"4","trade_count":42,` +
+		`"vwap":"2","base_volume":"3.5","quote_volume":"7","first_trade_id":"100","last_trade_id":"141","is_closed":true}` + "\n"}
+	repo := NewKlineRepository(newTestClient(t, server))
+
+	kline, err := repo.GetLastKline(context.Background(), "BTC_USDT", "MINUTE_1")
+	require.NoError(t, err)
+	require.NotNil(t, kline)
+	assert.Equal(t, "MINUTE_1", kline.TimeFrame)
+	assert.Equal(t, "1.5", kline.VolumeBS.BuyBase.String())
+	assert.Equal(t, int64(42), kline.TradeCount)
+	assert.Equal(t, int64(120000), kline.EndDt.UnixMilli())
+	assert.True(t, kline.IsClosed)
+	assert.Contains(t, server.queries[0], "FROM klines FINAL")
+
+	server.response = ""
+	kline, err = repo.GetLastKline(context.Background(), "BTC_USDT", "MINUTE_1")
+	require.NoError(t, err)
+	assert.Nil(t, kline)
+}
+
+func TestKlineRepository_SaveKlinesException(t *testing.T) {
+	server := &fakeServer{status: http.StatusInternalServerError, response: "Code: 60. DB::Exception: Table market.klines does not exist."}
+	repo := NewKlineRepository(newTestClient(t, server))
+
+	err := repo.SaveKlines(context.Background(), []models.Kline{{Pair: "BTC_USDT", TimeFrame: "MINUTE_1"}})
+	var exception *Exception
+	require.ErrorAs(t, err, &exception)
+	assert.Contains(t, exception.Message, "does not exist")
+}
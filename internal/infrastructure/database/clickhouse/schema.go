@@ -0,0 +1,63 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+)
+
+// createTradesTable keeps every trade. Inserting a batch again, as the writers do
+// when a write has failed, is deduplicated by the server as long as the batch
+// is the same.
+const createTradesTable = `CREATE TABLE IF NOT EXISTS trades (
+    exchange LowCardinality(String),
+    pair LowCardinality(String),
+    tid String,
+    price Decimal(38, 18),
+    amount Decimal(38, 18),
+    quantity Decimal(38, 18),
+    side LowCardinality(String),
+    timestamp Int64,
+    created_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(fromUnixTimestamp64Milli(timestamp))
+ORDER BY (exchange, pair, timestamp, tid)
+SETTINGS non_replicated_deduplication_window = 1000`
+
+// createKlinesTable keeps the latest version of every candle, keyed like the
+// klines of Postgres: the versions of an open candle written on every flush
+// are replaced in the background and reads use FINAL.
+const createKlinesTable = `CREATE TABLE IF NOT EXISTS klines (
+    exchange LowCardinality(String),
+    pair LowCardinality(String),
+    interval LowCardinality(String),
+    open Decimal(38, 18),
+    high Decimal(38, 18),
+    low Decimal(38, 18),
+    close Decimal(38, 18),
+    utc_begin Int64,
+    utc_end Int64,
+    buy_base Decimal(38, 18),
+    sell_base Decimal(38, 18),
+    buy_quote Decimal(38, 18),
+    sell_quote Decimal(38, 18),
+    trade_count Int64,
+    vwap Decimal(38, 18),
+    base_volume Decimal(38, 18),
+    quote_volume Decimal(38, 18),
+    first_trade_id String,
+    last_trade_id String,
+    is_closed Bool,
+    version Int64
+) ENGINE = ReplacingMergeTree(version)
+PARTITION BY toYYYYMM(fromUnixTimestamp64Milli(utc_begin))
+ORDER BY (exchange, pair, interval, utc_begin)`
+
+// CreateTables creates the trades and klines tables unless they exist.
+func (c *Client) CreateTables(ctx context.Context) error {
+	for _, statement := range []string{createTradesTable, createKlinesTable} {
+		if err := c.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("create tables: %w", err)
+		}
+	}
+	return nil
+}
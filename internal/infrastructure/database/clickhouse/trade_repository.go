@@ -0,0 +1,127 @@
+package clickhouse
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+type tradeRow struct {
+	Exchange  string          `json:"exchange"`
+	Pair      string          `json:"pair"`
+	Tid       string          `json:"tid"`
+	Price     decimal.Decimal `json:"price"`
+	Amount    decimal.Decimal `json:"amount"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	Side      string          `json:"side"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+var tradeColumns = []string{"exchange", "pair", "tid", "price", "amount", "quantity", "side", "timestamp"}
+
+type TradeRepository struct {
+	client   *Client
+	metrics  *metrics.Metrics
+	exchange string
+}
+
+func NewTradeRepository(client *Client, opts ...Option) *TradeRepository {
+	o := newOptions(opts)
+	return &TradeRepository{
+		client:   client,
+		metrics:  o.metrics,
+		exchange: o.exchange,
+	}
+}
+
+func (r *TradeRepository) SaveTrade(ctx context.Context, trade models.RecentTrade) error {
+	return r.SaveTrades(ctx, []models.RecentTrade{trade})
+}
+
+// SaveTrades inserts the trades in one batch. ClickHouse stores the whole
+// batch or none of it.
+func (r *TradeRepository) SaveTrades(ctx context.Context, trades []models.RecentTrade) error {
+	defer r.metrics.ObserveDB("clickhouse_save_trades", time.Now())
+	if len(trades) == 0 {
+		return nil
+	}
+
+	rows := make([]tradeRow, len(trades))
+	for i, trade := range trades {
+		rows[i] = tradeRow{
+			Exchange:  r.exchange,
+			Pair:      trade.Pair,
+			Tid:       trade.Tid,
+			Price:     trade.Price,
+			Amount:    trade.Amount,
+			Quantity:  trade.Quantity,
+			Side:      trade.Side,
+			Timestamp: trade.Timestamp,
+		}
+	}
+	return insert(ctx, r.client, "trades", tradeColumns, rows)
+}
+
+// GetLastTradeTime returns the timestamp of the newest stored trade of the
+// pair, or 0 when there are none.
+func (r *TradeRepository) GetLastTradeTime(ctx context.Context, pair string) (int64, error) {
+	defer r.metrics.ObserveDB("clickhouse_get_last_trade_time", time.Now())
+	rows, err := query[struct {
+		Timestamp int64 `json:"timestamp"`
+	}](ctx, r.client,
+		`SELECT max(timestamp) AS timestamp FROM trades
+         WHERE exchange = {exchange:String} AND pair = {pair:String}`,
+		map[string]string{"exchange": r.exchange, "pair": pair})
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Timestamp, nil
+}
+
+// GetTradesByTimeRange reads the trades like the Postgres repository does.
+// A trade stored twice is returned once.
+func (r *TradeRepository) GetTradesByTimeRange(ctx context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error) {
+	defer r.metrics.ObserveDB("clickhouse_get_trades_by_time_range", time.Now())
+	rows, err := query[tradeRow](ctx, r.client,
+		`SELECT exchange, pair, tid, price, amount, quantity, side, timestamp
+         FROM trades
+         WHERE exchange = {exchange:String}
+           AND pair = {pair:String}
+           AND timestamp <= {end:Int64}
+           AND (timestamp > {start:Int64} OR (timestamp = {start:Int64} AND tid > {after:String}))
+         ORDER BY timestamp, tid
+         LIMIT 1 BY timestamp, tid
+         LIMIT {limit:UInt32}`,
+		map[string]string{
+			"exchange": r.exchange,
+			"pair":     pair,
+			"start":    strconv.FormatInt(startTime, 10),
+			"end":      strconv.FormatInt(endTime, 10),
+			"after":    afterTid,
+			"limit":    strconv.Itoa(limit),
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]models.RecentTrade, 0, len(rows))
+	for _, row := range rows {
+		trades = append(trades, models.RecentTrade{
+			Exchange:  r.exchange,
+			Tid:       row.Tid,
+			Pair:      row.Pair,
+			Symbol:    row.Pair,
+			Price:     row.Price,
+			Amount:    row.Amount,
+			Quantity:  row.Quantity,
+			Side:      row.Side,
+			Timestamp: row.Timestamp,
+		})
+	}
+	return trades, nil
+}
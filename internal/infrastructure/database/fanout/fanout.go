@@ -0,0 +1,173 @@
+// Package fanout writes trades and klines to several repositories at once.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/service"
+)
+
+// Sink is a repository writes are fanned out to, named in errors.
+type Sink[R any] struct {
+	Name       string
+	Repository R
+}
+
+// TradeRepository saves trades to the first sink and reads them from it. The
+// trades the first sink stored are queued for every other sink, which is
+// written by its own service.TradeWriter: a failing sink is retried alone,
+// and a sink never gets a trade again because another sink failed.
+type TradeRepository struct {
+	repository.TradeRepository
+	primary string
+	writers []sinkWriter
+}
+
+type sinkWriter struct {
+	name   string
+	writer *service.TradeWriter
+}
+
+// NewTradeRepository returns a repository over the sinks; it panics if there
+// are none. The options configure the writers of all but the first sink,
+// whose metrics are labelled with the stage "writer_<sink name>".
+func NewTradeRepository(sinks []Sink[repository.TradeRepository], opts ...service.TradeWriterOption) *TradeRepository {
+	if len(sinks) == 0 {
+		panic("fanout: no trade sinks")
+	}
+
+	r := &TradeRepository{TradeRepository: sinks[0].Repository, primary: sinks[0].Name}
+	for _, sink := range sinks[1:] {
+		sinkOpts := append([]service.TradeWriterOption{}, opts...)
+		sinkOpts = append(sinkOpts, service.WithWriterStage(metrics.StageWriter+"_"+sink.Name))
+		r.writers = append(r.writers, sinkWriter{
+			name:   sink.Name,
+			writer: service.NewTradeWriter(sink.Repository, sinkOpts...),
+		})
+	}
+	return r
+}
+
+func (r *TradeRepository) SaveTrade(ctx context.Context, trade models.RecentTrade) error {
+	return r.SaveTrades(ctx, []models.RecentTrade{trade})
+}
+
+// SaveTrades saves the trades to the first sink and queues the ones it
+// stored for the other sinks. Its errors are returned as they are, so the
+// caller retries only what the first sink did not store.
+func (r *TradeRepository) SaveTrades(ctx context.Context, trades []models.RecentTrade) error {
+	err := r.TradeRepository.SaveTrades(ctx, trades)
+	var rejected *repository.TradeWriteError
+	if err != nil && !errors.As(err, &rejected) {
+		return fmt.Errorf("%s: %w", r.primary, err)
+	}
+
+	stored := trades
+	if rejected != nil {
+		stored = without(trades, rejected.Failed)
+		err = fmt.Errorf("%s: %w", r.primary, err)
+	}
+	for _, w := range r.writers {
+		w.writer.Add(stored...)
+	}
+	return err
+}
+
+// Run writes the trades queued for the other sinks until ctx is cancelled.
+// The caller is expected to call Flush once more after it stops saving trades.
+func (r *TradeRepository) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, w := range r.writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.writer.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Flush writes the trades queued for the other sinks.
+func (r *TradeRepository) Flush(ctx context.Context) error {
+	var errs []error
+	for _, w := range r.writers {
+		if err := w.writer.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w, %d trades left", w.name, err, w.writer.Len()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// without returns the trades that are not listed in failed.
+func without(trades, failed []models.RecentTrade) []models.RecentTrade {
+	skip := make(map[string]struct{}, len(failed))
+	for _, trade := range failed {
+		skip[trade.Pair+"|"+trade.Tid] = struct{}{}
+	}
+
+	rest := make([]models.RecentTrade, 0, len(trades))
+	for _, trade := range trades {
+		if _, ok := skip[trade.Pair+"|"+trade.Tid]; !ok {
+			rest = append(rest, trade)
+		}
+	}
+	return rest
+}
+
+// KlineRepository saves klines to every sink and reads them from the first.
+type KlineRepository struct {
+	repository.KlineRepository
+	sinks []Sink[repository.KlineRepository]
+}
+
+// NewKlineRepository returns a repository over the sinks; it panics if there
+// are none.
+func NewKlineRepository(sinks ...Sink[repository.KlineRepository]) *KlineRepository {
+	if len(sinks) == 0 {
+		panic("fanout: no kline sinks")
+	}
+	return &KlineRepository{KlineRepository: sinks[0].Repository, sinks: sinks}
+}
+
+func (r *KlineRepository) SaveKline(ctx context.Context, kline models.Kline) error {
+	return r.SaveKlines(ctx, []models.Kline{kline})
+}
+
+// SaveKlines saves the klines to every sink, even if some of them fail.
+func (r *KlineRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	var errs []error
+	for _, sink := range r.sinks {
+		if err := sink.Repository.SaveKlines(ctx, klines); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// klineReplacer is a kline repository that can overwrite stored klines.
+type klineReplacer interface {
+	ReplaceKlines(ctx context.Context, klines []models.Kline) error
+}
+
+// ReplaceKlines overwrites the klines in every sink, even if some of them
+// fail. A sink that cannot overwrite klines fails.
+func (r *KlineRepository) ReplaceKlines(ctx context.Context, klines []models.Kline) error {
+	var errs []error
+	for _, sink := range r.sinks {
+		replacer, ok := sink.Repository.(klineReplacer)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: replacing klines is not supported", sink.Name))
+			continue
+		}
+		if err := replacer.ReplaceKlines(ctx, klines); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
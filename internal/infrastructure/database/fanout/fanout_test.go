@@ -0,0 +1,206 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/service"
+)
+
+type fakeTradeRepository struct {
+	repository.TradeRepository
+	saved    []models.RecentTrade
+	err      error
+	lastTime int64
+}
+
+func (r *fakeTradeRepository) SaveTrades(_ context.Context, trades []models.RecentTrade) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.saved = append(r.saved, trades...)
+	return nil
+}
+
+func (r *fakeTradeRepository) GetLastTradeTime(context.Context, string) (int64, error) {
+	return r.lastTime, nil
+}
+
+type fakeKlineRepository struct {
+	repository.KlineRepository
+	saved []models.Kline
+	err   error
+}
+
+func (r *fakeKlineRepository) SaveKlines(_ context.Context, klines []models.Kline) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.saved = append(r.saved, klines...)
+	return nil
+}
+
+var trades = []models.RecentTrade{
+	{Tid: "1", Pair: "BTC_USDT"},
+	{Tid: "2", Pair: "BTC_USDT"},
+}
+
+func TestTradeRepository_WritesEverySinkReadsFirst(t *testing.T) {
+	ctx := context.Background()
+	postgres := &fakeTradeRepository{lastTime: 1000}
+	clickhouse := &fakeTradeRepository{lastTime: 2000}
+	repo := NewTradeRepository([]Sink[repository.TradeRepository]{
+		{Name: "postgres", Repository: postgres},
+		{Name: "clickhouse", Repository: clickhouse},
+	})
+
+	require.NoError(t, repo.SaveTrades(ctx, trades))
+	assert.Equal(t, trades, postgres.saved)
+
+	// The other sinks are written by their own writers.
+	assert.Empty(t, clickhouse.saved)
+	require.NoError(t, repo.Flush(ctx))
+	assert.Equal(t, trades, clickhouse.saved)
+
+	last, err := repo.GetLastTradeTime(ctx, "BTC_USDT")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), last)
+}
+
+// rejectingTradeRepository stores every trade but the one with tid reject.
+type rejectingTradeRepository struct {
+	fakeTradeRepository
+	reject string
+}
+
+func (r *rejectingTradeRepository) SaveTrades(_ context.Context, trades []models.RecentTrade) error {
+	rejected := &repository.TradeWriteError{}
+	for _, trade := range trades {
+		if trade.Tid == r.reject {
+			rejected.Failed = append(rejected.Failed, trade)
+			rejected.Err = errors.New("value too long")
+			continue
+		}
+		r.saved = append(r.saved, trade)
+	}
+	if len(rejected.Failed) > 0 {
+		return rejected
+	}
+	return nil
+}
+
+func TestTradeRepository_RetriesOnlyFailingSinks(t *testing.T) {
+	ctx := context.Background()
+	postgres := &rejectingTradeRepository{reject: "2"}
+	clickhouse := &fakeTradeRepository{}
+	repo := NewTradeRepository([]Sink[repository.TradeRepository]{
+		{Name: "postgres", Repository: postgres},
+		{Name: "clickhouse", Repository: clickhouse},
+	})
+	writer := service.NewTradeWriter(repo)
+
+	writer.Add(trades...)
+	var writeErr *repository.TradeWriteError
+	require.ErrorAs(t, writer.Flush(ctx), &writeErr)
+	assert.Equal(t, trades[1:], writeErr.Failed)
+
+	// The rejected trade is retried until it is stored.
+	postgres.reject = ""
+	require.NoError(t, writer.Flush(ctx))
+	require.NoError(t, repo.Flush(ctx))
+
+	assert.Equal(t, trades, postgres.saved)
+	assert.ElementsMatch(t, trades, clickhouse.saved, "no trade may reach a sink twice")
+}
+
+func TestTradeRepository_FailingSinkIsRetriedAlone(t *testing.T) {
+	ctx := context.Background()
+	unavailable := errors.New("connection refused")
+	postgres := &fakeTradeRepository{}
+	clickhouse := &fakeTradeRepository{err: unavailable}
+	repo := NewTradeRepository([]Sink[repository.TradeRepository]{
+		{Name: "postgres", Repository: postgres},
+		{Name: "clickhouse", Repository: clickhouse},
+	})
+
+	require.NoError(t, repo.SaveTrades(ctx, trades))
+	assert.ErrorIs(t, repo.Flush(ctx), unavailable)
+
+	clickhouse.err = nil
+	require.NoError(t, repo.Flush(ctx))
+	assert.Equal(t, trades, postgres.saved)
+	assert.Equal(t, trades, clickhouse.saved)
+}
+
+func TestTradeRepository_FirstSinkUnavailable(t *testing.T) {
+	ctx := context.Background()
+	unavailable := errors.New("connection refused")
+	clickhouse := &fakeTradeRepository{}
+	repo := NewTradeRepository([]Sink[repository.TradeRepository]{
+		{Name: "postgres", Repository: &fakeTradeRepository{err: unavailable}},
+		{Name: "clickhouse", Repository: clickhouse},
+	})
+
+	// Nothing is queued for the other sinks until the first one stored it.
+	err := repo.SaveTrades(ctx, trades)
+	assert.ErrorIs(t, err, unavailable)
+	assert.ErrorContains(t, err, "postgres: connection refused")
+	require.NoError(t, repo.Flush(ctx))
+	assert.Empty(t, clickhouse.saved)
+}
+
+func TestKlineRepository_WritesEverySink(t *testing.T) {
+	ctx := context.Background()
+	postgres := &fakeKlineRepository{err: errors.New("connection refused")}
+	clickhouse := &fakeKlineRepository{}
+	repo := NewKlineRepository(
+		Sink[repository.KlineRepository]{Name: "postgres", Repository: postgres},
+		Sink[repository.KlineRepository]{Name: "clickhouse", Repository: clickhouse},
+	)
+
+	klines := []models.Kline{{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: 60000}}
+	err := repo.SaveKlines(ctx, klines)
+	assert.ErrorContains(t, err, "postgres: connection refused")
+	assert.Equal(t, klines, clickhouse.saved)
+}
+
+type replacingKlineRepository struct {
+	fakeKlineRepository
+	replaced []models.Kline
+}
+
+func (r *replacingKlineRepository) ReplaceKlines(_ context.Context, klines []models.Kline) error {
+	r.replaced = append(r.replaced, klines...)
+	return nil
+}
+
+func TestKlineRepository_ReplacesInEverySink(t *testing.T) {
+	ctx := context.Background()
+	postgres := &replacingKlineRepository{}
+	clickhouse := &replacingKlineRepository{}
+	repo := NewKlineRepository(
+		Sink[repository.KlineRepository]{Name: "postgres", Repository: postgres},
+		Sink[repository.KlineRepository]{Name: "clickhouse", Repository: clickhouse},
+	)
+
+	klines := []models.Kline{{Pair: "BTC_USDT", TimeFrame: "HOUR_1", UtcBegin: 3600000}}
+	require.NoError(t, repo.ReplaceKlines(ctx, klines))
+	assert.Equal(t, klines, postgres.replaced)
+	assert.Equal(t, klines, clickhouse.replaced)
+	assert.Empty(t, postgres.saved)
+
+	// A sink that can only save klines is not written as if it replaced them.
+	plain := &fakeKlineRepository{}
+	repo = NewKlineRepository(
+		Sink[repository.KlineRepository]{Name: "postgres", Repository: postgres},
+		Sink[repository.KlineRepository]{Name: "spool", Repository: plain},
+	)
+	assert.ErrorContains(t, repo.ReplaceKlines(ctx, klines), "spool: replacing klines is not supported")
+	assert.Empty(t, plain.saved)
+}
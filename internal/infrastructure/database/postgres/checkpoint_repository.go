@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+type CheckpointRepository struct {
+	pool     *pgxpool.Pool
+	metrics  *metrics.Metrics
+	exchange string
+}
+
+func NewCheckpointRepository(pool *pgxpool.Pool, opts ...Option) *CheckpointRepository {
+	o := newOptions(opts)
+	return &CheckpointRepository{
+		pool:     pool,
+		metrics:  o.metrics,
+		exchange: o.exchange,
+	}
+}
+
+func (r *CheckpointRepository) GetCheckpoint(ctx context.Context, pair, timeframe string) (*models.BackfillCheckpoint, error) {
+	defer r.metrics.ObserveDB("get_checkpoint", time.Now())
+	checkpoint := models.BackfillCheckpoint{Pair: pair, TimeFrame: timeframe}
+
+	err := r.pool.QueryRow(ctx,
+		`SELECT start_time, done_until
+         FROM backfill_checkpoints
+         WHERE exchange = $1 AND pair = $2 AND interval = $3`,
+		r.exchange, pair, timeframe).Scan(&checkpoint.StartTime, &checkpoint.DoneUntil)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+func (r *CheckpointRepository) SaveCheckpoint(ctx context.Context, checkpoint models.BackfillCheckpoint) error {
+	defer r.metrics.ObserveDB("save_checkpoint", time.Now())
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO backfill_checkpoints (exchange, pair, interval, start_time, done_until, updated_at)
+         VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+         ON CONFLICT (exchange, pair, interval)
+         DO UPDATE SET
+            start_time = EXCLUDED.start_time,
+            done_until = EXCLUDED.done_until,
+            updated_at = EXCLUDED.updated_at`,
+		r.exchange, checkpoint.Pair, checkpoint.TimeFrame, checkpoint.StartTime, checkpoint.DoneUntil)
+	return err
+}
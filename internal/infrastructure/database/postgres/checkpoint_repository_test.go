@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/test/integration"
+)
+
+func TestCheckpointRepository_SaveAndGetCheckpoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewCheckpointRepository(container.Pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	checkpoint, err := repo.GetCheckpoint(ctx, "BTC_USDT", "MINUTE_1")
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	saved := models.BackfillCheckpoint{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", StartTime: 1000, DoneUntil: 2000}
+	require.NoError(t, repo.SaveCheckpoint(ctx, saved))
+
+	saved.DoneUntil = 3000
+	require.NoError(t, repo.SaveCheckpoint(ctx, saved))
+
+	checkpoint, err = repo.GetCheckpoint(ctx, "BTC_USDT", "MINUTE_1")
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	assert.Equal(t, saved, *checkpoint)
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/puddle"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+)
+
+// Unavailable reports whether err means that the database could not be
+// reached or refused to work, as opposed to rejecting the data or the query.
+// Retrying the same write later may succeed in the first case only, so
+// errors that are not known to be an outage, e.g. failing to encode a value,
+// count as a rejection.
+func Unavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var rejected *repository.TradeWriteError
+	if errors.As(err, &rejected) {
+		return false
+	}
+
+	// pgconn does not export its connect error, which also wraps the
+	// server's refusal to accept the connection.
+	if strings.Contains(err.Error(), "failed to connect to") {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions, insufficient resources and operator
+		// intervention such as a shutdown.
+		return strings.HasPrefix(pgErr.Code, "08") ||
+			strings.HasPrefix(pgErr.Code, "53") ||
+			strings.HasPrefix(pgErr.Code, "57P")
+	}
+
+	// Errors of a connection that failed before the query was sent, e.g. a
+	// closed connection.
+	var retry interface{ SafeToRetry() bool }
+	if errors.As(err, &retry) && retry.SafeToRetry() {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		pgconn.Timeout(err) ||
+		errors.Is(err, puddle.ErrClosedPool) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/puddle"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+)
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"connect", errors.New("failed to connect to `host=localhost user=collector database=market`: server error"), true},
+		{"deadline", fmt.Errorf("save: %w", context.DeadlineExceeded), true},
+		{"closed pool", puddle.ErrClosedPool, true},
+		{"connection lost", fmt.Errorf("receive message: %w", io.ErrUnexpectedEOF), true},
+		{"encode", errors.New("cannot encode status undefined into binary format"), false},
+		{"cancelled", fmt.Errorf("save: %w", context.Canceled), false},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"value too long", &pgconn.PgError{Code: "22001"}, false},
+		{"rejected trades", &repository.TradeWriteError{Err: errors.New("value too long")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Unavailable(tt.err))
+		})
+	}
+}
@@ -5,54 +5,149 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
 )
 
 type KlineRepository struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	metrics  *metrics.Metrics
+	exchange string
+	// source is the relation klines are read from.
+	source string
 }
 
-func NewKlineRepository(pool *pgxpool.Pool) *KlineRepository {
+func NewKlineRepository(pool *pgxpool.Pool, opts ...Option) *KlineRepository {
+	o := newOptions(opts)
+	source := klinesTable
+	if o.timescale {
+		source = klinesTimescaleView
+	}
 	return &KlineRepository{
-		pool: pool,
+		pool:     pool,
+		metrics:  o.metrics,
+		exchange: o.exchange,
+		source:   source,
 	}
 }
 
+const upsertKlineQuery = `INSERT INTO klines (pair, interval, open, high, low, close, utc_begin, utc_end, volume_bs, begin_dt, end_dt, exchange,
+                            trade_count, vwap, base_volume, quote_volume, first_trade_id, last_trade_id, is_closed)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+         ON CONFLICT (exchange, pair, interval, utc_begin) 
+         DO UPDATE SET
+            high = GREATEST(klines.high, $4),
+            low = LEAST(klines.low, $5),
+            close = $6,
+            volume_bs = $9,
+            trade_count = $13,
+            vwap = $14,
+            base_volume = $15,
+            quote_volume = $16,
+            first_trade_id = $17,
+            last_trade_id = $18,
+            is_closed = $19`
+
+// replaceKlineQuery overwrites a stored candle entirely, unlike
+// upsertKlineQuery, which merges the live states of one candle.
+const replaceKlineQuery = `INSERT INTO klines (pair, interval, open, high, low, close, utc_begin, utc_end, volume_bs, begin_dt, end_dt, exchange,
+                            trade_count, vwap, base_volume, quote_volume, first_trade_id, last_trade_id, is_closed)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+         ON CONFLICT (exchange, pair, interval, utc_begin)
+         DO UPDATE SET
+            open = EXCLUDED.open,
+            high = EXCLUDED.high,
+            low = EXCLUDED.low,
+            close = EXCLUDED.close,
+            utc_end = EXCLUDED.utc_end,
+            volume_bs = EXCLUDED.volume_bs,
+            begin_dt = EXCLUDED.begin_dt,
+            end_dt = EXCLUDED.end_dt,
+            trade_count = EXCLUDED.trade_count,
+            vwap = EXCLUDED.vwap,
+            base_volume = EXCLUDED.base_volume,
+            quote_volume = EXCLUDED.quote_volume,
+            first_trade_id = EXCLUDED.first_trade_id,
+            last_trade_id = EXCLUDED.last_trade_id,
+            is_closed = EXCLUDED.is_closed`
+
 func (r *KlineRepository) SaveKline(ctx context.Context, kline models.Kline) error {
+	defer r.metrics.ObserveDB("save_kline", time.Now())
 	log.Printf("Saving kline in repository: Pair=%s, Timeframe=%s, UtcBegin=%d", kline.Pair, kline.TimeFrame, kline.UtcBegin)
 	volumeBSJson, err := json.Marshal(kline.VolumeBS)
 	if err != nil {
 		return err
 	}
 
-	_, err = r.pool.Exec(ctx,
-		`INSERT INTO klines (pair, interval, open, high, low, close, utc_begin, utc_end, volume_bs, begin_dt, end_dt)
-         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-         ON CONFLICT (pair, interval, utc_begin) 
-         DO UPDATE SET
-            high = GREATEST(klines.high, $4),
-            low = LEAST(klines.low, $5),
-            close = $6,
-            volume_bs = $9`,
+	_, err = r.pool.Exec(ctx, upsertKlineQuery,
 		kline.Pair, kline.TimeFrame, kline.O, kline.H, kline.L, kline.C,
-		kline.UtcBegin, kline.UtcEnd, volumeBSJson, kline.BeginDt, kline.EndDt)
+		kline.UtcBegin, kline.UtcEnd, volumeBSJson, kline.BeginDt, kline.EndDt, r.exchange,
+		kline.TradeCount, kline.VWAP, kline.BaseVolume, kline.QuoteVolume,
+		kline.FirstTradeID, kline.LastTradeID, kline.IsClosed)
 
 	return err
 }
 
+func (r *KlineRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	defer r.metrics.ObserveDB("save_klines", time.Now())
+	log.Printf("Saving %d klines in repository", len(klines))
+	return r.saveKlines(ctx, upsertKlineQuery, klines)
+}
+
+// ReplaceKlines stores the klines over the stored ones, e.g. candles rebuilt
+// or loaded again from the exchange, which must not be merged with wrong
+// stored values.
+func (r *KlineRepository) ReplaceKlines(ctx context.Context, klines []models.Kline) error {
+	defer r.metrics.ObserveDB("replace_klines", time.Now())
+	log.Printf("Replacing %d klines in repository", len(klines))
+	return r.saveKlines(ctx, replaceKlineQuery, klines)
+}
+
+func (r *KlineRepository) saveKlines(ctx context.Context, query string, klines []models.Kline) error {
+	batch := &pgx.Batch{}
+
+	for _, kline := range klines {
+		volumeBSJson, err := json.Marshal(kline.VolumeBS)
+		if err != nil {
+			return err
+		}
+
+		batch.Queue(query,
+			kline.Pair, kline.TimeFrame, kline.O, kline.H, kline.L, kline.C,
+			kline.UtcBegin, kline.UtcEnd, volumeBSJson, kline.BeginDt, kline.EndDt, r.exchange,
+			kline.TradeCount, kline.VWAP, kline.BaseVolume, kline.QuoteVolume,
+			kline.FirstTradeID, kline.LastTradeID, kline.IsClosed)
+	}
+
+	br := r.pool.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for _, kline := range klines {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("save kline %s %s %d: %w", kline.Pair, kline.TimeFrame, kline.UtcBegin, err)
+		}
+	}
+
+	return nil
+}
+
 func (r *KlineRepository) GetKlineByInterval(ctx context.Context, pair, timeframe string, beginTime int64) (*models.Kline, error) {
+	defer r.metrics.ObserveDB("get_kline_by_interval", time.Now())
 	var kline models.Kline
 	log.Printf("Getting kline by interval in repository: Pair=%s, Timeframe=%s, BeginTime=%d", pair, timeframe, beginTime)
 
 	query := `SELECT id, pair, "interval", "open", high, low, "close", utc_begin, utc_end, volume_bs, created_at, updated_at
               FROM klines 
-              WHERE pair = $1 AND interval = $2 AND utc_begin >= $3`
+              WHERE exchange = $4 AND pair = $1 AND interval = $2 AND utc_begin >= $3`
 
-	err := r.pool.QueryRow(ctx, query, pair, timeframe, beginTime).Scan(
+	err := r.pool.QueryRow(ctx, query, pair, timeframe, beginTime, r.exchange).Scan(
 		&kline.Pair, &kline.TimeFrame, &kline.O, &kline.H, &kline.L, &kline.C,
 		&kline.UtcBegin, &kline.UtcEnd,
 		&kline.VolumeBS.BuyBase, &kline.VolumeBS.SellBase,
@@ -68,13 +163,14 @@ func (r *KlineRepository) GetKlineByInterval(ctx context.Context, pair, timefram
 		return nil, err
 	}
 
+	kline.Exchange = r.exchange
 	return &kline, nil
 }
 
 // count in table
 func (r *KlineRepository) CountKlines(ctx context.Context) (int, error) {
 	var count int
-	err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM klines").Scan(&count)
+	err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM klines WHERE exchange = $1", r.exchange).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -82,18 +178,20 @@ func (r *KlineRepository) CountKlines(ctx context.Context) (int, error) {
 }
 
 func (r *KlineRepository) GetLastKline(ctx context.Context, pair, timeframe string) (*models.Kline, error) {
+	defer r.metrics.ObserveDB("get_last_kline", time.Now())
 	var kline models.Kline
 	var volumeBSJson []byte
 	log.Printf("Getting last kline in repository: Pair=%s, Timeframe=%s", pair, timeframe)
 
 	err := r.pool.QueryRow(ctx,
 		`SELECT pair, interval, open, high, low, close, 
-                utc_begin, utc_end, volume_bs
-         FROM klines
-         WHERE pair = $1 AND interval = $2
+                utc_begin, utc_end, volume_bs, trade_count, vwap,
+                base_volume, quote_volume, first_trade_id, last_trade_id, is_closed
+         FROM `+r.source+`
+         WHERE exchange = $3 AND pair = $1 AND interval = $2
          ORDER BY utc_begin DESC
          LIMIT 1`,
-		pair, timeframe).Scan(
+		pair, timeframe, r.exchange).Scan(
 		&kline.Pair,
 		&kline.TimeFrame,
 		&kline.O,
@@ -102,7 +200,67 @@ func (r *KlineRepository) GetLastKline(ctx context.Context, pair, timeframe stri
 		&kline.C,
 		&kline.UtcBegin,
 		&kline.UtcEnd,
-		&volumeBSJson)
+		&volumeBSJson,
+		&kline.TradeCount,
+		&kline.VWAP,
+		&kline.BaseVolume,
+		&kline.QuoteVolume,
+		&kline.FirstTradeID,
+		&kline.LastTradeID,
+		&kline.IsClosed)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(volumeBSJson, &kline.VolumeBS); err != nil {
+		return nil, err
+	}
+
+	kline.Exchange = r.exchange
+	return &kline, nil
+}
+
+// GetLastKlineBefore returns the latest kline that begins before the given
+// time, or nil when there is none.
+func (r *KlineRepository) GetLastKlineBefore(ctx context.Context, pair, timeframe string, before int64) (*models.Kline, error) {
+	defer r.metrics.ObserveDB("get_last_kline_before", time.Now())
+	var kline models.Kline
+	var volumeBSJson []byte
+
+	err := r.pool.QueryRow(ctx,
+		`SELECT pair, interval, open, high, low, close,
+                utc_begin, utc_end, volume_bs, trade_count, vwap,
+                base_volume, quote_volume, first_trade_id, last_trade_id, is_closed
+         FROM `+r.source+`
+         WHERE exchange = $4 AND pair = $1 AND interval = $2 AND utc_begin < $3
+         ORDER BY utc_begin DESC
+         LIMIT 1`,
+		pair, timeframe, before, r.exchange).Scan(
+		&kline.Pair,
+		&kline.TimeFrame,
+		&kline.O,
+		&kline.H,
+		&kline.L,
+		&kline.C,
+		&kline.UtcBegin,
+		&kline.UtcEnd,
+		&volumeBSJson,
+		&kline.TradeCount,
+		&kline.VWAP,
+		&kline.BaseVolume,
+		&kline.QuoteVolume,
+		&kline.FirstTradeID,
+		&kline.LastTradeID,
+		&kline.IsClosed)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
 
 	if err != nil {
 		return nil, err
@@ -112,20 +270,24 @@ func (r *KlineRepository) GetLastKline(ctx context.Context, pair, timeframe stri
 		return nil, err
 	}
 
+	kline.Exchange = r.exchange
 	return &kline, nil
 }
 
 func (r *KlineRepository) GetKlinesByTimeRange(ctx context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error) {
+	defer r.metrics.ObserveDB("get_klines_by_time_range", time.Now())
 	rows, err := r.pool.Query(ctx,
 		`SELECT pair, interval, open, high, low, close, 
-                utc_begin, utc_end, volume_bs
-         FROM klines
-         WHERE pair = $1 
+                utc_begin, utc_end, begin_dt, end_dt, volume_bs, trade_count, vwap,
+                base_volume, quote_volume, first_trade_id, last_trade_id, is_closed
+         FROM `+r.source+`
+         WHERE exchange = $5
+           AND pair = $1
            AND interval = $2 
            AND utc_begin >= $3 
            AND utc_end <= $4
          ORDER BY utc_begin`,
-		pair, timeframe, startTime, endTime)
+		pair, timeframe, startTime, endTime, r.exchange)
 	if err != nil {
 		return nil, err
 	}
@@ -145,7 +307,16 @@ func (r *KlineRepository) GetKlinesByTimeRange(ctx context.Context, pair, timefr
 			&kline.C,
 			&kline.UtcBegin,
 			&kline.UtcEnd,
-			&volumeBSJson); err != nil {
+			&kline.BeginDt,
+			&kline.EndDt,
+			&volumeBSJson,
+			&kline.TradeCount,
+			&kline.VWAP,
+			&kline.BaseVolume,
+			&kline.QuoteVolume,
+			&kline.FirstTradeID,
+			&kline.LastTradeID,
+			&kline.IsClosed); err != nil {
 			return nil, err
 		}
 
@@ -153,6 +324,7 @@ func (r *KlineRepository) GetKlinesByTimeRange(ctx context.Context, pair, timefr
 			return nil, err
 		}
 
+		kline.Exchange = r.exchange
 		klines = append(klines, kline)
 	}
 
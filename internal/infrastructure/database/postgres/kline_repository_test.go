@@ -6,10 +6,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/service"
 	"github.com/Zmey56/poloniex-collector/test/integration"
 )
 
@@ -27,18 +30,25 @@ func TestKlineRepository_SaveAndGetKline(t *testing.T) {
 	kline := models.Kline{
 		Pair:      "BTC_USDT",
 		TimeFrame: "1m",
-		O:         50000.0,
-		H:         51000.0,
-		L:         49000.0,
-		C:         50500.0,
+		O:         decimal.NewFromInt(50000),
+		H:         decimal.NewFromInt(51000),
+		L:         decimal.NewFromInt(49000),
+		C:         decimal.NewFromInt(50500),
 		UtcBegin:  time.Now().Truncate(time.Second).Unix(),
 		UtcEnd:    time.Now().Add(time.Minute).Truncate(time.Second).Unix(),
 		VolumeBS: models.VBS{
-			BuyBase:   1.5,
-			SellBase:  2.0,
-			BuyQuote:  75000.0,
-			SellQuote: 100000.0,
+			BuyBase:   decimal.RequireFromString("1.5"),
+			SellBase:  decimal.NewFromInt(2),
+			BuyQuote:  decimal.NewFromInt(75000),
+			SellQuote: decimal.NewFromInt(100000),
 		},
+		TradeCount:   42,
+		VWAP:         decimal.RequireFromString("50285.71428571"),
+		BaseVolume:   decimal.RequireFromString("3.5"),
+		QuoteVolume:  decimal.NewFromInt(175000),
+		FirstTradeID: "100",
+		LastTradeID:  "141",
+		IsClosed:     true,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -55,11 +65,18 @@ func TestKlineRepository_SaveAndGetKline(t *testing.T) {
 
 	assert.Equal(t, kline.Pair, savedKline.Pair)
 	assert.Equal(t, kline.TimeFrame, savedKline.TimeFrame)
-	assert.Equal(t, kline.O, savedKline.O)
-	assert.Equal(t, kline.H, savedKline.H)
-	assert.Equal(t, kline.L, savedKline.L)
-	assert.Equal(t, kline.C, savedKline.C)
+	assert.Equal(t, kline.O.String(), savedKline.O.String())
+	assert.Equal(t, kline.H.String(), savedKline.H.String())
+	assert.Equal(t, kline.L.String(), savedKline.L.String())
+	assert.Equal(t, kline.C.String(), savedKline.C.String())
 	assert.Equal(t, kline.VolumeBS, savedKline.VolumeBS)
+	assert.Equal(t, kline.TradeCount, savedKline.TradeCount)
+	assert.Equal(t, kline.VWAP.String(), savedKline.VWAP.String())
+	assert.Equal(t, kline.BaseVolume.String(), savedKline.BaseVolume.String())
+	assert.Equal(t, kline.QuoteVolume.String(), savedKline.QuoteVolume.String())
+	assert.Equal(t, kline.FirstTradeID, savedKline.FirstTradeID)
+	assert.Equal(t, kline.LastTradeID, savedKline.LastTradeID)
+	assert.True(t, savedKline.IsClosed)
 }
 
 func TestKlineRepository_GetKlinesByTimeRange(t *testing.T) {
@@ -111,21 +128,105 @@ func TestKlineRepository_GetKlinesByTimeRange(t *testing.T) {
 	assert.Len(t, result, 3)
 }
 
+func TestKlineRepository_GetLastKlineBefore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewKlineRepository(container.Pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repo.SaveKline(ctx, createTestKline("BTC_USDT", "1m", base.Add(time.Duration(i)*time.Minute))))
+	}
+
+	kline, err := repo.GetLastKlineBefore(ctx, "BTC_USDT", "1m", base.Add(2*time.Minute).Unix())
+	require.NoError(t, err)
+	require.NotNil(t, kline)
+	assert.Equal(t, base.Add(time.Minute).Unix(), kline.UtcBegin)
+
+	kline, err = repo.GetLastKlineBefore(ctx, "BTC_USDT", "1m", base.Unix())
+	require.NoError(t, err)
+	assert.Nil(t, kline)
+}
+
 func createTestKline(pair, timeframe string, timestamp time.Time) models.Kline {
 	return models.Kline{
 		Pair:      pair,
 		TimeFrame: timeframe,
-		O:         50000.0,
-		H:         51000.0,
-		L:         49000.0,
-		C:         50500.0,
+		O:         decimal.NewFromInt(50000),
+		H:         decimal.NewFromInt(51000),
+		L:         decimal.NewFromInt(49000),
+		C:         decimal.NewFromInt(50500),
 		UtcBegin:  timestamp.Unix(),
 		UtcEnd:    timestamp.Add(time.Minute).Unix(),
 		VolumeBS: models.VBS{
-			BuyBase:   1.5,
-			SellBase:  2.0,
-			BuyQuote:  75000.0,
-			SellQuote: 100000.0,
+			BuyBase:   decimal.RequireFromString("1.5"),
+			SellBase:  decimal.NewFromInt(2),
+			BuyQuote:  decimal.NewFromInt(75000),
+			SellQuote: decimal.NewFromInt(100000),
 		},
 	}
 }
+
+func TestKlineRepository_RecomputeReplacesWrongKline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewKlineRepository(container.Pool)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+
+	// A stored hour that is wrong in every field, including the ones the
+	// live upsert only widens or never changes.
+	wrong := models.Kline{
+		Pair: "BTC_USDT", TimeFrame: "HOUR_1",
+		O: decimal.NewFromInt(1), H: decimal.NewFromInt(999), L: decimal.RequireFromString("0.5"), C: decimal.NewFromInt(1),
+		UtcBegin: start, UtcEnd: start + 60*minute,
+		TradeCount: 1000, BaseVolume: decimal.NewFromInt(1000), QuoteVolume: decimal.NewFromInt(1000),
+		FirstTradeID: "1", LastTradeID: "1000",
+	}
+	require.NoError(t, repo.SaveKlines(ctx, []models.Kline{wrong}))
+
+	var minutes []models.Kline
+	for i := int64(0); i < 60; i++ {
+		price := decimal.NewFromInt(100 + i)
+		minutes = append(minutes, models.Kline{
+			Pair: "BTC_USDT", TimeFrame: "MINUTE_1",
+			O: price, H: price.Add(decimal.NewFromInt(1)), L: price.Sub(decimal.NewFromInt(1)), C: price,
+			UtcBegin: start + i*minute, UtcEnd: start + (i+1)*minute,
+			TradeCount: 2, BaseVolume: decimal.NewFromInt(1), QuoteVolume: price,
+			IsClosed: true,
+		})
+	}
+	require.NoError(t, repo.SaveKlines(ctx, minutes))
+
+	require.NoError(t, service.RecomputeTimeFrames(ctx, repo, "BTC_USDT",
+		timeframe.MustParseList([]string{"1h"}), start, start+60*minute))
+
+	hours, err := repo.GetKlinesByTimeRange(ctx, "BTC_USDT", "HOUR_1", start, start+60*minute)
+	require.NoError(t, err)
+	require.Len(t, hours, 1)
+	assert.Equal(t, "100", hours[0].O.String())
+	assert.Equal(t, "160", hours[0].H.String())
+	assert.Equal(t, "99", hours[0].L.String())
+	assert.Equal(t, "159", hours[0].C.String())
+	assert.Equal(t, int64(120), hours[0].TradeCount)
+	assert.Equal(t, "60", hours[0].BaseVolume.String())
+	assert.True(t, hours[0].IsClosed)
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+// DefaultExchange is the exchange repositories are scoped to unless
+// WithExchange says otherwise. The data stored before the exchange column
+// was added belongs to it.
+const DefaultExchange = "poloniex"
+
+type options struct {
+	metrics   *metrics.Metrics
+	exchange  string
+	timescale bool
+}
+
+type Option func(*options)
+
+// WithExchange scopes a repository to the data of one exchange: everything
+// it saves is stored under the exchange and only the data of the exchange is
+// read back.
+func WithExchange(exchange string) Option {
+	return func(o *options) {
+		if exchange != "" {
+			o.exchange = exchange
+		}
+	}
+}
+
+// WithMetrics sets the metrics used to record database operation latency.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{exchange: DefaultExchange}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// MonitorPool reports the number of open pool connections every interval until ctx is cancelled.
+func MonitorPool(ctx context.Context, pool *pgxpool.Pool, m *metrics.Metrics, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.SetDBConnections(pool.Stat().TotalConns())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
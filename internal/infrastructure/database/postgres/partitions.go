@@ -0,0 +1,324 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// tradePartitionLayout names the monthly partitions of trades created by the
+// migrations in migrations/partitioned, e.g. trades_y2025m04.
+const tradePartitionLayout = "trades_y2006m01"
+
+const (
+	defaultPremakeMonths     = 3
+	defaultPartitionInterval = time.Hour
+)
+
+// tradePartition is the partition of trades holding one calendar month (UTC).
+type tradePartition struct {
+	name  string
+	month time.Time
+}
+
+func monthlyPartition(t time.Time) tradePartition {
+	t = t.UTC()
+	month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return tradePartition{name: month.Format(tradePartitionLayout), month: month}
+}
+
+func parseTradePartition(name string) (tradePartition, bool) {
+	month, err := time.Parse(tradePartitionLayout, name)
+	if err != nil {
+		return tradePartition{}, false
+	}
+	return tradePartition{name: name, month: month}, true
+}
+
+// from and to are the partition bounds in unix milliseconds, to exclusive.
+func (p tradePartition) from() int64 { return p.month.UnixMilli() }
+func (p tradePartition) to() int64   { return p.month.AddDate(0, 1, 0).UnixMilli() }
+
+// TradesPartitioned reports whether trades is partitioned by the migrations
+// in migrations/partitioned, which leave it without partitions for the months
+// after the next two unless TradePartitions runs. Until then the trades of
+// those months pile up in the default partition.
+func TradesPartitioned(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var partitioned bool
+	err := pool.QueryRow(ctx, `SELECT relkind = 'p' FROM pg_class WHERE oid = 'trades'::regclass`).Scan(&partitioned)
+	return partitioned, err
+}
+
+// TradePartitions keeps the monthly partitions of trades: it creates the
+// partitions of the coming months ahead of time and drops or detaches the
+// ones older than the retention period.
+type TradePartitions struct {
+	pool          *pgxpool.Pool
+	premakeMonths int
+	retention     int
+	detach        bool
+	interval      time.Duration
+}
+
+type TradePartitionsOption func(*TradePartitions)
+
+// WithPremakeMonths sets how many months after the current one get their
+// partitions in advance.
+func WithPremakeMonths(months int) TradePartitionsOption {
+	return func(p *TradePartitions) {
+		if months > 0 {
+			p.premakeMonths = months
+		}
+	}
+}
+
+// WithRetentionMonths sets how many full months before the current one are
+// kept. Older partitions are dropped, or detached with WithDetach. Zero,
+// the default, keeps every partition.
+func WithRetentionMonths(months int) TradePartitionsOption {
+	return func(p *TradePartitions) {
+		if months > 0 {
+			p.retention = months
+		}
+	}
+}
+
+// WithDetach makes expired partitions detached from trades instead of
+// dropped, so that they can be archived.
+func WithDetach(detach bool) TradePartitionsOption {
+	return func(p *TradePartitions) {
+		p.detach = detach
+	}
+}
+
+// WithMaintenanceInterval sets how often Run checks the partitions.
+func WithMaintenanceInterval(interval time.Duration) TradePartitionsOption {
+	return func(p *TradePartitions) {
+		if interval > 0 {
+			p.interval = interval
+		}
+	}
+}
+
+func NewTradePartitions(pool *pgxpool.Pool, opts ...TradePartitionsOption) *TradePartitions {
+	p := &TradePartitions{
+		pool:          pool,
+		premakeMonths: defaultPremakeMonths,
+		interval:      defaultPartitionInterval,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Run maintains the partitions at once and then every maintenance interval
+// until ctx is cancelled.
+func (p *TradePartitions) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Maintain(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to maintain trade partitions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain moves the trades of the default partition into monthly
+// partitions, creates the partitions from the month of now up to the premade
+// months and removes the expired ones.
+func (p *TradePartitions) Maintain(ctx context.Context, now time.Time) error {
+	existing, err := p.partitions(ctx)
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+
+	defaultPartition, err := p.defaultPartition(ctx)
+	if err != nil {
+		return fmt.Errorf("find default partition: %w", err)
+	}
+	if defaultPartition != "" {
+		months, err := p.defaultMonths(ctx, defaultPartition)
+		if err != nil {
+			return fmt.Errorf("list months of %s: %w", defaultPartition, err)
+		}
+		for _, month := range months {
+			partition := monthlyPartition(month)
+			if _, ok := existing[partition.name]; ok {
+				// Only trades of months without a partition get into the default one.
+				continue
+			}
+			moved, err := p.split(ctx, partition, defaultPartition)
+			if err != nil {
+				return fmt.Errorf("split partition %s from %s: %w", partition.name, defaultPartition, err)
+			}
+			existing[partition.name] = partition
+			log.Printf("Created trade partition %s with %d trades from %s", partition.name, moved, defaultPartition)
+		}
+	}
+
+	current := monthlyPartition(now)
+	for i := 0; i <= p.premakeMonths; i++ {
+		partition := monthlyPartition(current.month.AddDate(0, i, 0))
+		if _, ok := existing[partition.name]; ok {
+			continue
+		}
+		if err := p.create(ctx, partition); err != nil {
+			return fmt.Errorf("create partition %s: %w", partition.name, err)
+		}
+		log.Printf("Created trade partition %s", partition.name)
+	}
+
+	if p.retention == 0 {
+		return nil
+	}
+
+	oldest := current.month.AddDate(0, -p.retention, 0)
+	for _, partition := range sortedPartitions(existing) {
+		if !partition.month.Before(oldest) {
+			break
+		}
+		if err := p.remove(ctx, partition); err != nil {
+			return fmt.Errorf("remove partition %s: %w", partition.name, err)
+		}
+		if p.detach {
+			log.Printf("Detached expired trade partition %s", partition.name)
+		} else {
+			log.Printf("Dropped expired trade partition %s", partition.name)
+		}
+	}
+	return nil
+}
+
+// partitions returns the monthly partitions attached to trades. Partitions
+// not named by tradePartitionLayout are left alone.
+func (p *TradePartitions) partitions(ctx context.Context) (map[string]tradePartition, error) {
+	rows, err := p.pool.Query(ctx,
+		`SELECT c.relname
+         FROM pg_inherits i
+         JOIN pg_class c ON c.oid = i.inhrelid
+         WHERE i.inhparent = 'trades'::regclass`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make(map[string]tradePartition)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if partition, ok := parseTradePartition(name); ok {
+			partitions[name] = partition
+		}
+	}
+	return partitions, rows.Err()
+}
+
+// defaultPartition returns the name of the default partition of trades, or
+// an empty string when there is none.
+func (p *TradePartitions) defaultPartition(ctx context.Context) (string, error) {
+	var name string
+	err := p.pool.QueryRow(ctx,
+		`SELECT partdefid::regclass::text
+         FROM pg_partitioned_table
+         WHERE partrelid = 'trades'::regclass AND partdefid <> 0`).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return name, err
+}
+
+// defaultMonths returns the months (UTC) of the trades in the default
+// partition.
+func (p *TradePartitions) defaultMonths(ctx context.Context, defaultPartition string) ([]time.Time, error) {
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(
+		`SELECT DISTINCT date_trunc('month', to_timestamp(timestamp / 1000.0) AT TIME ZONE 'UTC')
+         FROM %s`, pgx.Identifier{defaultPartition}.Sanitize()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []time.Time
+	for rows.Next() {
+		var month time.Time
+		if err := rows.Scan(&month); err != nil {
+			return nil, err
+		}
+		months = append(months, month)
+	}
+	return months, rows.Err()
+}
+
+func (p *TradePartitions) create(ctx context.Context, partition tradePartition) error {
+	_, err := p.pool.Exec(ctx, createPartitionQuery(partition))
+	return err
+}
+
+// split creates the partition and moves its trades out of the default
+// partition. A partition cannot be created while the default one holds rows
+// of its range, so the default partition is detached meanwhile; it all
+// happens in one transaction. It returns the number of moved trades.
+func (p *TradePartitions) split(ctx context.Context, partition tradePartition, defaultPartition string) (int64, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	table := pgx.Identifier{defaultPartition}.Sanitize()
+	if _, err := tx.Exec(ctx, `ALTER TABLE trades DETACH PARTITION `+table); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, createPartitionQuery(partition)); err != nil {
+		return 0, err
+	}
+	tag, err := tx.Exec(ctx, fmt.Sprintf(
+		`WITH moved AS (DELETE FROM %s WHERE timestamp >= $1 AND timestamp < $2 RETURNING *)
+         INSERT INTO trades SELECT * FROM moved`, table), partition.from(), partition.to())
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `ALTER TABLE trades ATTACH PARTITION `+table+` DEFAULT`); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+func createPartitionQuery(partition tradePartition) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF trades FOR VALUES FROM (%d) TO (%d)`,
+		pgx.Identifier{partition.name}.Sanitize(), partition.from(), partition.to())
+}
+
+func (p *TradePartitions) remove(ctx context.Context, partition tradePartition) error {
+	query := `DROP TABLE %s`
+	if p.detach {
+		query = `ALTER TABLE trades DETACH PARTITION %s`
+	}
+	_, err := p.pool.Exec(ctx, fmt.Sprintf(query, pgx.Identifier{partition.name}.Sanitize()))
+	return err
+}
+
+func sortedPartitions(partitions map[string]tradePartition) []tradePartition {
+	sorted := make([]tradePartition, 0, len(partitions))
+	for _, partition := range partitions {
+		sorted = append(sorted, partition)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].month.Before(sorted[j].month) })
+	return sorted
+}
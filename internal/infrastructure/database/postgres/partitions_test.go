@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/test/integration"
+)
+
+func TestMonthlyPartition(t *testing.T) {
+	partition := monthlyPartition(time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC))
+	assert.Equal(t, "trades_y2025m12", partition.name)
+	assert.Equal(t, time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), partition.from())
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), partition.to())
+
+	parsed, ok := parseTradePartition("trades_y2025m12")
+	require.True(t, ok)
+	assert.Equal(t, partition, parsed)
+
+	_, ok = parseTradePartition("trades_archive")
+	assert.False(t, ok)
+}
+
+func TestTradePartitions_Maintain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = container.Pool.Exec(ctx, `DROP TABLE trades`)
+	require.NoError(t, err)
+	_, err = container.Pool.Exec(ctx, `CREATE TABLE trades (
+            tid VARCHAR(255) NOT NULL,
+            timestamp BIGINT NOT NULL
+        ) PARTITION BY RANGE (timestamp)`)
+	require.NoError(t, err)
+
+	partitioned, err := TradesPartitioned(ctx, container.Pool)
+	require.NoError(t, err)
+	assert.True(t, partitioned)
+
+	now := time.Date(2025, 4, 15, 12, 0, 0, 0, time.UTC)
+	partitions := NewTradePartitions(container.Pool, WithPremakeMonths(2), WithRetentionMonths(1))
+
+	require.NoError(t, partitions.Maintain(ctx, now))
+	existing, err := partitions.partitions(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"trades_y2025m04", "trades_y2025m05", "trades_y2025m06"}, names(existing))
+
+	_, err = container.Pool.Exec(ctx, `INSERT INTO trades (tid, timestamp) VALUES ('1', $1)`, now.UnixMilli())
+	require.NoError(t, err)
+
+	// Two months later April is out of the retention period.
+	require.NoError(t, partitions.Maintain(ctx, now.AddDate(0, 2, 0)))
+	existing, err = partitions.partitions(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"trades_y2025m05", "trades_y2025m06", "trades_y2025m07", "trades_y2025m08"}, names(existing))
+
+	var count int
+	require.NoError(t, container.Pool.QueryRow(ctx, `SELECT count(*) FROM trades`).Scan(&count))
+	assert.Zero(t, count)
+}
+
+func TestTradePartitions_Detach(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = container.Pool.Exec(ctx, `DROP TABLE trades`)
+	require.NoError(t, err)
+	_, err = container.Pool.Exec(ctx, `CREATE TABLE trades (timestamp BIGINT NOT NULL) PARTITION BY RANGE (timestamp)`)
+	require.NoError(t, err)
+
+	now := time.Date(2025, 4, 15, 12, 0, 0, 0, time.UTC)
+	partitions := NewTradePartitions(container.Pool, WithPremakeMonths(1), WithRetentionMonths(1), WithDetach(true))
+	require.NoError(t, partitions.Maintain(ctx, now))
+	require.NoError(t, partitions.Maintain(ctx, now.AddDate(0, 2, 0)))
+
+	// The detached partition is kept as a standalone table.
+	var exists bool
+	require.NoError(t, container.Pool.QueryRow(ctx, `SELECT to_regclass('trades_y2025m04') IS NOT NULL`).Scan(&exists))
+	assert.True(t, exists)
+}
+
+func TestTradePartitions_SplitsDefault(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = container.Pool.Exec(ctx, `DROP TABLE trades`)
+	require.NoError(t, err)
+	_, err = container.Pool.Exec(ctx, `CREATE TABLE trades (
+            tid VARCHAR(255) NOT NULL,
+            timestamp BIGINT NOT NULL
+        ) PARTITION BY RANGE (timestamp)`)
+	require.NoError(t, err)
+	_, err = container.Pool.Exec(ctx, `CREATE TABLE trades_default PARTITION OF trades DEFAULT`)
+	require.NoError(t, err)
+
+	now := time.Date(2025, 4, 15, 12, 0, 0, 0, time.UTC)
+	partitions := NewTradePartitions(container.Pool, WithPremakeMonths(1))
+	require.NoError(t, partitions.Maintain(ctx, now))
+
+	// Trades of months without a partition are kept in the default one.
+	for i, ts := range []time.Time{
+		time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		now,
+	} {
+		_, err = container.Pool.Exec(ctx, `INSERT INTO trades (tid, timestamp) VALUES ($1, $2)`,
+			fmt.Sprint(i), ts.UnixMilli())
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, partitions.Maintain(ctx, now))
+	existing, err := partitions.partitions(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"trades_y2025m01", "trades_y2025m04", "trades_y2025m05", "trades_y2025m09"}, names(existing))
+
+	count := func(table string) int {
+		var count int
+		require.NoError(t, container.Pool.QueryRow(ctx, `SELECT count(*) FROM `+table).Scan(&count))
+		return count
+	}
+	assert.Zero(t, count("trades_default"))
+	assert.Equal(t, 2, count("trades_y2025m01"))
+	assert.Equal(t, 1, count("trades_y2025m09"))
+	assert.Equal(t, 4, count("trades"))
+
+	// The default partition is attached again.
+	name, err := partitions.defaultPartition(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "trades_default", name)
+}
+
+func names(partitions map[string]tradePartition) []string {
+	var names []string
+	for name := range partitions {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+type TickerRepository struct {
+	pool    *pgxpool.Pool
+	metrics *metrics.Metrics
+}
+
+func NewTickerRepository(pool *pgxpool.Pool, opts ...Option) *TickerRepository {
+	o := newOptions(opts)
+	return &TickerRepository{
+		pool:    pool,
+		metrics: o.metrics,
+	}
+}
+
+func (r *TickerRepository) SaveTicker(ctx context.Context, ticker models.Ticker) error {
+	defer r.metrics.ObserveDB("save_ticker", time.Now())
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO tickers (pair, last, bid, ask, open, high, low, volume, quote_volume, change, trade_count, timestamp)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+         ON CONFLICT (pair, timestamp) DO NOTHING`,
+		ticker.Pair, ticker.Last, ticker.Bid, ticker.Ask, ticker.Open, ticker.High, ticker.Low,
+		ticker.Volume, ticker.QuoteVolume, ticker.Change, ticker.TradeCount, ticker.Timestamp)
+	return err
+}
+
+func (r *TickerRepository) GetLastTicker(ctx context.Context, pair string) (*models.Ticker, error) {
+	defer r.metrics.ObserveDB("get_last_ticker", time.Now())
+	var ticker models.Ticker
+
+	err := r.pool.QueryRow(ctx,
+		`SELECT pair, last, bid, ask, open, high, low, volume, quote_volume, change, trade_count, timestamp
+         FROM tickers
+         WHERE pair = $1
+         ORDER BY timestamp DESC
+         LIMIT 1`,
+		pair).Scan(
+		&ticker.Pair,
+		&ticker.Last,
+		&ticker.Bid,
+		&ticker.Ask,
+		&ticker.Open,
+		&ticker.High,
+		&ticker.Low,
+		&ticker.Volume,
+		&ticker.QuoteVolume,
+		&ticker.Change,
+		&ticker.TradeCount,
+		&ticker.Timestamp)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticker, nil
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/test/integration"
+)
+
+func TestTickerRepository_SaveAndGetLastTicker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewTickerRepository(container.Pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	last, err := repo.GetLastTicker(ctx, "BTC_USDT")
+	require.NoError(t, err)
+	assert.Nil(t, last)
+
+	now := time.Now().UnixMilli()
+	older := models.Ticker{
+		Pair: "BTC_USDT", Last: 50000, Bid: 49999, Ask: 50001, Open: 49000, High: 51000, Low: 48000,
+		Volume: 10, QuoteVolume: 500000, Change: 0.02, TradeCount: 100, Timestamp: now - 1000,
+	}
+	newer := older
+	newer.Last = 50100
+	newer.TradeCount = 101
+	newer.Timestamp = now
+
+	require.NoError(t, repo.SaveTicker(ctx, newer))
+	require.NoError(t, repo.SaveTicker(ctx, older))
+	require.NoError(t, repo.SaveTicker(ctx, newer))
+
+	last, err = repo.GetLastTicker(ctx, "BTC_USDT")
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, newer, *last)
+}
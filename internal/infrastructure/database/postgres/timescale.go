@@ -0,0 +1,45 @@
+package postgres
+
+import "github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+
+// TimescaleTimeFrames are the intervals whose candles the Timescale
+// migrations build in continuous aggregates over trades. Months have no
+// fixed length and are left to KlineProcessor.
+var TimescaleTimeFrames = []string{
+	"MINUTE_5", "MINUTE_10", "MINUTE_15", "MINUTE_30",
+	"HOUR_1", "HOUR_2", "HOUR_4", "HOUR_6", "HOUR_12",
+	"DAY_1", "DAY_3", "WEEK_1",
+}
+
+const (
+	klinesTable = "klines"
+	// klinesTimescaleView reads like klines but takes the candles of
+	// TimescaleTimeFrames from the continuous aggregates.
+	klinesTimescaleView = "klines_timescale"
+)
+
+// WithTimescale makes a kline repository read the candles of
+// TimescaleTimeFrames from the continuous aggregates created by the
+// migrations in migrations/timescale. Klines are still saved to klines.
+func WithTimescale() Option {
+	return func(o *options) {
+		o.timescale = true
+	}
+}
+
+// WithoutAggregates returns the timeframes that are not built by the
+// continuous aggregates and still have to be built from trades.
+func WithoutAggregates(timeframes []timeframe.TimeFrame) []timeframe.TimeFrame {
+	aggregated := make(map[string]struct{}, len(TimescaleTimeFrames))
+	for _, name := range TimescaleTimeFrames {
+		aggregated[name] = struct{}{}
+	}
+
+	var rest []timeframe.TimeFrame
+	for _, tf := range timeframes {
+		if _, ok := aggregated[tf.Name]; !ok {
+			rest = append(rest, tf)
+		}
+	}
+	return rest
+}
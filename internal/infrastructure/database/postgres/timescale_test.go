@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/test/integration"
+)
+
+func TestTimescaleTimeFrames_MatchMigrations(t *testing.T) {
+	files, err := filepath.Glob("../../../../migrations/timescale/*.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	var sql strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		sql.Write(data)
+	}
+
+	aggregates := regexp.MustCompile(`CREATE MATERIALIZED VIEW klines_(\w+)`).FindAllStringSubmatch(sql.String(), -1)
+	require.Len(t, aggregates, len(TimescaleTimeFrames))
+
+	for _, name := range TimescaleTimeFrames {
+		tf, err := timeframe.Parse(name)
+		require.NoError(t, err)
+
+		bucket := fmt.Sprintf("time_bucket(BIGINT '%d', timestamp", tf.Duration.Milliseconds())
+		view := "CREATE MATERIALIZED VIEW klines_" + strings.ToLower(name) + "\n"
+		i := strings.Index(sql.String(), view)
+		require.GreaterOrEqual(t, i, 0, "no continuous aggregate for %s", name)
+		definition, _, _ := strings.Cut(sql.String()[i:], "WITH NO DATA")
+		assert.Contains(t, definition, bucket, name)
+		// Trade quantity is the base volume, trade amount the quote volume.
+		assert.Contains(t, definition, "sum(quantity) AS base_volume", name)
+		assert.Contains(t, definition, "sum(amount) AS quote_volume", name)
+		assert.Contains(t, sql.String(), "'"+name+"'::VARCHAR(10)", name)
+	}
+}
+
+func TestWithoutAggregates(t *testing.T) {
+	timeframes := timeframe.MustParseList([]string{"MINUTE_1", "MINUTE_15", "HOUR_1", "MONTH_1"})
+	assert.Equal(t, []string{"MINUTE_1", "MONTH_1"}, timeframe.Names(WithoutAggregates(timeframes)))
+}
+
+func TestTimescale_TradeStoredTwiceIsCountedOnce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t, integration.WithImage("timescale/timescaledb:latest-pg14"))
+	require.NoError(t, err)
+	defer container.Close()
+
+	db, err := goose.OpenDBWithDriver("pgx", container.ConnString)
+	require.NoError(t, err)
+	defer db.Close()
+	goose.SetTableName("goose_db_version_timescale")
+	defer goose.SetTableName("goose_db_version")
+	require.NoError(t, goose.Up(db, "../../../../migrations/timescale"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	trades := NewTradeRepository(container.Pool)
+	klines := NewKlineRepository(container.Pool, WithTimescale())
+
+	begin := time.Now().Truncate(time.Hour).UnixMilli()
+	trade := models.RecentTrade{
+		Tid: "1", Pair: "BTC_USDT", Symbol: "BTC_USDT", Price: decimal.NewFromInt(50000),
+		Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(50000), Side: "buy", Timestamp: begin + 1000,
+	}
+	require.NoError(t, trades.SaveTrades(ctx, []models.RecentTrade{trade}))
+
+	// The same trade timed by another clock, once in a batch and once alone.
+	trade.Timestamp = begin + 1500
+	require.NoError(t, trades.SaveTrades(ctx, []models.RecentTrade{trade}))
+	trade.Timestamp = begin + 2000
+	require.NoError(t, trades.SaveTrade(ctx, trade))
+
+	stored, err := trades.GetTradesByTimeRange(ctx, "BTC_USDT", begin, begin+time.Hour.Milliseconds(), "", 10)
+	require.NoError(t, err)
+	assert.Len(t, stored, 1)
+
+	candles, err := klines.GetKlinesByTimeRange(ctx, "BTC_USDT", "MINUTE_5", begin, begin+time.Hour.Milliseconds())
+	require.NoError(t, err)
+	require.Len(t, candles, 1)
+	assert.Equal(t, int64(1), candles[0].TradeCount)
+	assert.Equal(t, "1", candles[0].BaseVolume.String())
+	assert.Equal(t, "50000", candles[0].QuoteVolume.String())
+	assert.Equal(t, "50000", candles[0].VolumeBS.BuyQuote.String())
+}
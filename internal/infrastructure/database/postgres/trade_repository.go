@@ -2,46 +2,213 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/shopspring/decimal"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type TradeRepository struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	metrics  *metrics.Metrics
+	exchange string
 }
 
-func NewTradeRepository(pool *pgxpool.Pool) *TradeRepository {
+func NewTradeRepository(pool *pgxpool.Pool, opts ...Option) *TradeRepository {
+	o := newOptions(opts)
 	return &TradeRepository{
-		pool: pool,
+		pool:     pool,
+		metrics:  o.metrics,
+		exchange: o.exchange,
 	}
 }
 
 func (r *TradeRepository) SaveTrade(ctx context.Context, trade models.RecentTrade) error {
+	defer r.metrics.ObserveDB("save_trade", time.Now())
 	log.Printf("Trade saved %+v", trade)
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO trades (tid, pair, price, amount, side, timestamp, quantity)
-         VALUES ($1, $2, $3, $4, $5, $6, $7)
-         ON CONFLICT (tid, pair) DO NOTHING`,
-		trade.Tid, trade.Symbol, trade.Price, trade.Amount, trade.Side, trade.Timestamp, trade.Quantity)
+		`INSERT INTO trades (exchange, tid, pair, price, amount, side, timestamp, quantity)
+         SELECT $1::VARCHAR, $2::VARCHAR, $3::VARCHAR, $4::NUMERIC, $5::NUMERIC, $6::VARCHAR, $7::BIGINT, $8::NUMERIC
+         WHERE NOT EXISTS (
+                SELECT 1 FROM trades t
+                WHERE t.exchange = $1 AND t.pair = $3 AND t.tid = $2
+                  AND t.timestamp BETWEEN $7 - `+tradeTimeSkew+` AND $7 + `+tradeTimeSkew+`)
+         ON CONFLICT DO NOTHING`,
+		r.exchange, trade.Tid, trade.Symbol, trade.Price, trade.Amount, trade.Side, trade.Timestamp, trade.Quantity)
 	return err
 }
 
+// tradesStagingTable receives a batch of trades by COPY before they are
+// merged into trades, which COPY alone cannot do without failing on
+// duplicates.
+const tradesStagingTable = "trades_staging"
+
+const createTradesStagingQuery = `CREATE TEMP TABLE ` + tradesStagingTable + ` (
+                exchange VARCHAR(20),
+                tid VARCHAR(255),
+                pair VARCHAR(20),
+                price NUMERIC,
+                amount NUMERIC,
+                quantity NUMERIC,
+                side VARCHAR(4),
+                timestamp BIGINT
+         ) ON COMMIT DROP`
+
+// tradeTimeSkew bounds, in ms, how far apart two timestamps of one trade
+// are looked for. It keeps the lookup of a stored trade to a few chunks or
+// partitions.
+const tradeTimeSkew = "86400000"
+
+// mergeTradesStagingQuery names no conflict target: the unique key of trades
+// is (exchange, pair, tid) on plain Postgres but must include timestamp once
+// trades is a hypertable or partitioned. That key would take a trade stored
+// again under another timestamp, so stored trades are skipped explicitly.
+const mergeTradesStagingQuery = `INSERT INTO trades (exchange, tid, pair, price, amount, quantity, side, timestamp)
+         SELECT DISTINCT ON (s.exchange, s.pair, s.tid)
+                s.exchange, s.tid, s.pair, s.price, s.amount, s.quantity, s.side, s.timestamp
+         FROM ` + tradesStagingTable + ` s
+         WHERE NOT EXISTS (
+                SELECT 1 FROM trades t
+                WHERE t.exchange = s.exchange AND t.pair = s.pair AND t.tid = s.tid
+                  AND t.timestamp BETWEEN s.timestamp - ` + tradeTimeSkew + ` AND s.timestamp + ` + tradeTimeSkew + `)
+         ON CONFLICT DO NOTHING`
+
+var tradeCopyColumns = []string{"exchange", "tid", "pair", "price", "amount", "quantity", "side", "timestamp"}
+
+// SaveTrades copies the trades into a staging table and merges them into
+// trades in one transaction. When the database rejects the batch it is split
+// in halves until the rejected trades are found; those are returned in a
+// *repository.TradeWriteError and the rest is stored.
 func (r *TradeRepository) SaveTrades(ctx context.Context, trades []models.RecentTrade) error {
-	batch := &pgx.Batch{}
+	defer r.metrics.ObserveDB("save_trades", time.Now())
+	if len(trades) == 0 {
+		return nil
+	}
 
-	for _, trade := range trades {
-		batch.Queue(
-			`INSERT INTO trades (tid, pair, price, amount, side, timestamp, quantity)
-             VALUES ($1, $2, $3, $4, $5, $6, $7)
-             ON CONFLICT (tid, pair) DO NOTHING`,
-			trade.Tid, trade.Pair, trade.Price, trade.Amount, trade.Side, trade.Timestamp, trade.Quantity)
+	rejected := &repository.TradeWriteError{}
+	if err := r.saveTrades(ctx, trades, rejected); err != nil {
+		return err
 	}
+	if len(rejected.Failed) > 0 {
+		return rejected
+	}
+	return nil
+}
 
-	br := r.pool.SendBatch(ctx, batch)
-	defer br.Close()
+// saveTrades stores the trades and adds the ones rejected by the database to
+// rejected. Errors of an unavailable database, e.g. a lost connection, are
+// returned as they are.
+func (r *TradeRepository) saveTrades(ctx context.Context, trades []models.RecentTrade, rejected *repository.TradeWriteError) error {
+	err := r.copyTrades(ctx, trades)
 
-	return nil
+	switch {
+	case err == nil:
+		return nil
+	case Unavailable(err) || errors.Is(err, context.Canceled):
+		return err
+	case len(trades) == 1:
+		log.Printf("Trade rejected: Pair=%s, Tid=%s: %v", trades[0].Pair, trades[0].Tid, err)
+		rejected.Failed = append(rejected.Failed, trades[0])
+		rejected.Err = err
+		return nil
+	}
+
+	mid := len(trades) / 2
+	if err := r.saveTrades(ctx, trades[:mid], rejected); err != nil {
+		return err
+	}
+	return r.saveTrades(ctx, trades[mid:], rejected)
+}
+
+func (r *TradeRepository) copyTrades(ctx context.Context, trades []models.RecentTrade) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createTradesStagingQuery); err != nil {
+		return err
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{tradesStagingTable}, tradeCopyColumns,
+		pgx.CopyFromSlice(len(trades), func(i int) ([]interface{}, error) {
+			trade := trades[i]
+			return []interface{}{
+				r.exchange, trade.Tid, trade.Pair,
+				numeric(trade.Price), numeric(trade.Amount), numeric(trade.Quantity),
+				trade.Side, trade.Timestamp,
+			}, nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, mergeTradesStagingQuery); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// numeric converts d for COPY, which uses the binary format where decimals
+// cannot be sent as text.
+func numeric(d decimal.Decimal) pgtype.Numeric {
+	return pgtype.Numeric{Int: d.Coefficient(), Exp: d.Exponent(), Status: pgtype.Present}
+}
+
+// GetLastTradeTime returns the timestamp of the newest stored trade of the
+// pair, or 0 when there are none.
+func (r *TradeRepository) GetLastTradeTime(ctx context.Context, pair string) (int64, error) {
+	defer r.metrics.ObserveDB("get_last_trade_time", time.Now())
+	var ts int64
+	err := r.pool.QueryRow(ctx,
+		`SELECT COALESCE(MAX(timestamp), 0) FROM trades WHERE exchange = $1 AND pair = $2`,
+		r.exchange, pair).Scan(&ts)
+	return ts, err
+}
+
+func (r *TradeRepository) GetTradesByTimeRange(ctx context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error) {
+	defer r.metrics.ObserveDB("get_trades_by_time_range", time.Now())
+	rows, err := r.pool.Query(ctx,
+		`SELECT tid, pair, price, amount, quantity, side, timestamp
+         FROM trades
+         WHERE exchange = $6
+           AND pair = $1
+           AND timestamp <= $3
+           AND (timestamp > $2 OR (timestamp = $2 AND tid > $4))
+         ORDER BY timestamp, tid
+         LIMIT $5`,
+		pair, startTime, endTime, afterTid, limit, r.exchange)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := make([]models.RecentTrade, 0, limit)
+	for rows.Next() {
+		var trade models.RecentTrade
+		if err := rows.Scan(
+			&trade.Tid,
+			&trade.Pair,
+			&trade.Price,
+			&trade.Amount,
+			&trade.Quantity,
+			&trade.Side,
+			&trade.Timestamp); err != nil {
+			return nil, err
+		}
+		trade.Exchange = r.exchange
+		trade.Symbol = trade.Pair
+		trades = append(trades, trade)
+	}
+
+	return trades, rows.Err()
 }
@@ -2,13 +2,16 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
 	"github.com/Zmey56/poloniex-collector/test/integration"
 )
 
@@ -33,8 +36,8 @@ func TestTradeRepository_SaveTrade(t *testing.T) {
 			trade: models.RecentTrade{
 				Tid:       "123",
 				Pair:      "BTC_USDT",
-				Price:     "50000.00",
-				Amount:    "1.5",
+				Price:     decimal.NewFromInt(50000),
+				Amount:    decimal.RequireFromString("1.5"),
 				Side:      "buy",
 				Timestamp: time.Now().Unix(),
 			},
@@ -45,8 +48,8 @@ func TestTradeRepository_SaveTrade(t *testing.T) {
 			trade: models.RecentTrade{
 				Tid:       "123",
 				Pair:      "BTC_USDT",
-				Price:     "50000.00",
-				Amount:    "1.5",
+				Price:     decimal.NewFromInt(50000),
+				Amount:    decimal.RequireFromString("1.5"),
 				Side:      "buy",
 				Timestamp: time.Now().Unix(),
 			},
@@ -81,16 +84,16 @@ func TestTradeRepository_SaveTrades(t *testing.T) {
 		{
 			Tid:       "123",
 			Pair:      "BTC_USDT",
-			Price:     "50000.00",
-			Amount:    "1.5",
+			Price:     decimal.NewFromInt(50000),
+			Amount:    decimal.RequireFromString("1.5"),
 			Side:      "buy",
 			Timestamp: time.Now().Unix(),
 		},
 		{
 			Tid:       "124",
 			Pair:      "BTC_USDT",
-			Price:     "50100.00",
-			Amount:    "2.0",
+			Price:     decimal.NewFromInt(50100),
+			Amount:    decimal.NewFromInt(2),
 			Side:      "sell",
 			Timestamp: time.Now().Unix(),
 		},
@@ -98,4 +101,173 @@ func TestTradeRepository_SaveTrades(t *testing.T) {
 
 	err = repo.SaveTrades(context.Background(), trades)
 	assert.NoError(t, err)
+
+	// Saving the same trades again, also twice in one batch, is not an error.
+	err = repo.SaveTrades(context.Background(), append(trades, trades...))
+	assert.NoError(t, err)
+}
+
+func TestTradeRepository_SaveTrades_PartialFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewTradeRepository(container.Pool)
+	ctx := context.Background()
+
+	var trades []models.RecentTrade
+	for i := 0; i < 5; i++ {
+		trades = append(trades, models.RecentTrade{
+			Tid: fmt.Sprintf("%d", i), Pair: "BTC_USDT", Price: decimal.NewFromInt(50000),
+			Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: int64(1000 + i),
+		})
+	}
+	// The side does not fit its column, so the database rejects the trade.
+	trades[3].Side = "unknown"
+
+	err = repo.SaveTrades(ctx, trades)
+	var rejected *repository.TradeWriteError
+	require.ErrorAs(t, err, &rejected)
+	require.Len(t, rejected.Failed, 1)
+	assert.Equal(t, "3", rejected.Failed[0].Tid)
+
+	stored, err := repo.GetTradesByTimeRange(ctx, "BTC_USDT", 0, 2000, "", 10)
+	require.NoError(t, err)
+	var tids []string
+	for _, trade := range stored {
+		tids = append(tids, trade.Tid)
+	}
+	assert.Equal(t, []string{"0", "1", "2", "4"}, tids)
+}
+
+func TestTradeRepository_GetLastTradeTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewTradeRepository(container.Pool)
+	ctx := context.Background()
+
+	ts, err := repo.GetLastTradeTime(ctx, "BTC_USDT")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), ts)
+
+	now := time.Now().UnixMilli()
+	err = repo.SaveTrades(ctx, []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(50000), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: now - 1000},
+		{Tid: "2", Pair: "BTC_USDT", Price: decimal.NewFromInt(50000), Amount: decimal.NewFromInt(1), Side: "sell", Timestamp: now},
+		{Tid: "3", Pair: "ETH_USDT", Price: decimal.NewFromInt(3000), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: now + 1000},
+	})
+	require.NoError(t, err)
+
+	ts, err = repo.GetLastTradeTime(ctx, "BTC_USDT")
+	require.NoError(t, err)
+	assert.Equal(t, now, ts)
+}
+
+func TestTradeRepository_GetTradesByTimeRange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewTradeRepository(container.Pool)
+	ctx := context.Background()
+
+	err = repo.SaveTrades(ctx, []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(50000), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1000},
+		{Tid: "2", Pair: "BTC_USDT", Price: decimal.NewFromInt(50100), Amount: decimal.NewFromInt(1), Side: "sell", Timestamp: 2000},
+		{Tid: "3", Pair: "BTC_USDT", Price: decimal.NewFromInt(50200), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 2000},
+		{Tid: "4", Pair: "BTC_USDT", Price: decimal.NewFromInt(50300), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 3000},
+		{Tid: "5", Pair: "ETH_USDT", Price: decimal.NewFromInt(3000), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 2000},
+	})
+	require.NoError(t, err)
+
+	trades, err := repo.GetTradesByTimeRange(ctx, "BTC_USDT", 1000, 3000, "", 2)
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	assert.Equal(t, "1", trades[0].Tid)
+	assert.Equal(t, "2", trades[1].Tid)
+	assert.Equal(t, "50100", trades[1].Price.String())
+
+	trades, err = repo.GetTradesByTimeRange(ctx, "BTC_USDT", 2000, 3000, "2", 10)
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	assert.Equal(t, "3", trades[0].Tid)
+	assert.Equal(t, "4", trades[1].Tid)
+}
+
+func TestTradeRepository_ScopedByExchange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	poloniex := NewTradeRepository(container.Pool)
+	binance := NewTradeRepository(container.Pool, WithExchange("binance"))
+	ctx := context.Background()
+
+	// The same trade id may be used by both exchanges.
+	require.NoError(t, poloniex.SaveTrades(ctx, []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(50000), Amount: decimal.NewFromInt(1), Side: "buy", Timestamp: 1000},
+	}))
+	require.NoError(t, binance.SaveTrades(ctx, []models.RecentTrade{
+		{Tid: "1", Pair: "BTC_USDT", Price: decimal.NewFromInt(50010), Amount: decimal.NewFromInt(2), Side: "sell", Timestamp: 2000},
+	}))
+
+	trades, err := binance.GetTradesByTimeRange(ctx, "BTC_USDT", 0, 3000, "", 10)
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	assert.Equal(t, "binance", trades[0].Exchange)
+	assert.Equal(t, "sell", trades[0].Side)
+
+	ts, err := poloniex.GetLastTradeTime(ctx, "BTC_USDT")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), ts)
+}
+
+func TestTradeRepository_ExactDecimals(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	container, err := integration.NewPostgresContainer(t)
+	require.NoError(t, err)
+	defer container.Close()
+
+	repo := NewTradeRepository(container.Pool)
+	ctx := context.Background()
+
+	// A DOGE trade whose quote amount has more than eight decimals.
+	trade := models.RecentTrade{
+		Tid:       "1",
+		Pair:      "DOGE_USDT",
+		Price:     decimal.RequireFromString("0.123456789"),
+		Quantity:  decimal.RequireFromString("1234.5678"),
+		Amount:    decimal.RequireFromString("152.4157653293742"),
+		Side:      "buy",
+		Timestamp: 1000,
+	}
+	require.NoError(t, repo.SaveTrades(ctx, []models.RecentTrade{trade}))
+
+	trades, err := repo.GetTradesByTimeRange(ctx, "DOGE_USDT", 0, 2000, "", 10)
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	assert.Equal(t, trade.Price.String(), trades[0].Price.String())
+	assert.Equal(t, trade.Quantity.String(), trades[0].Quantity.String())
+	assert.Equal(t, trade.Amount.String(), trades[0].Amount.String())
 }
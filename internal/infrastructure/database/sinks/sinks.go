@@ -0,0 +1,65 @@
+// Package sinks builds the repositories of the stores trades and klines are
+// written to, so that every command writes to the same configured sinks.
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/clickhouse"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/fanout"
+)
+
+// Names of the supported sinks.
+const (
+	Postgres   = "postgres"
+	ClickHouse = "clickhouse"
+)
+
+// Stores are the stores the sinks are built on. The Postgres repositories
+// are built by the caller, which may wrap them, e.g. in a spool.
+type Stores struct {
+	PostgresTrades    repository.TradeRepository
+	PostgresKlines    repository.KlineRepository
+	ClickHouse        *clickhouse.Client
+	ClickHouseOptions []clickhouse.Option
+}
+
+// Sinks are the repositories of the sinks, in the configured order.
+type Sinks struct {
+	Trades []fanout.Sink[repository.TradeRepository]
+	Klines []fanout.Sink[repository.KlineRepository]
+}
+
+// Open returns the sinks named in names. The ClickHouse tables are created
+// when ClickHouse is one of them.
+func Open(ctx context.Context, names []string, stores Stores) (Sinks, error) {
+	if len(names) == 0 {
+		return Sinks{}, errors.New("no sinks configured")
+	}
+
+	var s Sinks
+	for _, name := range names {
+		var (
+			trades repository.TradeRepository
+			klines repository.KlineRepository
+		)
+		switch name {
+		case Postgres:
+			trades, klines = stores.PostgresTrades, stores.PostgresKlines
+		case ClickHouse:
+			if err := stores.ClickHouse.CreateTables(ctx); err != nil {
+				return Sinks{}, fmt.Errorf("prepare ClickHouse: %w", err)
+			}
+			trades = clickhouse.NewTradeRepository(stores.ClickHouse, stores.ClickHouseOptions...)
+			klines = clickhouse.NewKlineRepository(stores.ClickHouse, stores.ClickHouseOptions...)
+		default:
+			return Sinks{}, fmt.Errorf("unsupported sink %q", name)
+		}
+		s.Trades = append(s.Trades, fanout.Sink[repository.TradeRepository]{Name: name, Repository: trades})
+		s.Klines = append(s.Klines, fanout.Sink[repository.KlineRepository]{Name: name, Repository: klines})
+	}
+	return s, nil
+}
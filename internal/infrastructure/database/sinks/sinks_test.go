@@ -0,0 +1,31 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/postgres"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	trades := postgres.NewTradeRepository(nil)
+	klines := postgres.NewKlineRepository(nil)
+
+	opened, err := Open(ctx, []string{Postgres}, Stores{PostgresTrades: trades, PostgresKlines: klines})
+	require.NoError(t, err)
+	require.Len(t, opened.Trades, 1)
+	require.Len(t, opened.Klines, 1)
+	assert.Equal(t, Postgres, opened.Trades[0].Name)
+	assert.Same(t, trades, opened.Trades[0].Repository)
+	assert.Same(t, klines, opened.Klines[0].Repository)
+
+	_, err = Open(ctx, nil, Stores{})
+	assert.ErrorContains(t, err, "no sinks configured")
+
+	_, err = Open(ctx, []string{Postgres, "mysql"}, Stores{PostgresTrades: trades, PostgresKlines: klines})
+	assert.ErrorContains(t, err, `unsupported sink "mysql"`)
+}
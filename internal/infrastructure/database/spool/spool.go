@@ -0,0 +1,207 @@
+// Package spool keeps the writes of a repository in a write-ahead log while
+// the database is unavailable and replays them in order once it is back.
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/database/postgres"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/wal"
+)
+
+const defaultRetryInterval = 5 * time.Second
+
+type options struct {
+	retryInterval time.Duration
+}
+
+type Option func(*options)
+
+// WithRetryInterval sets how often the replay of spooled writes is attempted.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.retryInterval = interval
+		}
+	}
+}
+
+// spool writes batches directly while its log is empty and appends them to
+// the log when the database is unavailable. Once the log holds anything,
+// later batches are appended too, so that they are written in order.
+type spool[T any] struct {
+	name          string
+	log           *wal.Log
+	save          func(ctx context.Context, batch T) error
+	retryInterval time.Duration
+
+	mu sync.Mutex
+}
+
+func newSpool[T any](name string, l *wal.Log, save func(context.Context, T) error, opts []Option) *spool[T] {
+	o := options{retryInterval: defaultRetryInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &spool[T]{
+		name:          name,
+		log:           l,
+		save:          save,
+		retryInterval: o.retryInterval,
+	}
+}
+
+func (s *spool[T]) write(ctx context.Context, batch T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log.Len() == 0 {
+		err := s.save(ctx, batch)
+		if !postgres.Unavailable(err) {
+			return err
+		}
+		log.Printf("Database unavailable, spooling %s: %v", s.name, err)
+		if serr := s.append(batch); serr != nil {
+			return fmt.Errorf("%w (spool %s: %v)", err, s.name, serr)
+		}
+		return nil
+	}
+
+	if err := s.append(batch); err != nil {
+		return fmt.Errorf("spool %s: %w", s.name, err)
+	}
+	return nil
+}
+
+func (s *spool[T]) append(batch T) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("encode batch: %w", err)
+	}
+	return s.log.Append(data)
+}
+
+// replay writes the spooled batches until the log is empty or the database
+// is unavailable again. Batches the database rejects are logged and dropped.
+func (s *spool[T]) replay(ctx context.Context) error {
+	if s.log.Len() == 0 {
+		return nil
+	}
+
+	replayed, err := s.log.Replay(func(data []byte) error {
+		var batch T
+		if err := json.Unmarshal(data, &batch); err != nil {
+			log.Printf("Skipping corrupted spooled %s: %v", s.name, err)
+			return nil
+		}
+
+		err := s.save(ctx, batch)
+		if err != nil && !postgres.Unavailable(err) && !errors.Is(err, context.Canceled) {
+			log.Printf("Dropping spooled %s rejected by the database: %v", s.name, err)
+			return nil
+		}
+		return err
+	})
+
+	if replayed > 0 {
+		log.Printf("Replayed %d spooled batches of %s, %d left", replayed, s.name, s.log.Len())
+	}
+	return err
+}
+
+func (s *spool[T]) run(ctx context.Context) {
+	ticker := time.NewTicker(s.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.replay(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Database still unavailable, %d spooled batches of %s left: %v", s.log.Len(), s.name, err)
+			}
+		}
+	}
+}
+
+// TradeRepository spools the trades written while the database is
+// unavailable. Reads go straight to the wrapped repository.
+type TradeRepository struct {
+	repository.TradeRepository
+	spool *spool[[]models.RecentTrade]
+}
+
+func NewTradeRepository(inner repository.TradeRepository, l *wal.Log, opts ...Option) *TradeRepository {
+	return &TradeRepository{
+		TradeRepository: inner,
+		spool:           newSpool("trades", l, inner.SaveTrades, opts),
+	}
+}
+
+func (r *TradeRepository) SaveTrade(ctx context.Context, trade models.RecentTrade) error {
+	return r.SaveTrades(ctx, []models.RecentTrade{trade})
+}
+
+func (r *TradeRepository) SaveTrades(ctx context.Context, trades []models.RecentTrade) error {
+	if len(trades) == 0 {
+		return nil
+	}
+	return r.spool.write(ctx, trades)
+}
+
+// Replay writes the spooled trades. It returns an error if the database is
+// still unavailable.
+func (r *TradeRepository) Replay(ctx context.Context) error {
+	return r.spool.replay(ctx)
+}
+
+// Run replays the spooled trades every retry interval until ctx is cancelled.
+func (r *TradeRepository) Run(ctx context.Context) {
+	r.spool.run(ctx)
+}
+
+// KlineRepository spools the klines written while the database is
+// unavailable. Reads go straight to the wrapped repository.
+type KlineRepository struct {
+	repository.KlineRepository
+	spool *spool[[]models.Kline]
+}
+
+func NewKlineRepository(inner repository.KlineRepository, l *wal.Log, opts ...Option) *KlineRepository {
+	return &KlineRepository{
+		KlineRepository: inner,
+		spool:           newSpool("klines", l, inner.SaveKlines, opts),
+	}
+}
+
+func (r *KlineRepository) SaveKline(ctx context.Context, kline models.Kline) error {
+	return r.SaveKlines(ctx, []models.Kline{kline})
+}
+
+func (r *KlineRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	if len(klines) == 0 {
+		return nil
+	}
+	return r.spool.write(ctx, klines)
+}
+
+// Replay writes the spooled klines. It returns an error if the database is
+// still unavailable.
+func (r *KlineRepository) Replay(ctx context.Context) error {
+	return r.spool.replay(ctx)
+}
+
+// Run replays the spooled klines every retry interval until ctx is cancelled.
+func (r *KlineRepository) Run(ctx context.Context) {
+	r.spool.run(ctx)
+}
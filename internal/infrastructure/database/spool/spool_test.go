@@ -0,0 +1,256 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/wal"
+)
+
+var errConnRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")}
+
+// fakeDatabase stores trades and klines in memory and fails every write
+// while it is down or rejects everything.
+type fakeDatabase struct {
+	mu     sync.Mutex
+	down   bool
+	reject error
+	trades []string
+	klines map[int64]models.Kline
+}
+
+func (db *fakeDatabase) setReject(err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.reject = err
+}
+
+func (db *fakeDatabase) setDown(down bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.down = down
+}
+
+func (db *fakeDatabase) storedTrades() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.trades...)
+}
+
+type fakeTradeRepository struct {
+	repository.TradeRepository
+	db *fakeDatabase
+}
+
+func (r *fakeTradeRepository) SaveTrades(_ context.Context, trades []models.RecentTrade) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.db.down {
+		return errConnRefused
+	}
+	if r.db.reject != nil {
+		return r.db.reject
+	}
+	for _, trade := range trades {
+		r.db.trades = append(r.db.trades, trade.Tid)
+	}
+	return nil
+}
+
+type fakeKlineRepository struct {
+	repository.KlineRepository
+	db *fakeDatabase
+}
+
+func (r *fakeKlineRepository) SaveKlines(_ context.Context, klines []models.Kline) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.db.down {
+		return errConnRefused
+	}
+	for _, kline := range klines {
+		r.db.klines[kline.UtcBegin] = kline
+	}
+	return nil
+}
+
+func tradeBatch(batch int) []models.RecentTrade {
+	trades := make([]models.RecentTrade, 10)
+	for i := range trades {
+		trades[i] = models.RecentTrade{
+			Tid:    fmt.Sprintf("%03d", batch*10+i),
+			Pair:   "BTC_USDT",
+			Price:  decimal.RequireFromString("50000.123456789"),
+			Amount: decimal.NewFromInt(1),
+		}
+	}
+	return trades
+}
+
+func expectedTrades(batches int) []string {
+	var tids []string
+	for i := 0; i < batches*10; i++ {
+		tids = append(tids, fmt.Sprintf("%03d", i))
+	}
+	return tids
+}
+
+func TestTradeRepository_DatabaseDiesMidStream(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDatabase{}
+	l, err := wal.Open(t.TempDir(), wal.WithSegmentSize(2048), wal.WithSync(wal.SyncAlways, 0))
+	require.NoError(t, err)
+	defer l.Close()
+
+	repo := NewTradeRepository(&fakeTradeRepository{db: db}, l)
+
+	for batch := 0; batch < 10; batch++ {
+		switch batch {
+		case 3:
+			db.setDown(true)
+		case 7:
+			db.setDown(false)
+		}
+		require.NoError(t, repo.SaveTrades(ctx, tradeBatch(batch)))
+	}
+
+	// Nothing is written around the spool until it has been replayed, not
+	// even after the database is back.
+	assert.Equal(t, expectedTrades(3), db.storedTrades())
+	assert.Equal(t, 7, l.Len())
+
+	require.NoError(t, repo.Replay(ctx))
+	assert.Equal(t, expectedTrades(10), db.storedTrades())
+	assert.Zero(t, l.Len())
+
+	require.NoError(t, repo.SaveTrades(ctx, tradeBatch(10)))
+	assert.Equal(t, expectedTrades(11), db.storedTrades())
+}
+
+func TestTradeRepository_RejectionDoesNotWedge(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDatabase{}
+	l, err := wal.Open(t.TempDir())
+	require.NoError(t, err)
+	defer l.Close()
+
+	repo := NewTradeRepository(&fakeTradeRepository{db: db}, l)
+	errEncode := errors.New("cannot encode status undefined into binary format")
+
+	// A batch the database cannot take is returned, not spooled.
+	db.setReject(errEncode)
+	assert.ErrorIs(t, repo.SaveTrades(ctx, tradeBatch(0)), errEncode)
+	assert.Zero(t, l.Len())
+
+	// A spooled batch that turns out to be rejected is dropped on replay.
+	db.setDown(true)
+	require.NoError(t, repo.SaveTrades(ctx, tradeBatch(1)))
+	db.setDown(false)
+	require.NoError(t, repo.Replay(ctx))
+	assert.Zero(t, l.Len())
+
+	db.setReject(nil)
+	require.NoError(t, repo.SaveTrades(ctx, tradeBatch(2)))
+	assert.Equal(t, expectedTrades(3)[20:], db.storedTrades())
+}
+
+func TestTradeRepository_ReplayStopsWhileDatabaseIsDown(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDatabase{down: true}
+	l, err := wal.Open(t.TempDir())
+	require.NoError(t, err)
+	defer l.Close()
+
+	repo := NewTradeRepository(&fakeTradeRepository{db: db}, l, WithRetryInterval(10*time.Millisecond))
+	for batch := 0; batch < 3; batch++ {
+		require.NoError(t, repo.SaveTrades(ctx, tradeBatch(batch)))
+	}
+
+	assert.ErrorIs(t, repo.Replay(ctx), errConnRefused)
+	assert.Equal(t, 3, l.Len())
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go repo.Run(runCtx)
+
+	db.setDown(false)
+	assert.Eventually(t, func() bool { return l.Len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, expectedTrades(3), db.storedTrades())
+}
+
+func TestTradeRepository_SurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db := &fakeDatabase{down: true}
+
+	l, err := wal.Open(dir, wal.WithSync(wal.SyncNever, 0))
+	require.NoError(t, err)
+	repo := NewTradeRepository(&fakeTradeRepository{db: db}, l)
+	for batch := 0; batch < 4; batch++ {
+		require.NoError(t, repo.SaveTrades(ctx, tradeBatch(batch)))
+	}
+	require.NoError(t, l.Close())
+
+	db.setDown(false)
+	l, err = wal.Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+
+	repo = NewTradeRepository(&fakeTradeRepository{db: db}, l)
+	require.NoError(t, repo.Replay(ctx))
+	assert.Equal(t, expectedTrades(4), db.storedTrades())
+}
+
+func TestTradeRepository_FullSpool(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDatabase{down: true}
+	l, err := wal.Open(t.TempDir(), wal.WithMaxSize(3000))
+	require.NoError(t, err)
+	defer l.Close()
+
+	repo := NewTradeRepository(&fakeTradeRepository{db: db}, l)
+
+	var saveErr error
+	for batch := 0; batch < 10 && saveErr == nil; batch++ {
+		saveErr = repo.SaveTrades(ctx, tradeBatch(batch))
+	}
+	assert.ErrorIs(t, saveErr, wal.ErrFull)
+	assert.LessOrEqual(t, l.Size(), int64(3000))
+}
+
+func TestKlineRepository_KeepsLastState(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDatabase{klines: make(map[int64]models.Kline)}
+	l, err := wal.Open(t.TempDir())
+	require.NoError(t, err)
+	defer l.Close()
+
+	repo := NewKlineRepository(&fakeKlineRepository{db: db}, l)
+
+	kline := models.Kline{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: 60000, C: decimal.NewFromInt(1)}
+	require.NoError(t, repo.SaveKline(ctx, kline))
+
+	db.setDown(true)
+	kline.C = decimal.NewFromInt(2)
+	require.NoError(t, repo.SaveKline(ctx, kline))
+	kline.C = decimal.NewFromInt(3)
+	kline.IsClosed = true
+	require.NoError(t, repo.SaveKlines(ctx, []models.Kline{kline}))
+	assert.Equal(t, "1", db.klines[60000].C.String())
+
+	db.setDown(false)
+	require.NoError(t, repo.Replay(ctx))
+	assert.Equal(t, "3", db.klines[60000].C.String())
+	assert.True(t, db.klines[60000].IsClosed)
+}
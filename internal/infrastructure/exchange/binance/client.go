@@ -0,0 +1,507 @@
+// Package binance is the exchange adapter for Binance spot market data:
+// historical klines and aggregated trades over REST and live aggregated
+// trades over WebSocket.
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
+	"golang.org/x/time/rate"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/stream"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+// Name identifies Binance in the stored data.
+const Name = "binance"
+
+const (
+	defaultTradeBufferSize = 1000
+
+	// maxKlinePageSize is the largest number of candles Binance returns per request.
+	maxKlinePageSize = 1000
+	// maxTradesPageSize is the largest number of aggregated trades Binance
+	// returns per request.
+	maxTradesPageSize = 1000
+	// maxTradesWindow is the longest time range of one aggregated trades request.
+	maxTradesWindow = time.Hour
+	// defaultRequestRate is the number of REST requests sent per second.
+	defaultRequestRate = 10
+)
+
+// intervals maps the canonical timeframe names to the Binance kline
+// intervals. Binance has no 10 minute candles.
+var intervals = map[string]string{
+	"MINUTE_1":  "1m",
+	"MINUTE_5":  "5m",
+	"MINUTE_15": "15m",
+	"MINUTE_30": "30m",
+	"HOUR_1":    "1h",
+	"HOUR_2":    "2h",
+	"HOUR_4":    "4h",
+	"HOUR_6":    "6h",
+	"HOUR_12":   "12h",
+	"DAY_1":     "1d",
+	"DAY_3":     "3d",
+	"WEEK_1":    "1w",
+	"MONTH_1":   "1M",
+}
+
+type Client struct {
+	wsURL   string
+	restURL string
+	client  *http.Client
+	limiter *rate.Limiter
+
+	klinePageSize int
+
+	tradeBufferSize int
+	overflowPolicy  queue.Policy
+	spillDir        string
+	tradesDropped   prometheus.Counter
+	metrics         *metrics.Metrics
+}
+
+type Option func(*Client)
+
+// WithTradeBufferSize sets how many received trades are buffered for the consumer.
+func WithTradeBufferSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.tradeBufferSize = size
+		}
+	}
+}
+
+// WithRateLimit sets how many REST requests are sent per second.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(c *Client) {
+		if requestsPerSecond > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+		}
+	}
+}
+
+// WithKlinePageSize sets how many candles are requested at once, up to the
+// Binance limit of 1000.
+func WithKlinePageSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 && size <= maxKlinePageSize {
+			c.klinePageSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets what happens to received trades when the consumer
+// falls behind. spillDir is used by queue.PolicySpill.
+func WithOverflowPolicy(policy queue.Policy, spillDir string) Option {
+	return func(c *Client) {
+		c.overflowPolicy = policy
+		c.spillDir = spillDir
+	}
+}
+
+// WithDropCounter sets the counter incremented for every dropped trade.
+func WithDropCounter(counter prometheus.Counter) Option {
+	return func(c *Client) {
+		c.tradesDropped = counter
+	}
+}
+
+// WithMetrics sets the metrics updated for received trades and WebSocket connections.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// NewClient returns a Binance client. wsURL is the raw stream endpoint, e.g.
+// wss://stream.binance.com:9443/ws, and restURL the API root, e.g.
+// https://api.binance.com.
+func NewClient(wsURL, restURL string, opts ...Option) *Client {
+	c := &Client{
+		wsURL:           wsURL,
+		restURL:         restURL,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		limiter:         rate.NewLimiter(defaultRequestRate, 1),
+		klinePageSize:   maxKlinePageSize,
+		tradeBufferSize: defaultTradeBufferSize,
+		overflowPolicy:  queue.PolicyBlock,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) Name() string {
+	return Name
+}
+
+// symbol returns the Binance symbol of an instrument, e.g. BTCUSDT.
+func symbol(inst instrument.Instrument) string {
+	return inst.Base + inst.Quote
+}
+
+func interval(tf timeframe.TimeFrame) (string, error) {
+	interval, ok := intervals[tf.Name]
+	if !ok {
+		return "", fmt.Errorf("timeframe %s is not supported by binance", tf)
+	}
+	return interval, nil
+}
+
+// GetHistoricalKlines returns the candles that begin between startTime and
+// endTime (unix ms), oldest first, paging through the range klinePageSize
+// candles at a time.
+func (c *Client) GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error) {
+	interval, err := interval(tf)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []models.Kline
+	for from := startTime; from <= endTime; {
+		var rows [][]json.RawMessage
+		err := c.get(ctx, "/api/v3/klines", url.Values{
+			"symbol":    {symbol(inst)},
+			"interval":  {interval},
+			"startTime": {strconv.FormatInt(from, 10)},
+			"endTime":   {strconv.FormatInt(endTime, 10)},
+			"limit":     {strconv.Itoa(c.klinePageSize)},
+		}, &rows)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			kline, err := parseKline(row)
+			if err != nil {
+				return nil, err
+			}
+			if kline.UtcBegin < from || kline.UtcBegin > endTime {
+				continue
+			}
+			kline.Pair = inst.String()
+			kline.TimeFrame = tf.Name
+			klines = append(klines, kline)
+			from = kline.UtcBegin + 1
+		}
+
+		if len(rows) < c.klinePageSize {
+			break
+		}
+	}
+
+	log.Printf("Received %d klines for %s %s", len(klines), inst, tf)
+	return klines, nil
+}
+
+// parseKline reads a candle in the Binance REST layout: [openTime, open,
+// high, low, close, volume, closeTime, quoteVolume, trades,
+// takerBuyBaseVolume, takerBuyQuoteVolume, ignore]. The taker buy volumes
+// give the buy/sell split.
+func parseKline(row []json.RawMessage) (models.Kline, error) {
+	if len(row) < 11 {
+		return models.Kline{}, fmt.Errorf("malformed kline %s", row)
+	}
+
+	r := rowReader{row: row}
+	begin, end := r.int(0), r.int(6)
+	open, high, low, closePrice := r.decimal(1), r.decimal(2), r.decimal(3), r.decimal(4)
+	volume, quoteVolume := r.decimal(5), r.decimal(7)
+	tradeCount := r.int(8)
+	buyBase, buyQuote := r.decimal(9), r.decimal(10)
+	if r.err != nil {
+		return models.Kline{}, r.err
+	}
+
+	var vwap decimal.Decimal
+	if !volume.IsZero() {
+		vwap = quoteVolume.Div(volume)
+	}
+
+	return models.Kline{
+		Exchange: Name,
+		O:        open,
+		H:        high,
+		L:        low,
+		C:        closePrice,
+		UtcBegin: begin,
+		UtcEnd:   end,
+		BeginDt:  time.UnixMilli(begin).UTC(),
+		EndDt:    time.UnixMilli(end).UTC(),
+		VolumeBS: models.VBS{
+			BuyBase:   buyBase,
+			SellBase:  volume.Sub(buyBase),
+			BuyQuote:  buyQuote,
+			SellQuote: quoteVolume.Sub(buyQuote),
+		},
+		TradeCount:  tradeCount,
+		VWAP:        vwap,
+		BaseVolume:  volume,
+		QuoteVolume: quoteVolume,
+	}, nil
+}
+
+// rowReader reads the fields of a JSON array row and keeps the first error.
+type rowReader struct {
+	row []json.RawMessage
+	err error
+}
+
+func (r *rowReader) int(i int) int64 {
+	var v int64
+	if err := json.Unmarshal(r.row[i], &v); err != nil && r.err == nil {
+		r.err = fmt.Errorf("malformed field %d: %w", i, err)
+	}
+	return v
+}
+
+// decimal reads a number sent as a string.
+func (r *rowReader) decimal(i int) decimal.Decimal {
+	var v decimal.Decimal
+	if err := json.Unmarshal(r.row[i], &v); err != nil && r.err == nil {
+		r.err = fmt.Errorf("malformed field %d: %w", i, err)
+	}
+	return v
+}
+
+// aggTrade is an aggregated trade as sent by both the REST API and the
+// WebSocket stream.
+type aggTrade struct {
+	ID           int64           `json:"a"`
+	Price        decimal.Decimal `json:"p"`
+	Quantity     decimal.Decimal `json:"q"`
+	Time         int64           `json:"T"`
+	BuyerIsMaker bool            `json:"m"`
+	// BestMatch is unused, but encoding/json matches keys case-insensitively
+	// and "M" would otherwise overwrite BuyerIsMaker.
+	BestMatch bool `json:"M"`
+}
+
+// trade converts an aggregated trade of the pair. The amount is in the quote
+// currency and the quantity in the base currency, as with the other
+// exchanges.
+func (t aggTrade) trade(pair string) models.RecentTrade {
+	// The taker sold when the buyer was the maker.
+	side := "buy"
+	if t.BuyerIsMaker {
+		side = "sell"
+	}
+
+	return models.RecentTrade{
+		Exchange:   Name,
+		Tid:        strconv.FormatInt(t.ID, 10),
+		Pair:       pair,
+		Symbol:     pair,
+		Price:      t.Price,
+		Amount:     t.Price.Mul(t.Quantity),
+		Quantity:   t.Quantity,
+		Side:       side,
+		Timestamp:  t.Time,
+		CreateTime: t.Time,
+	}
+}
+
+// GetHistoricalTrades returns the aggregated trades of the instrument made
+// between from and to (unix ms), oldest first. Binance serves at most an hour
+// of trades per request, so the range is fetched hour by hour.
+func (c *Client) GetHistoricalTrades(ctx context.Context, inst instrument.Instrument, from, to int64) ([]models.RecentTrade, error) {
+	pair := inst.String()
+	seen := make(map[int64]struct{})
+	var trades []models.RecentTrade
+
+	for windowFrom := from; windowFrom <= to; {
+		windowTo := min(windowFrom+maxTradesWindow.Milliseconds()-1, to)
+
+		var page []aggTrade
+		err := c.get(ctx, "/api/v3/aggTrades", url.Values{
+			"symbol":    {symbol(inst)},
+			"startTime": {strconv.FormatInt(windowFrom, 10)},
+			"endTime":   {strconv.FormatInt(windowTo, 10)},
+			"limit":     {strconv.Itoa(maxTradesPageSize)},
+		}, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, raw := range page {
+			if _, ok := seen[raw.ID]; ok {
+				continue
+			}
+			seen[raw.ID] = struct{}{}
+
+			trades = append(trades, raw.trade(pair))
+		}
+
+		// A full page may not cover the window: continue from its last
+		// trade, which is requested again and skipped as already seen.
+		if len(page) == maxTradesPageSize && page[len(page)-1].Time > windowFrom {
+			windowFrom = page[len(page)-1].Time
+			continue
+		}
+		windowFrom = windowTo + 1
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Timestamp < trades[j].Timestamp
+	})
+	return trades, nil
+}
+
+// get sends a rate limited GET request to the REST API and decodes the JSON
+// response into out.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait error: %w", err)
+	}
+
+	u := c.restURL + path + "?" + query.Encode()
+	log.Printf("Making request to: %s", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request error: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response error: %w", err)
+	}
+	return nil
+}
+
+// SubscribeToTrades streams the aggregated trades of the instruments. The
+// trade ids are the aggregated trade ids, the same ones GetHistoricalTrades
+// returns, so a gap filled after a reconnect does not duplicate trades.
+func (c *Client) SubscribeToTrades(ctx context.Context, instruments []instrument.Instrument) (<-chan models.RecentTrade, error) {
+	log.Printf("Starting subscription to trades for pairs: %v", instruments)
+	trades := queue.New[models.RecentTrade](
+		c.tradeBufferSize,
+		c.overflowPolicy,
+		filepath.Join(c.spillDir, "binance-trades.spill"),
+		c.tradesDropped,
+	)
+
+	streams := make([]string, len(instruments))
+	pairs := make(map[string]string, len(instruments))
+	for i, inst := range instruments {
+		streams[i] = strings.ToLower(symbol(inst)) + "@aggTrade"
+		pairs[symbol(inst)] = inst.String()
+	}
+
+	// reconnected holds the pairs that have not received a trade on the
+	// current connection yet; their next trade is marked as Reconnected.
+	reconnected := make(map[string]bool, len(pairs))
+	onConnect := func() {
+		for _, pair := range pairs {
+			reconnected[pair] = true
+		}
+	}
+
+	go func() {
+		defer trades.Close()
+
+		stream.Stream{
+			URL: c.wsURL,
+			Subscribe: func(conn *websocket.Conn) error {
+				return subscribe(conn, streams)
+			},
+			OnConnect: onConnect,
+			Metrics:   c.metrics,
+			Handle: func(_ *websocket.Conn, message []byte) error {
+				var msg struct {
+					Event     string `json:"e"`
+					EventTime int64  `json:"E"`
+					Symbol    string `json:"s"`
+					aggTrade
+				}
+				if err := json.Unmarshal(message, &msg); err != nil {
+					log.Printf("Error parsing message: %v", err)
+					return nil
+				}
+				if msg.Event != "aggTrade" {
+					return nil
+				}
+
+				pair, ok := pairs[msg.Symbol]
+				if !ok {
+					log.Printf("Skipping trade of unexpected symbol %s", msg.Symbol)
+					return nil
+				}
+
+				trade := msg.trade(pair)
+				if reconnected[pair] {
+					trade.Reconnected = true
+					delete(reconnected, pair)
+				}
+
+				c.metrics.TradeReceived(pair)
+				trades.Push(ctx, trade)
+				c.metrics.SetQueueLength(metrics.StageExchange, trades.Len())
+				return nil
+			},
+		}.Run(ctx)
+	}()
+
+	return trades.C(), nil
+}
+
+// subscribe asks for the streams and waits for the confirmation.
+func subscribe(conn *websocket.Conn, streams []string) error {
+	request := struct {
+		Method string   `json:"method"`
+		Params []string `json:"params"`
+		ID     int      `json:"id"`
+	}{Method: "SUBSCRIBE", Params: streams, ID: 1}
+
+	log.Printf("Subscribing to %v", streams)
+	if err := conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("subscribe error: %w", err)
+	}
+
+	var response struct {
+		ID    int `json:"id"`
+		Error *struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		} `json:"error"`
+	}
+	if err := conn.ReadJSON(&response); err != nil {
+		return fmt.Errorf("read subscription response error: %w", err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("subscription rejected: %d %s", response.Error.Code, response.Error.Msg)
+	}
+	return nil
+}
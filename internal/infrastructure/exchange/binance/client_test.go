@@ -0,0 +1,260 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+var (
+	btcUSDT = instrument.New("BTC", "USDT")
+	ethUSDT = instrument.New("ETH", "USDT")
+)
+
+func mustTimeFrame(t *testing.T, name string) timeframe.TimeFrame {
+	t.Helper()
+	tf, err := timeframe.Parse(name)
+	require.NoError(t, err)
+	return tf
+}
+
+func queryInt(t *testing.T, r *http.Request, name string) int64 {
+	v, err := strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+	require.NoError(t, err, name)
+	return v
+}
+
+func TestClient_GetHistoricalKlines(t *testing.T) {
+	begin := time.Date(2024, 7, 3, 0, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/api/v3/klines", r.URL.Path)
+		assert.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		assert.Equal(t, "1m", r.URL.Query().Get("interval"))
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+
+		from, to := queryInt(t, r, "startTime"), queryInt(t, r, "endTime")
+		var rows []string
+		for ts := (from + minute - 1) / minute * minute; ts <= to && len(rows) < 2; ts += minute {
+			// volume 10 of which 4 bought, quote volume 1000 of which 420 bought
+			rows = append(rows, fmt.Sprintf(`[%d,"100.0","110.0","90.0","105.0","10.0",%d,"1000.0",7,"4.0","420.0","0"]`, ts, ts+minute-1))
+		}
+		w.Write([]byte("[" + strings.Join(rows, ",") + "]"))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithKlinePageSize(2))
+
+	klines, err := client.GetHistoricalKlines(context.Background(), btcUSDT, mustTimeFrame(t, "1m"), begin, begin+4*minute)
+	require.NoError(t, err)
+	require.Len(t, klines, 5)
+	assert.Equal(t, 3, requests)
+
+	for i, kline := range klines {
+		assert.Equal(t, begin+int64(i)*minute, kline.UtcBegin)
+	}
+
+	kline := klines[0]
+	assert.Equal(t, "binance", kline.Exchange)
+	assert.Equal(t, "BTC_USDT", kline.Pair)
+	assert.Equal(t, "MINUTE_1", kline.TimeFrame)
+	assert.Equal(t, "100", kline.O.String())
+	assert.Equal(t, "110", kline.H.String())
+	assert.Equal(t, "90", kline.L.String())
+	assert.Equal(t, "105", kline.C.String())
+	assert.Equal(t, begin+minute-1, kline.UtcEnd)
+	assert.Equal(t, "4", kline.VolumeBS.BuyBase.String())
+	assert.Equal(t, "6", kline.VolumeBS.SellBase.String())
+	assert.Equal(t, "420", kline.VolumeBS.BuyQuote.String())
+	assert.Equal(t, "580", kline.VolumeBS.SellQuote.String())
+	assert.Equal(t, int64(7), kline.TradeCount)
+	assert.Equal(t, "10", kline.BaseVolume.String())
+	assert.Equal(t, "1000", kline.QuoteVolume.String())
+	assert.Equal(t, "100", kline.VWAP.String())
+}
+
+func TestClient_GetHistoricalKlines_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL)
+
+	_, err := client.GetHistoricalKlines(context.Background(), btcUSDT, mustTimeFrame(t, "1m"), 0, 60000)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid symbol.")
+
+	_, err = client.GetHistoricalKlines(context.Background(), btcUSDT, mustTimeFrame(t, "10m"), 0, 60000)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestClient_GetHistoricalTrades(t *testing.T) {
+	begin := time.Date(2024, 7, 3, 0, 0, 0, 0, time.UTC).UnixMilli()
+	end := begin + 2*time.Hour.Milliseconds()
+	const every = 3000 // 1200 trades an hour, more than a page
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/aggTrades", r.URL.Path)
+		assert.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+
+		from, to := queryInt(t, r, "startTime"), queryInt(t, r, "endTime")
+		assert.Less(t, to-from, time.Hour.Milliseconds(), "window too long")
+
+		var trades []string
+		for ts := (from + every - 1) / every * every; ts <= to && len(trades) < maxTradesPageSize; ts += every {
+			id := (ts - begin) / every
+			trades = append(trades, fmt.Sprintf(`{"a":%d,"p":"50000.5","q":"0.2","f":1,"l":1,"T":%d,"m":%t,"M":true}`, id, ts, id%2 == 1))
+		}
+		w.Write([]byte("[" + strings.Join(trades, ",") + "]"))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithRateLimit(1000))
+
+	trades, err := client.GetHistoricalTrades(context.Background(), btcUSDT, begin, end)
+	require.NoError(t, err)
+	require.Len(t, trades, 2401)
+
+	for i, trade := range trades {
+		require.Equal(t, strconv.Itoa(i), trade.Tid)
+		require.Equal(t, begin+int64(i)*every, trade.Timestamp)
+	}
+
+	trade := trades[1]
+	assert.Equal(t, "binance", trade.Exchange)
+	assert.Equal(t, "BTC_USDT", trade.Pair)
+	assert.Equal(t, "50000.5", trade.Price.String())
+	assert.Equal(t, "0.2", trade.Quantity.String())
+	assert.Equal(t, "10000.1", trade.Amount.String())
+	assert.Equal(t, "sell", trade.Side)
+	assert.Equal(t, "buy", trades[2].Side)
+}
+
+func TestClient_SubscribeToTrades(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	var subscribed []string
+	scripts := [][]string{
+		{
+			`{"e":"aggTrade","E":10,"s":"BTCUSDT","a":1,"p":"50000","q":"0.002","f":1,"l":1,"T":1,"m":false,"M":true}`,
+			`{"e":"aggTrade","E":10,"s":"ETHUSDT","a":2,"p":"3000","q":"0.01","f":2,"l":2,"T":2,"m":true,"M":true}`,
+			`{"e":"aggTrade","E":10,"s":"BTCUSDT","a":3,"p":"50000","q":"0.002","f":3,"l":3,"T":3,"m":false,"M":true}`,
+		},
+		{
+			`{"e":"aggTrade","E":10,"s":"BTCUSDT","a":4,"p":"50000","q":"0.002","f":4,"l":4,"T":4,"m":false,"M":true}`,
+		},
+	}
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var request struct {
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+			ID     int      `json:"id"`
+		}
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"result":null,"id":%d}`, request.ID)))
+
+		mu.Lock()
+		subscribed = request.Params
+		script := scripts[connections%len(scripts)]
+		connections++
+		last := connections == len(scripts)
+		mu.Unlock()
+
+		for _, message := range script {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+
+		if last {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		// Drop the first connection so that the client reconnects.
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), server.URL)
+	trades, err := client.SubscribeToTrades(ctx, []instrument.Instrument{btcUSDT, ethUSDT})
+	require.NoError(t, err)
+
+	expected := map[string]bool{"1": true, "2": true, "3": false, "4": true}
+	for i := 0; i < len(expected); i++ {
+		select {
+		case trade := <-trades:
+			assert.Equal(t, expected[trade.Tid], trade.Reconnected, "trade %s", trade.Tid)
+			assert.Equal(t, "binance", trade.Exchange)
+			if trade.Tid == "2" {
+				assert.Equal(t, "ETH_USDT", trade.Pair)
+				assert.Equal(t, "sell", trade.Side)
+				assert.Equal(t, "30", trade.Amount.String())
+			} else {
+				assert.Equal(t, "BTC_USDT", trade.Pair)
+				assert.Equal(t, "buy", trade.Side)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a trade")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"btcusdt@aggTrade", "ethusdt@aggTrade"}, subscribed)
+}
+
+func TestSubscribe_Rejected(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var request json.RawMessage
+		conn.ReadJSON(&request)
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"error":{"code":2,"msg":"Invalid request"},"id":1}`))
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = subscribe(conn, []string{"btcusdt@aggTrade"})
+	assert.ErrorContains(t, err, "Invalid request")
+}
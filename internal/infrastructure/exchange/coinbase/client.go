@@ -0,0 +1,523 @@
+// Package coinbase is the exchange adapter for Coinbase Exchange market data:
+// historical candles and trades over REST and live matches over the
+// WebSocket feed.
+package coinbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
+	"golang.org/x/time/rate"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/stream"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+// Name identifies Coinbase in the stored data.
+const Name = "coinbase"
+
+const (
+	defaultTradeBufferSize = 1000
+
+	// maxKlinePageSize is the largest number of candles Coinbase returns per request.
+	maxKlinePageSize = 300
+	// tradesPageSize is the number of trades requested at once, the most
+	// Coinbase returns.
+	tradesPageSize = 1000
+	// defaultRequestRate is the number of REST requests sent per second.
+	defaultRequestRate = 5
+	// idleTimeout is how long the stream waits for a message before it
+	// reconnects. Coinbase sends a heartbeat every second for every product.
+	idleTimeout = 10 * time.Second
+)
+
+// granularities maps the canonical timeframe names to the Coinbase candle
+// granularities in seconds.
+var granularities = map[string]int{
+	"MINUTE_1":  60,
+	"MINUTE_5":  300,
+	"MINUTE_15": 900,
+	"HOUR_1":    3600,
+	"HOUR_6":    21600,
+	"DAY_1":     86400,
+}
+
+type Client struct {
+	wsURL   string
+	restURL string
+	client  *http.Client
+	limiter *rate.Limiter
+
+	klinePageSize int
+
+	tradeBufferSize int
+	overflowPolicy  queue.Policy
+	spillDir        string
+	tradesDropped   prometheus.Counter
+	metrics         *metrics.Metrics
+}
+
+type Option func(*Client)
+
+// WithTradeBufferSize sets how many received trades are buffered for the consumer.
+func WithTradeBufferSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.tradeBufferSize = size
+		}
+	}
+}
+
+// WithRateLimit sets how many REST requests are sent per second.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(c *Client) {
+		if requestsPerSecond > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+		}
+	}
+}
+
+// WithKlinePageSize sets how many candles are requested at once, up to the
+// Coinbase limit of 300.
+func WithKlinePageSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 && size <= maxKlinePageSize {
+			c.klinePageSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets what happens to received trades when the consumer
+// falls behind. spillDir is used by queue.PolicySpill.
+func WithOverflowPolicy(policy queue.Policy, spillDir string) Option {
+	return func(c *Client) {
+		c.overflowPolicy = policy
+		c.spillDir = spillDir
+	}
+}
+
+// WithDropCounter sets the counter incremented for every dropped trade.
+func WithDropCounter(counter prometheus.Counter) Option {
+	return func(c *Client) {
+		c.tradesDropped = counter
+	}
+}
+
+// WithMetrics sets the metrics updated for received trades and WebSocket connections.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// NewClient returns a Coinbase Exchange client. wsURL is the feed endpoint,
+// e.g. wss://ws-feed.exchange.coinbase.com, and restURL the API root, e.g.
+// https://api.exchange.coinbase.com.
+func NewClient(wsURL, restURL string, opts ...Option) *Client {
+	c := &Client{
+		wsURL:           wsURL,
+		restURL:         restURL,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		limiter:         rate.NewLimiter(defaultRequestRate, 1),
+		klinePageSize:   maxKlinePageSize,
+		tradeBufferSize: defaultTradeBufferSize,
+		overflowPolicy:  queue.PolicyBlock,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) Name() string {
+	return Name
+}
+
+// productID returns the Coinbase product of an instrument, e.g. BTC-USD.
+func productID(inst instrument.Instrument) string {
+	return inst.Base + "-" + inst.Quote
+}
+
+func granularity(tf timeframe.TimeFrame) (int, error) {
+	granularity, ok := granularities[tf.Name]
+	if !ok {
+		return 0, fmt.Errorf("timeframe %s is not supported by coinbase", tf)
+	}
+	return granularity, nil
+}
+
+// GetHistoricalKlines returns the candles that begin between startTime and
+// endTime (unix ms), oldest first. The range is requested in windows of
+// klinePageSize candles.
+func (c *Client) GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error) {
+	granularity, err := granularity(tf)
+	if err != nil {
+		return nil, err
+	}
+	step := int64(granularity) * 1000
+
+	// Candles begin at multiples of the granularity.
+	var klines []models.Kline
+	for from := (startTime + step - 1) / step * step; from <= endTime; {
+		to := min(from+int64(c.klinePageSize-1)*step, endTime)
+
+		var rows [][]json.Number
+		err := c.get(ctx, "/products/"+productID(inst)+"/candles", url.Values{
+			"granularity": {strconv.Itoa(granularity)},
+			"start":       {time.UnixMilli(from).UTC().Format(time.RFC3339)},
+			"end":         {time.UnixMilli(to).UTC().Format(time.RFC3339)},
+		}, &rows, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Candles come newest first.
+		page := make([]models.Kline, 0, len(rows))
+		for _, row := range rows {
+			kline, err := parseKline(row, tf)
+			if err != nil {
+				return nil, err
+			}
+			if kline.UtcBegin < from || kline.UtcBegin > to {
+				continue
+			}
+			kline.Pair = inst.String()
+			page = append(page, kline)
+		}
+		sort.Slice(page, func(i, j int) bool {
+			return page[i].UtcBegin < page[j].UtcBegin
+		})
+		klines = append(klines, page...)
+
+		from = to + step
+	}
+
+	log.Printf("Received %d klines for %s %s", len(klines), inst, tf)
+	return klines, nil
+}
+
+// parseKline reads a candle in the Coinbase layout: [time, low, high, open,
+// close, volume]. Coinbase has no taker split, so the volume is split evenly
+// between buys and sells and priced at the average of open and close, as for
+// Poloniex.
+func parseKline(row []json.Number, tf timeframe.TimeFrame) (models.Kline, error) {
+	if len(row) < 6 {
+		return models.Kline{}, fmt.Errorf("malformed kline %v", row)
+	}
+
+	seconds, err := row[0].Int64()
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("malformed kline time: %w", err)
+	}
+	values := make([]decimal.Decimal, 5)
+	for i := range values {
+		if values[i], err = decimal.NewFromString(row[i+1].String()); err != nil {
+			return models.Kline{}, fmt.Errorf("malformed field %d: %w", i+1, err)
+		}
+	}
+	low, high, open, closePrice, volume := values[0], values[1], values[2], values[3], values[4]
+
+	oneHalf := decimal.New(5, -1)
+	half, mid := volume.Mul(oneHalf), open.Add(closePrice).Mul(oneHalf)
+
+	begin := seconds * 1000
+	end := begin + tf.Duration.Milliseconds() - 1
+	return models.Kline{
+		Exchange:  Name,
+		TimeFrame: tf.Name,
+		O:         open,
+		H:         high,
+		L:         low,
+		C:         closePrice,
+		UtcBegin:  begin,
+		UtcEnd:    end,
+		BeginDt:   time.UnixMilli(begin).UTC(),
+		EndDt:     time.UnixMilli(end).UTC(),
+		VolumeBS: models.VBS{
+			BuyBase:   half,
+			SellBase:  half,
+			BuyQuote:  half.Mul(mid),
+			SellQuote: half.Mul(mid),
+		},
+		BaseVolume:  volume,
+		QuoteVolume: volume.Mul(mid),
+	}, nil
+}
+
+// match is a trade as sent by both the REST API and the WebSocket feed. The
+// side is the maker's, so the taker traded the other way.
+type match struct {
+	TradeID   int64           `json:"trade_id"`
+	ProductID string          `json:"product_id"`
+	Price     decimal.Decimal `json:"price"`
+	Size      decimal.Decimal `json:"size"`
+	Side      string          `json:"side"`
+	Time      time.Time       `json:"time"`
+}
+
+// trade converts a match of the pair. The amount is in the quote currency and
+// the quantity in the base currency, as with the other exchanges.
+func (m match) trade(pair string) models.RecentTrade {
+	side := "buy"
+	if m.Side == "buy" {
+		side = "sell"
+	}
+
+	timestamp := m.Time.UnixMilli()
+	return models.RecentTrade{
+		Exchange:   Name,
+		Tid:        strconv.FormatInt(m.TradeID, 10),
+		Pair:       pair,
+		Symbol:     pair,
+		Price:      m.Price,
+		Amount:     m.Price.Mul(m.Size),
+		Quantity:   m.Size,
+		Side:       side,
+		Timestamp:  timestamp,
+		CreateTime: timestamp,
+	}
+}
+
+// GetHistoricalTrades returns the trades of the instrument made between from
+// and to (unix ms), oldest first. Coinbase pages trades from the newest
+// backwards, so the pages are followed until they reach past from.
+func (c *Client) GetHistoricalTrades(ctx context.Context, inst instrument.Instrument, from, to int64) ([]models.RecentTrade, error) {
+	pair := inst.String()
+	query := url.Values{"limit": {strconv.Itoa(tradesPageSize)}}
+	var trades []models.RecentTrade
+
+	for {
+		var page []match
+		header := make(http.Header)
+		if err := c.get(ctx, "/products/"+productID(inst)+"/trades", query, &page, header); err != nil {
+			return nil, err
+		}
+
+		done := len(page) == 0
+		for _, raw := range page {
+			timestamp := raw.Time.UnixMilli()
+			if timestamp < from {
+				done = true
+				break
+			}
+			if timestamp > to {
+				continue
+			}
+
+			trades = append(trades, raw.trade(pair))
+		}
+
+		after := header.Get("Cb-After")
+		if done || after == "" || after == query.Get("after") {
+			break
+		}
+		query.Set("after", after)
+	}
+
+	// The pages come newest first.
+	slices.Reverse(trades)
+	return trades, nil
+}
+
+// get sends a rate limited GET request to the REST API and decodes the JSON
+// response into out. If header is not nil, the response headers are copied
+// into it.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any, header http.Header) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait error: %w", err)
+	}
+
+	u := c.restURL + path + "?" + query.Encode()
+	log.Printf("Making request to: %s", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request error: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response error: %w", err)
+	}
+	if header != nil {
+		for key, values := range resp.Header {
+			header[key] = values
+		}
+	}
+	return nil
+}
+
+// message is a message of the WebSocket feed.
+type message struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+
+	// LastTradeID is set on heartbeats.
+	LastTradeID int64 `json:"last_trade_id"`
+	match
+}
+
+// SubscribeToTrades streams the matches of the instruments. The trade ids are
+// the ones GetHistoricalTrades returns, so a gap filled after a reconnect
+// does not duplicate trades.
+//
+// Coinbase sends a heartbeat with the last trade id of every product each
+// second. A heartbeat that is ahead of the received matches means matches
+// were lost, and the stream reconnects so that the gap is filled; without
+// heartbeats the stream reconnects as well.
+func (c *Client) SubscribeToTrades(ctx context.Context, instruments []instrument.Instrument) (<-chan models.RecentTrade, error) {
+	log.Printf("Starting subscription to trades for pairs: %v", instruments)
+	trades := queue.New[models.RecentTrade](
+		c.tradeBufferSize,
+		c.overflowPolicy,
+		filepath.Join(c.spillDir, "coinbase-trades.spill"),
+		c.tradesDropped,
+	)
+
+	products := make([]string, len(instruments))
+	pairs := make(map[string]string, len(instruments))
+	for i, inst := range instruments {
+		products[i] = productID(inst)
+		pairs[products[i]] = inst.String()
+	}
+
+	// reconnected holds the pairs that have not received a trade on the
+	// current connection yet; their next trade is marked as Reconnected.
+	// lastTradeID holds the last trade id received for each product on the
+	// current connection.
+	reconnected := make(map[string]bool, len(pairs))
+	lastTradeID := make(map[string]int64, len(pairs))
+	onConnect := func() {
+		for _, pair := range pairs {
+			reconnected[pair] = true
+		}
+		clear(lastTradeID)
+	}
+
+	go func() {
+		defer trades.Close()
+
+		stream.Stream{
+			URL: c.wsURL,
+			Subscribe: func(conn *websocket.Conn) error {
+				return subscribe(conn, products)
+			},
+			OnConnect:   onConnect,
+			Metrics:     c.metrics,
+			IdleTimeout: idleTimeout,
+			Handle: func(_ *websocket.Conn, raw []byte) error {
+				var msg message
+				if err := json.Unmarshal(raw, &msg); err != nil {
+					log.Printf("Error parsing message: %v", err)
+					return nil
+				}
+
+				switch msg.Type {
+				case "heartbeat":
+					last, ok := lastTradeID[msg.ProductID]
+					if ok && msg.LastTradeID > last {
+						return fmt.Errorf("missed trades of %s after %d, heartbeat is at %d", msg.ProductID, last, msg.LastTradeID)
+					}
+					return nil
+				case "error":
+					return fmt.Errorf("feed error: %s %s", msg.Message, msg.Reason)
+				case "match", "last_match":
+				default:
+					return nil
+				}
+
+				pair, ok := pairs[msg.ProductID]
+				if !ok {
+					log.Printf("Skipping trade of unexpected product %s", msg.ProductID)
+					return nil
+				}
+				lastTradeID[msg.ProductID] = max(lastTradeID[msg.ProductID], msg.TradeID)
+
+				trade := msg.trade(pair)
+				if reconnected[pair] {
+					trade.Reconnected = true
+					delete(reconnected, pair)
+				}
+
+				c.metrics.TradeReceived(pair)
+				trades.Push(ctx, trade)
+				c.metrics.SetQueueLength(metrics.StageExchange, trades.Len())
+				return nil
+			},
+		}.Run(ctx)
+	}()
+
+	return trades.C(), nil
+}
+
+// subscribe asks for the matches and heartbeats of the products and waits
+// for the confirmation.
+func subscribe(conn *websocket.Conn, products []string) error {
+	request := struct {
+		Type       string   `json:"type"`
+		ProductIDs []string `json:"product_ids"`
+		Channels   []string `json:"channels"`
+	}{Type: "subscribe", ProductIDs: products, Channels: []string{"matches", "heartbeat"}}
+
+	log.Printf("Subscribing to %v", products)
+	if err := conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("subscribe error: %w", err)
+	}
+
+	var response struct {
+		Type     string `json:"type"`
+		Message  string `json:"message"`
+		Reason   string `json:"reason"`
+		Channels []struct {
+			Name       string   `json:"name"`
+			ProductIDs []string `json:"product_ids"`
+		} `json:"channels"`
+	}
+	if err := conn.ReadJSON(&response); err != nil {
+		return fmt.Errorf("read subscription response error: %w", err)
+	}
+
+	switch response.Type {
+	case "subscriptions":
+		for _, channel := range response.Channels {
+			if channel.Name == "matches" && len(channel.ProductIDs) != len(products) {
+				return fmt.Errorf("subscribed to the matches of %v only", channel.ProductIDs)
+			}
+		}
+		return nil
+	case "error":
+		return fmt.Errorf("subscription rejected: %s %s", response.Message, response.Reason)
+	default:
+		return fmt.Errorf("unexpected subscription response %q", response.Type)
+	}
+}
@@ -0,0 +1,274 @@
+package coinbase
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+var (
+	btcUSD = instrument.New("BTC", "USD")
+	ethUSD = instrument.New("ETH", "USD")
+)
+
+func mustTimeFrame(t *testing.T, name string) timeframe.TimeFrame {
+	t.Helper()
+	tf, err := timeframe.Parse(name)
+	require.NoError(t, err)
+	return tf
+}
+
+// fixture returns a recorded response from testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+// fixtureLines returns a recorded WebSocket session from testdata, one
+// message per line.
+func fixtureLines(t *testing.T, name string) []string {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestClient_GetHistoricalKlines(t *testing.T) {
+	var windows [][2]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/products/BTC-USD/candles", r.URL.Path)
+		assert.Equal(t, "60", r.URL.Query().Get("granularity"))
+		windows = append(windows, [2]string{r.URL.Query().Get("start"), r.URL.Query().Get("end")})
+		w.Write(fixture(t, "candles.json"))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithKlinePageSize(2), WithRateLimit(1000))
+
+	begin := time.Unix(1719999900, 0).UnixMilli()
+	klines, err := client.GetHistoricalKlines(context.Background(), btcUSD, mustTimeFrame(t, "1m"), begin, begin+3*time.Minute.Milliseconds())
+	require.NoError(t, err)
+
+	assert.Equal(t, [][2]string{
+		{"2024-07-03T09:45:00Z", "2024-07-03T09:46:00Z"},
+		{"2024-07-03T09:47:00Z", "2024-07-03T09:48:00Z"},
+	}, windows)
+
+	require.Len(t, klines, 4)
+	for i, kline := range klines {
+		assert.Equal(t, begin+int64(i)*time.Minute.Milliseconds(), kline.UtcBegin)
+	}
+
+	kline := klines[1]
+	assert.Equal(t, "coinbase", kline.Exchange)
+	assert.Equal(t, "BTC_USD", kline.Pair)
+	assert.Equal(t, "MINUTE_1", kline.TimeFrame)
+	assert.Equal(t, "60300.2", kline.O.String())
+	assert.Equal(t, "60318", kline.H.String())
+	assert.Equal(t, "60299.9", kline.L.String())
+	assert.Equal(t, "60312.4", kline.C.String())
+	assert.Equal(t, kline.UtcBegin+time.Minute.Milliseconds()-1, kline.UtcEnd)
+	assert.Equal(t, "1.25", kline.VolumeBS.BuyBase.String())
+	assert.Equal(t, "1.25", kline.VolumeBS.SellBase.String())
+	assert.Equal(t, "2.5", kline.BaseVolume.String())
+	// Coinbase reports no quote volume; it is estimated at the mid price.
+	assert.Equal(t, "150765.75", kline.QuoteVolume.String())
+}
+
+func TestClient_GetHistoricalKlines_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"NotFound"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithRateLimit(1000))
+
+	_, err := client.GetHistoricalKlines(context.Background(), btcUSD, mustTimeFrame(t, "1m"), 0, 60000)
+	assert.ErrorContains(t, err, "NotFound")
+
+	_, err = client.GetHistoricalKlines(context.Background(), btcUSD, mustTimeFrame(t, "4h"), 0, 60000)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestClient_GetHistoricalTrades(t *testing.T) {
+	var cursors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/products/BTC-USD/trades", r.URL.Path)
+
+		after := r.URL.Query().Get("after")
+		cursors = append(cursors, after)
+		switch after {
+		case "":
+			w.Header().Set("Cb-After", "665217803")
+			w.Write(fixture(t, "trades_1.json"))
+		case "665217803":
+			w.Header().Set("Cb-After", "665217800")
+			w.Write(fixture(t, "trades_2.json"))
+		default:
+			t.Errorf("unexpected cursor %s", after)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithRateLimit(1000))
+
+	from := time.Date(2024, 7, 3, 10, 15, 0, 0, time.UTC).UnixMilli()
+	to := time.Date(2024, 7, 3, 10, 16, 35, 0, time.UTC).UnixMilli()
+	trades, err := client.GetHistoricalTrades(context.Background(), btcUSD, from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "665217803"}, cursors)
+
+	// The newest recorded trade is past the range and the oldest before it.
+	var ids []string
+	for _, trade := range trades {
+		ids = append(ids, trade.Tid)
+	}
+	assert.Equal(t, []string{"665217801", "665217802", "665217803", "665217804"}, ids)
+
+	trade := trades[0]
+	assert.Equal(t, "coinbase", trade.Exchange)
+	assert.Equal(t, "BTC_USD", trade.Pair)
+	assert.Equal(t, "60312.4", trade.Price.String())
+	assert.Equal(t, "0.00165", trade.Quantity.String())
+	assert.Equal(t, "99.51546", trade.Amount.String())
+	assert.Equal(t, int64(1720001701254), trade.Timestamp)
+	// The recorded side is the maker's.
+	assert.Equal(t, "buy", trades[0].Side)
+	assert.Equal(t, "sell", trades[2].Side)
+}
+
+// replayServer serves recorded WebSocket sessions: it reads the subscription
+// request, sends the messages of the next session and keeps the connection
+// open until the client closes it.
+func replayServer(t *testing.T, sessions [][]string, requests chan<- json.RawMessage) *httptest.Server {
+	var mu sync.Mutex
+	served := 0
+
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var request json.RawMessage
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		requests <- request
+
+		mu.Lock()
+		session := sessions[min(served, len(sessions)-1)]
+		served++
+		mu.Unlock()
+
+		for _, message := range session {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestClient_SubscribeToTrades(t *testing.T) {
+	// The first session gets a heartbeat ahead of its matches, so the client
+	// reconnects although the server keeps the connection open.
+	requests := make(chan json.RawMessage, 2)
+	server := replayServer(t, [][]string{
+		fixtureLines(t, "ws_missed.jsonl"),
+		fixtureLines(t, "ws_matches.jsonl"),
+	}, requests)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), server.URL)
+	trades, err := client.SubscribeToTrades(ctx, []instrument.Instrument{btcUSD, ethUSD})
+	require.NoError(t, err)
+
+	expected := []struct {
+		tid         string
+		reconnected bool
+	}{
+		{"665217801", true},
+		{"665217801", true}, {"512390871", true}, {"665217802", false},
+	}
+	for _, want := range expected {
+		select {
+		case trade := <-trades:
+			assert.Equal(t, want.tid, trade.Tid)
+			assert.Equal(t, want.reconnected, trade.Reconnected, "trade %s", trade.Tid)
+			assert.Equal(t, "coinbase", trade.Exchange)
+			switch trade.Tid {
+			case "665217801":
+				assert.Equal(t, "BTC_USD", trade.Pair)
+				assert.Equal(t, "buy", trade.Side)
+				assert.Equal(t, "99.51546", trade.Amount.String())
+			case "512390871":
+				assert.Equal(t, "ETH_USD", trade.Pair)
+				assert.Equal(t, "sell", trade.Side)
+				assert.Equal(t, "4951.875", trade.Amount.String())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a trade")
+		}
+	}
+
+	var request struct {
+		Type       string   `json:"type"`
+		ProductIDs []string `json:"product_ids"`
+		Channels   []string `json:"channels"`
+	}
+	require.NoError(t, json.Unmarshal(<-requests, &request))
+	assert.Equal(t, "subscribe", request.Type)
+	assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, request.ProductIDs)
+	assert.Equal(t, []string{"matches", "heartbeat"}, request.Channels)
+	assert.Len(t, requests, 1, "client did not reconnect")
+}
+
+func TestSubscribe_Rejected(t *testing.T) {
+	requests := make(chan json.RawMessage, 1)
+	server := replayServer(t, [][]string{fixtureLines(t, "ws_subscribe_error.jsonl")}, requests)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = subscribe(conn, []string{"XYZ-USD"})
+	assert.ErrorContains(t, err, "XYZ-USD is not a valid product")
+}
@@ -0,0 +1,69 @@
+// Package exchange creates the exchange adapter selected in the config.
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/binance"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/coinbase"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/kraken"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/poloniex"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+// Settings are the settings every adapter understands. An empty
+// OverflowPolicy means queue.PolicyBlock.
+type Settings struct {
+	WSURL   string
+	RestURL string
+
+	TradeBufferSize int
+	OverflowPolicy  queue.Policy
+	SpillDir        string
+	DropCounter     prometheus.Counter
+	Metrics         *metrics.Metrics
+}
+
+// New returns the adapter of the named exchange.
+func New(name string, s Settings) (repository.ExchangeClient, error) {
+	if s.OverflowPolicy == "" {
+		s.OverflowPolicy = queue.PolicyBlock
+	}
+
+	switch name {
+	case poloniex.Name:
+		return poloniex.NewClient(s.WSURL, s.RestURL,
+			poloniex.WithTradeBufferSize(s.TradeBufferSize),
+			poloniex.WithOverflowPolicy(s.OverflowPolicy, s.SpillDir),
+			poloniex.WithDropCounter(s.DropCounter),
+			poloniex.WithMetrics(s.Metrics),
+		), nil
+	case binance.Name:
+		return binance.NewClient(s.WSURL, s.RestURL,
+			binance.WithTradeBufferSize(s.TradeBufferSize),
+			binance.WithOverflowPolicy(s.OverflowPolicy, s.SpillDir),
+			binance.WithDropCounter(s.DropCounter),
+			binance.WithMetrics(s.Metrics),
+		), nil
+	case kraken.Name:
+		return kraken.NewClient(s.WSURL, s.RestURL,
+			kraken.WithTradeBufferSize(s.TradeBufferSize),
+			kraken.WithOverflowPolicy(s.OverflowPolicy, s.SpillDir),
+			kraken.WithDropCounter(s.DropCounter),
+			kraken.WithMetrics(s.Metrics),
+		), nil
+	case coinbase.Name:
+		return coinbase.NewClient(s.WSURL, s.RestURL,
+			coinbase.WithTradeBufferSize(s.TradeBufferSize),
+			coinbase.WithOverflowPolicy(s.OverflowPolicy, s.SpillDir),
+			coinbase.WithDropCounter(s.DropCounter),
+			coinbase.WithMetrics(s.Metrics),
+		), nil
+	default:
+		return nil, fmt.Errorf("unsupported exchange %q", name)
+	}
+}
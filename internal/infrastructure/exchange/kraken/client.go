@@ -0,0 +1,618 @@
+// Package kraken is the exchange adapter for Kraken spot market data:
+// historical OHLC candles and trades over REST and live trades over the v2
+// WebSocket API.
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
+	"golang.org/x/time/rate"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/stream"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+// Name identifies Kraken in the stored data.
+const Name = "kraken"
+
+const (
+	defaultTradeBufferSize = 1000
+
+	// tradesPageSize is the number of trades requested at once, the most
+	// Kraken returns.
+	tradesPageSize = 1000
+	// defaultRequestRate is the number of REST requests sent per second;
+	// Kraken allows about one public request a second.
+	defaultRequestRate = 1
+	// idleTimeout is how long the stream waits for a message before it
+	// reconnects. Kraken sends a heartbeat every second while subscribed.
+	idleTimeout = 10 * time.Second
+)
+
+// intervals maps the canonical timeframe names to the Kraken OHLC intervals
+// in minutes.
+var intervals = map[string]int{
+	"MINUTE_1":  1,
+	"MINUTE_5":  5,
+	"MINUTE_15": 15,
+	"MINUTE_30": 30,
+	"HOUR_1":    60,
+	"HOUR_4":    240,
+	"DAY_1":     1440,
+	"WEEK_1":    10080,
+}
+
+// restAssets maps asset codes to the legacy codes the REST API uses in
+// pair names.
+var restAssets = map[string]string{
+	"BTC":  "XBT",
+	"DOGE": "XDG",
+}
+
+type Client struct {
+	wsURL   string
+	restURL string
+	client  *http.Client
+	limiter *rate.Limiter
+
+	tradeBufferSize int
+	overflowPolicy  queue.Policy
+	spillDir        string
+	tradesDropped   prometheus.Counter
+	metrics         *metrics.Metrics
+}
+
+type Option func(*Client)
+
+// WithTradeBufferSize sets how many received trades are buffered for the consumer.
+func WithTradeBufferSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.tradeBufferSize = size
+		}
+	}
+}
+
+// WithRateLimit sets how many REST requests are sent per second.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(c *Client) {
+		if requestsPerSecond > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+		}
+	}
+}
+
+// WithOverflowPolicy sets what happens to received trades when the consumer
+// falls behind. spillDir is used by queue.PolicySpill.
+func WithOverflowPolicy(policy queue.Policy, spillDir string) Option {
+	return func(c *Client) {
+		c.overflowPolicy = policy
+		c.spillDir = spillDir
+	}
+}
+
+// WithDropCounter sets the counter incremented for every dropped trade.
+func WithDropCounter(counter prometheus.Counter) Option {
+	return func(c *Client) {
+		c.tradesDropped = counter
+	}
+}
+
+// WithMetrics sets the metrics updated for received trades and WebSocket connections.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// NewClient returns a Kraken client. wsURL is the v2 endpoint, e.g.
+// wss://ws.kraken.com/v2, and restURL the API root, e.g.
+// https://api.kraken.com.
+func NewClient(wsURL, restURL string, opts ...Option) *Client {
+	c := &Client{
+		wsURL:           wsURL,
+		restURL:         restURL,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		limiter:         rate.NewLimiter(defaultRequestRate, 1),
+		tradeBufferSize: defaultTradeBufferSize,
+		overflowPolicy:  queue.PolicyBlock,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) Name() string {
+	return Name
+}
+
+// wsSymbol returns the WebSocket symbol of an instrument, e.g. BTC/USD.
+func wsSymbol(inst instrument.Instrument) string {
+	return inst.Base + "/" + inst.Quote
+}
+
+// restSymbol returns the REST pair name of an instrument, e.g. XBTUSD.
+func restSymbol(inst instrument.Instrument) string {
+	return restAsset(inst.Base) + restAsset(inst.Quote)
+}
+
+func restAsset(asset string) string {
+	if legacy, ok := restAssets[asset]; ok {
+		return legacy
+	}
+	return asset
+}
+
+func interval(tf timeframe.TimeFrame) (int, error) {
+	interval, ok := intervals[tf.Name]
+	if !ok {
+		return 0, fmt.Errorf("timeframe %s is not supported by kraken", tf)
+	}
+	return interval, nil
+}
+
+// GetHistoricalKlines returns the candles that begin between startTime and
+// endTime (unix ms), oldest first. Kraken serves only the latest 720 candles
+// of each interval, so older parts of the range come back empty.
+func (c *Client) GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error) {
+	interval, err := interval(tf)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []models.Kline
+	for from := startTime; from <= endTime; {
+		var result map[string]json.RawMessage
+		err := c.get(ctx, "/0/public/OHLC", url.Values{
+			"pair":     {restSymbol(inst)},
+			"interval": {strconv.Itoa(interval)},
+			"since":    {strconv.FormatInt(from/1000-1, 10)},
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := pairRows(result)
+		if err != nil {
+			return nil, err
+		}
+
+		next := from
+		for _, row := range rows {
+			kline, err := parseKline(row, tf)
+			if err != nil {
+				return nil, err
+			}
+			if kline.UtcBegin < from || kline.UtcBegin > endTime {
+				continue
+			}
+			kline.Pair = inst.String()
+			klines = append(klines, kline)
+			next = kline.UtcBegin + 1
+		}
+
+		// The response ends with the current candle, so a page that did not
+		// move past from is the last one.
+		if next == from {
+			break
+		}
+		from = next
+	}
+
+	log.Printf("Received %d klines for %s %s", len(klines), inst, tf)
+	return klines, nil
+}
+
+// pairRows returns the rows of the only pair in a result. The result is keyed
+// by the canonical pair name, e.g. XXBTZUSD, which differs from the
+// requested one, next to the "last" cursor.
+func pairRows(result map[string]json.RawMessage) ([][]json.RawMessage, error) {
+	for key, raw := range result {
+		if key == "last" {
+			continue
+		}
+		var rows [][]json.RawMessage
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, fmt.Errorf("malformed %s rows: %w", key, err)
+		}
+		return rows, nil
+	}
+	return nil, nil
+}
+
+// parseKline reads a candle in the Kraken OHLC layout: [time, open, high,
+// low, close, vwap, volume, count]. Kraken has no taker split, so the volume
+// is split evenly between buys and sells and priced at the vwap.
+func parseKline(row []json.RawMessage, tf timeframe.TimeFrame) (models.Kline, error) {
+	if len(row) < 8 {
+		return models.Kline{}, fmt.Errorf("malformed kline %s", row)
+	}
+
+	r := rowReader{row: row}
+	begin := r.int(0) * 1000
+	open, high, low, closePrice := r.decimal(1), r.decimal(2), r.decimal(3), r.decimal(4)
+	vwap, volume, tradeCount := r.decimal(5), r.decimal(6), r.int(7)
+	if r.err != nil {
+		return models.Kline{}, r.err
+	}
+
+	end := begin + tf.Duration.Milliseconds() - 1
+	half := volume.Mul(decimal.New(5, -1))
+	return models.Kline{
+		Exchange:  Name,
+		TimeFrame: tf.Name,
+		O:         open,
+		H:         high,
+		L:         low,
+		C:         closePrice,
+		UtcBegin:  begin,
+		UtcEnd:    end,
+		BeginDt:   time.UnixMilli(begin).UTC(),
+		EndDt:     time.UnixMilli(end).UTC(),
+		VolumeBS: models.VBS{
+			BuyBase:   half,
+			SellBase:  half,
+			BuyQuote:  half.Mul(vwap),
+			SellQuote: half.Mul(vwap),
+		},
+		TradeCount:  tradeCount,
+		VWAP:        vwap,
+		BaseVolume:  volume,
+		QuoteVolume: volume.Mul(vwap),
+	}, nil
+}
+
+// rowReader reads the fields of a JSON array row and keeps the first error.
+type rowReader struct {
+	row []json.RawMessage
+	err error
+}
+
+func (r *rowReader) int(i int) int64 {
+	var v int64
+	if err := json.Unmarshal(r.row[i], &v); err != nil && r.err == nil {
+		r.err = fmt.Errorf("malformed field %d: %w", i, err)
+	}
+	return v
+}
+
+// number reads a number sent as a JSON number.
+func (r *rowReader) number(i int) float64 {
+	var v float64
+	if err := json.Unmarshal(r.row[i], &v); err != nil && r.err == nil {
+		r.err = fmt.Errorf("malformed field %d: %w", i, err)
+	}
+	return v
+}
+
+// string reads a string field.
+func (r *rowReader) string(i int) string {
+	var s string
+	if err := json.Unmarshal(r.row[i], &s); err != nil && r.err == nil {
+		r.err = fmt.Errorf("malformed field %d: %w", i, err)
+	}
+	return s
+}
+
+// decimal reads a number sent as a string.
+func (r *rowReader) decimal(i int) decimal.Decimal {
+	var v decimal.Decimal
+	if err := json.Unmarshal(r.row[i], &v); err != nil && r.err == nil {
+		r.err = fmt.Errorf("malformed field %d: %w", i, err)
+	}
+	return v
+}
+
+// newTrade builds a trade of the pair. The amount is in the quote currency
+// and the quantity in the base currency, as with the other exchanges.
+func newTrade(pair string, id int64, price, quantity decimal.Decimal, side string, timestamp int64) models.RecentTrade {
+	return models.RecentTrade{
+		Exchange:   Name,
+		Tid:        strconv.FormatInt(id, 10),
+		Pair:       pair,
+		Symbol:     pair,
+		Price:      price,
+		Amount:     price.Mul(quantity),
+		Quantity:   quantity,
+		Side:       side,
+		Timestamp:  timestamp,
+		CreateTime: timestamp,
+	}
+}
+
+// parseTrade reads a trade in the REST layout: [price, volume, time,
+// buy/sell, market/limit, miscellaneous, trade id]. The side is the taker's.
+func parseTrade(pair string, row []json.RawMessage) (models.RecentTrade, error) {
+	if len(row) < 7 {
+		return models.RecentTrade{}, fmt.Errorf("malformed trade %s", row)
+	}
+
+	r := rowReader{row: row}
+	price, quantity := r.decimal(0), r.decimal(1)
+	seconds := r.number(2)
+	side := r.string(3)
+	id := r.int(6)
+	if r.err != nil {
+		return models.RecentTrade{}, r.err
+	}
+
+	if side == "s" {
+		side = "sell"
+	} else {
+		side = "buy"
+	}
+	return newTrade(pair, id, price, quantity, side, int64(math.Round(seconds*1000))), nil
+}
+
+// GetHistoricalTrades returns the trades of the instrument made between from
+// and to (unix ms), oldest first, following the "last" cursor of the Trades
+// endpoint.
+func (c *Client) GetHistoricalTrades(ctx context.Context, inst instrument.Instrument, from, to int64) ([]models.RecentTrade, error) {
+	pair := inst.String()
+	since := strconv.FormatInt(from*int64(time.Millisecond), 10)
+	var trades []models.RecentTrade
+
+	for {
+		var result map[string]json.RawMessage
+		err := c.get(ctx, "/0/public/Trades", url.Values{
+			"pair":  {restSymbol(inst)},
+			"since": {since},
+			"count": {strconv.Itoa(tradesPageSize)},
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := pairRows(result)
+		if err != nil {
+			return nil, err
+		}
+
+		// A page ends the range when it is empty or reaches past to.
+		done := len(rows) == 0
+		for _, row := range rows {
+			trade, err := parseTrade(pair, row)
+			if err != nil {
+				log.Printf("Skipping trade of %s: %v", pair, err)
+				continue
+			}
+			if trade.Timestamp > to {
+				done = true
+				break
+			}
+			if trade.Timestamp >= from {
+				trades = append(trades, trade)
+			}
+		}
+
+		var last string
+		if raw, ok := result["last"]; ok {
+			json.Unmarshal(raw, &last)
+		}
+		if done || last == "" || last == since {
+			break
+		}
+		since = last
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Timestamp < trades[j].Timestamp
+	})
+	return trades, nil
+}
+
+// get sends a rate limited GET request to the REST API and decodes the
+// result of the response into out. Kraken reports errors in the body, often
+// with status 200.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait error: %w", err)
+	}
+
+	u := c.restURL + path + "?" + query.Encode()
+	log.Printf("Making request to: %s", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request error: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response struct {
+		Error  []string        `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("decode response error: %w", err)
+	}
+	if len(response.Error) > 0 {
+		return fmt.Errorf("kraken error: %s", strings.Join(response.Error, ", "))
+	}
+	if err := json.Unmarshal(response.Result, out); err != nil {
+		return fmt.Errorf("decode result error: %w", err)
+	}
+	return nil
+}
+
+// message is the envelope of every v2 WebSocket message: channel messages
+// carry a channel, request responses a method.
+type message struct {
+	Channel string          `json:"channel"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+
+	Method  string `json:"method"`
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+	Result  struct {
+		Symbol string `json:"symbol"`
+	} `json:"result"`
+}
+
+// wsTrade is a trade of the v2 trade channel. The side is the taker's.
+type wsTrade struct {
+	Symbol    string          `json:"symbol"`
+	Side      string          `json:"side"`
+	Price     decimal.Decimal `json:"price"`
+	Qty       decimal.Decimal `json:"qty"`
+	TradeID   int64           `json:"trade_id"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// SubscribeToTrades streams the trades of the instruments. The trade ids are
+// the ones GetHistoricalTrades returns, so a gap filled after a reconnect
+// does not duplicate trades. The heartbeats Kraken sends every second keep
+// the connection alive; without them the stream reconnects.
+func (c *Client) SubscribeToTrades(ctx context.Context, instruments []instrument.Instrument) (<-chan models.RecentTrade, error) {
+	log.Printf("Starting subscription to trades for pairs: %v", instruments)
+	trades := queue.New[models.RecentTrade](
+		c.tradeBufferSize,
+		c.overflowPolicy,
+		filepath.Join(c.spillDir, "kraken-trades.spill"),
+		c.tradesDropped,
+	)
+
+	symbols := make([]string, len(instruments))
+	pairs := make(map[string]string, len(instruments))
+	for i, inst := range instruments {
+		symbols[i] = wsSymbol(inst)
+		pairs[symbols[i]] = inst.String()
+	}
+
+	// reconnected holds the pairs that have not received a trade on the
+	// current connection yet; their next trade is marked as Reconnected.
+	reconnected := make(map[string]bool, len(pairs))
+	onConnect := func() {
+		for _, pair := range pairs {
+			reconnected[pair] = true
+		}
+	}
+
+	go func() {
+		defer trades.Close()
+
+		stream.Stream{
+			URL: c.wsURL,
+			Subscribe: func(conn *websocket.Conn) error {
+				return subscribe(conn, symbols)
+			},
+			OnConnect:   onConnect,
+			Metrics:     c.metrics,
+			IdleTimeout: idleTimeout,
+			Handle: func(_ *websocket.Conn, raw []byte) error {
+				var msg message
+				if err := json.Unmarshal(raw, &msg); err != nil {
+					log.Printf("Error parsing message: %v", err)
+					return nil
+				}
+				if msg.Method != "" && !msg.Success {
+					return fmt.Errorf("%s failed: %s", msg.Method, msg.Error)
+				}
+				if msg.Channel != "trade" {
+					// heartbeat and status messages only keep the connection alive
+					return nil
+				}
+
+				var data []wsTrade
+				if err := json.Unmarshal(msg.Data, &data); err != nil {
+					log.Printf("Error parsing trades: %v", err)
+					return nil
+				}
+
+				for _, t := range data {
+					pair, ok := pairs[t.Symbol]
+					if !ok {
+						log.Printf("Skipping trade of unexpected symbol %s", t.Symbol)
+						continue
+					}
+
+					trade := newTrade(pair, t.TradeID, t.Price, t.Qty, t.Side, t.Timestamp.UnixMilli())
+					if reconnected[pair] {
+						trade.Reconnected = true
+						delete(reconnected, pair)
+					}
+
+					c.metrics.TradeReceived(pair)
+					trades.Push(ctx, trade)
+					c.metrics.SetQueueLength(metrics.StageExchange, trades.Len())
+				}
+				return nil
+			},
+		}.Run(ctx)
+	}()
+
+	return trades.C(), nil
+}
+
+// subscribe asks for the trades of the symbols and waits until every symbol
+// is acknowledged. Trades that arrive in the meantime are skipped; they are
+// older than the first trade marked as Reconnected and so are recovered by
+// the gap fill.
+func subscribe(conn *websocket.Conn, symbols []string) error {
+	request := struct {
+		Method string `json:"method"`
+		Params struct {
+			Channel  string   `json:"channel"`
+			Symbol   []string `json:"symbol"`
+			Snapshot bool     `json:"snapshot"`
+		} `json:"params"`
+		ReqID int `json:"req_id"`
+	}{Method: "subscribe", ReqID: 1}
+	request.Params.Channel = "trade"
+	request.Params.Symbol = symbols
+
+	log.Printf("Subscribing to %v", symbols)
+	if err := conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("subscribe error: %w", err)
+	}
+
+	pending := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		pending[symbol] = true
+	}
+	for len(pending) > 0 {
+		var msg message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return fmt.Errorf("read subscription response error: %w", err)
+		}
+		if msg.Method != "subscribe" {
+			continue
+		}
+		if !msg.Success {
+			return fmt.Errorf("subscription rejected: %s", msg.Error)
+		}
+		delete(pending, msg.Result.Symbol)
+	}
+	return nil
+}
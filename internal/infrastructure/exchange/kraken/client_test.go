@@ -0,0 +1,304 @@
+package kraken
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+var (
+	btcUSD = instrument.New("BTC", "USD")
+	ethUSD = instrument.New("ETH", "USD")
+)
+
+func mustTimeFrame(t *testing.T, name string) timeframe.TimeFrame {
+	t.Helper()
+	tf, err := timeframe.Parse(name)
+	require.NoError(t, err)
+	return tf
+}
+
+// fixture returns a recorded response from testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+// fixtureLines returns a recorded WebSocket session from testdata, one
+// message per line.
+func fixtureLines(t *testing.T, name string) []string {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestSymbols(t *testing.T) {
+	assert.Equal(t, "XBTUSD", restSymbol(btcUSD))
+	assert.Equal(t, "XDGUSD", restSymbol(instrument.New("DOGE", "USD")))
+	assert.Equal(t, "ETHUSD", restSymbol(ethUSD))
+	assert.Equal(t, "BTC/USD", wsSymbol(btcUSD))
+}
+
+func TestClient_GetHistoricalKlines(t *testing.T) {
+	var recorded struct {
+		Result struct {
+			Rows [][]json.RawMessage `json:"XXBTZUSD"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(fixture(t, "ohlc.json"), &recorded))
+	rows := recorded.Result.Rows
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/0/public/OHLC", r.URL.Path)
+		assert.Equal(t, "XBTUSD", r.URL.Query().Get("pair"))
+		assert.Equal(t, "1", r.URL.Query().Get("interval"))
+
+		// Kraken returns the candles after since, up to the current one.
+		since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		require.NoError(t, err)
+		page := [][]json.RawMessage{}
+		for _, row := range rows {
+			var begin int64
+			require.NoError(t, json.Unmarshal(row[0], &begin))
+			if begin > since {
+				page = append(page, row)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":  []string{},
+			"result": map[string]any{"XXBTZUSD": page, "last": 1720000020},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithRateLimit(1000))
+
+	// The range starts after the first recorded candle and ends before the
+	// last one.
+	begin := time.Unix(1719999960, 0).UnixMilli()
+	klines, err := client.GetHistoricalKlines(context.Background(), btcUSD, mustTimeFrame(t, "1m"), begin, begin+90*time.Second.Milliseconds())
+	require.NoError(t, err)
+	require.Len(t, klines, 2)
+	assert.Equal(t, 2, requests)
+
+	for i, kline := range klines {
+		assert.Equal(t, begin+int64(i)*time.Minute.Milliseconds(), kline.UtcBegin)
+	}
+
+	kline := klines[0]
+	assert.Equal(t, "kraken", kline.Exchange)
+	assert.Equal(t, "BTC_USD", kline.Pair)
+	assert.Equal(t, "MINUTE_1", kline.TimeFrame)
+	assert.Equal(t, "60300.2", kline.O.String())
+	assert.Equal(t, "60318", kline.H.String())
+	assert.Equal(t, "60299.9", kline.L.String())
+	assert.Equal(t, "60312.4", kline.C.String())
+	assert.Equal(t, kline.UtcBegin+time.Minute.Milliseconds()-1, kline.UtcEnd)
+	assert.Equal(t, "1.25", kline.VolumeBS.BuyBase.String())
+	assert.Equal(t, "1.25", kline.VolumeBS.SellBase.String())
+	assert.Equal(t, "75387.625", kline.VolumeBS.BuyQuote.String())
+	assert.Equal(t, int64(44), kline.TradeCount)
+	assert.Equal(t, "60310.1", kline.VWAP.String())
+	assert.Equal(t, "2.5", kline.BaseVolume.String())
+	assert.Equal(t, "150775.25", kline.QuoteVolume.String())
+}
+
+func TestClient_GetHistoricalKlines_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":["EQuery:Unknown asset pair"]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithRateLimit(1000))
+
+	_, err := client.GetHistoricalKlines(context.Background(), btcUSD, mustTimeFrame(t, "1m"), 0, 60000)
+	assert.ErrorContains(t, err, "EQuery:Unknown asset pair")
+
+	_, err = client.GetHistoricalKlines(context.Background(), btcUSD, mustTimeFrame(t, "10m"), 0, 60000)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestClient_GetHistoricalTrades(t *testing.T) {
+	var sinces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/0/public/Trades", r.URL.Path)
+		assert.Equal(t, "XBTUSD", r.URL.Query().Get("pair"))
+
+		since := r.URL.Query().Get("since")
+		sinces = append(sinces, since)
+		switch since {
+		case "1720001700000000000":
+			w.Write(fixture(t, "trades_1.json"))
+		case "1720001755800411000":
+			w.Write(fixture(t, "trades_2.json"))
+		default:
+			t.Errorf("unexpected since %s", since)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithRateLimit(1000))
+
+	trades, err := client.GetHistoricalTrades(context.Background(), btcUSD, 1720001700000, 1720001800000)
+	require.NoError(t, err)
+	assert.Len(t, sinces, 2)
+
+	// The last recorded trade is past the range.
+	require.Len(t, trades, 4)
+	for i, trade := range trades {
+		assert.Equal(t, strconv.Itoa(72514461+i), trade.Tid)
+	}
+
+	trade := trades[0]
+	assert.Equal(t, "kraken", trade.Exchange)
+	assert.Equal(t, "BTC_USD", trade.Pair)
+	assert.Equal(t, "60312.4", trade.Price.String())
+	assert.Equal(t, "0.00165", trade.Quantity.String())
+	assert.Equal(t, "99.51546", trade.Amount.String())
+	assert.Equal(t, "buy", trade.Side)
+	assert.Equal(t, int64(1720001701254), trade.Timestamp)
+	assert.Equal(t, "sell", trades[1].Side)
+}
+
+// replayServer serves a recorded WebSocket session: it checks the
+// subscription request and then sends the recorded messages. Every
+// connection but the last is dropped after the session so that the client
+// reconnects.
+func replayServer(t *testing.T, session []string, connections int, requests chan<- json.RawMessage) *httptest.Server {
+	var mu sync.Mutex
+	served := 0
+
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var request json.RawMessage
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		requests <- request
+
+		mu.Lock()
+		served++
+		last := served >= connections
+		mu.Unlock()
+
+		for _, message := range session {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+
+		if last {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+	}))
+}
+
+func TestClient_SubscribeToTrades(t *testing.T) {
+	requests := make(chan json.RawMessage, 2)
+	server := replayServer(t, fixtureLines(t, "ws_trades.jsonl"), 2, requests)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), server.URL)
+	trades, err := client.SubscribeToTrades(ctx, []instrument.Instrument{btcUSD, ethUSD})
+	require.NoError(t, err)
+
+	// The recorded session is replayed on both connections.
+	expected := []struct {
+		tid         string
+		reconnected bool
+	}{
+		{"72514461", true}, {"72514462", false}, {"45120987", true},
+		{"72514461", true}, {"72514462", false}, {"45120987", true},
+	}
+	for _, want := range expected {
+		select {
+		case trade := <-trades:
+			assert.Equal(t, want.tid, trade.Tid)
+			assert.Equal(t, want.reconnected, trade.Reconnected, "trade %s", trade.Tid)
+			assert.Equal(t, "kraken", trade.Exchange)
+			switch trade.Tid {
+			case "72514461":
+				assert.Equal(t, "BTC_USD", trade.Pair)
+				assert.Equal(t, "60312.4", trade.Price.String())
+				assert.Equal(t, "buy", trade.Side)
+				assert.Equal(t, "99.51546", trade.Amount.String())
+				assert.Equal(t, int64(1720001701254), trade.Timestamp)
+			case "45120987":
+				assert.Equal(t, "ETH_USD", trade.Pair)
+				assert.Equal(t, "sell", trade.Side)
+				assert.Equal(t, "4951.875", trade.Amount.String())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a trade")
+		}
+	}
+
+	var request struct {
+		Method string `json:"method"`
+		Params struct {
+			Channel  string   `json:"channel"`
+			Symbol   []string `json:"symbol"`
+			Snapshot bool     `json:"snapshot"`
+		} `json:"params"`
+	}
+	require.NoError(t, json.Unmarshal(<-requests, &request))
+	assert.Equal(t, "subscribe", request.Method)
+	assert.Equal(t, "trade", request.Params.Channel)
+	assert.Equal(t, []string{"BTC/USD", "ETH/USD"}, request.Params.Symbol)
+	assert.False(t, request.Params.Snapshot)
+}
+
+func TestSubscribe_Rejected(t *testing.T) {
+	requests := make(chan json.RawMessage, 1)
+	server := replayServer(t, fixtureLines(t, "ws_subscribe_error.jsonl"), 1, requests)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = subscribe(conn, []string{"XYZ/USD"})
+	assert.ErrorContains(t, err, "Currency pair not supported XYZ/USD")
+}
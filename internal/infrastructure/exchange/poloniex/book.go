@@ -0,0 +1,215 @@
+package poloniex
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+)
+
+var (
+	errSequenceGap = errors.New("order book sequence gap")
+	errCrossedBook = errors.New("order book is crossed")
+	errNoSnapshot  = errors.New("order book has no snapshot")
+)
+
+// OrderBook is a local copy of a Poloniex book_lv2 order book.
+//
+// book_lv2 messages carry no checksum, so the book is verified by the
+// message sequence (every update's lastId must match the id of the previous
+// message) and by checking that the best bid stays below the best ask.
+type OrderBook struct {
+	mu        sync.RWMutex
+	symbol    string
+	bids      map[float64]float64
+	asks      map[float64]float64
+	lastID    int64
+	timestamp int64
+	ready     bool
+}
+
+func NewOrderBook(symbol string) *OrderBook {
+	return &OrderBook{
+		symbol: symbol,
+		bids:   make(map[float64]float64),
+		asks:   make(map[float64]float64),
+	}
+}
+
+func (b *OrderBook) applySnapshot(bids, asks [][]string, id, ts int64) error {
+	newBids, err := parseLevels(bids)
+	if err != nil {
+		return err
+	}
+	newAsks, err := parseLevels(asks)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = newBids
+	b.asks = newAsks
+	b.lastID = id
+	b.timestamp = ts
+	b.ready = true
+
+	if err := b.verifyLocked(); err != nil {
+		b.ready = false
+		return err
+	}
+	return nil
+}
+
+// reset marks the book stale until the next snapshot arrives.
+func (b *OrderBook) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ready = false
+}
+
+func (b *OrderBook) applyUpdate(bids, asks [][]string, lastID, id, ts int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.ready {
+		return errNoSnapshot
+	}
+	if lastID != b.lastID {
+		b.ready = false
+		return fmt.Errorf("%w: %s expected lastId %d, got %d", errSequenceGap, b.symbol, b.lastID, lastID)
+	}
+
+	if err := applyLevels(b.bids, bids); err != nil {
+		return err
+	}
+	if err := applyLevels(b.asks, asks); err != nil {
+		return err
+	}
+	b.lastID = id
+	b.timestamp = ts
+
+	if err := b.verifyLocked(); err != nil {
+		b.ready = false
+		return err
+	}
+	return nil
+}
+
+func (b *OrderBook) verifyLocked() error {
+	bid, hasBid := bestLevel(b.bids, true)
+	ask, hasAsk := bestLevel(b.asks, false)
+	if hasBid && hasAsk && bid.Price >= ask.Price {
+		return fmt.Errorf("%w: %s bid %v >= ask %v", errCrossedBook, b.symbol, bid.Price, ask.Price)
+	}
+	return nil
+}
+
+// Ready reports whether the book holds a verified snapshot.
+func (b *OrderBook) Ready() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.ready
+}
+
+func (b *OrderBook) BestBid() (models.PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return bestLevel(b.bids, true)
+}
+
+func (b *OrderBook) BestAsk() (models.PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return bestLevel(b.asks, false)
+}
+
+// Depth returns up to n best levels on each side, best price first.
+// A non-positive n returns the whole book.
+func (b *OrderBook) Depth(n int) (bids, asks []models.PriceLevel) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return sortedLevels(b.bids, true, n), sortedLevels(b.asks, false, n)
+}
+
+// Snapshot returns up to depth best levels on each side together with the
+// book sequence and timestamp.
+func (b *OrderBook) Snapshot(depth int) models.OrderBook {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return models.OrderBook{
+		Pair:      b.symbol,
+		Bids:      sortedLevels(b.bids, true, depth),
+		Asks:      sortedLevels(b.asks, false, depth),
+		Sequence:  b.lastID,
+		Timestamp: b.timestamp,
+	}
+}
+
+func parseLevels(raw [][]string) (map[float64]float64, error) {
+	levels := make(map[float64]float64, len(raw))
+	if err := applyLevels(levels, raw); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// applyLevels sets the amount of every price level; a zero amount removes it.
+func applyLevels(levels map[float64]float64, raw [][]string) error {
+	for _, level := range raw {
+		if len(level) < 2 {
+			return fmt.Errorf("malformed price level: %v", level)
+		}
+		price, err := strconv.ParseFloat(level[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid price level price %q: %w", level[0], err)
+		}
+		amount, err := strconv.ParseFloat(level[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid price level amount %q: %w", level[1], err)
+		}
+
+		if amount == 0 {
+			delete(levels, price)
+			continue
+		}
+		levels[price] = amount
+	}
+	return nil
+}
+
+func bestLevel(levels map[float64]float64, highest bool) (models.PriceLevel, bool) {
+	var best models.PriceLevel
+	found := false
+	for price, amount := range levels {
+		if !found || (highest && price > best.Price) || (!highest && price < best.Price) {
+			best = models.PriceLevel{Price: price, Amount: amount}
+			found = true
+		}
+	}
+	return best, found
+}
+
+func sortedLevels(levels map[float64]float64, descending bool, n int) []models.PriceLevel {
+	result := make([]models.PriceLevel, 0, len(levels))
+	for price, amount := range levels {
+		result = append(result, models.PriceLevel{Price: price, Amount: amount})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if descending {
+			return result[i].Price > result[j].Price
+		}
+		return result[i].Price < result[j].Price
+	})
+
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
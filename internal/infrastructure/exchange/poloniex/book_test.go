@@ -0,0 +1,75 @@
+package poloniex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+)
+
+func TestOrderBook_SnapshotAndUpdates(t *testing.T) {
+	book := NewOrderBook("BTC_USDT")
+	assert.False(t, book.Ready())
+
+	require.NoError(t, book.applySnapshot(
+		[][]string{{"100", "1"}, {"99", "2"}, {"98", "3"}},
+		[][]string{{"101", "1"}, {"102", "2"}},
+		10, 1000,
+	))
+	assert.True(t, book.Ready())
+
+	require.NoError(t, book.applyUpdate(
+		[][]string{{"100", "0"}, {"99.5", "4"}},
+		[][]string{{"101", "0.5"}},
+		10, 11, 1001,
+	))
+
+	bid, ok := book.BestBid()
+	require.True(t, ok)
+	assert.Equal(t, models.PriceLevel{Price: 99.5, Amount: 4}, bid)
+
+	ask, ok := book.BestAsk()
+	require.True(t, ok)
+	assert.Equal(t, models.PriceLevel{Price: 101, Amount: 0.5}, ask)
+
+	bids, asks := book.Depth(2)
+	assert.Equal(t, []models.PriceLevel{{Price: 99.5, Amount: 4}, {Price: 99, Amount: 2}}, bids)
+	assert.Equal(t, []models.PriceLevel{{Price: 101, Amount: 0.5}, {Price: 102, Amount: 2}}, asks)
+
+	snapshot := book.Snapshot(1)
+	assert.Equal(t, "BTC_USDT", snapshot.Pair)
+	assert.Equal(t, int64(11), snapshot.Sequence)
+	assert.Equal(t, int64(1001), snapshot.Timestamp)
+	assert.Len(t, snapshot.Bids, 1)
+	assert.Len(t, snapshot.Asks, 1)
+}
+
+func TestOrderBook_SequenceGap(t *testing.T) {
+	book := NewOrderBook("BTC_USDT")
+	assert.ErrorIs(t, book.applyUpdate(nil, nil, 1, 2, 0), errNoSnapshot)
+
+	require.NoError(t, book.applySnapshot([][]string{{"100", "1"}}, [][]string{{"101", "1"}}, 10, 0))
+
+	err := book.applyUpdate([][]string{{"100", "2"}}, nil, 12, 13, 0)
+	assert.ErrorIs(t, err, errSequenceGap)
+	assert.False(t, book.Ready())
+	assert.ErrorIs(t, book.applyUpdate(nil, nil, 13, 14, 0), errNoSnapshot)
+
+	require.NoError(t, book.applySnapshot([][]string{{"100", "5"}}, [][]string{{"101", "1"}}, 20, 0))
+	assert.True(t, book.Ready())
+}
+
+func TestOrderBook_CrossedBook(t *testing.T) {
+	book := NewOrderBook("BTC_USDT")
+	require.NoError(t, book.applySnapshot([][]string{{"100", "1"}}, [][]string{{"101", "1"}}, 10, 0))
+
+	err := book.applyUpdate([][]string{{"101.5", "1"}}, nil, 10, 11, 0)
+	assert.ErrorIs(t, err, errCrossedBook)
+	assert.False(t, book.Ready())
+
+	err = book.applySnapshot([][]string{{"102", "1"}}, [][]string{{"101", "1"}}, 12, 0)
+	assert.ErrorIs(t, err, errCrossedBook)
+	assert.False(t, book.Ready())
+}
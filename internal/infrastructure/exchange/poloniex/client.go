@@ -4,40 +4,201 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"net/url"
-	"strconv"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
+	"golang.org/x/time/rate"
 
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+// Name identifies Poloniex in the stored data.
+const Name = "poloniex"
+
+const (
+	defaultTradeBufferSize = 1000
+
+	// maxKlinePageSize is the largest number of candles Poloniex returns per request.
+	maxKlinePageSize = 500
+	// maxTradesPageSize is the largest number of recent trades Poloniex returns.
+	maxTradesPageSize = 1000
+	// defaultRequestRate is the number of REST requests sent per second.
+	defaultRequestRate = 10
 )
 
 type Client struct {
 	wsURL   string
 	restURL string
 	client  *http.Client
+	limiter *rate.Limiter
+
+	klinePageSize int
+
+	tradeBufferSize int
+	overflowPolicy  queue.Policy
+	spillDir        string
+	tradesDropped   prometheus.Counter
+	metrics         *metrics.Metrics
+
+	booksMu sync.Mutex
+	books   map[string]*OrderBook
+}
+
+type Option func(*Client)
+
+// WithTradeBufferSize sets how many received trades are buffered for the consumer.
+func WithTradeBufferSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.tradeBufferSize = size
+		}
+	}
+}
+
+// WithRateLimit sets how many REST requests are sent per second.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(c *Client) {
+		if requestsPerSecond > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+		}
+	}
+}
+
+// WithKlinePageSize sets how many candles are requested at once, up to the
+// Poloniex limit of 500.
+func WithKlinePageSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 && size <= maxKlinePageSize {
+			c.klinePageSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets what happens to received trades when the consumer
+// falls behind. spillDir is used by queue.PolicySpill.
+func WithOverflowPolicy(policy queue.Policy, spillDir string) Option {
+	return func(c *Client) {
+		c.overflowPolicy = policy
+		c.spillDir = spillDir
+	}
+}
+
+// WithDropCounter sets the counter incremented for every dropped trade.
+func WithDropCounter(counter prometheus.Counter) Option {
+	return func(c *Client) {
+		c.tradesDropped = counter
+	}
 }
 
-func NewClient(wsURL, restURL string) *Client {
-	return &Client{
-		wsURL:   wsURL,
-		restURL: restURL,
-		client:  &http.Client{Timeout: 10 * time.Second},
+// WithMetrics sets the metrics updated for received trades and WebSocket connections.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
 	}
 }
 
-func (c *Client) GetHistoricalKlines(ctx context.Context, pair string, timeframe string, startTime, endTime int64) ([]models.Kline, error) {
-	log.Printf("Getting historical klines for pair: %s, timeframe: %s", pair, timeframe)
-	u := fmt.Sprintf("%s/markets/%s/candles?interval=%s&startTime=%d&endTime=%d",
+func NewClient(wsURL, restURL string, opts ...Option) *Client {
+	c := &Client{
+		wsURL:           wsURL,
+		restURL:         restURL,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		limiter:         rate.NewLimiter(defaultRequestRate, 1),
+		klinePageSize:   maxKlinePageSize,
+		tradeBufferSize: defaultTradeBufferSize,
+		overflowPolicy:  queue.PolicyBlock,
+		books:           make(map[string]*OrderBook),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) Name() string {
+	return Name
+}
+
+// symbol returns the Poloniex symbol of an instrument. Poloniex writes
+// symbols the canonical way, BTC_USDT.
+func symbol(inst instrument.Instrument) string {
+	return inst.Base + "_" + inst.Quote
+}
+
+// interval returns the Poloniex interval of a timeframe. The canonical
+// timeframe names are the Poloniex interval names.
+func interval(tf timeframe.TimeFrame) string {
+	return tf.Name
+}
+
+// GetHistoricalKlines returns the candles that begin between startMs and
+// endMs (unix ms), oldest first. Poloniex caps the number of candles per
+// response, so the range is fetched in windows of klinePageSize candles.
+func (c *Client) GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startMs, endMs int64) ([]models.Kline, error) {
+	log.Printf("Getting historical klines for pair: %s, timeframe: %s", inst, tf)
+
+	window := tf.Duration.Milliseconds() * int64(c.klinePageSize)
+
+	byBegin := make(map[int64]models.Kline)
+	for from := startMs; from <= endMs; from += window {
+		to := from + window - 1
+		if to > endMs {
+			to = endMs
+		}
+
+		page, err := c.fetchKlines(ctx, inst, tf, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, kline := range page {
+			if kline.UtcBegin < startMs || kline.UtcBegin > endMs {
+				continue
+			}
+			byBegin[kline.UtcBegin] = kline
+		}
+	}
+
+	klines := make([]models.Kline, 0, len(byBegin))
+	for _, kline := range byBegin {
+		klines = append(klines, kline)
+	}
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].UtcBegin < klines[j].UtcBegin
+	})
+
+	log.Printf("Received %d klines for %s %s", len(klines), inst, tf)
+	return klines, nil
+}
+
+// fetchKlines requests one page of candles between from and to (unix ms).
+func (c *Client) fetchKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, from, to int64) ([]models.Kline, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limit wait error: %w", err)
+	}
+
+	u := fmt.Sprintf("%s/markets/%s/candles?interval=%s&startTime=%d&endTime=%d&limit=%d",
 		c.restURL,
-		pair,
-		timeframe,
-		startTime*1000,
-		endTime*1000,
+		symbol(inst),
+		interval(tf),
+		from,
+		to,
+		c.klinePageSize,
 	)
 
 	log.Printf("Making request to: %s", u)
@@ -52,235 +213,303 @@ func (c *Client) GetHistoricalKlines(ctx context.Context, pair string, timeframe
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
 	// Decode JSON as an array of arrays
 	var rawData [][]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&rawData); err != nil {
 		return nil, fmt.Errorf("decode response error: %w", err)
 	}
 
-	log.Printf("Received %d klines from API", len(rawData))
-
-	klines := make([]models.Kline, len(rawData))
-	for i, row := range rawData {
-		if len(row) < 14 {
-			log.Printf("Skipping malformed entry: %v", row)
+	klines := make([]models.Kline, 0, len(rawData))
+	for _, row := range rawData {
+		kline, err := parseCandle(inst, tf, row)
+		if err != nil {
+			log.Printf("Skipping malformed entry %v: %v", row, err)
 			continue
 		}
+		klines = append(klines, kline)
+	}
+
+	return klines, nil
+}
+
+// parseCandle converts a candle in the Poloniex REST layout:
+// [low, high, open, close, amount, quantity, buyTakerAmount, buyTakerQuantity,
+// tradeCount, ts, weightedAverage, interval, startTime, closeTime].
+// Amounts are in the quote currency and quantities in the base currency.
+func parseCandle(inst instrument.Instrument, tf timeframe.TimeFrame, row []interface{}) (models.Kline, error) {
+	if len(row) < 14 {
+		return models.Kline{}, fmt.Errorf("expected 14 fields, got %d", len(row))
+	}
 
-		open, _ := strconv.ParseFloat(row[0].(string), 64)
-		high, _ := strconv.ParseFloat(row[1].(string), 64)
-		low, _ := strconv.ParseFloat(row[2].(string), 64)
-		close, _ := strconv.ParseFloat(row[3].(string), 64)
-		volume, _ := strconv.ParseFloat(row[4].(string), 64)
-		startTimestamp := int64(row[12].(float64))
-		endTimestamp := int64(row[13].(float64))
-
-		startTimeDt := time.Unix(startTimestamp/1000, (startTimestamp%1000)*1e6)
-		endTimeDt := time.Unix(endTimestamp/1000, (endTimestamp%1000)*1e6)
-
-		klines[i] = models.Kline{
-			Pair:      pair,
-			TimeFrame: timeframe,
-			O:         open,
-			H:         high,
-			L:         low,
-			C:         close,
-			UtcBegin:  startTimestamp,
-			UtcEnd:    endTimestamp,
-			BeginDt:   startTimeDt,
-			EndDt:     endTimeDt,
-			VolumeBS: models.VBS{
-				BuyBase:   volume / 2,
-				SellBase:  volume / 2,
-				BuyQuote:  (volume / 2) * ((open + close) / 2),
-				SellQuote: (volume / 2) * ((open + close) / 2),
-			},
+	var fields [8]decimal.Decimal
+	for i := range fields {
+		text, ok := row[i].(string)
+		if !ok {
+			return models.Kline{}, fmt.Errorf("field %d: expected a string, got %T", i, row[i])
 		}
+		value, err := decimal.NewFromString(text)
+		if err != nil {
+			return models.Kline{}, fmt.Errorf("field %d: %w", i, err)
+		}
+		fields[i] = value
 	}
+	low, high, open, close := fields[0], fields[1], fields[2], fields[3]
+	quoteVolume, baseVolume := fields[4], fields[5]
+	buyQuote, buyBase := fields[6], fields[7]
 
-	return klines, nil
+	vwapText, ok := row[10].(string)
+	if !ok {
+		return models.Kline{}, fmt.Errorf("weighted average: expected a string, got %T", row[10])
+	}
+	vwap, err := decimal.NewFromString(vwapText)
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("weighted average: %w", err)
+	}
+
+	tradeCount, ok1 := row[8].(float64)
+	startTimestamp, ok2 := row[12].(float64)
+	endTimestamp, ok3 := row[13].(float64)
+	if !ok1 || !ok2 || !ok3 {
+		return models.Kline{}, fmt.Errorf("trade count and times must be numbers")
+	}
+
+	return models.Kline{
+		Exchange:  Name,
+		Pair:      inst.String(),
+		TimeFrame: tf.Name,
+		O:         open,
+		H:         high,
+		L:         low,
+		C:         close,
+		UtcBegin:  int64(startTimestamp),
+		UtcEnd:    int64(endTimestamp),
+		BeginDt:   time.UnixMilli(int64(startTimestamp)),
+		EndDt:     time.UnixMilli(int64(endTimestamp)),
+		VolumeBS: models.VBS{
+			BuyBase:   buyBase,
+			SellBase:  baseVolume.Sub(buyBase),
+			BuyQuote:  buyQuote,
+			SellQuote: quoteVolume.Sub(buyQuote),
+		},
+		TradeCount:  int64(tradeCount),
+		VWAP:        vwap,
+		BaseVolume:  baseVolume,
+		QuoteVolume: quoteVolume,
+	}, nil
 }
 
-func (c *Client) SubscribeToTrades(ctx context.Context, pairs []string) (<-chan models.RecentTrade, error) {
-	log.Printf("Starting subscription to trades for pairs: %v", pairs)
-	trades := make(chan models.RecentTrade, 1000)
+// GetHistoricalTrades returns the trades of the pair made between from and to
+// (unix ms), oldest first. The Poloniex trades endpoint only serves the most
+// recent maxTradesPageSize trades, so when the range reaches past them the
+// newer trades are returned with a *repository.IncompleteTradesError.
+func (c *Client) GetHistoricalTrades(ctx context.Context, inst instrument.Instrument, from, to int64) ([]models.RecentTrade, error) {
+	pair := inst.String()
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limit wait error: %w", err)
+	}
 
-	formattedPairs := make([]string, len(pairs))
-	for i, pair := range pairs {
-		formattedPairs[i] = strings.ToUpper(pair) // Убедимся, что пара в верхнем регистре
+	u := fmt.Sprintf("%s/markets/%s/trades?limit=%d", c.restURL, symbol(inst), maxTradesPageSize)
+
+	log.Printf("Making request to: %s", u)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request error: %w", err)
 	}
 
-	connectWebSocket := func() (*websocket.Conn, error) {
-		u, err := url.Parse(c.wsURL)
-		if err != nil {
-			return nil, fmt.Errorf("parse ws url error: %w", err)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var rawTrades []struct {
+		ID         string `json:"id"`
+		Price      string `json:"price"`
+		Quantity   string `json:"quantity"`
+		Amount     string `json:"amount"`
+		TakerSide  string `json:"takerSide"`
+		Timestamp  int64  `json:"ts"`
+		CreateTime int64  `json:"createTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rawTrades); err != nil {
+		return nil, fmt.Errorf("decode response error: %w", err)
+	}
+
+	oldest := int64(0)
+	seen := make(map[string]struct{}, len(rawTrades))
+	trades := make([]models.RecentTrade, 0, len(rawTrades))
+	for _, raw := range rawTrades {
+		if oldest == 0 || raw.CreateTime < oldest {
+			oldest = raw.CreateTime
+		}
+		if raw.CreateTime < from || raw.CreateTime > to {
+			continue
 		}
-		log.Printf("Connecting to WebSocket: %s", u.String())
+		if _, ok := seen[raw.ID]; ok {
+			continue
+		}
+		seen[raw.ID] = struct{}{}
 
-		conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+		price, err := decimal.NewFromString(raw.Price)
+		if err != nil {
+			log.Printf("Error parsing price: %v", err)
+			continue
+		}
+		amount, err := decimal.NewFromString(raw.Amount)
 		if err != nil {
-			return nil, fmt.Errorf("dial ws error: %w", err)
+			log.Printf("Error parsing amount: %v", err)
+			continue
+		}
+		quantity, err := decimal.NewFromString(raw.Quantity)
+		if err != nil {
+			log.Printf("Error parsing quantity: %v", err)
+			continue
 		}
-		log.Println("WebSocket connection established")
-		return conn, nil
+
+		trades = append(trades, models.RecentTrade{
+			Exchange:   Name,
+			Tid:        raw.ID,
+			Pair:       pair,
+			Symbol:     pair,
+			Price:      price,
+			Amount:     amount,
+			Quantity:   quantity,
+			Side:       strings.ToLower(raw.TakerSide),
+			Timestamp:  raw.CreateTime,
+			CreateTime: raw.CreateTime,
+		})
 	}
 
-	subscribe := func(conn *websocket.Conn) error {
-		subscribeMsg := map[string]interface{}{
-			"event":   "subscribe",
-			"channel": []string{"trades"},
-			"symbols": formattedPairs,
-		}
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].Timestamp < trades[j].Timestamp
+	})
 
-		msgBytes, _ := json.Marshal(subscribeMsg)
-		log.Printf("Sending subscription message: %s", string(msgBytes))
+	if len(rawTrades) == maxTradesPageSize && oldest > from {
+		return trades, &repository.IncompleteTradesError{Pair: pair, From: from, Oldest: oldest}
+	}
+	return trades, nil
+}
 
-		if err := conn.WriteJSON(subscribeMsg); err != nil {
-			return fmt.Errorf("subscribe error: %w", err)
-		}
+func (c *Client) SubscribeToTrades(ctx context.Context, instruments []instrument.Instrument) (<-chan models.RecentTrade, error) {
+	log.Printf("Starting subscription to trades for pairs: %v", instruments)
+	trades := queue.New[models.RecentTrade](
+		c.tradeBufferSize,
+		c.overflowPolicy,
+		filepath.Join(c.spillDir, "exchange-trades.spill"),
+		c.tradesDropped,
+	)
 
-		var response map[string]interface{}
-		if err := conn.ReadJSON(&response); err != nil {
-			return fmt.Errorf("read subscription response error: %w", err)
-		}
-		log.Printf("Subscription response: %+v", response)
+	symbols := make([]string, len(instruments))
+	pairs := make(map[string]string, len(instruments))
+	for i, inst := range instruments {
+		symbols[i] = symbol(inst)
+		pairs[symbols[i]] = inst.String()
+	}
+
+	sub := subscription{
+		Event:   "subscribe",
+		Channel: []string{"trades"},
+		Symbols: symbols,
+	}
 
-		return nil
+	// reconnected holds the pairs that have not received a trade on the
+	// current connection yet; their next trade is marked as Reconnected.
+	reconnected := make(map[string]bool, len(symbols))
+	onConnect := func() {
+		for _, pair := range pairs {
+			reconnected[pair] = true
+		}
 	}
 
 	go func() {
-		defer close(trades)
-
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Context cancelled, stopping WebSocket reader")
-				return
-			default:
-				conn, err := connectWebSocket()
+		defer trades.Close()
+
+		c.runStream(ctx, sub, onConnect, func(_ *websocket.Conn, message []byte) error {
+			log.Printf("Received raw message: %s", string(message))
+
+			var msg struct {
+				Channel string `json:"channel"`
+				Data    []struct {
+					Symbol     string `json:"symbol"`
+					Amount     string `json:"amount"`
+					Quantity   string `json:"quantity"`
+					TakerSide  string `json:"takerSide"`
+					CreateTime int64  `json:"createTime"`
+					Price      string `json:"price"`
+					ID         string `json:"id"`
+					Timestamp  int64  `json:"ts"`
+				} `json:"data"`
+			}
+
+			if err := json.Unmarshal(message, &msg); err != nil {
+				log.Printf("Error parsing message: %v", err)
+				return nil
+			}
+
+			if msg.Channel != "trades" {
+				return nil
+			}
+			log.Printf("Received %+v trades", msg)
+
+			for _, trade := range msg.Data {
+				price, err := decimal.NewFromString(trade.Price)
 				if err != nil {
-					log.Printf("Connection error: %v, retrying in 5 seconds...", err)
-					time.Sleep(5 * time.Second)
+					log.Printf("Error parsing price: %v", err)
+					continue
+				}
+				amount, err := decimal.NewFromString(trade.Amount)
+				if err != nil {
+					log.Printf("Error parsing amount: %v", err)
+					continue
+				}
+				quantity, err := decimal.NewFromString(trade.Quantity)
+				if err != nil {
+					log.Printf("Error parsing quantity: %v", err)
 					continue
 				}
 
-				conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-				conn.SetPongHandler(func(string) error {
-					conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-					return nil
-				})
-
-				if err := subscribe(conn); err != nil {
-					log.Printf("Subscription error: %v, retrying...", err)
-					conn.Close()
-					time.Sleep(time.Second)
+				pair, ok := pairs[trade.Symbol]
+				if !ok {
+					log.Printf("Skipping trade of unexpected symbol %s", trade.Symbol)
 					continue
 				}
 
-				pingTicker := time.NewTicker(30 * time.Second)
-				go func() {
-					defer pingTicker.Stop()
-					for {
-						select {
-						case <-ctx.Done():
-							return
-						case <-pingTicker.C:
-							if err := conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-								log.Printf("Ping error: %v", err)
-								return
-							}
-						}
-					}
-				}()
-
-			readLoop:
-				for {
-					select {
-					case <-ctx.Done():
-						conn.Close()
-						return
-					default:
-						_, message, err := conn.ReadMessage()
-						if err != nil {
-							if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-								log.Printf("WebSocket error: %v, reconnecting...", err)
-							}
-							conn.Close()
-							break readLoop
-						}
-
-						log.Printf("Received raw message: %s", string(message))
-
-						var msg struct {
-							Channel string `json:"channel"`
-							Data    []struct {
-								Symbol     string `json:"symbol"`
-								Amount     string `json:"amount"`
-								Quantity   string `json:"quantity"`
-								TakerSide  string `json:"takerSide"`
-								CreateTime int64  `json:"createTime"`
-								Price      string `json:"price"`
-								ID         string `json:"id"`
-								Timestamp  int64  `json:"ts"`
-							} `json:"data"`
-						}
-
-						if err := json.Unmarshal(message, &msg); err != nil {
-							log.Printf("Error parsing message: %v", err)
-							continue
-						}
-
-						if msg.Channel != "trades" {
-							continue
-						}
-						log.Printf("Received %+v trades", msg)
-
-						for _, trade := range msg.Data {
-							price, err := strconv.ParseFloat(trade.Price, 64)
-							if err != nil {
-								log.Printf("Error parsing price: %v", err)
-								continue
-							}
-							amount, err := strconv.ParseFloat(trade.Amount, 64)
-							if err != nil {
-								log.Printf("Error parsing amount: %v", err)
-								continue
-							}
-							quantity, err := strconv.ParseFloat(trade.Quantity, 64)
-							if err != nil {
-								log.Printf("Error parsing quantity: %v", err)
-								continue
-							}
-
-							amountStr := fmt.Sprintf("%.8f", amount)
-							priceStr := fmt.Sprintf("%.8f", price)
-
-							recentTrade := models.RecentTrade{
-								Symbol:     trade.Symbol,
-								Pair:       trade.Symbol,
-								Amount:     amountStr,
-								Quantity:   quantity,
-								Side:       trade.TakerSide,
-								Price:      priceStr,
-								CreateTime: trade.CreateTime,
-								Timestamp:  trade.Timestamp,
-								Tid:        trade.ID,
-							}
-
-							select {
-							case trades <- recentTrade:
-							default:
-								log.Println("Trade channel is full, dropping trade")
-							}
-						}
-					}
+				recentTrade := models.RecentTrade{
+					Exchange:   Name,
+					Symbol:     pair,
+					Pair:       pair,
+					Amount:     amount,
+					Quantity:   quantity,
+					Side:       trade.TakerSide,
+					Price:      price,
+					CreateTime: trade.CreateTime,
+					// The trade time, as for the trades loaded over REST;
+					// ts is when the message was pushed.
+					Timestamp: trade.CreateTime,
+					Tid:       trade.ID,
+				}
+				if reconnected[pair] {
+					recentTrade.Reconnected = true
+					delete(reconnected, pair)
 				}
 
-				log.Println("Reconnecting after read loop end...")
-				time.Sleep(time.Second)
+				c.metrics.TradeReceived(recentTrade.Pair)
+				trades.Push(ctx, recentTrade)
+				c.metrics.SetQueueLength(metrics.StageExchange, trades.Len())
 			}
-		}
+			return nil
+		})
 	}()
 
-	return trades, nil
+	return trades.C(), nil
 }
@@ -3,59 +3,62 @@ package poloniex
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/service"
+	"github.com/Zmey56/poloniex-collector/test/mocks"
+)
+
+var (
+	btcUSDT = instrument.New("BTC", "USDT")
+	ethUSDT = instrument.New("ETH", "USDT")
+	minute1 = timeframe.MustParseList([]string{"MINUTE_1"})[0]
 )
 
+// candleRow builds a candle in the Poloniex REST layout:
+// [low, high, open, close, amount, quantity, buyTakerAmount, buyTakerQuantity,
+// tradeCount, ts, weightedAverage, interval, startTime, closeTime].
+func candleRow(price, amount string, interval string, begin, end int64) []interface{} {
+	return []interface{}{
+		price, price, price, price, amount, "0", "0", "0",
+		1, end, price, interval, begin, end,
+	}
+}
+
 func TestClient_GetHistoricalKlines(t *testing.T) {
+	begin := time.Date(2024, 7, 3, 2, 57, 0, 0, time.UTC)
+
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "/markets/BTC_USDT/candles", r.URL.Path)
 		assert.Equal(t, "MINUTE_1", r.URL.Query().Get("interval"))
+		assert.Equal(t, strconv.FormatInt(begin.UnixMilli(), 10), r.URL.Query().Get("startTime"))
+		assert.Equal(t, "500", r.URL.Query().Get("limit"))
 
-		response := struct {
-			Candles []struct {
-				Symbol     string `json:"symbol"`
-				Interval   string `json:"interval"`
-				Time       int64  `json:"time"`
-				OpenPrice  string `json:"openPrice"`
-				ClosePrice string `json:"closePrice"`
-				HighPrice  string `json:"highPrice"`
-				LowPrice   string `json:"lowPrice"`
-				Volume     string `json:"volume"`
-				Amount     string `json:"amount"`
-			} `json:"candles"`
-		}{
-			Candles: []struct {
-				Symbol     string `json:"symbol"`
-				Interval   string `json:"interval"`
-				Time       int64  `json:"time"`
-				OpenPrice  string `json:"openPrice"`
-				ClosePrice string `json:"closePrice"`
-				HighPrice  string `json:"highPrice"`
-				LowPrice   string `json:"lowPrice"`
-				Volume     string `json:"volume"`
-				Amount     string `json:"amount"`
-			}{
-				{
-					Symbol:     "BTC_USDT",
-					Interval:   "MINUTE_1",
-					Time:       1719975420000,
-					OpenPrice:  "58651",
-					ClosePrice: "58651",
-					HighPrice:  "58651",
-					LowPrice:   "58651",
-					Volume:     "500",
-					Amount:     "1000",
-				},
+		json.NewEncoder(w).Encode([][]interface{}{
+			{
+				"58600.5", "58700", "58651", "58690.25",
+				"29331.502", "0.5", "17597.4216", "0.3",
+				12, begin.UnixMilli(), "58663.004",
+				"MINUTE_1", begin.UnixMilli(), begin.Add(time.Minute).UnixMilli() - 1,
 			},
-		}
-
-		json.NewEncoder(w).Encode(response)
+		})
 	}))
 	defer server.Close()
 
@@ -66,26 +69,316 @@ func TestClient_GetHistoricalKlines(t *testing.T) {
 
 	klines, err := client.GetHistoricalKlines(
 		context.Background(),
-		"BTC_USDT",
-		"MINUTE_1",
-		time.Now().Add(-time.Hour).Unix(),
-		time.Now().Unix(),
+		btcUSDT,
+		minute1,
+		begin.UnixMilli(),
+		begin.Add(time.Minute).UnixMilli(),
 	)
 
 	require.NoError(t, err)
 	require.Len(t, klines, 1)
 
 	kline := klines[0]
+	assert.Equal(t, "poloniex", kline.Exchange)
 	assert.Equal(t, "BTC_USDT", kline.Pair)
 	assert.Equal(t, "MINUTE_1", kline.TimeFrame)
-	assert.Equal(t, 58651.0, kline.O)
-	assert.Equal(t, 58651.0, kline.H)
-	assert.Equal(t, 58651.0, kline.L)
-	assert.Equal(t, 58651.0, kline.C)
-	assert.Equal(t, int64(1719975420), kline.UtcBegin)
-
-	assert.Equal(t, 250.0, kline.VolumeBS.BuyBase)
-	assert.Equal(t, 250.0, kline.VolumeBS.SellBase)
-	assert.Equal(t, 500.0, kline.VolumeBS.BuyQuote)
-	assert.Equal(t, 500.0, kline.VolumeBS.SellQuote)
+	assert.Equal(t, "58651", kline.O.String())
+	assert.Equal(t, "58700", kline.H.String())
+	assert.Equal(t, "58600.5", kline.L.String())
+	assert.Equal(t, "58690.25", kline.C.String())
+	assert.Equal(t, begin.UnixMilli(), kline.UtcBegin)
+	assert.True(t, begin.Equal(kline.BeginDt))
+
+	// The buy side is the taker buy volume, the sell side the rest.
+	assert.Equal(t, "0.3", kline.VolumeBS.BuyBase.String())
+	assert.Equal(t, "0.2", kline.VolumeBS.SellBase.String())
+	assert.Equal(t, "17597.4216", kline.VolumeBS.BuyQuote.String())
+	assert.Equal(t, "11734.0804", kline.VolumeBS.SellQuote.String())
+	assert.Equal(t, int64(12), kline.TradeCount)
+	assert.Equal(t, "58663.004", kline.VWAP.String())
+	assert.Equal(t, "0.5", kline.BaseVolume.String())
+	assert.Equal(t, "29331.502", kline.QuoteVolume.String())
+}
+
+func TestParseCandle_Malformed(t *testing.T) {
+	begin := time.Date(2024, 7, 3, 2, 57, 0, 0, time.UTC).UnixMilli()
+
+	_, err := parseCandle(btcUSDT, minute1, []interface{}{"1", "2"})
+	assert.ErrorContains(t, err, "expected 14 fields")
+
+	row := candleRow("58651", "500", "MINUTE_1", begin, begin+59_999)
+	row[7] = "n/a"
+	_, err = parseCandle(btcUSDT, minute1, row)
+	assert.ErrorContains(t, err, "field 7")
+}
+
+func TestClient_GetHistoricalKlines_Paginates(t *testing.T) {
+	begin := time.Date(2024, 7, 3, 0, 0, 0, 0, time.UTC)
+	end := begin.Add(25 * time.Minute)
+
+	var mu sync.Mutex
+	var windows [][2]int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, err := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		require.NoError(t, err)
+		to, err := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+
+		mu.Lock()
+		windows = append(windows, [2]int64{from, to})
+		mu.Unlock()
+
+		// Return one candle before the window as well, like an inclusive
+		// boundary would, so the pages overlap.
+		var rows [][]interface{}
+		for ts := from - time.Minute.Milliseconds(); ts <= to; ts += time.Minute.Milliseconds() {
+			if ts < begin.UnixMilli() {
+				continue
+			}
+			rows = append(rows, candleRow("100", "1", "MINUTE_1", ts, ts+time.Minute.Milliseconds()-1))
+		}
+		json.NewEncoder(w).Encode(rows)
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL, WithKlinePageSize(10), WithRateLimit(20))
+
+	started := time.Now()
+	klines, err := client.GetHistoricalKlines(context.Background(), btcUSDT, minute1, begin.UnixMilli(), end.UnixMilli())
+	require.NoError(t, err)
+
+	require.Len(t, windows, 3)
+	assert.Equal(t, [2]int64{begin.UnixMilli(), begin.Add(10*time.Minute).UnixMilli() - 1}, windows[0])
+	assert.Equal(t, [2]int64{begin.Add(20 * time.Minute).UnixMilli(), end.UnixMilli()}, windows[2])
+	assert.GreaterOrEqual(t, time.Since(started), 100*time.Millisecond, "requests should be rate limited")
+
+	require.Len(t, klines, 26)
+	for i, kline := range klines {
+		assert.Equal(t, begin.Add(time.Duration(i)*time.Minute).UnixMilli(), kline.UtcBegin)
+	}
+}
+
+func TestClient_GetHistoricalKlines_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"code":429,"message":"Too many requests"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL)
+
+	_, err := client.GetHistoricalKlines(context.Background(), btcUSDT, minute1, 1719975420000, 1719979020000)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429")
+	assert.Contains(t, err.Error(), "Too many requests")
+}
+
+func TestClient_GetHistoricalTrades(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/markets/BTC_USDT/trades", r.URL.Path)
+		assert.Equal(t, "1000", r.URL.Query().Get("limit"))
+
+		// Newest first, like the exchange.
+		w.Write([]byte(`[
+			{"id":"5","price":"50500","quantity":"0.1","amount":"5050","takerSide":"BUY","ts":1700000009999,"createTime":1700000005000},
+			{"id":"4","price":"50400","quantity":"0.2","amount":"10080","takerSide":"SELL","ts":1700000009999,"createTime":1700000004000},
+			{"id":"3","price":"50300","quantity":"0.3","amount":"15090","takerSide":"BUY","ts":1700000009999,"createTime":1700000003000},
+			{"id":"3","price":"50300","quantity":"0.3","amount":"15090","takerSide":"BUY","ts":1700000009999,"createTime":1700000003000},
+			{"id":"1","price":"50100","quantity":"0.5","amount":"25050","takerSide":"SELL","ts":1700000009999,"createTime":1700000001000}
+		]`))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL)
+
+	trades, err := client.GetHistoricalTrades(context.Background(), btcUSDT, 1700000002000, 1700000004000)
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+
+	assert.Equal(t, "3", trades[0].Tid)
+	assert.Equal(t, "4", trades[1].Tid)
+
+	trade := trades[1]
+	assert.Equal(t, "poloniex", trade.Exchange)
+	assert.Equal(t, "BTC_USDT", trade.Pair)
+	assert.Equal(t, "BTC_USDT", trade.Symbol)
+	assert.Equal(t, "50400", trade.Price.String())
+	assert.Equal(t, "10080", trade.Amount.String())
+	assert.Equal(t, "0.2", trade.Quantity.String())
+	assert.Equal(t, "sell", trade.Side)
+	assert.Equal(t, int64(1700000004000), trade.Timestamp)
+}
+
+func TestClient_GetHistoricalTrades_Incomplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A full page, so older trades are not served.
+		raw := make([]string, maxTradesPageSize)
+		for i := range raw {
+			raw[i] = fmt.Sprintf(`{"id":"%d","price":"50000","quantity":"0.1","amount":"5000","takerSide":"BUY","createTime":%d}`,
+				2000+i, 1700000002000+int64(i))
+		}
+		w.Write([]byte("[" + strings.Join(raw, ",") + "]"))
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL)
+
+	trades, err := client.GetHistoricalTrades(context.Background(), btcUSDT, 1700000000000, 1700000005000)
+	var incomplete *repository.IncompleteTradesError
+	require.ErrorAs(t, err, &incomplete)
+	assert.Equal(t, "BTC_USDT", incomplete.Pair)
+	assert.Equal(t, int64(1700000000000), incomplete.From)
+	assert.Equal(t, int64(1700000002000), incomplete.Oldest)
+
+	// The trades that are still served are returned.
+	require.Len(t, trades, maxTradesPageSize)
+	assert.Equal(t, int64(1700000002000), trades[0].Timestamp)
+}
+
+// TestClient_CandleMatchesTrades checks that a candle built from the trades of
+// a minute agrees with the candle Poloniex reports for it, so that collected
+// and backfilled klines use the same meaning of base and quote volume.
+func TestClient_CandleMatchesTrades(t *testing.T) {
+	begin := time.Date(2024, 7, 3, 2, 57, 0, 0, time.UTC).UnixMilli()
+	end := begin + time.Minute.Milliseconds()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/markets/BTC_USDT/trades":
+			w.Write([]byte(fmt.Sprintf(`[
+				{"id":"4","price":"58690.25","quantity":"0.1","amount":"5869.025","takerSide":"SELL","createTime":%d},
+				{"id":"3","price":"58600.5","quantity":"0.1","amount":"5860.05","takerSide":"BUY","createTime":%d},
+				{"id":"2","price":"58700","quantity":"0.1","amount":"5870","takerSide":"SELL","createTime":%d},
+				{"id":"1","price":"58651","quantity":"0.2","amount":"11730.2","takerSide":"BUY","createTime":%d}
+			]`, begin+59000, begin+41000, begin+20000, begin+5000)))
+		case "/markets/BTC_USDT/candles":
+			json.NewEncoder(w).Encode([][]interface{}{{
+				"58600.5", "58700", "58651", "58690.25",
+				"29329.275", "0.5", "17590.25", "0.3",
+				4, end, "58658.55",
+				"MINUTE_1", begin, end - 1,
+			}})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("ws://localhost", server.URL)
+
+	klines, err := client.GetHistoricalKlines(context.Background(), btcUSDT, minute1, begin, end-1)
+	require.NoError(t, err)
+	require.Len(t, klines, 1)
+	want := klines[0]
+
+	trades, err := client.GetHistoricalTrades(context.Background(), btcUSDT, begin, end-1)
+	require.NoError(t, err)
+	require.Len(t, trades, 4)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var built []models.Kline
+	repo := mocks.NewMockKlineRepository(ctrl)
+	repo.EXPECT().SaveKlines(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, klines []models.Kline) { built = append(built, klines...) }).
+		Return(nil)
+
+	processor := service.NewKlineProcessor(repo, service.WithTimeFrames([]timeframe.TimeFrame{minute1}))
+	for i := range trades {
+		require.NoError(t, processor.ProcessTrade(context.Background(), &trades[i]))
+	}
+	require.NoError(t, processor.Flush(context.Background()))
+	require.Len(t, built, 1)
+	got := built[0]
+
+	assert.Equal(t, want.UtcBegin, got.UtcBegin)
+	for name, pair := range map[string][2]decimal.Decimal{
+		"open":         {want.O, got.O},
+		"high":         {want.H, got.H},
+		"low":          {want.L, got.L},
+		"close":        {want.C, got.C},
+		"base volume":  {want.BaseVolume, got.BaseVolume},
+		"quote volume": {want.QuoteVolume, got.QuoteVolume},
+		"buy base":     {want.VolumeBS.BuyBase, got.VolumeBS.BuyBase},
+		"sell base":    {want.VolumeBS.SellBase, got.VolumeBS.SellBase},
+		"buy quote":    {want.VolumeBS.BuyQuote, got.VolumeBS.BuyQuote},
+		"sell quote":   {want.VolumeBS.SellQuote, got.VolumeBS.SellQuote},
+		"vwap":         {want.VWAP, got.VWAP},
+	} {
+		assert.True(t, pair[0].Equal(pair[1]), "%s: exchange %s, built %s", name, pair[0], pair[1])
+	}
+	assert.Equal(t, want.TradeCount, got.TradeCount)
+}
+
+func TestClient_SubscribeToTrades_MarksFirstTradeAfterReconnect(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	scripts := [][]string{
+		{
+			`{"channel":"trades","data":[{"symbol":"BTC_USDT","amount":"100","quantity":"0.002","takerSide":"buy","createTime":1,"price":"50000","id":"1","ts":9999}]}`,
+			`{"channel":"trades","data":[{"symbol":"ETH_USDT","amount":"30","quantity":"0.01","takerSide":"sell","createTime":2,"price":"3000","id":"2","ts":9999}]}`,
+			`{"channel":"trades","data":[{"symbol":"BTC_USDT","amount":"100","quantity":"0.002","takerSide":"buy","createTime":3,"price":"50000","id":"3","ts":9999}]}`,
+		},
+		{
+			`{"channel":"trades","data":[{"symbol":"BTC_USDT","amount":"100","quantity":"0.002","takerSide":"buy","createTime":4,"price":"50000","id":"4","ts":9999}]}`,
+		},
+	}
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var sub subscription
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		conn.WriteJSON(map[string]interface{}{"event": "subscribe", "channel": "trades"})
+
+		mu.Lock()
+		script := scripts[connections%len(scripts)]
+		connections++
+		last := connections == len(scripts)
+		mu.Unlock()
+
+		for _, message := range script {
+			conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+
+		if last {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		// Drop the first connection so that the client reconnects.
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), server.URL)
+	trades, err := client.SubscribeToTrades(ctx, []instrument.Instrument{btcUSDT, ethUSDT})
+	require.NoError(t, err)
+
+	expected := map[string]bool{"1": true, "2": true, "3": false, "4": true}
+	for i := 0; i < len(expected); i++ {
+		select {
+		case trade := <-trades:
+			assert.Equal(t, expected[trade.Tid], trade.Reconnected, "trade %s", trade.Tid)
+			// Trades are timed by createTime like the trades loaded over REST.
+			assert.Equal(t, trade.CreateTime, trade.Timestamp, "trade %s", trade.Tid)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a trade")
+		}
+	}
 }
@@ -0,0 +1,145 @@
+package poloniex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+const (
+	orderBookChannel    = "book_lv2"
+	orderBookBufferSize = 100
+)
+
+// SubscribeToOrderBook maintains a local book_lv2 order book for every pair
+// and sends the top depth levels of a book each time it changes. Only the
+// latest books matter, so the oldest snapshots are dropped when the consumer
+// falls behind. When a sequence gap or a crossed book is detected the pair is
+// resubscribed to get a fresh snapshot.
+func (c *Client) SubscribeToOrderBook(ctx context.Context, pairs []string, depth int) (<-chan models.OrderBook, error) {
+	log.Printf("Starting subscription to order books for pairs: %v", pairs)
+	books := queue.New[models.OrderBook](orderBookBufferSize, queue.PolicyDropOldest, "", nil)
+
+	symbols := make([]string, len(pairs))
+	for i, pair := range pairs {
+		symbols[i] = strings.ToUpper(pair)
+		c.orderBook(symbols[i])
+	}
+
+	sub := subscription{
+		Event:   "subscribe",
+		Channel: []string{orderBookChannel},
+		Symbols: symbols,
+	}
+
+	onConnect := func() {
+		for _, symbol := range symbols {
+			c.orderBook(symbol).reset()
+		}
+	}
+
+	go func() {
+		defer books.Close()
+
+		c.runStream(ctx, sub, onConnect, func(conn *websocket.Conn, message []byte) error {
+			var msg struct {
+				Event   string `json:"event"`
+				Channel string `json:"channel"`
+				Action  string `json:"action"`
+				Data    []struct {
+					Symbol string     `json:"symbol"`
+					Asks   [][]string `json:"asks"`
+					Bids   [][]string `json:"bids"`
+					LastID int64      `json:"lastId"`
+					ID     int64      `json:"id"`
+					Ts     int64      `json:"ts"`
+				} `json:"data"`
+			}
+
+			if err := json.Unmarshal(message, &msg); err != nil {
+				log.Printf("Error parsing order book message: %v", err)
+				return nil
+			}
+
+			if msg.Event != "" || msg.Channel != orderBookChannel {
+				return nil
+			}
+
+			for _, data := range msg.Data {
+				book := c.orderBook(data.Symbol)
+
+				var err error
+				switch msg.Action {
+				case "snapshot":
+					err = book.applySnapshot(data.Bids, data.Asks, data.ID, data.Ts)
+				case "update":
+					err = book.applyUpdate(data.Bids, data.Asks, data.LastID, data.ID, data.Ts)
+				default:
+					continue
+				}
+
+				if errors.Is(err, errNoSnapshot) {
+					continue
+				}
+				if err != nil {
+					log.Printf("Order book %s is inconsistent: %v, resubscribing", data.Symbol, err)
+					book.reset()
+					if err := resubscribeOrderBook(conn, data.Symbol); err != nil {
+						return err
+					}
+					continue
+				}
+
+				books.Push(ctx, book.Snapshot(depth))
+			}
+			return nil
+		})
+	}()
+
+	return books.C(), nil
+}
+
+// OrderBook returns the local order book of a pair subscribed with SubscribeToOrderBook.
+func (c *Client) OrderBook(pair string) (*OrderBook, bool) {
+	c.booksMu.Lock()
+	defer c.booksMu.Unlock()
+
+	book, ok := c.books[strings.ToUpper(pair)]
+	return book, ok
+}
+
+func (c *Client) orderBook(symbol string) *OrderBook {
+	c.booksMu.Lock()
+	defer c.booksMu.Unlock()
+
+	book, ok := c.books[symbol]
+	if !ok {
+		book = NewOrderBook(symbol)
+		c.books[symbol] = book
+	}
+	return book
+}
+
+// resubscribeOrderBook asks for a new snapshot of one symbol. The
+// acknowledgements are read by the stream loop and ignored there.
+func resubscribeOrderBook(conn *websocket.Conn, symbol string) error {
+	for _, event := range []string{"unsubscribe", "subscribe"} {
+		sub := subscription{
+			Event:   event,
+			Channel: []string{orderBookChannel},
+			Symbols: []string{symbol},
+		}
+		if err := conn.WriteJSON(sub); err != nil {
+			return fmt.Errorf("%s order book %s error: %w", event, symbol, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package poloniex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+)
+
+// fakeBookServer is a book_lv2 server that sends a snapshot on every
+// subscription followed by the scripted updates of that subscription.
+type fakeBookServer struct {
+	t        *testing.T
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	subscriptions []subscription
+	scripts       [][]string
+}
+
+func (s *fakeBookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.t.Errorf("upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	for {
+		var sub subscription
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.subscriptions = append(s.subscriptions, sub)
+		var script []string
+		if sub.Event == "subscribe" && len(s.scripts) > 0 {
+			script, s.scripts = s.scripts[0], s.scripts[1:]
+		}
+		s.mu.Unlock()
+
+		if err := conn.WriteJSON(map[string]interface{}{"event": sub.Event, "channel": orderBookChannel}); err != nil {
+			return
+		}
+		for _, message := range script {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeBookServer) events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]string, len(s.subscriptions))
+	for i, sub := range s.subscriptions {
+		events[i] = sub.Event
+	}
+	return events
+}
+
+func nextBook(t *testing.T, books <-chan models.OrderBook) models.OrderBook {
+	t.Helper()
+
+	select {
+	case book, ok := <-books:
+		require.True(t, ok, "order book channel closed")
+		return book
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an order book")
+		return models.OrderBook{}
+	}
+}
+
+func TestClient_SubscribeToOrderBook(t *testing.T) {
+	server := &fakeBookServer{
+		t: t,
+		scripts: [][]string{
+			{
+				`{"channel":"book_lv2","action":"snapshot","data":[{"symbol":"BTC_USDT","bids":[["100","1"],["99","2"]],"asks":[["101","1"],["102","2"]],"lastId":0,"id":10,"ts":1000}]}`,
+				`{"channel":"book_lv2","action":"update","data":[{"symbol":"BTC_USDT","bids":[["100","3"]],"asks":[],"lastId":10,"id":11,"ts":1001}]}`,
+				// id 12 is missing: the client has to resubscribe.
+				`{"channel":"book_lv2","action":"update","data":[{"symbol":"BTC_USDT","bids":[],"asks":[["101","0"]],"lastId":12,"id":13,"ts":1002}]}`,
+				`{"channel":"book_lv2","action":"update","data":[{"symbol":"BTC_USDT","bids":[],"asks":[["102","0"]],"lastId":13,"id":14,"ts":1003}]}`,
+			},
+			{
+				`{"channel":"book_lv2","action":"snapshot","data":[{"symbol":"BTC_USDT","bids":[["100.5","1"],["100","3"]],"asks":[["102","2"],["103","1"]],"lastId":0,"id":20,"ts":2000}]}`,
+				`{"channel":"book_lv2","action":"update","data":[{"symbol":"BTC_USDT","bids":[["100.5","0"]],"asks":[["101.5","4"]],"lastId":20,"id":21,"ts":2001}]}`,
+			},
+		},
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient("ws"+strings.TrimPrefix(httpServer.URL, "http"), httpServer.URL)
+	books, err := client.SubscribeToOrderBook(ctx, []string{"btc_usdt"}, 1)
+	require.NoError(t, err)
+
+	book := nextBook(t, books)
+	assert.Equal(t, int64(10), book.Sequence)
+	assert.Equal(t, []models.PriceLevel{{Price: 100, Amount: 1}}, book.Bids)
+	assert.Equal(t, []models.PriceLevel{{Price: 101, Amount: 1}}, book.Asks)
+
+	book = nextBook(t, books)
+	assert.Equal(t, int64(11), book.Sequence)
+	assert.Equal(t, []models.PriceLevel{{Price: 100, Amount: 3}}, book.Bids)
+
+	// The updates after the gap are skipped until the new snapshot arrives.
+	book = nextBook(t, books)
+	assert.Equal(t, int64(20), book.Sequence)
+	assert.Equal(t, []models.PriceLevel{{Price: 100.5, Amount: 1}}, book.Bids)
+
+	book = nextBook(t, books)
+	assert.Equal(t, int64(21), book.Sequence)
+	assert.Equal(t, int64(2001), book.Timestamp)
+
+	local, ok := client.OrderBook("BTC_USDT")
+	require.True(t, ok)
+	assert.True(t, local.Ready())
+
+	bid, ok := local.BestBid()
+	require.True(t, ok)
+	assert.Equal(t, models.PriceLevel{Price: 100, Amount: 3}, bid)
+
+	ask, ok := local.BestAsk()
+	require.True(t, ok)
+	assert.Equal(t, models.PriceLevel{Price: 101.5, Amount: 4}, ask)
+
+	bids, asks := local.Depth(0)
+	assert.Equal(t, []models.PriceLevel{{Price: 100, Amount: 3}}, bids)
+	assert.Equal(t, []models.PriceLevel{{Price: 101.5, Amount: 4}, {Price: 102, Amount: 2}, {Price: 103, Amount: 1}}, asks)
+
+	assert.Equal(t, []string{"subscribe", "unsubscribe", "subscribe"}, server.events())
+}
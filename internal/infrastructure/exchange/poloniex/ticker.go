@@ -0,0 +1,126 @@
+package poloniex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
+)
+
+const (
+	tickerChannel    = "ticker"
+	tickerBufferSize = 100
+)
+
+type tickerData struct {
+	Symbol      string `json:"symbol"`
+	Open        string `json:"open"`
+	High        string `json:"high"`
+	Low         string `json:"low"`
+	Close       string `json:"close"`
+	Quantity    string `json:"quantity"`
+	Amount      string `json:"amount"`
+	DailyChange string `json:"dailyChange"`
+	TradeCount  int64  `json:"tradeCount"`
+	Bid         string `json:"bid"`
+	Ask         string `json:"ask"`
+	Timestamp   int64  `json:"ts"`
+}
+
+// SubscribeToTickers streams the 24h ticker of every pair. A ticker replaces
+// the previous one, so the oldest tickers are dropped when the consumer falls
+// behind.
+func (c *Client) SubscribeToTickers(ctx context.Context, pairs []string) (<-chan models.Ticker, error) {
+	log.Printf("Starting subscription to tickers for pairs: %v", pairs)
+	tickers := queue.New[models.Ticker](tickerBufferSize, queue.PolicyDropOldest, "", nil)
+
+	symbols := make([]string, len(pairs))
+	for i, pair := range pairs {
+		symbols[i] = strings.ToUpper(pair)
+	}
+
+	sub := subscription{
+		Event:   "subscribe",
+		Channel: []string{tickerChannel},
+		Symbols: symbols,
+	}
+
+	go func() {
+		defer tickers.Close()
+
+		c.runStream(ctx, sub, nil, func(_ *websocket.Conn, message []byte) error {
+			var msg struct {
+				Channel string       `json:"channel"`
+				Data    []tickerData `json:"data"`
+			}
+
+			if err := json.Unmarshal(message, &msg); err != nil {
+				log.Printf("Error parsing ticker message: %v", err)
+				return nil
+			}
+
+			if msg.Channel != tickerChannel {
+				return nil
+			}
+
+			for _, data := range msg.Data {
+				ticker, err := data.toTicker()
+				if err != nil {
+					log.Printf("Error parsing ticker %s: %v", data.Symbol, err)
+					continue
+				}
+				tickers.Push(ctx, ticker)
+			}
+			return nil
+		})
+	}()
+
+	return tickers.C(), nil
+}
+
+// toTicker converts a ticker message. The ticker channel does not always
+// carry the best bid and ask, in which case they are left zero.
+func (d tickerData) toTicker() (models.Ticker, error) {
+	ticker := models.Ticker{
+		Pair:       d.Symbol,
+		TradeCount: d.TradeCount,
+		Timestamp:  d.Timestamp,
+	}
+
+	fields := []struct {
+		name     string
+		value    string
+		dst      *float64
+		optional bool
+	}{
+		{"close", d.Close, &ticker.Last, false},
+		{"open", d.Open, &ticker.Open, false},
+		{"high", d.High, &ticker.High, false},
+		{"low", d.Low, &ticker.Low, false},
+		{"quantity", d.Quantity, &ticker.Volume, false},
+		{"amount", d.Amount, &ticker.QuoteVolume, false},
+		{"dailyChange", d.DailyChange, &ticker.Change, false},
+		{"bid", d.Bid, &ticker.Bid, true},
+		{"ask", d.Ask, &ticker.Ask, true},
+	}
+
+	for _, field := range fields {
+		if field.value == "" && field.optional {
+			continue
+		}
+		value, err := strconv.ParseFloat(field.value, 64)
+		if err != nil {
+			return models.Ticker{}, fmt.Errorf("invalid %s %q: %w", field.name, field.value, err)
+		}
+		*field.dst = value
+	}
+
+	return ticker, nil
+}
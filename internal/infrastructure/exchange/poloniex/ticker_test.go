@@ -0,0 +1,73 @@
+package poloniex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+)
+
+func TestClient_SubscribeToTickers(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var sub subscription
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		assert.Equal(t, []string{"ticker"}, sub.Channel)
+		assert.Equal(t, []string{"BTC_USDT"}, sub.Symbols)
+
+		conn.WriteJSON(map[string]interface{}{"event": "subscribe", "channel": "ticker"})
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"channel":"ticker","data":[{"symbol":"BTC_USDT","startTime":1700000000000,"open":"50000","high":"51000","low":"49000","close":"50500","quantity":"12.5","amount":"631250","tradeCount":340,"dailyChange":"0.01","markPrice":"50501","closeTime":1700086400000,"ts":1700086400123}]}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"channel":"ticker","data":[{"symbol":"BTC_USDT","open":"50000","high":"51000","low":"49000","close":"50600","quantity":"13","amount":"656500","tradeCount":341,"dailyChange":"0.012","bid":"50599","ask":"50601","ts":1700086401123}]}`))
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), server.URL)
+	tickers, err := client.SubscribeToTickers(ctx, []string{"btc_usdt"})
+	require.NoError(t, err)
+
+	expected := []models.Ticker{
+		{
+			Pair: "BTC_USDT", Last: 50500, Open: 50000, High: 51000, Low: 49000,
+			Volume: 12.5, QuoteVolume: 631250, Change: 0.01, TradeCount: 340, Timestamp: 1700086400123,
+		},
+		{
+			Pair: "BTC_USDT", Last: 50600, Bid: 50599, Ask: 50601, Open: 50000, High: 51000, Low: 49000,
+			Volume: 13, QuoteVolume: 656500, Change: 0.012, TradeCount: 341, Timestamp: 1700086401123,
+		},
+	}
+
+	for _, want := range expected {
+		select {
+		case ticker := <-tickers:
+			assert.Equal(t, want, ticker)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a ticker")
+		}
+	}
+}
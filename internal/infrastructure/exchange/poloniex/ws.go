@@ -0,0 +1,50 @@
+package poloniex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/exchange/stream"
+)
+
+type subscription struct {
+	Event   string   `json:"event"`
+	Channel []string `json:"channel"`
+	Symbols []string `json:"symbols"`
+}
+
+func subscribe(conn *websocket.Conn, sub subscription) error {
+	msgBytes, _ := json.Marshal(sub)
+	log.Printf("Sending subscription message: %s", string(msgBytes))
+
+	if err := conn.WriteJSON(sub); err != nil {
+		return fmt.Errorf("subscribe error: %w", err)
+	}
+
+	var response map[string]interface{}
+	if err := conn.ReadJSON(&response); err != nil {
+		return fmt.Errorf("read subscription response error: %w", err)
+	}
+	log.Printf("Subscription response: %+v", response)
+
+	return nil
+}
+
+// runStream keeps a subscription alive until ctx is cancelled, see
+// stream.Stream. onConnect, if set, is called after every successful
+// subscription.
+func (c *Client) runStream(ctx context.Context, sub subscription, onConnect func(), handle stream.Handler) {
+	stream.Stream{
+		URL: c.wsURL,
+		Subscribe: func(conn *websocket.Conn) error {
+			return subscribe(conn, sub)
+		},
+		OnConnect: onConnect,
+		Handle:    handle,
+		Metrics:   c.metrics,
+	}.Run(ctx)
+}
@@ -0,0 +1,170 @@
+// Package stream keeps an exchange WebSocket subscription alive. It is the
+// connection handling shared by the exchange adapters; what is subscribed to
+// and how messages are decoded is up to the adapter.
+package stream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+const (
+	readTimeout  = 60 * time.Second
+	pingInterval = 30 * time.Second
+)
+
+// Handler processes one message received on a subscription. The connection
+// is passed so that the handler can send follow-up requests. Returning an
+// error makes the stream reconnect.
+type Handler func(conn *websocket.Conn, message []byte) error
+
+// Stream describes a subscription.
+type Stream struct {
+	// URL is the WebSocket endpoint.
+	URL string
+	// Subscribe, if set, is called on every new connection before any
+	// message is handled. Returning an error makes the stream reconnect.
+	Subscribe func(conn *websocket.Conn) error
+	// OnConnect, if set, is called after every successful subscription.
+	OnConnect func()
+	// Handle is called for every received message.
+	Handle Handler
+	// Metrics, if set, tracks the open connections.
+	Metrics *metrics.Metrics
+	// IdleTimeout, if set, makes the stream reconnect when no message at all
+	// arrives for that long. It suits venues that send heartbeats, which
+	// then replace the pings as the liveness check.
+	IdleTimeout time.Duration
+}
+
+// Run keeps the subscription alive until ctx is cancelled: it connects,
+// subscribes, pings the server and passes every received message to Handle,
+// reconnecting after connection errors.
+func (s Stream) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Context cancelled, stopping WebSocket reader")
+			return
+		default:
+		}
+
+		conn, err := dial(ctx, s.URL)
+		if err != nil {
+			log.Printf("Connection error: %v, retrying in 5 seconds...", err)
+			sleep(ctx, 5*time.Second)
+			continue
+		}
+
+		timeout := readTimeout
+		if s.IdleTimeout > 0 {
+			timeout = s.IdleTimeout
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			return nil
+		})
+
+		if s.Subscribe != nil {
+			if err := s.Subscribe(conn); err != nil {
+				log.Printf("Subscription error: %v, retrying...", err)
+				conn.Close()
+				sleep(ctx, time.Second)
+				continue
+			}
+		}
+
+		s.Metrics.WSConnected()
+		if s.OnConnect != nil {
+			s.OnConnect()
+		}
+
+		readLoop(ctx, conn, s.Handle, s.IdleTimeout)
+
+		conn.Close()
+		s.Metrics.WSDisconnected()
+
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("Reconnecting after read loop end...")
+		sleep(ctx, time.Second)
+	}
+}
+
+func dial(ctx context.Context, wsURL string) (*websocket.Conn, error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse ws url error: %w", err)
+	}
+	log.Printf("Connecting to WebSocket: %s", u.String())
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial ws error: %w", err)
+	}
+	log.Println("WebSocket connection established")
+	return conn, nil
+}
+
+func readLoop(ctx context.Context, conn *websocket.Conn, handle Handler, idleTimeout time.Duration) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		pingTicker := time.NewTicker(pingInterval)
+		defer pingTicker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// Unblock ReadMessage so the stream stops promptly.
+				conn.Close()
+				return
+			case <-pingTicker.C:
+				if err := conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+					log.Printf("Ping error: %v", err)
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil && websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v, reconnecting...", err)
+			}
+			return
+		}
+		if idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+
+		if err := handle(conn, message); err != nil {
+			log.Printf("Stream handler error: %v, reconnecting...", err)
+			return
+		}
+	}
+}
+
+// sleep waits for d or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -1,81 +1,206 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+const (
+	StageExchange = "exchange"
+	StageWorker   = "worker"
+	StageWriter   = "writer"
+)
+
+// Metrics holds the collector's Prometheus metrics. All helper methods are
+// safe to call on a nil *Metrics, so components can run without metrics.
 type Metrics struct {
-	TradesReceived   prometheus.Counter
-	TradesQueued     prometheus.Counter
-	TradesProcessed  prometheus.Counter
-	TradesDropped    prometheus.Counter
-	ProcessingErrors prometheus.Counter
+	TradesReceived   *prometheus.CounterVec
+	TradesQueued     *prometheus.CounterVec
+	TradesProcessed  *prometheus.CounterVec
+	TradesDropped    *prometheus.CounterVec
+	ProcessingErrors *prometheus.CounterVec
+	TradeWriteErrors *prometheus.CounterVec
 	ProcessingTime   prometheus.Histogram
-	QueueLength      prometheus.Gauge
+	KlinesFlushed    *prometheus.CounterVec
+	QueueLength      *prometheus.GaugeVec
 	WSConnections    prometheus.Gauge
 	DBConnections    prometheus.Gauge
-	DBLatency        prometheus.Histogram
+	DBLatency        *prometheus.HistogramVec
+	StreamClients    prometheus.Gauge
+	StreamSlowDrops  prometheus.Counter
 }
 
 func NewMetrics(registry *prometheus.Registry) *Metrics {
-	m := &Metrics{
-		TradesReceived: promauto.NewCounter(prometheus.CounterOpts{
+	factory := promauto.With(registry)
+
+	return &Metrics{
+		TradesReceived: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "trades_received_total",
 			Help: "The total number of received trades",
-		}),
-		TradesQueued: promauto.NewCounter(prometheus.CounterOpts{
+		}, []string{"pair"}),
+		TradesQueued: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "trades_queued_total",
 			Help: "The total number of trades added to processing queue",
-		}),
-		TradesProcessed: promauto.NewCounter(prometheus.CounterOpts{
+		}, []string{"pair"}),
+		TradesProcessed: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "trades_processed_total",
 			Help: "The total number of successfully processed trades",
-		}),
-		TradesDropped: promauto.NewCounter(prometheus.CounterOpts{
+		}, []string{"pair"}),
+		TradesDropped: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "trades_dropped_total",
 			Help: "The total number of dropped trades due to queue overflow",
-		}),
-		ProcessingErrors: promauto.NewCounter(prometheus.CounterOpts{
+		}, []string{"stage"}),
+		ProcessingErrors: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "processing_errors_total",
 			Help: "The total number of trade processing errors",
-		}),
-		ProcessingTime: promauto.NewHistogram(prometheus.HistogramOpts{
+		}, []string{"pair"}),
+		TradeWriteErrors: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "trade_write_errors_total",
+			Help: "The total number of failed attempts to store a trade",
+		}, []string{"pair"}),
+		ProcessingTime: factory.NewHistogram(prometheus.HistogramOpts{
 			Name:    "trade_processing_duration_seconds",
 			Help:    "Time spent processing each trade",
 			Buckets: prometheus.ExponentialBuckets(0.001, 2, 10),
 		}),
-		QueueLength: promauto.NewGauge(prometheus.GaugeOpts{
+		KlinesFlushed: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "klines_flushed_total",
+			Help: "The total number of klines written to the repository",
+		}, []string{"pair", "timeframe"}),
+		QueueLength: factory.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "processing_queue_length",
 			Help: "Current length of the processing queue",
-		}),
-		WSConnections: promauto.NewGauge(prometheus.GaugeOpts{
+		}, []string{"stage"}),
+		WSConnections: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "websocket_connections",
 			Help: "Number of active WebSocket connections",
 		}),
-		DBConnections: promauto.NewGauge(prometheus.GaugeOpts{
+		DBConnections: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "database_connections",
 			Help: "Number of active database connections",
 		}),
-		DBLatency: promauto.NewHistogram(prometheus.HistogramOpts{
+		DBLatency: factory.NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "database_operation_duration_seconds",
 			Help:    "Time spent on database operations",
 			Buckets: prometheus.ExponentialBuckets(0.001, 2, 10),
+		}, []string{"operation"}),
+		StreamClients: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "stream_clients",
+			Help: "Number of connected candle stream clients",
+		}),
+		StreamSlowDrops: factory.NewCounter(prometheus.CounterOpts{
+			Name: "stream_slow_clients_dropped_total",
+			Help: "The total number of candle stream clients disconnected for being too slow",
 		}),
 	}
+}
+
+// DroppedCounter returns the drop counter of a pipeline stage, or nil when m is nil.
+func (m *Metrics) DroppedCounter(stage string) prometheus.Counter {
+	if m == nil {
+		return nil
+	}
+	return m.TradesDropped.WithLabelValues(stage)
+}
+
+func (m *Metrics) TradeReceived(pair string) {
+	if m == nil {
+		return
+	}
+	m.TradesReceived.WithLabelValues(pair).Inc()
+}
+
+func (m *Metrics) TradeQueued(pair string) {
+	if m == nil {
+		return
+	}
+	m.TradesQueued.WithLabelValues(pair).Inc()
+}
 
-	registry.MustRegister(
-		m.TradesReceived,
-		m.TradesQueued,
-		m.TradesProcessed,
-		m.TradesDropped,
-		m.ProcessingErrors,
-		m.ProcessingTime,
-		m.QueueLength,
-		m.WSConnections,
-		m.DBConnections,
-		m.DBLatency,
-	)
-
-	return m
+func (m *Metrics) TradeProcessed(pair string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.TradesProcessed.WithLabelValues(pair).Inc()
+	m.ProcessingTime.Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) ProcessingError(pair string) {
+	if m == nil {
+		return
+	}
+	m.ProcessingErrors.WithLabelValues(pair).Inc()
+}
+
+func (m *Metrics) TradeWriteFailed(pair string) {
+	if m == nil {
+		return
+	}
+	m.TradeWriteErrors.WithLabelValues(pair).Inc()
+}
+
+func (m *Metrics) KlineFlushed(pair, timeframe string) {
+	if m == nil {
+		return
+	}
+	m.KlinesFlushed.WithLabelValues(pair, timeframe).Inc()
+}
+
+func (m *Metrics) SetQueueLength(stage string, length int) {
+	if m == nil {
+		return
+	}
+	m.QueueLength.WithLabelValues(stage).Set(float64(length))
+}
+
+func (m *Metrics) WSConnected() {
+	if m == nil {
+		return
+	}
+	m.WSConnections.Inc()
+}
+
+func (m *Metrics) WSDisconnected() {
+	if m == nil {
+		return
+	}
+	m.WSConnections.Dec()
+}
+
+func (m *Metrics) SetDBConnections(n int32) {
+	if m == nil {
+		return
+	}
+	m.DBConnections.Set(float64(n))
+}
+
+// ObserveDB records the duration of a database operation started at start.
+func (m *Metrics) ObserveDB(operation string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.DBLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) StreamClientConnected() {
+	if m == nil {
+		return
+	}
+	m.StreamClients.Inc()
+}
+
+func (m *Metrics) StreamClientDisconnected() {
+	if m == nil {
+		return
+	}
+	m.StreamClients.Dec()
+}
+
+func (m *Metrics) StreamClientDropped() {
+	if m == nil {
+		return
+	}
+	m.StreamSlowDrops.Inc()
 }
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetrics_SeparateRegistries(t *testing.T) {
+	first := NewMetrics(prometheus.NewRegistry())
+	second := NewMetrics(prometheus.NewRegistry())
+
+	first.TradeReceived("BTC_USDT")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(first.TradesReceived.WithLabelValues("BTC_USDT")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(second.TradesReceived.WithLabelValues("BTC_USDT")))
+}
+
+func TestMetrics_Labels(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.DroppedCounter(StageWorker).Inc()
+	m.KlineFlushed("ETH_USDT", "MINUTE_1")
+	m.KlineFlushed("ETH_USDT", "MINUTE_1")
+	m.SetQueueLength(StageExchange, 7)
+	m.ObserveDB("save_trade", time.Now())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.TradesDropped.WithLabelValues(StageWorker)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.TradesDropped.WithLabelValues(StageExchange)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.KlinesFlushed.WithLabelValues("ETH_USDT", "MINUTE_1")))
+	assert.Equal(t, 7.0, testutil.ToFloat64(m.QueueLength.WithLabelValues(StageExchange)))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.DBLatency))
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.TradeReceived("BTC_USDT")
+		m.TradeQueued("BTC_USDT")
+		m.TradeProcessed("BTC_USDT", time.Now())
+		m.ProcessingError("BTC_USDT")
+		m.KlineFlushed("BTC_USDT", "MINUTE_1")
+		m.SetQueueLength(StageWorker, 1)
+		m.WSConnected()
+		m.WSDisconnected()
+		m.SetDBConnections(1)
+		m.ObserveDB("save_trade", time.Now())
+		m.StreamClientConnected()
+		m.StreamClientDisconnected()
+		m.StreamClientDropped()
+	})
+	assert.Nil(t, m.DroppedCounter(StageWorker))
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Policy defines what a Queue does with a new item when its buffer is full.
+type Policy string
+
+const (
+	// PolicyBlock waits until there is room in the buffer or the context is cancelled.
+	PolicyBlock Policy = "block"
+	// PolicyDropOldest discards the oldest buffered item to make room for the new one.
+	PolicyDropOldest Policy = "drop-oldest"
+	// PolicyDropNewest discards the new item.
+	PolicyDropNewest Policy = "drop-newest"
+	// PolicySpill appends overflowing items to a file and feeds them back in order.
+	PolicySpill Policy = "spill"
+)
+
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case PolicyBlock, PolicyDropOldest, PolicyDropNewest, PolicySpill:
+		return p, nil
+	case "":
+		return PolicyBlock, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q", s)
+	}
+}
+
+// Queue is a bounded FIFO channel with a configurable overflow policy.
+// Every item the queue discards is counted by the dropped counter.
+type Queue[T any] struct {
+	items   chan T
+	policy  Policy
+	dropped prometheus.Counter
+	spill   *spillFile[T]
+}
+
+// New creates a queue holding up to size items in memory. spillPath is only
+// used by PolicySpill; records left in it by a previous run are replayed first.
+// dropped may be nil.
+func New[T any](size int, policy Policy, spillPath string, dropped prometheus.Counter) *Queue[T] {
+	if size < 1 {
+		size = 1
+	}
+
+	q := &Queue[T]{
+		items:   make(chan T, size),
+		policy:  policy,
+		dropped: dropped,
+	}
+
+	if policy == PolicySpill {
+		q.spill = newSpillFile[T](spillPath, q.items)
+	}
+
+	return q
+}
+
+// C returns the channel consumers read items from. It is closed by Close.
+func (q *Queue[T]) C() <-chan T {
+	return q.items
+}
+
+func (q *Queue[T]) Len() int {
+	return len(q.items)
+}
+
+// Push adds an item according to the queue policy and reports whether the
+// item was accepted. Push must not be called after Close.
+func (q *Queue[T]) Push(ctx context.Context, item T) bool {
+	switch q.policy {
+	case PolicyDropNewest:
+		select {
+		case q.items <- item:
+			return true
+		default:
+			q.drop("queue is full, dropping newest item")
+			return false
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case q.items <- item:
+				return true
+			default:
+			}
+
+			select {
+			case <-q.items:
+				q.drop("queue is full, dropping oldest item")
+			default:
+			}
+		}
+	case PolicySpill:
+		if err := q.spill.push(item); err != nil {
+			q.drop(fmt.Sprintf("spill error: %v", err))
+			return false
+		}
+		return true
+	default:
+		select {
+		case q.items <- item:
+			return true
+		case <-ctx.Done():
+			q.drop("context cancelled while waiting for queue space")
+			return false
+		}
+	}
+}
+
+// Close stops accepting items and closes the consumer channel. Items that
+// are still spilled to disk stay in the spill file for the next run.
+func (q *Queue[T]) Close() {
+	if q.spill != nil {
+		q.spill.close()
+	}
+	close(q.items)
+}
+
+func (q *Queue[T]) drop(reason string) {
+	log.Printf("Dropping item: %s", reason)
+	if q.dropped != nil {
+		q.dropped.Inc()
+	}
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDroppedCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped_total"})
+}
+
+func drainN(t *testing.T, q *Queue[int], n int) []int {
+	t.Helper()
+
+	items := make([]int, 0, n)
+	for len(items) < n {
+		select {
+		case item := <-q.C():
+			items = append(items, item)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after reading %d of %d items", len(items), n)
+		}
+	}
+	return items
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, s := range []string{"block", "drop-oldest", "drop-newest", "spill"} {
+		p, err := ParsePolicy(s)
+		require.NoError(t, err)
+		assert.Equal(t, Policy(s), p)
+	}
+
+	p, err := ParsePolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, PolicyBlock, p)
+
+	_, err = ParsePolicy("unknown")
+	assert.Error(t, err)
+}
+
+func TestQueue_DropNewest(t *testing.T) {
+	dropped := newDroppedCounter()
+	q := New[int](2, PolicyDropNewest, "", dropped)
+
+	assert.True(t, q.Push(context.Background(), 1))
+	assert.True(t, q.Push(context.Background(), 2))
+	assert.False(t, q.Push(context.Background(), 3))
+
+	assert.Equal(t, []int{1, 2}, drainN(t, q, 2))
+	assert.Equal(t, 1.0, testutil.ToFloat64(dropped))
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	dropped := newDroppedCounter()
+	q := New[int](2, PolicyDropOldest, "", dropped)
+
+	for i := 1; i <= 4; i++ {
+		assert.True(t, q.Push(context.Background(), i))
+	}
+
+	assert.Equal(t, []int{3, 4}, drainN(t, q, 2))
+	assert.Equal(t, 2.0, testutil.ToFloat64(dropped))
+}
+
+func TestQueue_Block(t *testing.T) {
+	dropped := newDroppedCounter()
+	q := New[int](1, PolicyBlock, "", dropped)
+
+	assert.True(t, q.Push(context.Background(), 1))
+
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.Push(context.Background(), 2)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Equal(t, []int{1}, drainN(t, q, 1))
+	assert.True(t, <-pushed)
+	assert.Equal(t, []int{2}, drainN(t, q, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.True(t, q.Push(ctx, 3))
+	cancel()
+	assert.False(t, q.Push(ctx, 4))
+	assert.Equal(t, 1.0, testutil.ToFloat64(dropped))
+}
+
+func TestQueue_SpillKeepsOrder(t *testing.T) {
+	dropped := newDroppedCounter()
+	path := filepath.Join(t.TempDir(), "spill", "trades.spill")
+	q := New[int](4, PolicySpill, path, dropped)
+	defer q.Close()
+
+	for i := 0; i < 100; i++ {
+		require.True(t, q.Push(context.Background(), i))
+	}
+
+	expected := make([]int, 100)
+	for i := range expected {
+		expected[i] = i
+	}
+	assert.Equal(t, expected, drainN(t, q, 100))
+	assert.Equal(t, 0.0, testutil.ToFloat64(dropped))
+
+	require.True(t, q.Push(context.Background(), 100))
+	assert.Equal(t, []int{100}, drainN(t, q, 1))
+}
+
+func TestQueue_SpillSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.spill")
+
+	q := New[int](2, PolicySpill, path, nil)
+	for i := 0; i < 10; i++ {
+		require.True(t, q.Push(context.Background(), i))
+	}
+	assert.Equal(t, []int{0, 1, 2}, drainN(t, q, 3))
+	q.Close()
+
+	var remaining []int
+	for item := range q.C() {
+		remaining = append(remaining, item)
+	}
+
+	_, err := os.Stat(path)
+	require.NoError(t, err)
+
+	restarted := New[int](2, PolicySpill, path, nil)
+	defer restarted.Close()
+
+	replayed := drainN(t, restarted, 10-3-len(remaining))
+	assert.Equal(t, 10, 3+len(remaining)+len(replayed))
+	all := append(append([]int{0, 1, 2}, remaining...), replayed...)
+	for i, item := range all {
+		assert.Equal(t, i, item)
+	}
+}
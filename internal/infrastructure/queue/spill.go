@@ -0,0 +1,277 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// spillFile keeps the items that did not fit into the queue buffer as JSON
+// lines and feeds them back into the buffer in the order they were written.
+// While the file holds records, new items are appended to it as well so the
+// queue stays FIFO.
+type spillFile[T any] struct {
+	path  string
+	items chan<- T
+
+	mu         sync.Mutex
+	writer     *os.File
+	readFile   *os.File
+	reader     *bufio.Reader
+	readOffset int64
+	pending    int
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newSpillFile[T any](path string, items chan<- T) *spillFile[T] {
+	s := &spillFile[T]{
+		path:    path,
+		items:   items,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	pending, err := countRecords(path)
+	if err != nil {
+		log.Printf("Failed to read spill file %s: %v", path, err)
+	}
+	s.pending = pending
+	if pending > 0 {
+		log.Printf("Replaying %d spilled items from %s", pending, path)
+		s.notify()
+	}
+
+	go s.drain()
+
+	return s
+}
+
+func (s *spillFile[T]) push(item T) error {
+	s.mu.Lock()
+	if s.pending == 0 {
+		select {
+		case s.items <- item:
+			s.mu.Unlock()
+			return nil
+		default:
+		}
+	}
+
+	err := s.appendLocked(item)
+	if err == nil {
+		s.pending++
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func (s *spillFile[T]) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *spillFile[T]) appendLocked(item T) error {
+	if s.writer == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+			return fmt.Errorf("create spill directory: %w", err)
+		}
+		f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open spill file: %w", err)
+		}
+		s.writer = f
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("encode spilled item: %w", err)
+	}
+
+	if _, err := s.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	return nil
+}
+
+func (s *spillFile[T]) drain() {
+	defer close(s.stopped)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		for {
+			item, size, ok, err := s.next()
+			if err != nil {
+				log.Printf("Failed to read spill file %s: %v", s.path, err)
+				break
+			}
+			if !ok {
+				break
+			}
+
+			select {
+			case s.items <- item:
+				s.ack(size)
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// next reads the oldest spilled record without removing it from the file.
+func (s *spillFile[T]) next() (T, int64, bool, error) {
+	var item T
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.pending > 0 {
+		if s.reader == nil {
+			f, err := os.Open(s.path)
+			if err != nil {
+				return item, 0, false, err
+			}
+			if _, err := f.Seek(s.readOffset, io.SeekStart); err != nil {
+				f.Close()
+				return item, 0, false, err
+			}
+			s.readFile = f
+			s.reader = bufio.NewReader(f)
+		}
+
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			return item, 0, false, err
+		}
+
+		if err := json.Unmarshal(line, &item); err != nil {
+			log.Printf("Skipping corrupted spill record: %v", err)
+			s.ackLocked(int64(len(line)))
+			continue
+		}
+		return item, int64(len(line)), true, nil
+	}
+
+	return item, 0, false, nil
+}
+
+func (s *spillFile[T]) ack(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ackLocked(size)
+}
+
+func (s *spillFile[T]) ackLocked(size int64) {
+	s.pending--
+	s.readOffset += size
+	if s.pending > 0 {
+		return
+	}
+
+	if err := os.Truncate(s.path, 0); err != nil {
+		log.Printf("Failed to truncate spill file %s: %v", s.path, err)
+		return
+	}
+	s.readOffset = 0
+	if s.readFile != nil {
+		s.readFile.Close()
+		s.readFile = nil
+		s.reader = nil
+	}
+}
+
+// close stops the replay and rewrites the spill file so that it only holds
+// the records that have not been handed to the consumer yet.
+func (s *spillFile[T]) close() {
+	close(s.done)
+	<-s.stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readFile != nil {
+		s.readFile.Close()
+	}
+	if s.writer != nil {
+		s.writer.Close()
+	}
+
+	if s.pending == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove spill file %s: %v", s.path, err)
+		}
+		return
+	}
+
+	if err := compact(s.path, s.readOffset); err != nil {
+		log.Printf("Failed to compact spill file %s: %v", s.path, err)
+		return
+	}
+	log.Printf("Kept %d spilled items in %s", s.pending, s.path)
+}
+
+func compact(path string, offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func countRecords(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Count(data, []byte{'\n'}), nil
+}
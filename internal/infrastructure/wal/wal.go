@@ -0,0 +1,487 @@
+// Package wal implements an append-only log of records kept in segment files
+// of a directory. Records are read back oldest first and removed segment by
+// segment once they have been consumed.
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSegmentSize  = 64 << 20
+	defaultSyncInterval = time.Second
+
+	segmentExt = ".wal"
+
+	// headerSize is the size of the record header: the length of the
+	// payload and its CRC-32, both little endian uint32.
+	headerSize = 8
+)
+
+// ErrFull is returned by Append when the record would exceed the size cap.
+var ErrFull = errors.New("wal is full")
+
+// SyncPolicy defines when appended records are flushed to disk with fsync.
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes every record before Append returns.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes appended records every sync interval, so a crash
+	// of the machine loses at most that much of the log.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch p := SyncPolicy(s); p {
+	case SyncAlways, SyncInterval, SyncNever:
+		return p, nil
+	case "":
+		return SyncInterval, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q", s)
+	}
+}
+
+type segment struct {
+	index int64
+	size  int64
+}
+
+// Log is a segmented write-ahead log. Appends and reads may run concurrently,
+// but there must be a single reader.
+//
+// A record is consumed when Replay's callback returns nil for it. The read
+// position is only kept in memory, so after a restart the records of a
+// partially consumed segment are read again.
+type Log struct {
+	dir          string
+	segmentSize  int64
+	maxSize      int64
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+
+	replayMu sync.Mutex
+
+	mu         sync.Mutex
+	segments   []segment
+	active     *os.File
+	reader     *os.File
+	readOffset int64
+	size       int64
+	records    int
+	unsynced   bool
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+type Option func(*Log)
+
+// WithSegmentSize sets the size in bytes after which a new segment file is
+// started.
+func WithSegmentSize(size int64) Option {
+	return func(l *Log) {
+		if size > 0 {
+			l.segmentSize = size
+		}
+	}
+}
+
+// WithMaxSize caps the total size in bytes of the segment files; 0 means no
+// cap.
+func WithMaxSize(size int64) Option {
+	return func(l *Log) {
+		if size >= 0 {
+			l.maxSize = size
+		}
+	}
+}
+
+// WithSync sets the fsync policy and the interval used by SyncInterval.
+func WithSync(policy SyncPolicy, interval time.Duration) Option {
+	return func(l *Log) {
+		l.syncPolicy = policy
+		if interval > 0 {
+			l.syncInterval = interval
+		}
+	}
+}
+
+// Open opens the log in dir, creating the directory if needed. A record torn
+// by a crash at the end of a segment is cut off.
+func Open(dir string, opts ...Option) (*Log, error) {
+	l := &Log{
+		dir:          dir,
+		segmentSize:  defaultSegmentSize,
+		syncPolicy:   SyncInterval,
+		syncInterval: defaultSyncInterval,
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create wal directory: %w", err)
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if l.records > 0 {
+		log.Printf("Found %d records in %d wal segments of %s", l.records, len(l.segments), dir)
+	}
+
+	if l.syncPolicy == SyncInterval {
+		go l.syncLoop()
+	} else {
+		close(l.stopped)
+	}
+
+	return l, nil
+}
+
+func (l *Log) load() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("read wal directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		index, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, segment{index: index})
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].index < l.segments[j].index })
+
+	for i := range l.segments {
+		records, size, err := l.scan(l.segments[i].index)
+		if err != nil {
+			return err
+		}
+		l.segments[i].size = size
+		l.records += records
+		l.size += size
+	}
+	return nil
+}
+
+// scan counts the valid records of a segment and truncates whatever follows
+// them.
+func (l *Log) scan(index int64) (int, int64, error) {
+	path := l.path(index)
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open wal segment: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("stat wal segment: %w", err)
+	}
+
+	var records int
+	var offset int64
+	for offset < info.Size() {
+		_, size, err := readRecord(f, offset, info.Size())
+		if err != nil {
+			log.Printf("Truncating wal segment %s at offset %d: %v", path, offset, err)
+			if err := f.Truncate(offset); err != nil {
+				return 0, 0, fmt.Errorf("truncate wal segment: %w", err)
+			}
+			break
+		}
+		records++
+		offset += size
+	}
+	return records, offset, nil
+}
+
+// Append adds a record to the end of the log.
+func (l *Log) Append(data []byte) error {
+	record := make([]byte, headerSize+len(data))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[headerSize:], data)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSize > 0 && l.size+int64(len(record)) > l.maxSize {
+		return ErrFull
+	}
+
+	if l.active == nil || l.segments[len(l.segments)-1].size+int64(len(record)) > l.segmentSize {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.active.Write(record); err != nil {
+		return fmt.Errorf("write wal segment: %w", err)
+	}
+	l.segments[len(l.segments)-1].size += int64(len(record))
+	l.size += int64(len(record))
+	l.records++
+
+	switch l.syncPolicy {
+	case SyncAlways:
+		if err := l.active.Sync(); err != nil {
+			return fmt.Errorf("sync wal segment: %w", err)
+		}
+	case SyncInterval:
+		l.unsynced = true
+	}
+	return nil
+}
+
+// rotateLocked starts appending to a new segment. An empty last segment, e.g.
+// one left by a previous run, is reused.
+func (l *Log) rotateLocked() error {
+	if l.active != nil {
+		if err := l.active.Sync(); err != nil {
+			return fmt.Errorf("sync wal segment: %w", err)
+		}
+		l.active.Close()
+		l.active = nil
+	}
+
+	var index int64
+	if n := len(l.segments); n > 0 {
+		index = l.segments[n-1].index
+		if l.segments[n-1].size > 0 {
+			index++
+			l.segments = append(l.segments, segment{index: index})
+		}
+	} else {
+		l.segments = append(l.segments, segment{index: index})
+	}
+
+	f, err := os.OpenFile(l.path(index), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open wal segment: %w", err)
+	}
+	l.active = f
+	return nil
+}
+
+// Replay hands the records to fn oldest first and removes the ones fn
+// returns nil for. It stops at the first error of fn, which is returned with
+// the number of consumed records; that record is handed over again by the
+// next Replay.
+func (l *Log) Replay(fn func(data []byte) error) (int, error) {
+	l.replayMu.Lock()
+	defer l.replayMu.Unlock()
+
+	var consumed int
+	for {
+		data, size, ok, err := l.next()
+		if err != nil || !ok {
+			return consumed, err
+		}
+		if err := fn(data); err != nil {
+			return consumed, err
+		}
+		if err := l.ack(size); err != nil {
+			return consumed, err
+		}
+		consumed++
+	}
+}
+
+// next reads the oldest record without consuming it.
+func (l *Log) next() ([]byte, int64, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.records == 0 {
+		return nil, 0, false, nil
+	}
+
+	for l.readOffset >= l.segments[0].size {
+		// Segments are only left empty at the end of the log.
+		if len(l.segments) == 1 {
+			return nil, 0, false, nil
+		}
+		if err := l.removeFirstLocked(); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	if l.reader == nil {
+		f, err := os.Open(l.path(l.segments[0].index))
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("open wal segment: %w", err)
+		}
+		l.reader = f
+	}
+
+	data, size, err := readRecord(l.reader, l.readOffset, l.segments[0].size)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("read wal segment: %w", err)
+	}
+	return data, size, true, nil
+}
+
+func (l *Log) ack(size int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.readOffset += size
+	l.records--
+
+	if l.readOffset < l.segments[0].size {
+		return nil
+	}
+	if len(l.segments) > 1 || l.records == 0 {
+		return l.removeFirstLocked()
+	}
+	return nil
+}
+
+// removeFirstLocked deletes the first segment, which has been consumed.
+func (l *Log) removeFirstLocked() error {
+	if l.reader != nil {
+		l.reader.Close()
+		l.reader = nil
+	}
+
+	first := l.segments[0]
+	if len(l.segments) == 1 && l.active != nil {
+		l.active.Close()
+		l.active = nil
+	}
+	if err := os.Remove(l.path(first.index)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove wal segment: %w", err)
+	}
+
+	l.segments = l.segments[1:]
+	l.size -= first.size
+	l.readOffset = 0
+	return nil
+}
+
+// Len returns the number of records that have not been consumed.
+func (l *Log) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.records
+}
+
+// Size returns the total size of the segment files in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Sync flushes the appended records to disk.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.syncLocked()
+}
+
+func (l *Log) syncLocked() error {
+	if l.active == nil || !l.unsynced {
+		return nil
+	}
+	l.unsynced = false
+	return l.active.Sync()
+}
+
+func (l *Log) syncLoop() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			if err := l.Sync(); err != nil {
+				log.Printf("Failed to sync wal %s: %v", l.dir, err)
+			}
+		}
+	}
+}
+
+// Close flushes and closes the log. Records that have not been consumed stay
+// in the directory and are read again by the next Open.
+func (l *Log) Close() error {
+	close(l.done)
+	<-l.stopped
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.reader != nil {
+		l.reader.Close()
+		l.reader = nil
+	}
+	if l.active == nil {
+		return nil
+	}
+
+	l.unsynced = true
+	err := l.syncLocked()
+	if cerr := l.active.Close(); err == nil {
+		err = cerr
+	}
+	l.active = nil
+	return err
+}
+
+func (l *Log) path(index int64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%016d%s", index, segmentExt))
+}
+
+// readRecord reads the record at offset of a segment of size end and returns
+// its payload and its size including the header.
+func readRecord(r io.ReaderAt, offset, end int64) ([]byte, int64, error) {
+	if offset+headerSize > end {
+		return nil, 0, errors.New("truncated record header")
+	}
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return nil, 0, fmt.Errorf("read record header: %w", err)
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if offset+headerSize+int64(length) > end {
+		return nil, 0, errors.New("truncated record")
+	}
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset+headerSize); err != nil {
+		return nil, 0, fmt.Errorf("read record: %w", err)
+	}
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+	return data, headerSize + int64(length), nil
+}
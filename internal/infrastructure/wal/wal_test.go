@@ -0,0 +1,169 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendRecords(t *testing.T, l *Log, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		require.NoError(t, l.Append([]byte(fmt.Sprintf("record-%03d", i))))
+	}
+}
+
+func replayAll(t *testing.T, l *Log) []string {
+	t.Helper()
+	var records []string
+	_, err := l.Replay(func(data []byte) error {
+		records = append(records, string(data))
+		return nil
+	})
+	require.NoError(t, err)
+	return records
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestLog_ReplaysInOrderAcrossSegments(t *testing.T) {
+	dir := t.TempDir()
+	// Every record takes 18 bytes, so a segment holds three of them.
+	l, err := Open(dir, WithSegmentSize(60), WithSync(SyncAlways, 0))
+	require.NoError(t, err)
+	defer l.Close()
+
+	appendRecords(t, l, 0, 10)
+	assert.Equal(t, 10, l.Len())
+	assert.Len(t, segmentFiles(t, dir), 4)
+
+	records := replayAll(t, l)
+	require.Len(t, records, 10)
+	assert.Equal(t, "record-000", records[0])
+	assert.Equal(t, "record-009", records[9])
+
+	assert.Zero(t, l.Len())
+	assert.Zero(t, l.Size())
+	assert.Empty(t, segmentFiles(t, dir))
+
+	// The log keeps working after it has been emptied.
+	appendRecords(t, l, 10, 12)
+	assert.Equal(t, []string{"record-010", "record-011"}, replayAll(t, l))
+}
+
+func TestLog_ReplayStopsAtError(t *testing.T) {
+	l, err := Open(t.TempDir(), WithSegmentSize(60))
+	require.NoError(t, err)
+	defer l.Close()
+
+	appendRecords(t, l, 0, 5)
+
+	unavailable := errors.New("unavailable")
+	consumed, err := l.Replay(func(data []byte) error {
+		if string(data) == "record-003" {
+			return unavailable
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 3, consumed)
+	assert.Equal(t, 2, l.Len())
+
+	// Records appended meanwhile come after the ones not consumed yet.
+	appendRecords(t, l, 5, 6)
+	assert.Equal(t, []string{"record-003", "record-004", "record-005"}, replayAll(t, l))
+}
+
+func TestLog_MaxSize(t *testing.T) {
+	l, err := Open(t.TempDir(), WithSegmentSize(60), WithMaxSize(100))
+	require.NoError(t, err)
+	defer l.Close()
+
+	appendRecords(t, l, 0, 5)
+	assert.ErrorIs(t, l.Append([]byte("record-005")), ErrFull)
+	assert.Equal(t, 5, l.Len())
+
+	// Consumed segments free their space.
+	_, err = l.Replay(func(data []byte) error {
+		if string(data) == "record-003" {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	assert.NoError(t, l.Append([]byte("record-005")))
+}
+
+func TestLog_ReopenKeepsUnconsumedRecords(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, WithSegmentSize(60), WithSync(SyncNever, 0))
+	require.NoError(t, err)
+
+	appendRecords(t, l, 0, 7)
+	_, err = l.Replay(func(data []byte) error {
+		if string(data) == "record-004" {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	require.NoError(t, l.Close())
+
+	l, err = Open(dir, WithSegmentSize(60))
+	require.NoError(t, err)
+	defer l.Close()
+
+	// The consumed segment is gone; the rest of the partially consumed one is
+	// read again.
+	assert.Equal(t, 4, l.Len())
+	appendRecords(t, l, 7, 8)
+	assert.Equal(t, []string{"record-003", "record-004", "record-005", "record-006", "record-007"}, replayAll(t, l))
+}
+
+func TestLog_TruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir)
+	require.NoError(t, err)
+	appendRecords(t, l, 0, 3)
+	require.NoError(t, l.Close())
+
+	// A crash in the middle of a write leaves half a record behind.
+	files := segmentFiles(t, dir)
+	require.Len(t, files, 1)
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{12, 0, 0, 0, 1, 2, 3, 4, 'r', 'e'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	l, err = Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Equal(t, 3, l.Len())
+	appendRecords(t, l, 3, 4)
+	assert.Equal(t, []string{"record-000", "record-001", "record-002", "record-003"}, replayAll(t, l))
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	policy, err := ParseSyncPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, SyncInterval, policy)
+
+	policy, err = ParseSyncPolicy("always")
+	require.NoError(t, err)
+	assert.Equal(t, SyncAlways, policy)
+
+	_, err = ParseSyncPolicy("sometimes")
+	assert.Error(t, err)
+}
@@ -1,5 +1,7 @@
 package service
 
+import "github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+
 const (
 	TimeFrame1m  = "1m"
 	TimeFrame15m = "15m"
@@ -12,40 +14,25 @@ const (
 	PoloniexTimeFrame1d  = "DAY_1"
 )
 
-var TimeFrameMapping = map[string]string{
-	TimeFrame1m:  PoloniexTimeFrame1m,
-	TimeFrame15m: PoloniexTimeFrame15m,
-	TimeFrame1h:  PoloniexTimeFrame1h,
-	TimeFrame1d:  PoloniexTimeFrame1d,
-}
-
-func ConvertTimeFrameToAPI(timeframe string) string {
-	if apiTimeframe, ok := TimeFrameMapping[timeframe]; ok {
-		return apiTimeframe
+func ConvertTimeFrameToAPI(name string) string {
+	if tf, err := timeframe.Parse(name); err == nil {
+		return tf.Name
 	}
-	return timeframe
+	return name
 }
 
 func ConvertAPIToTimeFrame(apiTimeframe string) string {
-	for internal, api := range TimeFrameMapping {
-		if api == apiTimeframe {
-			return internal
-		}
+	if tf, err := timeframe.Parse(apiTimeframe); err == nil {
+		return tf.Alias
 	}
 	return apiTimeframe
 }
 
-func GetTimeFrameDuration(timeframe string) int64 {
-	switch timeframe {
-	case TimeFrame1m, PoloniexTimeFrame1m:
-		return 60 * 1e9
-	case TimeFrame15m, PoloniexTimeFrame15m:
-		return 15 * 60 * 1e9
-	case TimeFrame1h, PoloniexTimeFrame1h:
-		return 60 * 60 * 1e9
-	case TimeFrame1d, PoloniexTimeFrame1d:
-		return 24 * 60 * 60 * 1e9
-	default:
-		return 60 * 1e9
+// GetTimeFrameDuration returns the length of a timeframe in nanoseconds, or
+// one minute for an unknown timeframe.
+func GetTimeFrameDuration(name string) int64 {
+	if tf, err := timeframe.Parse(name); err == nil {
+		return tf.Duration.Nanoseconds()
 	}
+	return 60 * 1e9
 }
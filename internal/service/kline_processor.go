@@ -6,78 +6,245 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math"
-	"strconv"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/shopspring/decimal"
+
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+const (
+	defaultFlushInterval = 5 * time.Second
+	defaultBatchSize     = 1000
+
+	// closeCheckInterval is how often candles whose time has passed are
+	// marked and announced as closed.
+	closeCheckInterval = time.Second
 )
 
 type KlineRepository interface {
 	SaveKline(ctx context.Context, kline models.Kline) error
+	SaveKlines(ctx context.Context, klines []models.Kline) error
 	GetLastKline(ctx context.Context, pair, timeframe string) (*models.Kline, error)
 	GetKlineByInterval(ctx context.Context, pair, timeframe string, beginTime int64) (*models.Kline, error)
 }
 
+// KlineListener is notified about every candle change. closed is true for
+// the final state of a candle, sent once its time is over, and for late
+// corrections of a candle that was already announced as closed.
+//
+// OnKline is called from the trade processing path and must not block.
+type KlineListener interface {
+	OnKline(kline models.Kline, closed bool)
+}
+
+type klineKey struct {
+	pair      string
+	timeframe string
+}
+
+type klineEvent struct {
+	kline  models.Kline
+	closed bool
+}
+
+// KlineProcessor aggregates trades into open candles kept in memory and
+// flushes changed candles to the repository periodically, when the number of
+// changed candles reaches the batch size, or when a candle closes.
 type KlineProcessor struct {
-	repository KlineRepository
+	repository    KlineRepository
+	timeframes    []timeframe.TimeFrame
+	flushInterval time.Duration
+	batchSize     int
+	metrics       *metrics.Metrics
+	listeners     []KlineListener
+	cascadeMode   bool
+	// cascade is set in cascade mode, where only its base timeframe is built
+	// from trades.
+	cascade *cascade
+
+	flushMu sync.Mutex
+
+	mu     sync.Mutex
+	klines map[klineKey]*models.Kline
+	dirty  map[klineKey]struct{}
+	closed []models.Kline
+	// parts holds the lower timeframe candles of the current candle of
+	// every rolled up key in cascade mode.
+	parts map[klineKey][]models.Kline
+	// announced holds the begin time of the last candle of every key that
+	// was reported to the listener as closed.
+	announced map[klineKey]int64
+	// repaired holds the begin time of the last candle of every key that was
+	// replaced by Repair.
+	repaired map[klineKey]int64
 }
 
-func NewKlineProcessor(repository KlineRepository) *KlineProcessor {
-	return &KlineProcessor{
-		repository: repository,
+type KlineProcessorOption func(*KlineProcessor)
+
+// WithFlushInterval sets how often changed candles are written to the repository.
+func WithFlushInterval(interval time.Duration) KlineProcessorOption {
+	return func(p *KlineProcessor) {
+		if interval > 0 {
+			p.flushInterval = interval
+		}
 	}
 }
 
-func (p *KlineProcessor) ProcessTrade(ctx context.Context, trade *models.RecentTrade) error {
-	timeframes := []string{PoloniexTimeFrame1m, PoloniexTimeFrame15m, PoloniexTimeFrame1h, PoloniexTimeFrame1d}
+// WithBatchSize sets the maximum number of candles written in one repository
+// call and the number of changed candles that triggers an early flush.
+func WithBatchSize(size int) KlineProcessorOption {
+	return func(p *KlineProcessor) {
+		if size > 0 {
+			p.batchSize = size
+		}
+	}
+}
 
-	log.Printf("Processing trade: Pair=%s, Price=%s, Amount=%s, Side=%s, Timestamp=%d",
-		trade.Pair, trade.Price, trade.Amount, trade.Side, trade.Timestamp)
+// WithTimeFrames sets the timeframes klines are built for.
+func WithTimeFrames(timeframes []timeframe.TimeFrame) KlineProcessorOption {
+	return func(p *KlineProcessor) {
+		if len(timeframes) > 0 {
+			p.timeframes = timeframes
+		}
+	}
+}
+
+// WithProcessorMetrics sets the metrics updated for processed trades and flushed klines.
+func WithProcessorMetrics(m *metrics.Metrics) KlineProcessorOption {
+	return func(p *KlineProcessor) {
+		p.metrics = m
+	}
+}
+
+// WithKlineListener adds a listener notified about candle changes.
+func WithKlineListener(listener KlineListener) KlineProcessorOption {
+	return func(p *KlineProcessor) {
+		p.listeners = append(p.listeners, listener)
+	}
+}
 
-	price, err := strconv.ParseFloat(trade.Price, 64)
-	if err != nil {
-		return fmt.Errorf("invalid price format: %w", err)
+// WithCascade builds only MINUTE_1 candles from trades and rolls every other
+// timeframe up from finished candles of a lower timeframe. MINUTE_1 is added
+// to the timeframes when it is missing.
+func WithCascade() KlineProcessorOption {
+	return func(p *KlineProcessor) {
+		p.cascadeMode = true
 	}
+}
 
-	amount, err := strconv.ParseFloat(trade.Amount, 64)
-	if err != nil {
-		return fmt.Errorf("invalid amount format: %w", err)
+func NewKlineProcessor(repository KlineRepository, opts ...KlineProcessorOption) *KlineProcessor {
+	p := &KlineProcessor{
+		repository:    repository,
+		timeframes:    timeframe.MustParseList(timeframe.Default),
+		flushInterval: defaultFlushInterval,
+		batchSize:     defaultBatchSize,
+		klines:        make(map[klineKey]*models.Kline),
+		dirty:         make(map[klineKey]struct{}),
+		parts:         make(map[klineKey][]models.Kline),
+		announced:     make(map[klineKey]int64),
+		repaired:      make(map[klineKey]int64),
 	}
 
-	quoteAmount := price * amount
+	for _, opt := range opts {
+		opt(p)
+	}
 
-	for _, timeframe := range timeframes {
-		tfConvert := ConvertAPIToTimeFrame(timeframe)
+	if p.cascadeMode {
+		c := newCascade(p.timeframes)
+		p.cascade = &c
+		p.timeframes = c.order
+	}
 
-		beginTime, endTime := getKlineTimestamps(trade.Timestamp, tfConvert)
-		log.Printf("Kline timestamps: BeginTime=%d, EndTime=%d", beginTime, endTime)
-		log.Printf("Converting timestamps: BeginTime=%s, EndTime=%s", time.Unix(0, beginTime), time.Unix(0, endTime))
+	return p
+}
 
-		var klineExists bool
-		lastKline, err := p.repository.GetLastKline(ctx, trade.Pair, timeframe)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
-		if errors.Is(err, sql.ErrNoRows) || lastKline == nil {
-			log.Printf("No kline found Pair=%s, TimeFrame=%s, BeginTime=%d, creating new one", trade.Pair, tfConvert, beginTime)
-			klineExists = false
+// Restore loads the last stored candle of every pair and timeframe so that
+// trades arriving after a restart continue the candle that was open before it.
+// In cascade mode the lower timeframe candles of every rolled up candle are
+// loaded too, which requires the repository to implement
+// KlineRangeRepository.
+func (p *KlineProcessor) Restore(ctx context.Context, pairs []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pair := range pairs {
+		for _, tf := range p.timeframes {
+			lastKline, err := p.repository.GetLastKline(ctx, pair, tf.Name)
+			if errors.Is(err, sql.ErrNoRows) || (err == nil && lastKline == nil) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("restore kline %s %s: %w", pair, tf.Name, err)
+			}
+
+			key := klineKey{pair: pair, timeframe: tf.Name}
+			p.klines[key] = lastKline
+			log.Printf("Restored kline: Pair=%s, TimeFrame=%s, BeginTime=%d", pair, tf.Name, lastKline.UtcBegin)
+
+			if p.cascade == nil || tf.Name == p.cascade.base.Name {
+				continue
+			}
+			ranges, ok := p.repository.(KlineRangeRepository)
+			if !ok {
+				return fmt.Errorf("restore kline %s %s: repository cannot read klines by time range", pair, tf.Name)
+			}
+			parent := p.cascade.parents[tf.Name]
+			begin, end := tf.Bounds(lastKline.UtcBegin)
+			parts, err := ranges.GetKlinesByTimeRange(ctx, pair, parent.Name, begin, end)
+			if err != nil {
+				return fmt.Errorf("restore kline %s %s: %w", pair, tf.Name, err)
+			}
+			p.parts[key] = parts
 		}
+	}
 
-		if lastKline != nil && lastKline.UtcBegin >= beginTime {
-			log.Printf("Found kline: Pair=%s, TimeFrame=%s, BeginTime=%d, EndTime=%d",
-				lastKline.Pair, lastKline.TimeFrame, lastKline.UtcBegin, lastKline.UtcEnd)
-			klineExists = true
-		} else {
-			log.Printf("No kline found Pair=%s, TimeFrame=%s, BeginTime=%d, creating new one", trade.Pair, tfConvert, beginTime)
-			klineExists = false
+	return nil
+}
+
+func (p *KlineProcessor) ProcessTrade(ctx context.Context, trade *models.RecentTrade) error {
+	start := time.Now()
+	log.Printf("Processing trade: Pair=%s, Price=%s, Quantity=%s, Amount=%s, Side=%s, Timestamp=%d",
+		trade.Pair, trade.Price, trade.Quantity, trade.Amount, trade.Side, trade.Timestamp)
+
+	// Quantity is the traded volume in the base currency, Amount the same
+	// volume in the quote currency.
+	price, baseAmount, quoteAmount := trade.Price, trade.Quantity, trade.Amount
+
+	var events []klineEvent
+
+	p.mu.Lock()
+	closedBefore := len(p.closed)
+
+	timeframes := p.timeframes
+	if p.cascade != nil {
+		timeframes = timeframes[:1]
+	}
+
+	for _, tf := range timeframes {
+		timeframe := tf.Name
+		key := klineKey{pair: trade.Pair, timeframe: timeframe}
+		beginTime, endTime := getKlineTimestamps(trade.Timestamp, tf)
+
+		kline := p.klines[key]
+		if kline != nil && (beginTime < kline.UtcBegin || beginTime == p.repaired[key]) {
+			log.Printf("Skipping late trade for closed kline: Pair=%s, TimeFrame=%s, BeginTime=%d",
+				trade.Pair, timeframe, beginTime)
+			continue
 		}
 
-		log.Printf("GetLastKline result: Pair=%s, TimeFrame=%s, Error=%v, Found=%v, LastKline=%+v,  klineExists§=%v",
-			trade.Pair, timeframe, err, lastKline != nil, lastKline, klineExists)
+		if kline == nil || beginTime > kline.UtcBegin {
+			if kline != nil {
+				p.finish(key, kline, &events)
+			}
 
-		if !klineExists {
-			newKline := models.Kline{
+			kline = &models.Kline{
+				Exchange:  trade.Exchange,
 				Pair:      trade.Pair,
 				TimeFrame: timeframe,
 				O:         price,
@@ -88,78 +255,313 @@ func (p *KlineProcessor) ProcessTrade(ctx context.Context, trade *models.RecentT
 				UtcEnd:    endTime,
 				BeginDt:   time.Unix(0, beginTime*(int64(time.Millisecond))).UTC(),
 				EndDt:     time.Unix(0, endTime*(int64(time.Millisecond))).UTC(),
-				VolumeBS: models.VBS{
-					BuyBase:   0,
-					SellBase:  0,
-					BuyQuote:  0,
-					SellQuote: 0,
-				},
+
+				FirstTradeID: trade.Tid,
 			}
+			p.klines[key] = kline
+		} else {
+			kline.H = decimal.Max(kline.H, price)
+			kline.L = decimal.Min(kline.L, price)
+			kline.C = price
+		}
+
+		if trade.Side == "buy" {
+			kline.VolumeBS.BuyBase = kline.VolumeBS.BuyBase.Add(baseAmount)
+			kline.VolumeBS.BuyQuote = kline.VolumeBS.BuyQuote.Add(quoteAmount)
+		} else {
+			kline.VolumeBS.SellBase = kline.VolumeBS.SellBase.Add(baseAmount)
+			kline.VolumeBS.SellQuote = kline.VolumeBS.SellQuote.Add(quoteAmount)
+		}
+
+		kline.TradeCount++
+		kline.LastTradeID = trade.Tid
+		kline.BaseVolume = kline.BaseVolume.Add(baseAmount)
+		kline.QuoteVolume = kline.QuoteVolume.Add(quoteAmount)
+		if !kline.BaseVolume.IsZero() {
+			kline.VWAP = kline.QuoteVolume.Div(kline.BaseVolume)
+		}
+
+		p.dirty[key] = struct{}{}
+
+		if len(p.listeners) > 0 {
+			events = append(events, klineEvent{kline: *kline, closed: p.announced[key] == kline.UtcBegin})
+		}
+	}
+
+	flushNeeded := len(p.closed) > closedBefore || len(p.dirty) >= p.batchSize
+	p.mu.Unlock()
+
+	p.notify(events)
+
+	p.metrics.TradeProcessed(trade.Pair, start)
+
+	if flushNeeded {
+		return p.Flush(ctx)
+	}
+	return nil
+}
+
+// Repair replaces candles that cannot be built because their trades are
+// missing with complete candles, e.g. loaded from the exchange. The candles
+// are closed and must end before the trades still to be processed; trades
+// that fall into a repaired candle anyway are skipped. In cascade mode only
+// the candles of the base timeframe are used and rolled up.
+func (p *KlineProcessor) Repair(klines []models.Kline) {
+	klines = slices.Clone(klines)
+	sort.SliceStable(klines, func(i, j int) bool { return klines[i].UtcBegin < klines[j].UtcBegin })
 
-			if trade.Side == "buy" {
-				newKline.VolumeBS.BuyBase = amount
-				newKline.VolumeBS.BuyQuote = quoteAmount
-			} else {
-				newKline.VolumeBS.SellBase = amount
-				newKline.VolumeBS.SellQuote = quoteAmount
+	var events []klineEvent
+
+	p.mu.Lock()
+	for _, kline := range klines {
+		if p.rank(kline.TimeFrame) == len(p.timeframes) ||
+			(p.cascade != nil && kline.TimeFrame != p.cascade.base.Name) {
+			continue
+		}
+
+		key := klineKey{pair: kline.Pair, timeframe: kline.TimeFrame}
+		kline.IsClosed = true
+
+		current := p.klines[key]
+		switch {
+		case current == nil || kline.UtcBegin > current.UtcBegin:
+			if current != nil {
+				p.finish(key, current, &events)
 			}
+			p.klines[key] = &kline
+			p.dirty[key] = struct{}{}
+			p.repaired[key] = kline.UtcBegin
+			p.announced[key] = kline.UtcBegin
+		case kline.UtcBegin == current.UtcBegin:
+			*current = kline
+			p.dirty[key] = struct{}{}
+			p.repaired[key] = kline.UtcBegin
+			p.announced[key] = kline.UtcBegin
+		default:
+			p.closed = append(p.closed, kline)
+		}
+		log.Printf("Repaired kline: Pair=%s, TimeFrame=%s, BeginTime=%d", kline.Pair, kline.TimeFrame, kline.UtcBegin)
+
+		if len(p.listeners) > 0 {
+			events = append(events, klineEvent{kline: kline, closed: true})
+		}
+		if p.cascade != nil {
+			p.rollUp(kline, &events)
+		}
+	}
+	p.mu.Unlock()
+
+	p.notify(events)
+}
 
-			if err := p.repository.SaveKline(ctx, newKline); err != nil {
-				return err
+// Run flushes changed candles every flush interval until ctx is cancelled.
+// It also marks candles whose time is over as closed and announces them to
+// the listeners, so that pairs without new trades still get their final
+// candle.
+// The caller is expected to call Flush once more after it stops submitting trades.
+func (p *KlineProcessor) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	closeTicker := time.NewTicker(closeCheckInterval)
+	defer closeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Flush(ctx); err != nil {
+				log.Printf("Error flushing klines: %v", err)
 			}
-			log.Printf("Creating new kline: Pair=%s, TimeFrame=%s, BeginTime=%d",
-				newKline.Pair, newKline.TimeFrame, newKline.UtcBegin)
-		} else {
-			lastKline.H = math.Max(lastKline.H, price)
-			lastKline.L = math.Min(lastKline.L, price)
-			lastKline.C = price
-
-			if trade.Side == "buy" {
-				lastKline.VolumeBS.BuyBase += amount
-				lastKline.VolumeBS.BuyQuote += quoteAmount
-			} else {
-				lastKline.VolumeBS.SellBase += amount
-				lastKline.VolumeBS.SellQuote += quoteAmount
+		case now := <-closeTicker.C:
+			p.closeExpired(now.UnixMilli())
+		}
+	}
+}
+
+// closeExpired marks every candle that ended at or before now as closed and
+// announces the ones that have not been announced yet. Newly closed candles
+// are written on the next flush.
+func (p *KlineProcessor) closeExpired(now int64) {
+	var events []klineEvent
+
+	p.mu.Lock()
+	// Lower timeframes go first, so that in cascade mode a higher candle is
+	// rolled up from its last part before it is checked itself.
+	keys := make([]klineKey, 0, len(p.klines))
+	for key := range p.klines {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return p.rank(keys[i].timeframe) < p.rank(keys[j].timeframe) })
+
+	for _, key := range keys {
+		kline := p.klines[key]
+		if kline.UtcEnd > now {
+			continue
+		}
+		if !kline.IsClosed {
+			kline.IsClosed = true
+			p.dirty[key] = struct{}{}
+			if p.cascade != nil {
+				p.rollUp(*kline, &events)
 			}
+		}
+		if len(p.listeners) > 0 && p.announced[key] != kline.UtcBegin {
+			p.announced[key] = kline.UtcBegin
+			events = append(events, klineEvent{kline: *kline, closed: true})
+		}
+	}
+	p.mu.Unlock()
+
+	p.notify(events)
+}
+
+// finish closes the candle of key that is superseded by a newer one and
+// announces it. In cascade mode a newly closed candle is rolled up into the
+// higher timeframes.
+func (p *KlineProcessor) finish(key klineKey, kline *models.Kline, events *[]klineEvent) {
+	_, changed := p.dirty[key]
+	newlyClosed := !kline.IsClosed
+	if newlyClosed {
+		kline.IsClosed = true
+		changed = true
+	}
+	if changed {
+		p.closed = append(p.closed, *kline)
+	}
+	if len(p.listeners) > 0 && p.announced[key] != kline.UtcBegin {
+		p.announced[key] = kline.UtcBegin
+		*events = append(*events, klineEvent{kline: *kline, closed: true})
+	}
+	log.Printf("Closing kline: Pair=%s, TimeFrame=%s, BeginTime=%d",
+		kline.Pair, kline.TimeFrame, kline.UtcBegin)
+
+	if p.cascade != nil && newlyClosed {
+		p.rollUp(*kline, events)
+	}
+}
+
+// rollUp merges a finished candle into the candles of the timeframes rolled
+// up from its timeframe. A candle that is already closed is corrected in
+// place and its correction is announced as closed.
+func (p *KlineProcessor) rollUp(lower models.Kline, events *[]klineEvent) {
+	for _, tf := range p.cascade.children[lower.TimeFrame] {
+		key := klineKey{pair: lower.Pair, timeframe: tf.Name}
+		begin, _ := tf.Bounds(lower.UtcBegin)
+
+		current := p.klines[key]
+		if current != nil && begin < current.UtcBegin {
+			log.Printf("Skipping late kline for closed kline: Pair=%s, TimeFrame=%s, BeginTime=%d",
+				lower.Pair, tf.Name, begin)
+			continue
+		}
+		if current != nil && begin > current.UtcBegin {
+			p.finish(key, current, events)
+			delete(p.parts, key)
+			current = nil
+		}
 
-			if err := p.repository.SaveKline(ctx, *lastKline); err != nil {
-				return err
+		p.parts[key] = addPart(p.parts[key], lower)
+		kline := mergeKlines(tf, p.cascade.parents[tf.Name], p.parts[key])
+		if current != nil && current.IsClosed {
+			kline.IsClosed = true
+		}
+		p.klines[key] = &kline
+		p.dirty[key] = struct{}{}
+
+		if len(p.listeners) > 0 {
+			closed := kline.IsClosed || p.announced[key] == kline.UtcBegin
+			if closed {
+				p.announced[key] = kline.UtcBegin
 			}
-			log.Printf("Updating kline: Pair=%s, TimeFrame=%s, BeginTime=%d",
-				lastKline.Pair, lastKline.TimeFrame, lastKline.UtcBegin)
+			*events = append(*events, klineEvent{kline: kline, closed: closed})
+		}
+
+		if kline.IsClosed {
+			p.rollUp(kline, events)
+		}
+	}
+}
+
+// rank returns the position of the timeframe among the processed ones.
+func (p *KlineProcessor) rank(name string) int {
+	for i, tf := range p.timeframes {
+		if tf.Name == name {
+			return i
+		}
+	}
+	return len(p.timeframes)
+}
+
+func (p *KlineProcessor) notify(events []klineEvent) {
+	for _, event := range events {
+		for _, listener := range p.listeners {
+			listener.OnKline(event.kline, event.closed)
+		}
+	}
+}
+
+// Flush writes closed and changed open candles to the repository in batches.
+// Candles that fail to be written are kept and retried on the next flush.
+func (p *KlineProcessor) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	pending := p.closed
+	p.closed = nil
+	for key := range p.dirty {
+		pending = append(pending, *p.klines[key])
+	}
+	p.dirty = make(map[klineKey]struct{})
+	p.mu.Unlock()
+
+	for start := 0; start < len(pending); start += p.batchSize {
+		end := min(start+p.batchSize, len(pending))
+
+		if err := p.repository.SaveKlines(ctx, pending[start:end]); err != nil {
+			p.requeue(pending[start:])
+			return err
+		}
+		for _, kline := range pending[start:end] {
+			p.metrics.KlineFlushed(kline.Pair, kline.TimeFrame)
 		}
+		log.Printf("Flushed %d klines", end-start)
 	}
+
 	return nil
 }
 
-func getKlineTimestamps(timestamp int64, timeFrame string) (int64, int64) {
-	var t time.Time
+func (p *KlineProcessor) requeue(klines []models.Kline) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var closed []models.Kline
+	for _, kline := range klines {
+		key := klineKey{pair: kline.Pair, timeframe: kline.TimeFrame}
+		if current := p.klines[key]; current != nil && current.UtcBegin == kline.UtcBegin {
+			p.dirty[key] = struct{}{}
+			continue
+		}
+		closed = append(closed, kline)
+	}
+	p.closed = append(closed, p.closed...)
+}
+
+// getKlineTimestamps returns the beginning and the end of the bucket of tf
+// that contains timestamp, in unix ms. The timestamp may be given in seconds,
+// milliseconds or nanoseconds. Taking a parsed timeframe keeps an unknown
+// name from producing candles at the epoch.
+func getKlineTimestamps(timestamp int64, tf timeframe.TimeFrame) (int64, int64) {
+	var ms int64
 	if timestamp > 1000000000000 {
-		t = time.Unix(timestamp/1000, (timestamp%1000)*1000000).UTC()
+		ms = timestamp
 	} else if timestamp > 1000000000 {
-		t = time.Unix(timestamp, 0).UTC()
+		ms = timestamp * 1000
 	} else {
-		t = time.Unix(0, timestamp).UTC()
-	}
-
-	var beginTime time.Time
-	var endTime time.Time
-
-	switch timeFrame {
-	case TimeFrame1m:
-		beginTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
-		endTime = beginTime.Add(1 * time.Minute)
-	case TimeFrame15m:
-		minute := t.Minute() / 15 * 15
-		beginTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), minute, 0, 0, time.UTC)
-		endTime = beginTime.Add(15 * time.Minute)
-	case TimeFrame1h:
-		beginTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.UTC)
-		endTime = beginTime.Add(1 * time.Hour)
-	case TimeFrame1d:
-		beginTime = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
-		endTime = beginTime.Add(24 * time.Hour)
+		ms = timestamp / int64(time.Millisecond)
 	}
 
-	return beginTime.Unix() * 1000, endTime.Unix() * 1000
+	return tf.Bounds(ms)
 }
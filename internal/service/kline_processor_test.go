@@ -2,77 +2,82 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
 	"github.com/Zmey56/poloniex-collector/test/mocks"
 )
 
 func TestKlineProcessor_ProcessTrade(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	mockRepo := mocks.NewMockKlineRepository(ctrl)
-	processor := NewKlineProcessor(mockRepo)
-
 	tests := []struct {
 		name      string
-		trade     *models.RecentTrade
-		setupMock func()
+		trades    []*models.RecentTrade
+		setupMock func(mockRepo *mocks.MockKlineRepository)
 		wantErr   bool
 	}{
 		{
 			name: "new kline",
-			trade: &models.RecentTrade{
-				Tid:       "123",
-				Pair:      "BTC_USDT",
-				Price:     "50000.00",
-				Amount:    "1.5",
-				Side:      "buy",
-				Timestamp: time.Now().Unix(),
+			trades: []*models.RecentTrade{
+				{
+					Tid:       "123",
+					Pair:      "BTC_USDT",
+					Price:     decimal.RequireFromString("50000.00"),
+					Quantity:  decimal.RequireFromString("1.5"),
+					Amount:    decimal.RequireFromString("75000"),
+					Side:      "buy",
+					Timestamp: time.Now().Unix(),
+				},
 			},
-			setupMock: func() {
-				mockRepo.EXPECT().
-					GetLastKline(gomock.Any(), "BTC_USDT", "MINUTE_1").
-					Return(nil, nil)
-
+			setupMock: func(mockRepo *mocks.MockKlineRepository) {
 				mockRepo.EXPECT().
-					SaveKline(gomock.Any(), gomock.Any()).
+					SaveKlines(gomock.Any(), gomock.Len(4)).
 					Return(nil)
 			},
 			wantErr: false,
 		},
 		{
 			name: "update existing kline",
-			trade: &models.RecentTrade{
-				Tid:       "124",
-				Pair:      "BTC_USDT",
-				Price:     "51000.00",
-				Amount:    "2.0",
-				Side:      "sell",
-				Timestamp: time.Now().Unix(),
+			trades: []*models.RecentTrade{
+				{
+					Tid:       "123",
+					Pair:      "BTC_USDT",
+					Price:     decimal.RequireFromString("50000.00"),
+					Quantity:  decimal.RequireFromString("1.5"),
+					Amount:    decimal.RequireFromString("75000"),
+					Side:      "buy",
+					Timestamp: 1676548201000,
+				},
+				{
+					Tid:       "124",
+					Pair:      "BTC_USDT",
+					Price:     decimal.RequireFromString("51000.00"),
+					Quantity:  decimal.RequireFromString("2.0"),
+					Amount:    decimal.RequireFromString("102000"),
+					Side:      "sell",
+					Timestamp: 1676548234000,
+				},
 			},
-			setupMock: func() {
-				mockRepo.EXPECT().
-					GetLastKline(gomock.Any(), "BTC_USDT", "MINUTE_1").
-					Return(&models.Kline{
-						Pair:      "BTC_USDT",
-						TimeFrame: "MINUTE_1",
-						O:         50000.0,
-						H:         50000.0,
-						L:         50000.0,
-						C:         50000.0,
-						UtcBegin:  time.Now().Unix(),
-						UtcEnd:    time.Now().Add(time.Minute).Unix(),
-						VolumeBS:  models.VBS{},
-					}, nil)
-
+			setupMock: func(mockRepo *mocks.MockKlineRepository) {
 				mockRepo.EXPECT().
-					SaveKline(gomock.Any(), gomock.Any()).
+					SaveKlines(gomock.Any(), gomock.Len(4)).
+					Do(func(_ context.Context, klines []models.Kline) {
+						for _, k := range klines {
+							assert.Equal(t, "50000", k.O.String())
+							assert.Equal(t, "51000", k.H.String())
+							assert.Equal(t, "50000", k.L.String())
+							assert.Equal(t, "51000", k.C.String())
+							assert.Equal(t, "1.5", k.VolumeBS.BuyBase.String())
+							assert.Equal(t, "2", k.VolumeBS.SellBase.String())
+						}
+					}).
 					Return(nil)
 			},
 			wantErr: false,
@@ -81,9 +86,18 @@ func TestKlineProcessor_ProcessTrade(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.setupMock()
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockKlineRepository(ctrl)
+			processor := NewKlineProcessor(mockRepo)
+			tt.setupMock(mockRepo)
 
-			err := processor.ProcessTrade(context.Background(), tt.trade)
+			for _, trade := range tt.trades {
+				require.NoError(t, processor.ProcessTrade(context.Background(), trade))
+			}
+
+			err := processor.Flush(context.Background())
 			if tt.wantErr {
 				assert.Error(t, err)
 				return
@@ -103,27 +117,430 @@ func TestKlineProcessor_MultipleTimeframes(t *testing.T) {
 	trade := &models.RecentTrade{
 		Tid:       "123",
 		Pair:      "BTC_USDT",
-		Price:     "50000.00",
-		Amount:    "1.5",
+		Price:     decimal.RequireFromString("50000.00"),
+		Quantity:  decimal.RequireFromString("1.5"),
+		Amount:    decimal.RequireFromString("75000"),
 		Side:      "buy",
 		Timestamp: time.Now().Unix(),
 	}
 
 	timeframes := []string{"MINUTE_1", "MINUTE_15", "HOUR_1", "DAY_1"}
 
-	for _, tf := range timeframes {
-		mockRepo.EXPECT().
-			GetLastKline(gomock.Any(), trade.Pair, tf).
-			Return(nil, nil)
-
-		mockRepo.EXPECT().
-			SaveKline(gomock.Any(), gomock.Any()).
-			Do(func(_ context.Context, k models.Kline) {
-				assert.Equal(t, tf, k.TimeFrame)
-			}).
-			Return(nil)
+	mockRepo.EXPECT().
+		SaveKlines(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, klines []models.Kline) {
+			saved := make([]string, 0, len(klines))
+			for _, k := range klines {
+				saved = append(saved, k.TimeFrame)
+			}
+			assert.ElementsMatch(t, timeframes, saved)
+		}).
+		Return(nil)
+
+	err := processor.ProcessTrade(context.Background(), trade)
+	assert.NoError(t, err)
+
+	err = processor.Flush(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestKlineProcessor_ConfiguredTimeFrames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockKlineRepository(ctrl)
+	processor := NewKlineProcessor(mockRepo, WithTimeFrames(timeframe.MustParseList([]string{"4h", "WEEK_1", "MONTH_1"})))
+
+	trade := &models.RecentTrade{
+		Tid:       "123",
+		Pair:      "BTC_USDT",
+		Price:     decimal.RequireFromString("50000.00"),
+		Quantity:  decimal.RequireFromString("1.5"),
+		Amount:    decimal.RequireFromString("75000"),
+		Side:      "buy",
+		Timestamp: time.Date(2024, 2, 29, 13, 47, 0, 0, time.UTC).UnixMilli(),
+	}
+
+	expected := map[string][2]time.Time{
+		"HOUR_4":  {time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 16, 0, 0, 0, time.UTC)},
+		"WEEK_1":  {time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		"MONTH_1": {time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	mockRepo.EXPECT().
+		SaveKlines(gomock.Any(), gomock.Len(3)).
+		Do(func(_ context.Context, klines []models.Kline) {
+			for _, k := range klines {
+				bounds, ok := expected[k.TimeFrame]
+				require.True(t, ok, k.TimeFrame)
+				assert.Equal(t, bounds[0].UnixMilli(), k.UtcBegin, k.TimeFrame)
+				assert.Equal(t, bounds[1].UnixMilli(), k.UtcEnd, k.TimeFrame)
+			}
+		}).
+		Return(nil)
+
+	require.NoError(t, processor.ProcessTrade(context.Background(), trade))
+	require.NoError(t, processor.Flush(context.Background()))
+}
+
+func TestKlineProcessor_FlushesClosedKline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockKlineRepository(ctrl)
+	processor := NewKlineProcessor(mockRepo)
+
+	first := &models.RecentTrade{
+		Pair:      "BTC_USDT",
+		Price:     decimal.RequireFromString("50000.00"),
+		Quantity:  decimal.RequireFromString("1.5"),
+		Amount:    decimal.RequireFromString("75000"),
+		Side:      "buy",
+		Timestamp: 1676548201000,
+	}
+	second := &models.RecentTrade{
+		Pair:      "BTC_USDT",
+		Price:     decimal.RequireFromString("50100.00"),
+		Quantity:  decimal.RequireFromString("1.0"),
+		Amount:    decimal.RequireFromString("50100"),
+		Side:      "sell",
+		Timestamp: 1676548261000,
+	}
+
+	require.NoError(t, processor.ProcessTrade(context.Background(), first))
+
+	mockRepo.EXPECT().
+		SaveKlines(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, klines []models.Kline) {
+			var closed *models.Kline
+			for i := range klines {
+				if klines[i].TimeFrame == PoloniexTimeFrame1m && klines[i].UtcBegin == 1676548200000 {
+					closed = &klines[i]
+				}
+			}
+			require.NotNil(t, closed, "closed minute kline should be flushed")
+			assert.Equal(t, "50000", closed.C.String())
+			assert.Equal(t, "1.5", closed.VolumeBS.BuyBase.String())
+		}).
+		Return(nil)
+
+	require.NoError(t, processor.ProcessTrade(context.Background(), second))
+}
+
+func TestKlineProcessor_TradeStatistics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var saved []models.Kline
+	mockRepo := mocks.NewMockKlineRepository(ctrl)
+	mockRepo.EXPECT().SaveKlines(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, klines []models.Kline) { saved = append(saved, klines...) }).
+		Return(nil).AnyTimes()
+
+	processor := NewKlineProcessor(mockRepo, WithTimeFrames(timeframe.MustParseList([]string{"1m"})))
+
+	// Quantity is the base volume of a trade, amount its quote volume.
+	trade := func(tid, price, quantity, amount string, ts int64) {
+		require.NoError(t, processor.ProcessTrade(context.Background(), &models.RecentTrade{
+			Tid: tid, Pair: "BTC_USDT", Price: decimal.RequireFromString(price),
+			Quantity: decimal.RequireFromString(quantity), Amount: decimal.RequireFromString(amount),
+			Side: "buy", Timestamp: ts,
+		}))
+	}
+
+	trade("1", "100", "1", "100", 1676548201000)
+	trade("2", "110", "3", "330", 1676548230000)
+	trade("3", "105", "1", "105", 1676548250000)
+
+	kline := processor.klines[klineKey{pair: "BTC_USDT", timeframe: "MINUTE_1"}]
+	assert.Equal(t, int64(3), kline.TradeCount)
+	assert.Equal(t, "5", kline.BaseVolume.String())
+	assert.Equal(t, "535", kline.QuoteVolume.String())
+	assert.Equal(t, "107", kline.VWAP.String())
+	assert.Equal(t, "1", kline.FirstTradeID)
+	assert.Equal(t, "3", kline.LastTradeID)
+	assert.False(t, kline.IsClosed)
+
+	// The next minute closes the candle, which is written with the flag set.
+	trade("4", "120", "2", "240", 1676548261000)
+	require.NotEmpty(t, saved)
+	assert.Equal(t, int64(1676548200000), saved[0].UtcBegin)
+	assert.True(t, saved[0].IsClosed)
+	assert.Equal(t, int64(3), saved[0].TradeCount)
+
+	current := processor.klines[klineKey{pair: "BTC_USDT", timeframe: "MINUTE_1"}]
+	assert.Equal(t, int64(1), current.TradeCount)
+	assert.Equal(t, "4", current.FirstTradeID)
+	assert.Equal(t, "120", current.VWAP.String())
+
+	// Without listeners a candle whose time is over is still marked closed and
+	// written on the next flush.
+	saved = nil
+	processor.closeExpired(1676548320000)
+	require.NoError(t, processor.Flush(context.Background()))
+	require.Len(t, saved, 1)
+	assert.Equal(t, int64(1676548260000), saved[0].UtcBegin)
+	assert.True(t, saved[0].IsClosed)
+}
+
+func TestKlineProcessor_Cascade(t *testing.T) {
+	repo := newMemoryKlineRepository()
+	processor := NewKlineProcessor(repo, WithCascade(),
+		WithTimeFrames(timeframe.MustParseList([]string{"15m", "5m"})))
+
+	trade := func(tid, price, quantity, amount, side string, ts int64) {
+		require.NoError(t, processor.ProcessTrade(context.Background(), &models.RecentTrade{
+			Tid: tid, Pair: "BTC_USDT", Price: decimal.RequireFromString(price),
+			Quantity: decimal.RequireFromString(quantity), Amount: decimal.RequireFromString(amount),
+			Side: side, Timestamp: ts,
+		}))
 	}
 
+	base := time.Date(2023, 2, 16, 10, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+
+	trade("1", "100", "1", "100", "buy", base+10000)
+	trade("2", "110", "2", "220", "sell", base+minute+30000)
+	trade("3", "90", "1", "90", "buy", base+4*minute+59000)
+
+	// Higher timeframes are not built from trades but from finished candles of
+	// their parent: five minutes from minutes, fifteen minutes from five.
+	fiveMinutes := *processor.klines[klineKey{pair: "BTC_USDT", timeframe: "MINUTE_5"}]
+	assert.Equal(t, int64(2), fiveMinutes.TradeCount)
+	assert.Equal(t, "2", fiveMinutes.LastTradeID)
+	assert.False(t, fiveMinutes.IsClosed)
+	assert.Nil(t, processor.klines[klineKey{pair: "BTC_USDT", timeframe: "MINUTE_15"}])
+
+	// The first trade of the next five minutes finishes the last minute and
+	// with it the five minute candle.
+	trade("4", "95", "1", "95", "buy", base+5*minute+1000)
+	require.NoError(t, processor.Flush(context.Background()))
+
+	fiveMinutes = repo.klines[fmt.Sprintf("BTC_USDT|MINUTE_5|%d", base)]
+	assert.Equal(t, "100", fiveMinutes.O.String())
+	assert.Equal(t, "110", fiveMinutes.H.String())
+	assert.Equal(t, "90", fiveMinutes.L.String())
+	assert.Equal(t, "90", fiveMinutes.C.String())
+	assert.Equal(t, "2", fiveMinutes.VolumeBS.BuyBase.String())
+	assert.Equal(t, "190", fiveMinutes.VolumeBS.BuyQuote.String())
+	assert.Equal(t, "2", fiveMinutes.VolumeBS.SellBase.String())
+	assert.Equal(t, "220", fiveMinutes.VolumeBS.SellQuote.String())
+	assert.Equal(t, int64(3), fiveMinutes.TradeCount)
+	assert.Equal(t, "4", fiveMinutes.BaseVolume.String())
+	assert.Equal(t, "410", fiveMinutes.QuoteVolume.String())
+	assert.Equal(t, "102.5", fiveMinutes.VWAP.String())
+	assert.Equal(t, "1", fiveMinutes.FirstTradeID)
+	assert.Equal(t, "3", fiveMinutes.LastTradeID)
+	assert.Equal(t, base+5*minute, fiveMinutes.UtcEnd)
+	assert.True(t, fiveMinutes.IsClosed)
+
+	quarter := processor.klines[klineKey{pair: "BTC_USDT", timeframe: "MINUTE_15"}]
+	assert.Equal(t, int64(3), quarter.TradeCount)
+	assert.False(t, quarter.IsClosed)
+
+	// Once the time is over the remaining candles close from the bottom up.
+	processor.closeExpired(base + 15*minute)
+	require.NoError(t, processor.Flush(context.Background()))
+
+	stored := repo.klines[fmt.Sprintf("BTC_USDT|MINUTE_15|%d", base)]
+	assert.Equal(t, int64(4), stored.TradeCount)
+	assert.Equal(t, "95", stored.C.String())
+	assert.Equal(t, "4", stored.LastTradeID)
+	assert.True(t, stored.IsClosed)
+}
+
+func TestKlineProcessor_Repair(t *testing.T) {
+	repo := newMemoryKlineRepository()
+	processor := NewKlineProcessor(repo, WithTimeFrames(timeframe.MustParseList([]string{"1m"})))
+
+	trade := func(tid string, ts int64) {
+		require.NoError(t, processor.ProcessTrade(context.Background(), &models.RecentTrade{
+			Tid: tid, Pair: "BTC_USDT", Price: decimal.NewFromInt(100),
+			Quantity: decimal.NewFromInt(1), Amount: decimal.NewFromInt(100), Side: "buy", Timestamp: ts,
+		}))
+	}
+
+	base := time.Date(2023, 2, 16, 10, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+
+	trade("1", base+10000)
+
+	// The rest of the first minute and the next one are missing.
+	processor.Repair([]models.Kline{
+		{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: base + minute, UtcEnd: base + 2*minute,
+			C: decimal.NewFromInt(103), TradeCount: 3},
+		{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: base, UtcEnd: base + minute,
+			C: decimal.NewFromInt(105), TradeCount: 5},
+		{Pair: "BTC_USDT", TimeFrame: "MINUTE_5", UtcBegin: base, UtcEnd: base + 5*minute, TradeCount: 8},
+	})
+
+	// A trade of a repaired candle is already counted in it.
+	trade("2", base+minute+20000)
+	trade("3", base+2*minute+5000)
+	require.NoError(t, processor.Flush(context.Background()))
+
+	first := repo.klines[fmt.Sprintf("BTC_USDT|MINUTE_1|%d", base)]
+	assert.Equal(t, int64(5), first.TradeCount)
+	assert.Equal(t, "105", first.C.String())
+	assert.True(t, first.IsClosed)
+
+	second := repo.klines[fmt.Sprintf("BTC_USDT|MINUTE_1|%d", base+minute)]
+	assert.Equal(t, int64(3), second.TradeCount)
+	assert.True(t, second.IsClosed)
+
+	third := repo.klines[fmt.Sprintf("BTC_USDT|MINUTE_1|%d", base+2*minute)]
+	assert.Equal(t, int64(1), third.TradeCount)
+	assert.Equal(t, "3", third.FirstTradeID)
+
+	// Timeframes that are not processed are not repaired.
+	assert.NotContains(t, repo.klines, fmt.Sprintf("BTC_USDT|MINUTE_5|%d", base))
+}
+
+func TestKlineProcessor_BatchSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockKlineRepository(ctrl)
+	processor := NewKlineProcessor(mockRepo, WithBatchSize(3))
+
+	trade := &models.RecentTrade{
+		Pair:      "BTC_USDT",
+		Price:     decimal.RequireFromString("50000.00"),
+		Quantity:  decimal.RequireFromString("1.5"),
+		Amount:    decimal.RequireFromString("75000"),
+		Side:      "buy",
+		Timestamp: 1676548201000,
+	}
+
+	mockRepo.EXPECT().SaveKlines(gomock.Any(), gomock.Len(3)).Return(nil)
+	mockRepo.EXPECT().SaveKlines(gomock.Any(), gomock.Len(1)).Return(nil)
+
 	err := processor.ProcessTrade(context.Background(), trade)
 	assert.NoError(t, err)
 }
+
+func TestKlineProcessor_Restore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockKlineRepository(ctrl)
+	processor := NewKlineProcessor(mockRepo)
+
+	stored := &models.Kline{
+		Pair:      "BTC_USDT",
+		TimeFrame: PoloniexTimeFrame1d,
+		O:         decimal.NewFromInt(49000),
+		H:         decimal.NewFromInt(49500),
+		L:         decimal.NewFromInt(48900),
+		C:         decimal.NewFromInt(49200),
+		UtcBegin:  1676505600000,
+		UtcEnd:    1676592000000,
+		VolumeBS:  models.VBS{BuyBase: decimal.NewFromInt(2), BuyQuote: decimal.NewFromInt(98000)},
+	}
+
+	mockRepo.EXPECT().
+		GetLastKline(gomock.Any(), "BTC_USDT", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, timeframe string) (*models.Kline, error) {
+			if timeframe == PoloniexTimeFrame1d {
+				return stored, nil
+			}
+			return nil, nil
+		}).
+		Times(4)
+
+	require.NoError(t, processor.Restore(context.Background(), []string{"BTC_USDT"}))
+
+	mockRepo.EXPECT().
+		SaveKlines(gomock.Any(), gomock.Len(4)).
+		Do(func(_ context.Context, klines []models.Kline) {
+			for _, k := range klines {
+				if k.TimeFrame != PoloniexTimeFrame1d {
+					continue
+				}
+				assert.Equal(t, "49000", k.O.String())
+				assert.Equal(t, "50000", k.H.String())
+				assert.Equal(t, "50000", k.C.String())
+				assert.Equal(t, "3", k.VolumeBS.BuyBase.String())
+			}
+		}).
+		Return(nil)
+
+	err := processor.ProcessTrade(context.Background(), &models.RecentTrade{
+		Pair:      "BTC_USDT",
+		Price:     decimal.RequireFromString("50000.00"),
+		Quantity:  decimal.RequireFromString("1.0"),
+		Amount:    decimal.RequireFromString("50000"),
+		Side:      "buy",
+		Timestamp: 1676548234000,
+	})
+	require.NoError(t, err)
+	require.NoError(t, processor.Flush(context.Background()))
+}
+
+type recordedKline struct {
+	kline  models.Kline
+	closed bool
+}
+
+type recordingListener struct {
+	events []recordedKline
+}
+
+func (l *recordingListener) OnKline(kline models.Kline, closed bool) {
+	l.events = append(l.events, recordedKline{kline: kline, closed: closed})
+}
+
+func TestKlineProcessor_NotifiesListener(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockKlineRepository(ctrl)
+	mockRepo.EXPECT().SaveKlines(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	listener := &recordingListener{}
+	processor := NewKlineProcessor(mockRepo,
+		WithTimeFrames(timeframe.MustParseList([]string{"1m"})),
+		WithKlineListener(listener),
+	)
+
+	trade := func(price string, ts int64) {
+		require.NoError(t, processor.ProcessTrade(context.Background(), &models.RecentTrade{
+			Pair: "BTC_USDT", Price: decimal.RequireFromString(price), Quantity: decimal.NewFromInt(1),
+			Amount: decimal.RequireFromString(price), Side: "buy", Timestamp: ts,
+		}))
+	}
+
+	trade("100", 1676548201000)
+	trade("101", 1676548230000)
+	// The next minute closes the first candle before updating the new one.
+	trade("102", 1676548261000)
+
+	require.Len(t, listener.events, 4)
+	assert.False(t, listener.events[0].closed)
+	assert.Equal(t, "101", listener.events[1].kline.C.String())
+	assert.True(t, listener.events[2].closed)
+	assert.Equal(t, int64(1676548200000), listener.events[2].kline.UtcBegin)
+	assert.Equal(t, "101", listener.events[2].kline.C.String())
+	assert.False(t, listener.events[3].closed)
+	assert.Equal(t, int64(1676548260000), listener.events[3].kline.UtcBegin)
+
+	// Without new trades the candle is closed once its time is over.
+	processor.closeExpired(1676548319999)
+	assert.Len(t, listener.events, 4)
+	processor.closeExpired(1676548320000)
+	require.Len(t, listener.events, 5)
+	assert.True(t, listener.events[4].closed)
+	assert.Equal(t, "102", listener.events[4].kline.C.String())
+	processor.closeExpired(1676548330000)
+	assert.Len(t, listener.events, 5)
+
+	// A late trade in the announced candle is sent as a closed correction, and
+	// the following candle does not close it a second time.
+	trade("103", 1676548300000)
+	require.Len(t, listener.events, 6)
+	assert.True(t, listener.events[5].closed)
+	trade("104", 1676548321000)
+	require.Len(t, listener.events, 7)
+	assert.False(t, listener.events[6].closed)
+	assert.Equal(t, int64(1676548320000), listener.events[6].kline.UtcBegin)
+}
@@ -7,10 +7,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
 )
 
 type MockRepository struct {
@@ -38,6 +41,20 @@ func (m *MockRepository) SaveKline(ctx context.Context, kline models.Kline) erro
 	return args.Error(0)
 }
 
+func (m *MockRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	args := m.Called(ctx, klines)
+	return args.Error(0)
+}
+
+func findKline(klines []models.Kline, timeframe string) (models.Kline, bool) {
+	for _, k := range klines {
+		if k.TimeFrame == timeframe {
+			return k, true
+		}
+	}
+	return models.Kline{}, false
+}
+
 func TestProcessTrade(t *testing.T) {
 	t.Run("ProcessTrade_ValidData_CreatesNewKlines", func(t *testing.T) {
 		mockRepo := new(MockRepository)
@@ -46,27 +63,27 @@ func TestProcessTrade(t *testing.T) {
 
 		trade := &models.RecentTrade{
 			Pair:      "BTC_USDT",
-			Price:     "50000.0",
-			Amount:    "1.5",
+			Price:     decimal.RequireFromString("50000.0"),
+			Quantity:  decimal.RequireFromString("1.5"),
+			Amount:    decimal.RequireFromString("75000"),
 			Side:      "buy",
 			Timestamp: time.Now().Unix() * 1000,
 		}
 
-		for _, tf := range []string{
-			PoloniexTimeFrame1m,
-			PoloniexTimeFrame15m,
-			PoloniexTimeFrame1h,
-			PoloniexTimeFrame1d,
-		} {
-			mockRepo.On("GetLastKline", ctx, trade.Pair, tf).Return(nil, sql.ErrNoRows)
-			mockRepo.On("SaveKline", ctx, mock.AnythingOfType("models.Kline")).Return(nil)
-		}
+		mockRepo.On("SaveKlines", ctx, mock.AnythingOfType("[]models.Kline")).Return(nil)
 
 		err := processor.ProcessTrade(ctx, trade)
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "SaveKlines", mock.Anything, mock.Anything)
+
+		err = processor.Flush(ctx)
 
 		assert.NoError(t, err)
-		mockRepo.AssertNumberOfCalls(t, "GetLastKline", 4) // По одному на каждый таймфрейм
-		mockRepo.AssertNumberOfCalls(t, "SaveKline", 4)    // По одному на каждый таймфрейм
+		mockRepo.AssertNotCalled(t, "GetLastKline", mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertNumberOfCalls(t, "SaveKlines", 1)
+		mockRepo.AssertCalled(t, "SaveKlines", ctx, mock.MatchedBy(func(klines []models.Kline) bool {
+			return len(klines) == 4 // По одному на каждый таймфрейм
+		}))
 	})
 
 	t.Run("ProcessTrade_ValidData_UpdatesExistingKlines", func(t *testing.T) {
@@ -80,8 +97,9 @@ func TestProcessTrade(t *testing.T) {
 
 		trade := &models.RecentTrade{
 			Pair:      "BTC_USDT",
-			Price:     "50000.0",
-			Amount:    "1.5",
+			Price:     decimal.RequireFromString("50000.0"),
+			Quantity:  decimal.RequireFromString("1.5"),
+			Amount:    decimal.RequireFromString("75000"),
 			Side:      "sell",
 			Timestamp: now.Unix() * 1000, // Текущее время в мс
 		}
@@ -89,24 +107,23 @@ func TestProcessTrade(t *testing.T) {
 		existingKline := &models.Kline{
 			Pair:      trade.Pair,
 			TimeFrame: PoloniexTimeFrame1m,
-			O:         49000.0,
-			H:         49500.0,
-			L:         48900.0,
-			C:         49200.0,
+			O:         decimal.NewFromInt(49000),
+			H:         decimal.NewFromInt(49500),
+			L:         decimal.NewFromInt(48900),
+			C:         decimal.NewFromInt(49200),
 			UtcBegin:  beginTime.Unix() * 1000,
 			UtcEnd:    endTime.Unix() * 1000,
 			BeginDt:   beginTime,
 			EndDt:     endTime,
 			VolumeBS: models.VBS{
-				BuyBase:   2.0,
-				SellBase:  1.0,
-				BuyQuote:  98000.0,
-				SellQuote: 49200.0,
+				BuyBase:   decimal.NewFromInt(2),
+				SellBase:  decimal.NewFromInt(1),
+				BuyQuote:  decimal.NewFromInt(98000),
+				SellQuote: decimal.NewFromInt(49200),
 			},
 		}
 
 		mockRepo.On("GetLastKline", ctx, trade.Pair, PoloniexTimeFrame1m).Return(existingKline, nil)
-		mockRepo.On("SaveKline", ctx, mock.AnythingOfType("models.Kline")).Return(nil)
 
 		for _, tf := range []string{
 			PoloniexTimeFrame15m,
@@ -114,119 +131,91 @@ func TestProcessTrade(t *testing.T) {
 			PoloniexTimeFrame1d,
 		} {
 			mockRepo.On("GetLastKline", ctx, trade.Pair, tf).Return(nil, sql.ErrNoRows)
-			mockRepo.On("SaveKline", ctx, mock.AnythingOfType("models.Kline")).Return(nil)
 		}
+		mockRepo.On("SaveKlines", ctx, mock.AnythingOfType("[]models.Kline")).Return(nil)
 
-		err := processor.ProcessTrade(ctx, trade)
+		err := processor.Restore(ctx, []string{trade.Pair})
+		assert.NoError(t, err)
+
+		err = processor.ProcessTrade(ctx, trade)
+		assert.NoError(t, err)
+
+		err = processor.Flush(ctx)
 
 		assert.NoError(t, err)
 		mockRepo.AssertCalled(t, "GetLastKline", ctx, trade.Pair, PoloniexTimeFrame1m)
-		mockRepo.AssertCalled(t, "SaveKline", ctx, mock.MatchedBy(func(k models.Kline) bool {
-			expectedPrice := 50000.0
-			expectedH := 50000.0
-			expectedL := 48900.0
+		mockRepo.AssertCalled(t, "SaveKlines", ctx, mock.MatchedBy(func(klines []models.Kline) bool {
+			k, ok := findKline(klines, PoloniexTimeFrame1m)
+			if !assert.True(t, ok) {
+				return false
+			}
+
+			expectedPrice := "50000"
+			expectedH := "50000"
+			expectedL := "48900"
 
 			assert.Equal(t, trade.Pair, k.Pair)
 			assert.Equal(t, PoloniexTimeFrame1m, k.TimeFrame)
-			assert.Equal(t, expectedPrice, k.C)
-			assert.Equal(t, expectedH, k.H)
-			assert.Equal(t, expectedL, k.L)
+			assert.Equal(t, expectedPrice, k.C.String())
+			assert.Equal(t, expectedH, k.H.String())
+			assert.Equal(t, expectedL, k.L.String())
 
 			// Проверяем объемы
-			expectedSellBase := 2.5
-			expectedSellQuote := 124200.0
-			assert.Equal(t, expectedSellBase, k.VolumeBS.SellBase)
-			assert.Equal(t, expectedSellQuote, k.VolumeBS.SellQuote)
+			expectedSellBase := "2.5"
+			expectedSellQuote := "124200"
+			assert.Equal(t, expectedSellBase, k.VolumeBS.SellBase.String())
+			assert.Equal(t, expectedSellQuote, k.VolumeBS.SellQuote.String())
 
 			return true
 		}))
 	})
 
-	t.Run("ProcessTrade_InvalidPrice_ReturnsError", func(t *testing.T) {
-		mockRepo := new(MockRepository)
-		processor := NewKlineProcessor(mockRepo)
-		ctx := context.Background()
-
-		trade := &models.RecentTrade{
-			Pair:      "BTC_USDT",
-			Price:     "invalid",
-			Amount:    "1.5",
-			Side:      "buy",
-			Timestamp: time.Now().Unix() * 1000,
-		}
-
-		err := processor.ProcessTrade(ctx, trade)
-
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid price format")
-		mockRepo.AssertNotCalled(t, "SaveKline")
-	})
-
-	t.Run("ProcessTrade_InvalidAmount_ReturnsError", func(t *testing.T) {
+	t.Run("Restore_DatabaseError_ReturnsError", func(t *testing.T) {
 		mockRepo := new(MockRepository)
 		processor := NewKlineProcessor(mockRepo)
 		ctx := context.Background()
 
-		trade := &models.RecentTrade{
-			Pair:      "BTC_USDT",
-			Price:     "50000.0",
-			Amount:    "invalid",
-			Side:      "buy",
-			Timestamp: time.Now().Unix() * 1000,
-		}
-
-		err := processor.ProcessTrade(ctx, trade)
-
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid amount format")
-		mockRepo.AssertNotCalled(t, "SaveKline")
-	})
-
-	t.Run("ProcessTrade_DatabaseError_ReturnsError", func(t *testing.T) {
-		mockRepo := new(MockRepository)
-		processor := NewKlineProcessor(mockRepo)
-		ctx := context.Background()
-
-		trade := &models.RecentTrade{
-			Pair:      "BTC_USDT",
-			Price:     "50000.0",
-			Amount:    "1.5",
-			Side:      "buy",
-			Timestamp: time.Now().Unix() * 1000,
-		}
-
 		dbError := errors.New("database error")
-		mockRepo.On("GetLastKline", ctx, trade.Pair, PoloniexTimeFrame1m).Return(nil, dbError)
+		mockRepo.On("GetLastKline", ctx, "BTC_USDT", PoloniexTimeFrame1m).Return(nil, dbError)
 
-		err := processor.ProcessTrade(ctx, trade)
+		err := processor.Restore(ctx, []string{"BTC_USDT"})
 
 		assert.Error(t, err)
-		assert.Equal(t, dbError, err)
-		mockRepo.AssertNotCalled(t, "SaveKline")
+		assert.ErrorIs(t, err, dbError)
+		mockRepo.AssertNotCalled(t, "SaveKlines")
 	})
 
-	t.Run("ProcessTrade_SaveError_ReturnsError", func(t *testing.T) {
-
+	t.Run("Flush_SaveError_RetriesOnNextFlush", func(t *testing.T) {
 		mockRepo := new(MockRepository)
 		processor := NewKlineProcessor(mockRepo)
 		ctx := context.Background()
 
 		trade := &models.RecentTrade{
 			Pair:      "BTC_USDT",
-			Price:     "50000.0",
-			Amount:    "1.5",
+			Price:     decimal.RequireFromString("50000.0"),
+			Quantity:  decimal.RequireFromString("1.5"),
+			Amount:    decimal.RequireFromString("75000"),
 			Side:      "buy",
 			Timestamp: time.Now().Unix() * 1000,
 		}
 
-		mockRepo.On("GetLastKline", ctx, trade.Pair, PoloniexTimeFrame1m).Return(nil, sql.ErrNoRows)
 		saveError := errors.New("save error")
-		mockRepo.On("SaveKline", ctx, mock.AnythingOfType("models.Kline")).Return(saveError)
+		mockRepo.On("SaveKlines", ctx, mock.AnythingOfType("[]models.Kline")).Return(saveError).Once()
+		mockRepo.On("SaveKlines", ctx, mock.AnythingOfType("[]models.Kline")).Return(nil).Once()
 
 		err := processor.ProcessTrade(ctx, trade)
+		assert.NoError(t, err)
 
+		err = processor.Flush(ctx)
 		assert.Error(t, err)
 		assert.Equal(t, saveError, err)
+
+		err = processor.Flush(ctx)
+		assert.NoError(t, err)
+		mockRepo.AssertNumberOfCalls(t, "SaveKlines", 2)
+		mockRepo.AssertCalled(t, "SaveKlines", ctx, mock.MatchedBy(func(klines []models.Kline) bool {
+			return len(klines) == 4
+		}))
 	})
 }
 
@@ -266,11 +255,34 @@ func TestGetKlineTimestamps(t *testing.T) {
 			expectedBegin: 1676505600000,
 			expectedEnd:   1676592000000,
 		},
+		{
+			name:          "4 hour timeframe with millisecond timestamp",
+			timestamp:     1676548234000,
+			timeFrame:     "HOUR_4",
+			expectedBegin: 1676548800000 - 4*3600000,
+			expectedEnd:   1676548800000,
+		},
+		{
+			name:          "1 week timeframe starts on monday",
+			timestamp:     1676548234000, // Thursday 2023-02-16
+			timeFrame:     "WEEK_1",
+			expectedBegin: 1676246400000, // Monday 2023-02-13
+			expectedEnd:   1676851200000,
+		},
+		{
+			name:          "1 month timeframe follows the calendar",
+			timestamp:     1676548234000,
+			timeFrame:     "MONTH_1",
+			expectedBegin: 1675209600000, // 2023-02-01
+			expectedEnd:   1677628800000, // 2023-03-01
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			beginTime, endTime := getKlineTimestamps(tc.timestamp, tc.timeFrame)
+			tf, err := timeframe.Parse(tc.timeFrame)
+			require.NoError(t, err)
+			beginTime, endTime := getKlineTimestamps(tc.timestamp, tf)
 
 			assert.Equal(t, tc.expectedBegin, beginTime)
 			assert.Equal(t, tc.expectedEnd, endTime)
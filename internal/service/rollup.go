@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+const (
+	// cascadeBase is the timeframe built from trades in cascade mode; every
+	// other timeframe is rolled up from it.
+	cascadeBase = "MINUTE_1"
+
+	// recomputeChunk is the least time range of candles read at once by
+	// RecomputeTimeFrames.
+	recomputeChunk = 24 * time.Hour
+)
+
+// KlineRangeRepository reads and writes the candles of a time range.
+type KlineRangeRepository interface {
+	GetKlinesByTimeRange(ctx context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error)
+	SaveKlines(ctx context.Context, klines []models.Kline) error
+}
+
+// KlineRebuildRepository reads the candles of a time range and overwrites
+// stored candles with rebuilt ones.
+type KlineRebuildRepository interface {
+	GetKlinesByTimeRange(ctx context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error)
+	ReplaceKlines(ctx context.Context, klines []models.Kline) error
+}
+
+// cascade describes how timeframes are rolled up: every timeframe but the
+// base is built from its parent, the longest shorter timeframe that divides
+// it.
+type cascade struct {
+	base     timeframe.TimeFrame
+	order    []timeframe.TimeFrame
+	parents  map[string]timeframe.TimeFrame
+	children map[string][]timeframe.TimeFrame
+}
+
+// newCascade builds the cascade of the timeframes. MINUTE_1 is added when
+// it is missing, since it is the base of every cascade.
+func newCascade(timeframes []timeframe.TimeFrame) cascade {
+	base := timeframe.MustParseList([]string{cascadeBase})[0]
+
+	order := []timeframe.TimeFrame{base}
+	for _, tf := range timeframes {
+		if tf.Name != base.Name {
+			order = append(order, tf)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Duration < order[j].Duration })
+
+	c := cascade{
+		base:     base,
+		order:    order,
+		parents:  make(map[string]timeframe.TimeFrame),
+		children: make(map[string][]timeframe.TimeFrame),
+	}
+	for i, tf := range order[1:] {
+		parent := base
+		for _, lower := range order[:i+1] {
+			if lower.Duration < tf.Duration && lower.Divides(tf) {
+				parent = lower
+			}
+		}
+		c.parents[tf.Name] = parent
+		c.children[parent.Name] = append(c.children[parent.Name], tf)
+	}
+	return c
+}
+
+// mergeKlines combines consecutive candles of parent, oldest first, into the
+// candle of tf that contains them. The result is closed when the last
+// candle is closed and completes the candle of tf.
+func mergeKlines(tf, parent timeframe.TimeFrame, parts []models.Kline) models.Kline {
+	first, last := parts[0], parts[len(parts)-1]
+	begin, end := tf.Bounds(first.UtcBegin)
+
+	kline := models.Kline{
+		Exchange:  first.Exchange,
+		Pair:      first.Pair,
+		TimeFrame: tf.Name,
+		O:         first.O,
+		H:         first.H,
+		L:         first.L,
+		C:         last.C,
+		UtcBegin:  begin,
+		UtcEnd:    end,
+		BeginDt:   time.UnixMilli(begin).UTC(),
+		EndDt:     time.UnixMilli(end).UTC(),
+	}
+
+	for _, part := range parts {
+		kline.H = decimal.Max(kline.H, part.H)
+		kline.L = decimal.Min(kline.L, part.L)
+
+		kline.VolumeBS.BuyBase = kline.VolumeBS.BuyBase.Add(part.VolumeBS.BuyBase)
+		kline.VolumeBS.SellBase = kline.VolumeBS.SellBase.Add(part.VolumeBS.SellBase)
+		kline.VolumeBS.BuyQuote = kline.VolumeBS.BuyQuote.Add(part.VolumeBS.BuyQuote)
+		kline.VolumeBS.SellQuote = kline.VolumeBS.SellQuote.Add(part.VolumeBS.SellQuote)
+
+		kline.TradeCount += part.TradeCount
+		kline.BaseVolume = kline.BaseVolume.Add(part.BaseVolume)
+		kline.QuoteVolume = kline.QuoteVolume.Add(part.QuoteVolume)
+
+		if kline.FirstTradeID == "" {
+			kline.FirstTradeID = part.FirstTradeID
+		}
+		if part.LastTradeID != "" {
+			kline.LastTradeID = part.LastTradeID
+		}
+	}
+
+	if !kline.BaseVolume.IsZero() {
+		kline.VWAP = kline.QuoteVolume.Div(kline.BaseVolume)
+	}
+
+	_, lastEnd := parent.Bounds(last.UtcBegin)
+	kline.IsClosed = last.IsClosed && lastEnd == end
+	return kline
+}
+
+// addPart inserts the candle into parts, sorted by begin time, replacing a
+// previous state of the same candle.
+func addPart(parts []models.Kline, kline models.Kline) []models.Kline {
+	i := sort.Search(len(parts), func(i int) bool { return parts[i].UtcBegin >= kline.UtcBegin })
+	if i < len(parts) && parts[i].UtcBegin == kline.UtcBegin {
+		parts[i] = kline
+		return parts
+	}
+	return append(parts[:i], append([]models.Kline{kline}, parts[i:]...)...)
+}
+
+// RollUp builds the candles of tf from the candles of parent, which must be
+// sorted by begin time.
+func RollUp(tf, parent timeframe.TimeFrame, klines []models.Kline) []models.Kline {
+	var result []models.Kline
+	for start := 0; start < len(klines); {
+		_, end := tf.Bounds(klines[start].UtcBegin)
+		stop := start
+		for stop < len(klines) && klines[stop].UtcBegin < end {
+			stop++
+		}
+		result = append(result, mergeKlines(tf, parent, klines[start:stop]))
+		start = stop
+	}
+	return result
+}
+
+// RecomputeTimeFrames rebuilds the candles of every timeframe but MINUTE_1
+// of the pair between from and to (unix ms) from the stored MINUTE_1
+// candles, each timeframe from the one it is rolled up from in cascade mode.
+// The range is widened to whole candles of every timeframe. Rebuilt candles
+// replace the stored ones; candles without any stored MINUTE_1 candle are
+// left as they are. A rebuilt candle whose time is over is closed, even when
+// its last minutes had no trades.
+func RecomputeTimeFrames(ctx context.Context, repository KlineRebuildRepository, pair string, timeframes []timeframe.TimeFrame, from, to int64) error {
+	c := newCascade(timeframes)
+	now := time.Now().UnixMilli()
+
+	begin, end := from, to
+	for _, tf := range c.order {
+		b, _ := tf.Bounds(from)
+		_, e := tf.Bounds(to - 1)
+		begin, end = min(begin, b), max(end, e)
+	}
+
+	for _, tf := range c.order[1:] {
+		parent := c.parents[tf.Name]
+
+		var saved int
+		chunkBegin, _ := tf.Bounds(begin)
+		for chunkBegin < end {
+			chunkEnd := chunkBegin
+			for chunkEnd < end && chunkEnd-chunkBegin < recomputeChunk.Milliseconds() {
+				_, chunkEnd = tf.Bounds(chunkEnd)
+			}
+
+			parts, err := repository.GetKlinesByTimeRange(ctx, pair, parent.Name, chunkBegin, chunkEnd)
+			if err != nil {
+				return fmt.Errorf("get %s %s klines: %w", pair, parent.Name, err)
+			}
+
+			if klines := RollUp(tf, parent, parts); len(klines) > 0 {
+				for i := range klines {
+					if klines[i].UtcEnd <= now {
+						klines[i].IsClosed = true
+					}
+				}
+				if err := repository.ReplaceKlines(ctx, klines); err != nil {
+					return fmt.Errorf("save %s %s klines: %w", pair, tf.Name, err)
+				}
+				saved += len(klines)
+			}
+
+			chunkBegin = chunkEnd
+		}
+
+		log.Printf("Recomputed %d %s klines of %s from %s", saved, tf.Name, pair, parent.Name)
+	}
+
+	return nil
+}
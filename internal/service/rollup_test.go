@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+func TestNewCascade(t *testing.T) {
+	c := newCascade(timeframe.MustParseList([]string{"1d", "10m", "15m", "1h", "1w", "1M"}))
+
+	names := make([]string, 0, len(c.order))
+	for _, tf := range c.order {
+		names = append(names, tf.Name)
+	}
+	assert.Equal(t, []string{"MINUTE_1", "MINUTE_10", "MINUTE_15", "HOUR_1", "DAY_1", "WEEK_1", "MONTH_1"}, names)
+
+	parents := map[string]string{
+		"MINUTE_10": "MINUTE_1",
+		"MINUTE_15": "MINUTE_1",
+		"HOUR_1":    "MINUTE_15",
+		"DAY_1":     "HOUR_1",
+		"WEEK_1":    "DAY_1",
+		"MONTH_1":   "DAY_1",
+	}
+	for name, parent := range parents {
+		assert.Equal(t, parent, c.parents[name].Name, name)
+	}
+}
+
+func TestRecomputeTimeFrames(t *testing.T) {
+	repo := newMemoryKlineRepository()
+
+	// Ninety historical minutes from 23:00 to 00:30 of the next day.
+	start := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+	var minutes []models.Kline
+	for i := int64(0); i < 90; i++ {
+		price := decimal.NewFromInt(100 + i)
+		minutes = append(minutes, models.Kline{
+			Pair: "BTC_USDT", TimeFrame: "MINUTE_1",
+			O: price, H: price.Add(decimal.NewFromInt(1)), L: price.Sub(decimal.NewFromInt(1)), C: price,
+			UtcBegin: start + i*minute, UtcEnd: start + (i+1)*minute - 1,
+			TradeCount: 2, BaseVolume: decimal.NewFromInt(1), QuoteVolume: price,
+			IsClosed: true,
+		})
+	}
+	require.NoError(t, repo.SaveKlines(context.Background(), minutes))
+
+	err := RecomputeTimeFrames(context.Background(), repo, "BTC_USDT",
+		timeframe.MustParseList([]string{"1d", "1h"}), start+30*minute, start+70*minute)
+	require.NoError(t, err)
+
+	lastHour := repo.klines[fmt.Sprintf("BTC_USDT|HOUR_1|%d", start)]
+	assert.Equal(t, "100", lastHour.O.String())
+	assert.Equal(t, "160", lastHour.H.String())
+	assert.Equal(t, "99", lastHour.L.String())
+	assert.Equal(t, "159", lastHour.C.String())
+	assert.Equal(t, int64(120), lastHour.TradeCount)
+	assert.Equal(t, "60", lastHour.BaseVolume.String())
+	assert.Equal(t, "129.5", lastHour.VWAP.String())
+	assert.True(t, lastHour.IsClosed)
+
+	// The hour is over, so it is closed although only its first half has
+	// minutes.
+	firstHour := repo.klines[fmt.Sprintf("BTC_USDT|HOUR_1|%d", start+60*minute)]
+	assert.Equal(t, "160", firstHour.O.String())
+	assert.Equal(t, int64(60), firstHour.TradeCount)
+	assert.True(t, firstHour.IsClosed)
+
+	// Days are rolled up from the recomputed hours.
+	day := repo.klines[fmt.Sprintf("BTC_USDT|DAY_1|%d", start-23*60*minute)]
+	assert.Equal(t, int64(120), day.TradeCount)
+	assert.True(t, day.IsClosed)
+
+	nextDay := repo.klines[fmt.Sprintf("BTC_USDT|DAY_1|%d", start+60*minute)]
+	assert.Equal(t, "189", nextDay.C.String())
+	assert.True(t, nextDay.IsClosed)
+}
+
+func TestRecomputeTimeFrames_ClosesHourWithoutLastMinute(t *testing.T) {
+	repo := newMemoryKlineRepository()
+	minute := time.Minute.Milliseconds()
+
+	minuteKline := func(begin int64) models.Kline {
+		return models.Kline{
+			Pair: "BTC_USDT", TimeFrame: "MINUTE_1",
+			O: decimal.NewFromInt(100), H: decimal.NewFromInt(100), L: decimal.NewFromInt(100), C: decimal.NewFromInt(100),
+			UtcBegin: begin, UtcEnd: begin + minute,
+			TradeCount: 1, BaseVolume: decimal.NewFromInt(1), QuoteVolume: decimal.NewFromInt(100),
+			IsClosed: true,
+		}
+	}
+
+	// A past hour without trades in its last minute, and the current hour.
+	past := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+	var minutes []models.Kline
+	for i := int64(0); i < 59; i++ {
+		minutes = append(minutes, minuteKline(past+i*minute))
+	}
+	current := time.Now().UTC().Truncate(time.Hour).UnixMilli()
+	minutes = append(minutes, minuteKline(current))
+	require.NoError(t, repo.SaveKlines(context.Background(), minutes))
+
+	hour := timeframe.MustParseList([]string{"1h"})
+	require.NoError(t, RecomputeTimeFrames(context.Background(), repo, "BTC_USDT", hour, past, past+60*minute))
+	require.NoError(t, RecomputeTimeFrames(context.Background(), repo, "BTC_USDT", hour, current, current+60*minute))
+
+	rebuilt := repo.klines[fmt.Sprintf("BTC_USDT|HOUR_1|%d", past)]
+	assert.Equal(t, int64(59), rebuilt.TradeCount)
+	assert.True(t, rebuilt.IsClosed)
+
+	// The current hour may still get trades.
+	open := repo.klines[fmt.Sprintf("BTC_USDT|HOUR_1|%d", current)]
+	assert.Equal(t, int64(1), open.TradeCount)
+	assert.False(t, open.IsClosed)
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+const (
+	// defaultMaxWriteAttempts is how many times a trade rejected by the
+	// repository is written before it is dropped.
+	defaultMaxWriteAttempts = 3
+
+	// defaultMaxPendingTrades is how many trades are buffered at most, e.g.
+	// while the database is unavailable, before the oldest are dropped.
+	defaultMaxPendingTrades = 100000
+)
+
+type TradeRepository interface {
+	SaveTrades(ctx context.Context, trades []models.RecentTrade) error
+}
+
+type pendingTrade struct {
+	trade    models.RecentTrade
+	attempts int
+}
+
+// TradeWriter buffers trades and writes them to the repository in batches,
+// every flush interval or as soon as a batch is full. Trades rejected by the
+// repository are retried on the following flushes and dropped after the
+// maximum number of attempts; when the whole batch fails, e.g. while the
+// database is unavailable, it is kept and retried without counting attempts.
+// At most the maximum number of pending trades is buffered; beyond it the
+// oldest trades are dropped.
+type TradeWriter struct {
+	repository    TradeRepository
+	flushInterval time.Duration
+	batchSize     int
+	maxAttempts   int
+	maxPending    int
+	metrics       *metrics.Metrics
+	stage         string
+
+	flushMu sync.Mutex
+	full    chan struct{}
+
+	mu      sync.Mutex
+	pending []pendingTrade
+}
+
+type TradeWriterOption func(*TradeWriter)
+
+// WithTradeFlushInterval sets how often buffered trades are written.
+func WithTradeFlushInterval(interval time.Duration) TradeWriterOption {
+	return func(w *TradeWriter) {
+		if interval > 0 {
+			w.flushInterval = interval
+		}
+	}
+}
+
+// WithTradeBatchSize sets the maximum number of trades written in one
+// repository call and the number of buffered trades that triggers a flush.
+func WithTradeBatchSize(size int) TradeWriterOption {
+	return func(w *TradeWriter) {
+		if size > 0 {
+			w.batchSize = size
+		}
+	}
+}
+
+// WithMaxWriteAttempts sets how many times a rejected trade is written
+// before it is dropped.
+func WithMaxWriteAttempts(attempts int) TradeWriterOption {
+	return func(w *TradeWriter) {
+		if attempts > 0 {
+			w.maxAttempts = attempts
+		}
+	}
+}
+
+// WithMaxPendingTrades sets how many trades are buffered at most before the
+// oldest are dropped.
+func WithMaxPendingTrades(max int) TradeWriterOption {
+	return func(w *TradeWriter) {
+		if max > 0 {
+			w.maxPending = max
+		}
+	}
+}
+
+// WithWriterMetrics sets the metrics updated for rejected, dropped and
+// buffered trades.
+func WithWriterMetrics(m *metrics.Metrics) TradeWriterOption {
+	return func(w *TradeWriter) {
+		w.metrics = m
+	}
+}
+
+// WithWriterStage sets the stage label of the writer's metrics,
+// metrics.StageWriter by default.
+func WithWriterStage(stage string) TradeWriterOption {
+	return func(w *TradeWriter) {
+		if stage != "" {
+			w.stage = stage
+		}
+	}
+}
+
+func NewTradeWriter(repository TradeRepository, opts ...TradeWriterOption) *TradeWriter {
+	w := &TradeWriter{
+		repository:    repository,
+		flushInterval: defaultFlushInterval,
+		batchSize:     defaultBatchSize,
+		maxAttempts:   defaultMaxWriteAttempts,
+		maxPending:    defaultMaxPendingTrades,
+		stage:         metrics.StageWriter,
+		full:          make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Add buffers the trades for writing. It never blocks on the repository:
+// when the buffer is full the oldest trades are dropped.
+func (w *TradeWriter) Add(trades ...models.RecentTrade) {
+	w.mu.Lock()
+	for _, trade := range trades {
+		w.pending = append(w.pending, pendingTrade{trade: trade})
+	}
+	w.trim()
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Len returns the number of buffered trades.
+func (w *TradeWriter) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// Run writes buffered trades every flush interval and whenever a batch is
+// full until ctx is cancelled. The caller is expected to call Flush once more
+// after it stops adding trades.
+func (w *TradeWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.full:
+		}
+
+		if err := w.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error writing trades: %v", err)
+		}
+	}
+}
+
+// Flush writes the buffered trades in batches. Rejected trades are kept for
+// the next flush until they run out of attempts. It returns the last error
+// of the repository.
+func (w *TradeWriter) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	var (
+		retry   []pendingTrade
+		lastErr error
+	)
+	for start := 0; start < len(pending); start += w.batchSize {
+		end := min(start+w.batchSize, len(pending))
+		batch := pending[start:end]
+
+		trades := make([]models.RecentTrade, len(batch))
+		for i := range batch {
+			trades[i] = batch[i].trade
+		}
+
+		err := w.repository.SaveTrades(ctx, trades)
+		if err == nil {
+			continue
+		}
+		lastErr = err
+
+		var rejected *repository.TradeWriteError
+		if !errors.As(err, &rejected) {
+			// Nothing is known to be stored, so the rest is kept as it is.
+			retry = append(retry, pending[start:]...)
+			break
+		}
+		retry = append(retry, w.rejected(batch, rejected)...)
+	}
+
+	w.mu.Lock()
+	if len(retry) > 0 {
+		w.pending = append(retry, w.pending...)
+	}
+	w.trim()
+	w.mu.Unlock()
+
+	return lastErr
+}
+
+// trim drops the oldest pending trades beyond the maximum and reports the
+// number of pending trades. w.mu must be held.
+func (w *TradeWriter) trim() {
+	if excess := len(w.pending) - w.maxPending; excess > 0 {
+		log.Printf("Dropping %d oldest trades: more than %d trades pending", excess, w.maxPending)
+		if counter := w.metrics.DroppedCounter(w.stage); counter != nil {
+			counter.Add(float64(excess))
+		}
+		w.pending = w.pending[excess:]
+	}
+	w.metrics.SetQueueLength(w.stage, len(w.pending))
+}
+
+// rejected counts an attempt for the trades of batch listed in err and
+// returns the ones that are retried.
+func (w *TradeWriter) rejected(batch []pendingTrade, err *repository.TradeWriteError) []pendingTrade {
+	failed := make(map[string]struct{}, len(err.Failed))
+	for _, trade := range err.Failed {
+		failed[trade.Pair+"|"+trade.Tid] = struct{}{}
+	}
+
+	var retry []pendingTrade
+	for _, p := range batch {
+		if _, ok := failed[p.trade.Pair+"|"+p.trade.Tid]; !ok {
+			continue
+		}
+		w.metrics.TradeWriteFailed(p.trade.Pair)
+
+		p.attempts++
+		if p.attempts >= w.maxAttempts {
+			log.Printf("Dropping trade after %d failed writes: Pair=%s, Tid=%s: %v",
+				p.attempts, p.trade.Pair, p.trade.Tid, err.Err)
+			if counter := w.metrics.DroppedCounter(w.stage); counter != nil {
+				counter.Inc()
+			}
+			continue
+		}
+		retry = append(retry, p)
+	}
+
+	log.Printf("%d of %d trades rejected, %d will be retried: %v", len(err.Failed), len(batch), len(retry), err.Err)
+	return retry
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+)
+
+// flakyTradeRepository rejects the trades listed in reject and fails whole
+// batches while down is set.
+type flakyTradeRepository struct {
+	mu      sync.Mutex
+	reject  map[string]bool
+	down    bool
+	stored  []string
+	batches []int
+}
+
+func (r *flakyTradeRepository) SaveTrades(_ context.Context, trades []models.RecentTrade) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.batches = append(r.batches, len(trades))
+	if r.down {
+		return errors.New("connection refused")
+	}
+
+	rejected := &repository.TradeWriteError{Err: errors.New("value too long")}
+	for _, trade := range trades {
+		if r.reject[trade.Tid] {
+			rejected.Failed = append(rejected.Failed, trade)
+			continue
+		}
+		r.stored = append(r.stored, trade.Tid)
+	}
+	if len(rejected.Failed) > 0 {
+		return rejected
+	}
+	return nil
+}
+
+func (r *flakyTradeRepository) storedTids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.stored...)
+}
+
+func writerTrades(tids ...string) []models.RecentTrade {
+	trades := make([]models.RecentTrade, 0, len(tids))
+	for _, tid := range tids {
+		trades = append(trades, models.RecentTrade{Tid: tid, Pair: "BTC_USDT"})
+	}
+	return trades
+}
+
+func TestTradeWriter_FlushesInBatches(t *testing.T) {
+	repo := &flakyTradeRepository{}
+	writer := NewTradeWriter(repo, WithTradeBatchSize(2))
+
+	writer.Add(writerTrades("1", "2", "3", "4", "5")...)
+	require.NoError(t, writer.Flush(context.Background()))
+
+	assert.Equal(t, []int{2, 2, 1}, repo.batches)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, repo.storedTids())
+	assert.Zero(t, writer.Len())
+}
+
+func TestTradeWriter_RetriesRejectedTrades(t *testing.T) {
+	repo := &flakyTradeRepository{reject: map[string]bool{"2": true, "4": true}}
+	writer := NewTradeWriter(repo, WithMaxWriteAttempts(2))
+
+	writer.Add(writerTrades("1", "2", "3", "4")...)
+
+	var rejected *repository.TradeWriteError
+	require.ErrorAs(t, writer.Flush(context.Background()), &rejected)
+	assert.Equal(t, []string{"1", "3"}, repo.storedTids())
+	assert.Equal(t, 2, writer.Len())
+
+	// The trade fixed in the meantime is stored, the other one is dropped
+	// after its last attempt.
+	repo.reject["2"] = false
+	require.ErrorAs(t, writer.Flush(context.Background()), &rejected)
+	assert.Equal(t, []string{"1", "3", "2"}, repo.storedTids())
+	assert.Zero(t, writer.Len())
+}
+
+func TestTradeWriter_KeepsBatchWhileRepositoryIsDown(t *testing.T) {
+	repo := &flakyTradeRepository{down: true}
+	writer := NewTradeWriter(repo, WithTradeBatchSize(2), WithMaxWriteAttempts(1))
+
+	writer.Add(writerTrades("1", "2", "3")...)
+	assert.Error(t, writer.Flush(context.Background()))
+	assert.Error(t, writer.Flush(context.Background()))
+	assert.Equal(t, 3, writer.Len())
+
+	writer.Add(writerTrades("4")...)
+	repo.down = false
+	require.NoError(t, writer.Flush(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, repo.storedTids())
+}
+
+func TestTradeWriter_DropsOldestBeyondMaxPending(t *testing.T) {
+	repo := &flakyTradeRepository{down: true}
+	m := metrics.NewMetrics(prometheus.NewRegistry())
+	writer := NewTradeWriter(repo, WithTradeBatchSize(2), WithMaxPendingTrades(3), WithWriterMetrics(m))
+
+	writer.Add(writerTrades("1", "2")...)
+	assert.Error(t, writer.Flush(context.Background()))
+	writer.Add(writerTrades("3", "4")...)
+	assert.Equal(t, 3, writer.Len())
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.QueueLength.WithLabelValues(metrics.StageWriter)))
+
+	// The requeued batch counts against the limit too.
+	assert.Error(t, writer.Flush(context.Background()))
+	writer.Add(writerTrades("5")...)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.TradesDropped.WithLabelValues(metrics.StageWriter)))
+
+	repo.down = false
+	require.NoError(t, writer.Flush(context.Background()))
+	assert.Equal(t, []string{"3", "4", "5"}, repo.storedTids())
+	assert.Zero(t, testutil.ToFloat64(m.QueueLength.WithLabelValues(metrics.StageWriter)))
+}
+
+func TestTradeWriter_RunFlushesFullBatch(t *testing.T) {
+	repo := &flakyTradeRepository{}
+	writer := NewTradeWriter(repo, WithTradeBatchSize(3), WithTradeFlushInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+
+	writer.Add(writerTrades("1", "2")...)
+	writer.Add(writerTrades("3")...)
+
+	assert.Eventually(t, func() bool { return len(repo.storedTids()) == 3 }, time.Second, 10*time.Millisecond)
+}
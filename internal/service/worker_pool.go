@@ -2,62 +2,156 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"path/filepath"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
 )
 
+const defaultPartitionQueueSize = 1000
+
+// WorkerPool processes trades in partitions keyed by a hash of the trade pair.
+// Every partition is served by a single worker, so trades of one pair are
+// applied in the order they were submitted while different pairs are
+// processed in parallel.
 type WorkerPool struct {
 	numWorkers int
-	taskQueue  chan *models.RecentTrade
+	partitions []*queue.Queue[*models.RecentTrade]
 	processor  *KlineProcessor
 	wg         sync.WaitGroup
+
+	queueSize      int
+	overflowPolicy queue.Policy
+	spillDir       string
+	tradesDropped  prometheus.Counter
+	metrics        *metrics.Metrics
+}
+
+type WorkerPoolOption func(*WorkerPool)
+
+// WithQueueSize sets the number of trades buffered by every partition.
+func WithQueueSize(size int) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		if size > 0 {
+			wp.queueSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets what Submit does when a partition queue is full.
+// spillDir is used by queue.PolicySpill.
+func WithOverflowPolicy(policy queue.Policy, spillDir string) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.overflowPolicy = policy
+		wp.spillDir = spillDir
+	}
+}
+
+// WithDropCounter sets the counter incremented for every dropped trade.
+func WithDropCounter(counter prometheus.Counter) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.tradesDropped = counter
+	}
+}
+
+// WithPoolMetrics sets the metrics updated for queued trades and queue length.
+func WithPoolMetrics(m *metrics.Metrics) WorkerPoolOption {
+	return func(wp *WorkerPool) {
+		wp.metrics = m
+	}
 }
 
-func NewWorkerPool(numWorkers int, processor *KlineProcessor) *WorkerPool {
-	return &WorkerPool{
-		numWorkers: numWorkers,
-		taskQueue:  make(chan *models.RecentTrade, 1000),
-		processor:  processor,
+func NewWorkerPool(numWorkers int, processor *KlineProcessor, opts ...WorkerPoolOption) *WorkerPool {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	wp := &WorkerPool{
+		numWorkers:     numWorkers,
+		processor:      processor,
+		queueSize:      defaultPartitionQueueSize,
+		overflowPolicy: queue.PolicyBlock,
+	}
+
+	for _, opt := range opts {
+		opt(wp)
+	}
+
+	wp.partitions = make([]*queue.Queue[*models.RecentTrade], numWorkers)
+	for i := range wp.partitions {
+		wp.partitions[i] = queue.New[*models.RecentTrade](
+			wp.queueSize,
+			wp.overflowPolicy,
+			filepath.Join(wp.spillDir, fmt.Sprintf("worker-%d.spill", i)),
+			wp.tradesDropped,
+		)
 	}
+
+	return wp
 }
 
 func (wp *WorkerPool) Start(ctx context.Context) {
 	for i := 0; i < wp.numWorkers; i++ {
 		wp.wg.Add(1)
-		go wp.worker(ctx)
+		go wp.worker(ctx, wp.partitions[i].C())
 	}
 }
 
 func (wp *WorkerPool) Stop() {
-	close(wp.taskQueue)
+	for _, partition := range wp.partitions {
+		partition.Close()
+	}
 	wp.wg.Wait()
 }
 
-func (wp *WorkerPool) Submit(trade *models.RecentTrade) bool {
-	select {
-	case wp.taskQueue <- trade:
-		return true
-	default:
-		return false
+// Submit queues the trade on its pair partition according to the overflow
+// policy and reports whether the trade was accepted.
+func (wp *WorkerPool) Submit(ctx context.Context, trade *models.RecentTrade) bool {
+	ok := wp.partitions[wp.partition(trade.Pair)].Push(ctx, trade)
+	if ok {
+		wp.metrics.TradeQueued(trade.Pair)
 	}
+	wp.metrics.SetQueueLength(metrics.StageWorker, wp.Len())
+	return ok
+}
+
+// Len returns the number of trades waiting in all partitions.
+func (wp *WorkerPool) Len() int {
+	n := 0
+	for _, partition := range wp.partitions {
+		n += partition.Len()
+	}
+	return n
+}
+
+func (wp *WorkerPool) partition(pair string) int {
+	h := fnv.New32a()
+	h.Write([]byte(pair))
+	return int(h.Sum32() % uint32(wp.numWorkers))
 }
 
-func (wp *WorkerPool) worker(ctx context.Context) {
+func (wp *WorkerPool) worker(ctx context.Context, taskQueue <-chan *models.RecentTrade) {
 	defer wp.wg.Done()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case trade, ok := <-wp.taskQueue:
+		case trade, ok := <-taskQueue:
 			if !ok {
 				return
 			}
 
 			if err := wp.processor.ProcessTrade(ctx, trade); err != nil {
 				log.Println("error processing trade:", err)
+				wp.metrics.ProcessingError(trade.Pair)
 				continue
 			}
 		}
@@ -2,13 +2,21 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/queue"
 	"github.com/Zmey56/poloniex-collector/test/mocks"
 )
 
@@ -18,7 +26,7 @@ func TestWorkerPool(t *testing.T) {
 
 	mockKlineRepo := mocks.NewMockKlineRepository(ctrl)
 	processor := NewKlineProcessor(mockKlineRepo)
-	pool := NewWorkerPool(2, processor)
+	pool := NewWorkerPool(2, processor, WithOverflowPolicy(queue.PolicyDropNewest, ""))
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -26,33 +34,167 @@ func TestWorkerPool(t *testing.T) {
 	trade := &models.RecentTrade{
 		Tid:       "123",
 		Pair:      "BTC_USDT",
-		Price:     "50000.00",
-		Amount:    "1.5",
+		Price:     decimal.RequireFromString("50000.00"),
+		Quantity:  decimal.RequireFromString("1.5"),
+		Amount:    decimal.RequireFromString("75000"),
 		Side:      "buy",
 		Timestamp: time.Now().Unix(),
 	}
 
 	mockKlineRepo.EXPECT().
-		GetLastKline(gomock.Any(), trade.Pair, "1m").
-		Return(nil, nil).
-		AnyTimes()
-
-	mockKlineRepo.EXPECT().
-		SaveKline(gomock.Any(), gomock.Any()).
+		SaveKlines(gomock.Any(), gomock.Any()).
 		Return(nil).
 		AnyTimes()
 
 	pool.Start(ctx)
 
-	success := pool.Submit(trade)
+	success := pool.Submit(ctx, trade)
 	assert.True(t, success, "Should successfully submit trade")
 
 	time.Sleep(100 * time.Millisecond)
 
 	for i := 0; i < 1100; i++ { // Больше чем размер буфера
-		pool.Submit(trade)
+		pool.Submit(ctx, trade)
 	}
 
 	cancel()
 	pool.Stop()
 }
+
+type memoryKlineRepository struct {
+	mu     sync.Mutex
+	klines map[string]models.Kline
+}
+
+func newMemoryKlineRepository() *memoryKlineRepository {
+	return &memoryKlineRepository{klines: make(map[string]models.Kline)}
+}
+
+func (r *memoryKlineRepository) SaveKline(_ context.Context, kline models.Kline) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.klines[fmt.Sprintf("%s|%s|%d", kline.Pair, kline.TimeFrame, kline.UtcBegin)] = kline
+	return nil
+}
+
+func (r *memoryKlineRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	for _, kline := range klines {
+		if err := r.SaveKline(ctx, kline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryKlineRepository) ReplaceKlines(ctx context.Context, klines []models.Kline) error {
+	return r.SaveKlines(ctx, klines)
+}
+
+func (r *memoryKlineRepository) GetLastKline(context.Context, string, string) (*models.Kline, error) {
+	return nil, nil
+}
+
+func (r *memoryKlineRepository) GetKlineByInterval(context.Context, string, string, int64) (*models.Kline, error) {
+	return nil, nil
+}
+
+func (r *memoryKlineRepository) GetKlinesByTimeRange(_ context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var klines []models.Kline
+	for _, kline := range r.klines {
+		if kline.Pair == pair && kline.TimeFrame == timeframe && kline.UtcBegin >= startTime && kline.UtcEnd <= endTime {
+			klines = append(klines, kline)
+		}
+	}
+	sort.Slice(klines, func(i, j int) bool { return klines[i].UtcBegin < klines[j].UtcBegin })
+	return klines, nil
+}
+
+func interleavedTrades() []*models.RecentTrade {
+	pairs := []string{"BTC_USDT", "ETH_USDT", "TRX_USDT", "DOGE_USDT", "BCH_USDT"}
+	base := time.Date(2023, 2, 16, 11, 50, 0, 0, time.UTC).UnixMilli()
+
+	var trades []*models.RecentTrade
+	for i := 0; i < 150; i++ {
+		for j, pair := range pairs {
+			side := "buy"
+			if (i+j)%2 == 0 {
+				side = "sell"
+			}
+			price := decimal.RequireFromString(fmt.Sprintf("%d.%d", 100+(i*7+j)%13, i%10))
+			quantity := decimal.RequireFromString(fmt.Sprintf("0.%03d", i+1))
+			trades = append(trades, &models.RecentTrade{
+				Tid:       fmt.Sprintf("%s-%d", pair, i),
+				Pair:      pair,
+				Price:     price,
+				Quantity:  quantity,
+				Amount:    price.Mul(quantity),
+				Side:      side,
+				Timestamp: base + int64(i)*1000,
+			})
+		}
+	}
+	return trades
+}
+
+func TestWorkerPool_PerPairOrdering(t *testing.T) {
+	trades := interleavedTrades()
+
+	expectedRepo := newMemoryKlineRepository()
+	sequential := NewKlineProcessor(expectedRepo)
+	for _, trade := range trades {
+		require.NoError(t, sequential.ProcessTrade(context.Background(), trade))
+	}
+	require.NoError(t, sequential.Flush(context.Background()))
+
+	for run := 0; run < 10; run++ {
+		repo := newMemoryKlineRepository()
+		processor := NewKlineProcessor(repo)
+		pool := NewWorkerPool(4, processor)
+		pool.Start(context.Background())
+
+		for _, trade := range trades {
+			require.True(t, pool.Submit(context.Background(), trade))
+		}
+
+		pool.Stop()
+		require.NoError(t, processor.Flush(context.Background()))
+
+		require.Equal(t, expectedRepo.klines, repo.klines, "run %d produced different klines", run)
+	}
+
+	last := trades[len(trades)-1]
+	kline := expectedRepo.klines[fmt.Sprintf("%s|%s|%d", last.Pair, PoloniexTimeFrame1m, last.Timestamp/60000*60000)]
+	assert.True(t, last.Price.Equal(kline.C), "close %s, last price %s", kline.C, last.Price)
+}
+
+func TestWorkerPool_SamePairSamePartition(t *testing.T) {
+	pool := NewWorkerPool(8, nil)
+
+	for _, pair := range []string{"BTC_USDT", "ETH_USDT", "DOGE_USDT"} {
+		partition := pool.partition(pair)
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, partition, pool.partition(pair))
+		}
+		assert.GreaterOrEqual(t, partition, 0)
+		assert.Less(t, partition, 8)
+	}
+}
+
+func TestWorkerPool_CountsDroppedTrades(t *testing.T) {
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "trades_dropped_total"})
+	pool := NewWorkerPool(1, nil,
+		WithQueueSize(2),
+		WithOverflowPolicy(queue.PolicyDropNewest, ""),
+		WithDropCounter(dropped),
+	)
+
+	trade := &models.RecentTrade{Pair: "BTC_USDT", Price: decimal.RequireFromString("50000.00"), Amount: decimal.RequireFromString("1.5"), Side: "buy"}
+	for i := 0; i < 5; i++ {
+		pool.Submit(context.Background(), trade)
+	}
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(dropped))
+}
@@ -0,0 +1,262 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultChunkCandles = 5000
+	defaultRetries      = 3
+	defaultRetryDelay   = 2 * time.Second
+	saveBatchSize       = 1000
+)
+
+// KlineSource is the part of the exchange client used by the backfill.
+type KlineSource interface {
+	GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error)
+}
+
+// KlineWriter is the part of the kline repository used by the backfill. The
+// candles of the exchange replace the stored ones.
+type KlineWriter interface {
+	ReplaceKlines(ctx context.Context, klines []models.Kline) error
+}
+
+// Job describes the candles to backfill. Timeframes may be given by their
+// exchange names (MINUTE_1) or aliases (1m).
+type Job struct {
+	Pairs      []string
+	TimeFrames []string
+	From       time.Time
+	To         time.Time
+}
+
+// Service loads historical klines chunk by chunk and records a checkpoint
+// after every saved chunk, so an interrupted run resumes where it stopped.
+// Every pair and timeframe is a separate task; tasks run in parallel.
+type Service struct {
+	source      KlineSource
+	klines      KlineWriter
+	checkpoints repository.CheckpointRepository
+
+	workers      int
+	chunkCandles int
+	retries      int
+	retryDelay   time.Duration
+	now          func() time.Time
+}
+
+type Option func(*Service)
+
+// WithWorkers sets how many pair/timeframe tasks run at the same time.
+func WithWorkers(n int) Option {
+	return func(s *Service) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+// WithChunkSize sets how many candles are loaded and checkpointed at once.
+func WithChunkSize(candles int) Option {
+	return func(s *Service) {
+		if candles > 0 {
+			s.chunkCandles = candles
+		}
+	}
+}
+
+// WithRetries sets how many times a failed chunk is retried and the delay
+// before the first retry; the delay doubles after every attempt.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(s *Service) {
+		if retries >= 0 {
+			s.retries = retries
+		}
+		s.retryDelay = delay
+	}
+}
+
+func NewService(source KlineSource, klines KlineWriter, checkpoints repository.CheckpointRepository, opts ...Option) *Service {
+	s := &Service{
+		source:       source,
+		klines:       klines,
+		checkpoints:  checkpoints,
+		workers:      defaultWorkers,
+		chunkCandles: defaultChunkCandles,
+		retries:      defaultRetries,
+		retryDelay:   defaultRetryDelay,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+type task struct {
+	instrument instrument.Instrument
+	pair       string
+	timeframe  timeframe.TimeFrame
+}
+
+// Run backfills every pair and timeframe of the job. A failing task does not
+// stop the others; the errors of all failed tasks are returned together.
+func (s *Service) Run(ctx context.Context, job Job) error {
+	if !job.From.Before(job.To) {
+		return fmt.Errorf("invalid range: from %s is not before to %s", job.From, job.To)
+	}
+
+	instruments, err := instrument.ParseList(job.Pairs)
+	if err != nil {
+		return err
+	}
+	timeframes, err := timeframe.ParseList(job.TimeFrames)
+	if err != nil {
+		return err
+	}
+
+	tasks := make(chan task)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				if err := s.backfill(ctx, t, job.From, job.To); err != nil {
+					log.Printf("Backfill %s %s failed: %v", t.pair, t.timeframe, err)
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s %s: %w", t.pair, t.timeframe, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, inst := range instruments {
+		for _, tf := range timeframes {
+			select {
+			case tasks <- task{instrument: inst, pair: inst.String(), timeframe: tf}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) backfill(ctx context.Context, t task, from, to time.Time) error {
+	startMs := from.UnixMilli()
+
+	// Only closed candles are loaded, so a checkpoint never covers a candle
+	// that may still change.
+	endMs := to.UnixMilli()
+	if closed, _ := t.timeframe.Bounds(s.now().UnixMilli()); endMs > closed {
+		endMs = closed
+	}
+
+	checkpoint := models.BackfillCheckpoint{Pair: t.pair, TimeFrame: t.timeframe.Name, StartTime: startMs, DoneUntil: startMs}
+	saved, err := s.checkpoints.GetCheckpoint(ctx, t.pair, t.timeframe.Name)
+	if err != nil {
+		return fmt.Errorf("get checkpoint error: %w", err)
+	}
+	if saved != nil && saved.StartTime <= startMs && saved.DoneUntil >= startMs {
+		checkpoint = *saved
+		log.Printf("Resuming backfill of %s %s from %s", t.pair, t.timeframe, time.UnixMilli(saved.DoneUntil).UTC())
+	}
+
+	chunk := t.timeframe.Duration.Milliseconds() * int64(s.chunkCandles)
+	for chunkFrom := checkpoint.DoneUntil; chunkFrom < endMs; chunkFrom = checkpoint.DoneUntil {
+		chunkTo := chunkFrom + chunk
+		if chunkTo > endMs {
+			chunkTo = endMs
+		}
+
+		err := s.retry(ctx, func() error {
+			return s.loadChunk(ctx, t, chunkFrom, chunkTo)
+		})
+		if err != nil {
+			return fmt.Errorf("load chunk from %d error: %w", chunkFrom, err)
+		}
+
+		checkpoint.DoneUntil = chunkTo
+		if err := s.checkpoints.SaveCheckpoint(ctx, checkpoint); err != nil {
+			return fmt.Errorf("save checkpoint error: %w", err)
+		}
+	}
+
+	log.Printf("Backfill of %s %s is complete up to %s", t.pair, t.timeframe, time.UnixMilli(checkpoint.DoneUntil).UTC())
+	return nil
+}
+
+// loadChunk loads and saves the candles beginning in [from, to), in unix ms.
+func (s *Service) loadChunk(ctx context.Context, t task, from, to int64) error {
+	klines, err := s.source.GetHistoricalKlines(ctx, t.instrument, t.timeframe, from, to-1)
+	if err != nil {
+		return fmt.Errorf("get historical klines error: %w", err)
+	}
+
+	inRange := klines[:0]
+	for _, kline := range klines {
+		if kline.UtcBegin >= from && kline.UtcBegin < to {
+			kline.IsClosed = true
+			inRange = append(inRange, kline)
+		}
+	}
+
+	for start := 0; start < len(inRange); start += saveBatchSize {
+		end := start + saveBatchSize
+		if end > len(inRange) {
+			end = len(inRange)
+		}
+		if err := s.klines.ReplaceKlines(ctx, inRange[start:end]); err != nil {
+			return fmt.Errorf("save klines error: %w", err)
+		}
+	}
+
+	log.Printf("Backfilled %d klines of %s %s from %s", len(inRange), t.pair, t.timeframe, time.UnixMilli(from).UTC())
+	return nil
+}
+
+func (s *Service) retry(ctx context.Context, fn func() error) error {
+	delay := s.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.retries || ctx.Err() != nil {
+			return err
+		}
+
+		log.Printf("Backfill attempt %d failed: %v, retrying in %s", attempt+1, err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,259 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+// fakeSource returns one MINUTE_1 candle per minute of the requested range
+// and fails the requests for which fail returns true.
+type fakeSource struct {
+	mu       sync.Mutex
+	requests map[string][]int64
+	fail     func(pair string, startTime int64) bool
+}
+
+func (f *fakeSource) GetHistoricalKlines(_ context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error) {
+	pair := inst.String()
+	f.mu.Lock()
+	if f.requests == nil {
+		f.requests = make(map[string][]int64)
+	}
+	f.requests[pair] = append(f.requests[pair], startTime)
+	fail := f.fail
+	f.mu.Unlock()
+
+	if fail != nil && fail(pair, startTime) {
+		return nil, errors.New("exchange unavailable")
+	}
+
+	var klines []models.Kline
+	for ts := startTime; ts <= endTime; ts += time.Minute.Milliseconds() {
+		klines = append(klines, models.Kline{Pair: pair, TimeFrame: tf.Name, UtcBegin: ts, UtcEnd: ts + time.Minute.Milliseconds() - 1})
+	}
+	return klines, nil
+}
+
+func (f *fakeSource) requestsOf(pair string) []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.requests[pair]...)
+}
+
+type memoryKlines struct {
+	mu     sync.Mutex
+	klines map[string]map[int64]models.Kline
+}
+
+func (m *memoryKlines) ReplaceKlines(_ context.Context, klines []models.Kline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.klines == nil {
+		m.klines = make(map[string]map[int64]models.Kline)
+	}
+	for _, kline := range klines {
+		key := kline.Pair + "/" + kline.TimeFrame
+		if m.klines[key] == nil {
+			m.klines[key] = make(map[int64]models.Kline)
+		}
+		m.klines[key][kline.UtcBegin] = kline
+	}
+	return nil
+}
+
+func (m *memoryKlines) begins(pair, timeframe string) []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var begins []int64
+	for begin := range m.klines[pair+"/"+timeframe] {
+		begins = append(begins, begin)
+	}
+	sort.Slice(begins, func(i, j int) bool { return begins[i] < begins[j] })
+	return begins
+}
+
+type memoryCheckpoints struct {
+	mu          sync.Mutex
+	checkpoints map[string]models.BackfillCheckpoint
+}
+
+func (m *memoryCheckpoints) GetCheckpoint(_ context.Context, pair, timeframe string) (*models.BackfillCheckpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	checkpoint, ok := m.checkpoints[pair+"/"+timeframe]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (m *memoryCheckpoints) SaveCheckpoint(_ context.Context, checkpoint models.BackfillCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.checkpoints == nil {
+		m.checkpoints = make(map[string]models.BackfillCheckpoint)
+	}
+	m.checkpoints[checkpoint.Pair+"/"+checkpoint.TimeFrame] = checkpoint
+	return nil
+}
+
+func minutes(from time.Time, n int) []int64 {
+	begins := make([]int64, n)
+	for i := range begins {
+		begins[i] = from.Add(time.Duration(i) * time.Minute).UnixMilli()
+	}
+	return begins
+}
+
+func TestService_Run(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(100 * time.Minute)
+
+	source := &fakeSource{}
+	klines := &memoryKlines{}
+	checkpoints := &memoryCheckpoints{}
+
+	s := NewService(source, klines, checkpoints, WithWorkers(3), WithChunkSize(30), WithRetries(0, 0))
+	err := s.Run(context.Background(), Job{
+		Pairs:      []string{"BTC_USDT", "ETH_USDT"},
+		TimeFrames: []string{"MINUTE_1"},
+		From:       from,
+		To:         to,
+	})
+	require.NoError(t, err)
+
+	for _, pair := range []string{"BTC_USDT", "ETH_USDT"} {
+		assert.Equal(t, minutes(from, 100), klines.begins(pair, "MINUTE_1"))
+		assert.Len(t, source.requestsOf(pair), 4)
+		for _, kline := range klines.klines[pair+"/MINUTE_1"] {
+			assert.True(t, kline.IsClosed, "kline %d is not closed", kline.UtcBegin)
+		}
+
+		checkpoint, err := checkpoints.GetCheckpoint(context.Background(), pair, "MINUTE_1")
+		require.NoError(t, err)
+		require.NotNil(t, checkpoint)
+		assert.Equal(t, from.UnixMilli(), checkpoint.StartTime)
+		assert.Equal(t, to.UnixMilli(), checkpoint.DoneUntil)
+	}
+}
+
+func TestService_ResumesFromCheckpoint(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(100 * time.Minute)
+	broken := from.Add(60 * time.Minute).UnixMilli()
+
+	source := &fakeSource{
+		fail: func(pair string, startTime int64) bool {
+			return pair == "BTC_USDT" && startTime == broken
+		},
+	}
+	klines := &memoryKlines{}
+	checkpoints := &memoryCheckpoints{}
+	job := Job{
+		Pairs:      []string{"BTC_USDT", "ETH_USDT"},
+		TimeFrames: []string{"MINUTE_1"},
+		From:       from,
+		To:         to,
+	}
+
+	s := NewService(source, klines, checkpoints, WithChunkSize(30), WithRetries(1, 0))
+	err := s.Run(context.Background(), job)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "BTC_USDT MINUTE_1")
+
+	// The other pair is not affected by the failure.
+	assert.Equal(t, minutes(from, 100), klines.begins("ETH_USDT", "MINUTE_1"))
+
+	checkpoint, err := checkpoints.GetCheckpoint(context.Background(), "BTC_USDT", "MINUTE_1")
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	assert.Equal(t, from.Add(60*time.Minute).UnixMilli(), checkpoint.DoneUntil)
+	assert.Equal(t, minutes(from, 60), klines.begins("BTC_USDT", "MINUTE_1"))
+
+	source.mu.Lock()
+	source.fail = nil
+	source.requests = nil
+	source.mu.Unlock()
+
+	require.NoError(t, s.Run(context.Background(), job))
+
+	assert.Equal(t, []int64{broken, from.Add(90 * time.Minute).UnixMilli()}, source.requestsOf("BTC_USDT"))
+	assert.Empty(t, source.requestsOf("ETH_USDT"), "a finished task should not be loaded again")
+	assert.Equal(t, minutes(from, 100), klines.begins("BTC_USDT", "MINUTE_1"))
+}
+
+func TestService_RetriesFailedChunk(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var mu sync.Mutex
+	failures := 2
+	source := &fakeSource{
+		fail: func(string, int64) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			failures--
+			return failures >= 0
+		},
+	}
+	klines := &memoryKlines{}
+
+	s := NewService(source, klines, &memoryCheckpoints{}, WithRetries(2, time.Millisecond))
+	err := s.Run(context.Background(), Job{
+		Pairs:      []string{"BTC_USDT"},
+		TimeFrames: []string{"MINUTE_1"},
+		From:       from,
+		To:         from.Add(10 * time.Minute),
+	})
+	require.NoError(t, err)
+	assert.Len(t, source.requestsOf("BTC_USDT"), 3)
+	assert.Equal(t, minutes(from, 10), klines.begins("BTC_USDT", "MINUTE_1"))
+}
+
+func TestService_SkipsOpenCandles(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := from.Add(10*time.Minute + 30*time.Second)
+
+	klines := &memoryKlines{}
+	checkpoints := &memoryCheckpoints{}
+
+	s := NewService(&fakeSource{}, klines, checkpoints)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.Run(context.Background(), Job{
+		Pairs:      []string{"BTC_USDT"},
+		TimeFrames: []string{"MINUTE_1"},
+		From:       from,
+		To:         from.Add(time.Hour),
+	}))
+
+	assert.Equal(t, minutes(from, 10), klines.begins("BTC_USDT", "MINUTE_1"))
+	checkpoint, err := checkpoints.GetCheckpoint(context.Background(), "BTC_USDT", "MINUTE_1")
+	require.NoError(t, err)
+	assert.Equal(t, from.Add(10*time.Minute).UnixMilli(), checkpoint.DoneUntil)
+}
+
+func TestService_RejectsEmptyRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewService(&fakeSource{}, &memoryKlines{}, &memoryCheckpoints{})
+
+	err := s.Run(context.Background(), Job{Pairs: []string{"BTC_USDT"}, TimeFrames: []string{"MINUTE_1"}, From: from, To: from})
+	assert.Error(t, err)
+
+	err = s.Run(context.Background(), Job{Pairs: []string{"BTC_USDT"}, TimeFrames: []string{"MINUTE_2"}, From: from, To: from.Add(time.Hour)})
+	assert.Error(t, err)
+}
@@ -2,118 +2,438 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
 	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/internal/infrastructure/metrics"
 	"github.com/Zmey56/poloniex-collector/internal/service"
 )
 
+// historicalBatchSize is the number of historical klines saved at once.
+const historicalBatchSize = 1000
+
+// storedTidsPageSize is the number of stored trades read at once when
+// filling a gap.
+const storedTidsPageSize = 1000
+
+// TradeListener is notified about every received trade, including the trades
+// loaded to fill a gap after a reconnect. Trades are stored asynchronously,
+// so a trade may reach the listener before it is stored. OnTrade is called
+// from the trade loop and must not block.
+type TradeListener interface {
+	OnTrade(trade models.RecentTrade)
+}
+
 type Service struct {
-	tradeRepo  repository.TradeRepository
-	klineRepo  repository.KlineRepository
-	exchange   repository.ExchangeClient
-	workerPool *service.WorkerPool
+	tradeRepo      repository.TradeRepository
+	klineRepo      repository.KlineRepository
+	tickerRepo     repository.TickerRepository
+	exchange       repository.ExchangeClient
+	klineProcessor *service.KlineProcessor
+	workerPool     *service.WorkerPool
+	tradeWriter    *service.TradeWriter
+	pairs          []string
+	timeframes     []timeframe.TimeFrame
+	tradeListeners []TradeListener
+}
+
+type options struct {
+	pairs          []string
+	timeframes     []timeframe.TimeFrame
+	processorOpts  []service.KlineProcessorOption
+	poolOpts       []service.WorkerPoolOption
+	writerOpts     []service.TradeWriterOption
+	tradeListeners []TradeListener
+}
+
+type Option func(*options)
+
+// WithPairs sets the pairs collected by the service.
+func WithPairs(pairs []string) Option {
+	return func(o *options) {
+		o.pairs = pairs
+	}
+}
+
+// WithTimeFrames sets the timeframes klines are built and caught up for.
+func WithTimeFrames(timeframes []timeframe.TimeFrame) Option {
+	return func(o *options) {
+		o.timeframes = timeframes
+		o.processorOpts = append(o.processorOpts, service.WithTimeFrames(timeframes))
+	}
+}
+
+// WithFlushInterval sets how often the in-memory klines and the buffered
+// trades are flushed to the repositories.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.processorOpts = append(o.processorOpts, service.WithFlushInterval(interval))
+		o.writerOpts = append(o.writerOpts, service.WithTradeFlushInterval(interval))
+	}
+}
+
+// WithBatchSize sets the maximum number of klines and trades written to the
+// repositories at once.
+func WithBatchSize(size int) Option {
+	return func(o *options) {
+		o.processorOpts = append(o.processorOpts, service.WithBatchSize(size))
+		o.writerOpts = append(o.writerOpts, service.WithTradeBatchSize(size))
+	}
+}
+
+// WithMaxPendingTrades sets how many trades wait for writing at most before
+// the oldest are dropped.
+func WithMaxPendingTrades(max int) Option {
+	return func(o *options) {
+		o.writerOpts = append(o.writerOpts, service.WithMaxPendingTrades(max))
+	}
+}
+
+// WithCascade builds only 1m klines from trades and rolls the other
+// timeframes up from them.
+func WithCascade() Option {
+	return func(o *options) {
+		o.processorOpts = append(o.processorOpts, service.WithCascade())
+	}
+}
+
+// WithKlineListener adds a listener notified about every candle change.
+func WithKlineListener(listener service.KlineListener) Option {
+	return func(o *options) {
+		o.processorOpts = append(o.processorOpts, service.WithKlineListener(listener))
+	}
+}
+
+// WithTradeListener adds a listener notified about every received trade,
+// before the trade is written asynchronously.
+func WithTradeListener(listener TradeListener) Option {
+	return func(o *options) {
+		o.tradeListeners = append(o.tradeListeners, listener)
+	}
+}
+
+// WithWorkerPoolOptions configures the worker pool queues, e.g. their overflow policy.
+func WithWorkerPoolOptions(opts ...service.WorkerPoolOption) Option {
+	return func(o *options) {
+		o.poolOpts = append(o.poolOpts, opts...)
+	}
+}
+
+// WithMetrics sets the metrics updated by the kline processor, the worker
+// pool and the trade writer.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) {
+		o.processorOpts = append(o.processorOpts, service.WithProcessorMetrics(m))
+		o.poolOpts = append(o.poolOpts, service.WithPoolMetrics(m))
+		o.writerOpts = append(o.writerOpts, service.WithWriterMetrics(m))
+	}
 }
 
 func NewService(
 	tradeRepo repository.TradeRepository,
 	klineRepo repository.KlineRepository,
+	tickerRepo repository.TickerRepository,
 	exchange repository.ExchangeClient,
 	numWorkers int,
+	opts ...Option,
 ) *Service {
-	klineProcessor := service.NewKlineProcessor(klineRepo)
+	o := options{timeframes: timeframe.MustParseList(timeframe.Default)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	klineProcessor := service.NewKlineProcessor(klineRepo, o.processorOpts...)
 
-	workerPool := service.NewWorkerPool(numWorkers, klineProcessor)
+	workerPool := service.NewWorkerPool(numWorkers, klineProcessor, o.poolOpts...)
 
 	return &Service{
-		tradeRepo:  tradeRepo,
-		klineRepo:  klineRepo,
-		exchange:   exchange,
-		workerPool: workerPool,
+		tradeRepo:      tradeRepo,
+		klineRepo:      klineRepo,
+		tickerRepo:     tickerRepo,
+		exchange:       exchange,
+		klineProcessor: klineProcessor,
+		workerPool:     workerPool,
+		tradeWriter:    service.NewTradeWriter(tradeRepo, o.writerOpts...),
+		pairs:          o.pairs,
+		timeframes:     o.timeframes,
+		tradeListeners: o.tradeListeners,
 	}
 }
 
 func (s *Service) Run(ctx context.Context) error {
-	s.workerPool.Start(ctx)
-	log.Println("Worker pool started")
-
-	pairs := []string{"BTC_USDT", "ETH_USDT", "TRX_USDT", "DOGE_USDT", "BCH_USDT"}
+	if len(s.pairs) == 0 {
+		return fmt.Errorf("no pairs configured")
+	}
+	instruments, err := instrument.ParseList(s.pairs)
+	if err != nil {
+		return err
+	}
+	pairs := instrument.Strings(instruments)
 
-	if err := s.loadHistoricalData(ctx, pairs); err != nil {
+	if err := s.loadHistoricalData(ctx, instruments); err != nil {
 		return fmt.Errorf("load historical data error: %w", err)
 	}
 
-	trades, err := s.exchange.SubscribeToTrades(ctx, pairs)
+	if err := s.klineProcessor.Restore(ctx, pairs); err != nil {
+		return fmt.Errorf("restore klines error: %w", err)
+	}
+
+	go s.klineProcessor.Run(ctx)
+	go s.tradeWriter.Run(ctx)
+
+	s.workerPool.Start(ctx)
+	log.Println("Worker pool started")
+
+	trades, err := s.exchange.SubscribeToTrades(ctx, instruments)
 	if err != nil {
 		return fmt.Errorf("subscribe to trades error: %w", err)
 	}
 
+	var tickersDone sync.WaitGroup
+	if tickerClient, ok := s.exchange.(repository.TickerClient); ok {
+		tickers, err := tickerClient.SubscribeToTickers(ctx, pairs)
+		if err != nil {
+			return fmt.Errorf("subscribe to tickers error: %w", err)
+		}
+
+		tickersDone.Add(1)
+		go func() {
+			defer tickersDone.Done()
+			s.saveTickers(ctx, tickers)
+		}()
+	} else {
+		log.Printf("%s does not stream tickers, tickers are not collected", s.exchange.Name())
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Context cancelled, stopping service")
+			tickersDone.Wait()
 			s.workerPool.Stop()
+			if err := s.klineProcessor.Flush(context.Background()); err != nil {
+				log.Printf("Error flushing klines on shutdown: %v", err)
+			}
+			if err := s.tradeWriter.Flush(context.Background()); err != nil {
+				log.Printf("Error writing trades on shutdown: %v, %d trades lost", err, s.tradeWriter.Len())
+			}
 			return ctx.Err()
 		case trade, ok := <-trades:
 			if !ok {
 				return fmt.Errorf("trade channel closed")
 			}
 
-			if err := s.tradeRepo.SaveTrade(ctx, trade); err != nil {
-				log.Printf("Error saving trade: %v", err)
-				continue
+			if trade.Reconnected {
+				s.fillTradeGap(ctx, trade)
 			}
 
-			if ok := s.workerPool.Submit(&trade); !ok {
-				log.Printf("Failed to submit trade to worker pool: queue is full")
+			s.tradeWriter.Add(trade)
+			s.notifyTrade(trade)
+
+			if ok := s.workerPool.Submit(ctx, &trade); !ok {
+				log.Printf("Failed to submit trade to worker pool: trade dropped")
 			}
 		}
 	}
 }
 
-func (s *Service) loadHistoricalData(ctx context.Context, pairs []string) error {
+// fillTradeGap loads the trades missed between the last stored trade of the
+// pair and first, the first trade received after the stream (re)connected.
+// The missed trades are saved and queued before first so that the klines see
+// them in order. It returns the number of queued trades.
+func (s *Service) fillTradeGap(ctx context.Context, first models.RecentTrade) int {
+	// Buffered trades would look missing and reach the klines twice. Trades
+	// rejected by the repository are not missing, they are retried.
+	var rejected *repository.TradeWriteError
+	if err := s.tradeWriter.Flush(ctx); err != nil && !errors.As(err, &rejected) {
+		log.Printf("Error writing trades before filling the gap of %s: %v", first.Pair, err)
+		return 0
+	}
+
+	last, err := s.tradeRepo.GetLastTradeTime(ctx, first.Pair)
+	if err != nil {
+		log.Printf("Error getting last trade time for %s: %v", first.Pair, err)
+		return 0
+	}
+	if last == 0 || last >= first.Timestamp {
+		return 0
+	}
+
+	inst, err := instrument.Parse(first.Pair)
+	if err != nil {
+		log.Printf("Error filling the trade gap: %v", err)
+		return 0
+	}
+
+	trades, err := s.exchange.GetHistoricalTrades(ctx, inst, last, first.Timestamp)
+	var incomplete *repository.IncompleteTradesError
+	if errors.As(err, &incomplete) {
+		log.Printf("Repairing the klines of %s from the exchange: %v", first.Pair, err)
+		s.repairKlines(ctx, inst, incomplete.From, incomplete.Oldest)
+	} else if err != nil {
+		log.Printf("Error getting missed trades for %s: %v", first.Pair, err)
+		return 0
+	}
+
+	// Trades at the last stored timestamp may already be stored; the
+	// repository ignores those, but they must not reach the klines twice.
+	seen, err := s.storedTids(ctx, first.Pair, last, first.Timestamp)
+	if err != nil {
+		log.Printf("Error getting stored trades of %s: %v", first.Pair, err)
+		return 0
+	}
+	seen[first.Tid] = struct{}{}
+
+	missed := make([]models.RecentTrade, 0, len(trades))
+	for _, trade := range trades {
+		if _, ok := seen[trade.Tid]; ok {
+			continue
+		}
+		seen[trade.Tid] = struct{}{}
+		missed = append(missed, trade)
+	}
+	if len(missed) == 0 {
+		return 0
+	}
+
+	s.tradeWriter.Add(missed...)
+
+	queued := 0
+	for i := range missed {
+		s.notifyTrade(missed[i])
+		if s.workerPool.Submit(ctx, &missed[i]) {
+			queued++
+		}
+	}
+
+	log.Printf("Filled a gap of %d trades for %s", queued, first.Pair)
+	return queued
+}
+
+// repairKlines replaces the candles of inst that end after from and at or
+// before to, which cannot be built from the trades the exchange still serves,
+// with the candles of the exchange. It must be called before the trades made
+// after to are queued.
+func (s *Service) repairKlines(ctx context.Context, inst instrument.Instrument, from, to int64) {
+	var klines []models.Kline
+	for _, tf := range s.timeframes {
+		begin, _ := tf.Bounds(from)
+		history, err := s.exchange.GetHistoricalKlines(ctx, inst, tf, begin, to)
+		if err != nil {
+			log.Printf("Error getting klines to repair for %s %s: %v", inst, tf.Name, err)
+			continue
+		}
+		for _, kline := range history {
+			if _, end := tf.Bounds(kline.UtcBegin); end <= to {
+				klines = append(klines, kline)
+			}
+		}
+	}
+	s.klineProcessor.Repair(klines)
+}
+
+// storedTids returns the ids of the stored trades of the pair made between
+// start and end inclusive.
+func (s *Service) storedTids(ctx context.Context, pair string, start, end int64) (map[string]struct{}, error) {
+	tids := make(map[string]struct{})
+	afterTid := ""
+	for {
+		trades, err := s.tradeRepo.GetTradesByTimeRange(ctx, pair, start, end, afterTid, storedTidsPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, trade := range trades {
+			tids[trade.Tid] = struct{}{}
+		}
+		if len(trades) < storedTidsPageSize {
+			return tids, nil
+		}
+		start, afterTid = trades[len(trades)-1].Timestamp, trades[len(trades)-1].Tid
+	}
+}
+
+func (s *Service) notifyTrade(trade models.RecentTrade) {
+	for _, listener := range s.tradeListeners {
+		listener.OnTrade(trade)
+	}
+}
+
+// saveTickers stores every received ticker until the ticker stream is closed.
+func (s *Service) saveTickers(ctx context.Context, tickers <-chan models.Ticker) {
+	for ticker := range tickers {
+		if err := s.tickerRepo.SaveTicker(ctx, ticker); err != nil && ctx.Err() == nil {
+			log.Printf("Error saving ticker %s: %v", ticker.Pair, err)
+		}
+	}
+}
+
+// loadHistoricalData catches up the klines missed while the collector was
+// stopped. Pairs without any klines are left to cmd/backfill, and a failing
+// pair is logged and skipped so it does not keep the collector from starting.
+func (s *Service) loadHistoricalData(ctx context.Context, instruments []instrument.Instrument) error {
 	log.Println("Loading historical data...")
-	timeframes := []string{"MINUTE_1", "MINUTE_15", "HOUR_1", "DAY_1"}
-	endTime := time.Now().Unix()
-
-	for _, pair := range pairs {
-		for _, timeframe := range timeframes {
-			lastKline, err := s.klineRepo.GetLastKline(ctx, pair, timeframe)
-
-			var startTime int64
-			if err == nil && lastKline != nil {
-				startTime = lastKline.UtcEnd
-				log.Printf("Found last kline for %s %s at %v, continuing from there",
-					pair, timeframe, startTime)
-			} else {
-				startTime = 1701388800 // 2024-12-01 00:00:00 UTC
-				log.Printf("No previous klines found for %s %s, starting from 2024-12-01",
-					pair, timeframe)
+	endTime := time.Now().UnixMilli()
+
+	for _, inst := range instruments {
+		pair := inst.String()
+		for _, tf := range s.timeframes {
+			lastKline, err := s.klineRepo.GetLastKline(ctx, pair, tf.Name)
+			if err != nil {
+				log.Printf("Error getting last kline for %s %s: %v", pair, tf.Name, err)
+				continue
+			}
+			if lastKline == nil {
+				log.Printf("No previous klines found for %s %s, use cmd/backfill to load the history",
+					pair, tf.Name)
+				continue
 			}
 
+			startTime := lastKline.UtcEnd
+			log.Printf("Found last kline for %s %s at %v, continuing from there",
+				pair, tf.Name, time.UnixMilli(startTime).UTC())
+
 			if startTime >= endTime {
-				log.Printf("No new data for %s %s", pair, timeframe)
+				log.Printf("No new data for %s %s", pair, tf.Name)
 				continue
 			}
 
-			klines, err := s.exchange.GetHistoricalKlines(ctx, pair, timeframe, startTime, endTime)
+			klines, err := s.exchange.GetHistoricalKlines(ctx, inst, tf, startTime, endTime)
 			if err != nil {
-				return fmt.Errorf("get historical klines error: %w", err)
+				log.Printf("Error getting historical klines for %s %s: %v", pair, tf.Name, err)
+				continue
 			}
 
-			log.Printf("Received %d klines for %s %s", len(klines), pair, timeframe)
+			log.Printf("Received %d klines for %s %s", len(klines), pair, tf.Name)
+
+			// All but the current candle are over.
+			for i := range klines {
+				klines[i].IsClosed = klines[i].UtcEnd <= endTime
+			}
 
-			for _, kline := range klines {
-				log.Printf("Saving get historical klines: %+v", kline)
-				if err := s.klineRepo.SaveKline(ctx, kline); err != nil {
-					return fmt.Errorf("save kline error: %w", err)
+			for start := 0; start < len(klines); start += historicalBatchSize {
+				end := start + historicalBatchSize
+				if end > len(klines) {
+					end = len(klines)
+				}
+				if err := s.klineRepo.SaveKlines(ctx, klines[start:end]); err != nil {
+					log.Printf("Error saving klines for %s %s: %v", pair, tf.Name, err)
+					break
 				}
 			}
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	log.Println("Historical data loaded successfully")
 	return nil
 }
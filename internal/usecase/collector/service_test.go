@@ -1 +1,161 @@
 package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/instrument"
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/repository"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+	"github.com/Zmey56/poloniex-collector/test/mocks"
+)
+
+var btcUSDT = instrument.New("BTC", "USDT")
+
+type serviceMocks struct {
+	trades   *mocks.MockTradeRepository
+	exchange *mocks.MockExchangeClient
+}
+
+type tradeRecorder struct {
+	trades []models.RecentTrade
+}
+
+func (r *tradeRecorder) OnTrade(trade models.RecentTrade) {
+	r.trades = append(r.trades, trade)
+}
+
+func newTestService(t *testing.T, opts ...Option) (*Service, serviceMocks) {
+	ctrl := gomock.NewController(t)
+
+	m := serviceMocks{
+		trades:   mocks.NewMockTradeRepository(ctrl),
+		exchange: mocks.NewMockExchangeClient(ctrl),
+	}
+	s := NewService(m.trades, mocks.NewMockKlineRepository(ctrl), mocks.NewMockTickerRepository(ctrl), m.exchange, 1, opts...)
+	return s, m
+}
+
+func TestService_FillTradeGap(t *testing.T) {
+	listener := &tradeRecorder{}
+	s, m := newTestService(t, WithTradeListener(listener))
+	ctx := context.Background()
+
+	first := models.RecentTrade{Tid: "105", Pair: "BTC_USDT", Timestamp: 5000, Reconnected: true}
+
+	m.trades.EXPECT().GetLastTradeTime(ctx, "BTC_USDT").Return(int64(1000), nil)
+	m.exchange.EXPECT().GetHistoricalTrades(ctx, btcUSDT, int64(1000), int64(5000)).Return([]models.RecentTrade{
+		{Tid: "100", Pair: "BTC_USDT", Timestamp: 1000},
+		{Tid: "099", Pair: "BTC_USDT", Timestamp: 1000},
+		{Tid: "101", Pair: "BTC_USDT", Timestamp: 2000},
+		{Tid: "102", Pair: "BTC_USDT", Timestamp: 3000},
+		{Tid: "102", Pair: "BTC_USDT", Timestamp: 3000},
+		{Tid: "105", Pair: "BTC_USDT", Timestamp: 5000},
+	}, nil)
+	// Only trade 100 of the last stored millisecond is stored.
+	m.trades.EXPECT().GetTradesByTimeRange(ctx, "BTC_USDT", int64(1000), int64(5000), "", storedTidsPageSize).Return([]models.RecentTrade{
+		{Tid: "100", Pair: "BTC_USDT", Timestamp: 1000},
+	}, nil)
+
+	assert.Equal(t, 3, s.fillTradeGap(ctx, first))
+	assert.Equal(t, 3, s.workerPool.Len())
+
+	// The missed trades are stored with the next batch.
+	m.trades.EXPECT().SaveTrades(ctx, []models.RecentTrade{
+		{Tid: "099", Pair: "BTC_USDT", Timestamp: 1000},
+		{Tid: "101", Pair: "BTC_USDT", Timestamp: 2000},
+		{Tid: "102", Pair: "BTC_USDT", Timestamp: 3000},
+	}).Return(nil)
+	require.NoError(t, s.tradeWriter.Flush(ctx))
+	assert.Equal(t, []models.RecentTrade{
+		{Tid: "099", Pair: "BTC_USDT", Timestamp: 1000},
+		{Tid: "101", Pair: "BTC_USDT", Timestamp: 2000},
+		{Tid: "102", Pair: "BTC_USDT", Timestamp: 3000},
+	}, listener.trades)
+}
+
+type klineRecorder struct {
+	klines []models.Kline
+}
+
+func (r *klineRecorder) OnKline(kline models.Kline, closed bool) {
+	if closed {
+		r.klines = append(r.klines, kline)
+	}
+}
+
+func TestService_FillTradeGap_RepairsKlines(t *testing.T) {
+	klines := &klineRecorder{}
+	minute1 := timeframe.MustParseList([]string{"1m"})
+	s, m := newTestService(t, WithTimeFrames(minute1), WithKlineListener(klines))
+	ctx := context.Background()
+
+	base := int64(1700000040000)
+	minute := int64(60000)
+	first := models.RecentTrade{Tid: "400", Pair: "BTC_USDT", Timestamp: base + 3*minute, Reconnected: true}
+	oldest := base + 2*minute + 30000
+
+	m.trades.EXPECT().GetLastTradeTime(ctx, "BTC_USDT").Return(base+10000, nil)
+	m.exchange.EXPECT().GetHistoricalTrades(ctx, btcUSDT, base+10000, first.Timestamp).Return([]models.RecentTrade{
+		{Tid: "300", Pair: "BTC_USDT", Timestamp: oldest},
+	}, &repository.IncompleteTradesError{Pair: "BTC_USDT", From: base + 10000, Oldest: oldest})
+	m.exchange.EXPECT().GetHistoricalKlines(ctx, btcUSDT, minute1[0], base, oldest).Return([]models.Kline{
+		{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: base, UtcEnd: base + minute - 1, TradeCount: 5},
+		{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: base + minute, UtcEnd: base + 2*minute - 1, TradeCount: 3},
+		{Pair: "BTC_USDT", TimeFrame: "MINUTE_1", UtcBegin: base + 2*minute, UtcEnd: base + 3*minute - 1, TradeCount: 1},
+	}, nil)
+	m.trades.EXPECT().GetTradesByTimeRange(ctx, "BTC_USDT", base+10000, first.Timestamp, "", storedTidsPageSize).Return(nil, nil)
+
+	// The trades that are still served are queued as usual.
+	assert.Equal(t, 1, s.fillTradeGap(ctx, first))
+
+	// The candles that ended before the oldest served trade are taken from
+	// the exchange; the one it falls into is built from the trades.
+	require.Len(t, klines.klines, 2)
+	assert.Equal(t, base, klines.klines[0].UtcBegin)
+	assert.Equal(t, int64(5), klines.klines[0].TradeCount)
+	assert.Equal(t, base+minute, klines.klines[1].UtcBegin)
+}
+
+func TestService_FillTradeGap_NothingToFill(t *testing.T) {
+	ctx := context.Background()
+	first := models.RecentTrade{Tid: "105", Pair: "BTC_USDT", Timestamp: 5000, Reconnected: true}
+
+	t.Run("no stored trades", func(t *testing.T) {
+		s, m := newTestService(t)
+		m.trades.EXPECT().GetLastTradeTime(ctx, "BTC_USDT").Return(int64(0), nil)
+
+		assert.Equal(t, 0, s.fillTradeGap(ctx, first))
+	})
+
+	t.Run("no gap", func(t *testing.T) {
+		s, m := newTestService(t)
+		m.trades.EXPECT().GetLastTradeTime(ctx, "BTC_USDT").Return(int64(5000), nil)
+
+		assert.Equal(t, 0, s.fillTradeGap(ctx, first))
+	})
+
+	t.Run("buffered trades not stored", func(t *testing.T) {
+		s, m := newTestService(t)
+		s.tradeWriter.Add(models.RecentTrade{Tid: "104", Pair: "BTC_USDT", Timestamp: 4000})
+		m.trades.EXPECT().SaveTrades(ctx, gomock.Len(1)).Return(errors.New("connection refused"))
+
+		assert.Equal(t, 0, s.fillTradeGap(ctx, first))
+		assert.Equal(t, 1, s.tradeWriter.Len())
+	})
+
+	t.Run("exchange error", func(t *testing.T) {
+		s, m := newTestService(t)
+		m.trades.EXPECT().GetLastTradeTime(ctx, "BTC_USDT").Return(int64(1000), nil)
+		m.exchange.EXPECT().GetHistoricalTrades(ctx, btcUSDT, int64(1000), int64(5000)).Return(nil, errors.New("unavailable"))
+
+		assert.Equal(t, 0, s.fillTradeGap(ctx, first))
+		assert.Equal(t, 0, s.workerPool.Len())
+	})
+}
@@ -0,0 +1,252 @@
+// Package query reads stored klines and trades page by page. It holds the
+// paging rules shared by the HTTP and gRPC APIs.
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Zmey56/poloniex-collector/internal/domain/models"
+	"github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
+)
+
+const (
+	DefaultLimit = 500
+	MaxLimit     = 1000
+)
+
+// InvalidArgumentError is returned for a query that cannot be served.
+type InvalidArgumentError struct {
+	Message string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return e.Message
+}
+
+// IsInvalidArgument reports whether err was caused by a bad query.
+func IsInvalidArgument(err error) bool {
+	var target *InvalidArgumentError
+	return errors.As(err, &target)
+}
+
+// KlineReader is the part of repository.KlineRepository used by the service.
+type KlineReader interface {
+	GetKlinesByTimeRange(ctx context.Context, pair, timeFrame string, startTime, endTime int64) ([]models.Kline, error)
+}
+
+// TradeReader is the part of repository.TradeRepository used by the service.
+type TradeReader interface {
+	GetTradesByTimeRange(ctx context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error)
+}
+
+// KlineQuery selects klines of one pair and timeframe. Times are unix ms.
+// Zero From, To and Limit select their defaults: To is the end of the last
+// closed candle, From is Limit candles before To, Limit is DefaultLimit.
+// Cursor, when set, replaces From.
+type KlineQuery struct {
+	Pair      string
+	TimeFrame string
+	From      int64
+	To        int64
+	Limit     int
+	Cursor    string
+}
+
+// TradeQuery selects trades of one pair. Times are unix ms. Zero To selects
+// now and zero Limit selects DefaultLimit. Cursor, when set, replaces From.
+type TradeQuery struct {
+	Pair   string
+	From   int64
+	To     int64
+	Limit  int
+	Cursor string
+}
+
+// KlinePage is one page of klines; NextCursor is empty on the last page.
+type KlinePage struct {
+	Klines     []models.Kline
+	NextCursor string
+}
+
+// TradePage is one page of trades, oldest first; NextCursor is empty on the
+// last page.
+type TradePage struct {
+	Trades     []models.RecentTrade
+	NextCursor string
+}
+
+type Service struct {
+	klines KlineReader
+	trades TradeReader
+	now    func() time.Time
+}
+
+type Option func(*Service)
+
+// WithClock sets the clock the default time ranges are derived from.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(klines KlineReader, trades TradeReader, opts ...Option) *Service {
+	s := &Service{
+		klines: klines,
+		trades: trades,
+		now:    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Klines returns a page of klines.
+//
+// A page covers the time span of Limit candles starting at From (or at the
+// cursor), so a page over a gap in the data may be short or even empty while
+// NextCursor is still set; callers keep following NextCursor until it is
+// empty.
+func (s *Service) Klines(ctx context.Context, q KlineQuery) (KlinePage, error) {
+	if q.Pair == "" {
+		return KlinePage{}, invalid("pair is required")
+	}
+	if q.TimeFrame == "" {
+		return KlinePage{}, invalid("timeframe is required")
+	}
+	tf, err := timeframe.Parse(q.TimeFrame)
+	if err != nil {
+		return KlinePage{}, invalid(err.Error())
+	}
+	limit, err := checkLimit(q.Limit)
+	if err != nil {
+		return KlinePage{}, err
+	}
+
+	span := int64(limit) * tf.Duration.Milliseconds()
+
+	to := q.To
+	if to == 0 {
+		to, _ = tf.Bounds(s.now().UnixMilli())
+	}
+	from := q.From
+	if from == 0 {
+		from = max(to-span, 0)
+	}
+	if q.Cursor != "" {
+		next, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return KlinePage{}, err
+		}
+		from = next.Time
+	}
+	if from >= to {
+		return KlinePage{}, invalid("from must be before to")
+	}
+
+	// Start at the candle containing from so it is not cut off.
+	from, _ = tf.Bounds(from)
+
+	end := min(from+span, to)
+	klines, err := s.klines.GetKlinesByTimeRange(ctx, q.Pair, tf.Name, from, end)
+	if err != nil {
+		return KlinePage{}, fmt.Errorf("load klines: %w", err)
+	}
+	if len(klines) > limit {
+		klines = klines[:limit]
+		end = klines[limit-1].UtcEnd
+	}
+
+	page := KlinePage{Klines: klines}
+	if end < to {
+		page.NextCursor = cursor{Time: end}.encode()
+	}
+	return page, nil
+}
+
+// Trades returns a page of trades.
+func (s *Service) Trades(ctx context.Context, q TradeQuery) (TradePage, error) {
+	if q.Pair == "" {
+		return TradePage{}, invalid("pair is required")
+	}
+	limit, err := checkLimit(q.Limit)
+	if err != nil {
+		return TradePage{}, err
+	}
+
+	from, to := q.From, q.To
+	if to == 0 {
+		to = s.now().UnixMilli()
+	}
+	var afterTid string
+	if q.Cursor != "" {
+		next, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return TradePage{}, err
+		}
+		from, afterTid = next.Time, next.Tid
+	}
+	if from > to {
+		return TradePage{}, invalid("from must not be after to")
+	}
+
+	// One extra row tells whether there is a next page.
+	trades, err := s.trades.GetTradesByTimeRange(ctx, q.Pair, from, to, afterTid, limit+1)
+	if err != nil {
+		return TradePage{}, fmt.Errorf("load trades: %w", err)
+	}
+
+	page := TradePage{Trades: trades}
+	if len(trades) > limit {
+		page.Trades = trades[:limit]
+		last := trades[limit-1]
+		page.NextCursor = cursor{Time: last.Timestamp, Tid: last.Tid}.encode()
+	}
+	return page, nil
+}
+
+func checkLimit(limit int) (int, error) {
+	if limit == 0 {
+		return DefaultLimit, nil
+	}
+	if limit < 0 || limit > MaxLimit {
+		return 0, invalid(fmt.Sprintf("limit must be between 1 and %d", MaxLimit))
+	}
+	return limit, nil
+}
+
+func invalid(message string) error {
+	return &InvalidArgumentError{Message: message}
+}
+
+// cursor is the position the next page starts from. It is handed to clients
+// as opaque base64 JSON so the encoding can change without breaking them.
+type cursor struct {
+	Time int64  `json:"t"`
+	Tid  string `json:"id,omitempty"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, invalid("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, invalid("invalid cursor")
+	}
+	return c, nil
+}
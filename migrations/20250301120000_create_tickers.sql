@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tickers (
+                        id BIGSERIAL PRIMARY KEY,
+                        pair VARCHAR(20) NOT NULL,
+                        last DECIMAL(20, 8) NOT NULL,
+                        bid DECIMAL(20, 8) NOT NULL,
+                        ask DECIMAL(20, 8) NOT NULL,
+                        open DECIMAL(20, 8) NOT NULL,
+                        high DECIMAL(20, 8) NOT NULL,
+                        low DECIMAL(20, 8) NOT NULL,
+                        volume DECIMAL(30, 8) NOT NULL,
+                        quote_volume DECIMAL(30, 8) NOT NULL,
+                        change DECIMAL(20, 8) NOT NULL,
+                        trade_count BIGINT NOT NULL,
+                        timestamp BIGINT NOT NULL,
+                        created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                        UNIQUE(pair, timestamp)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS tickers;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS backfill_checkpoints (
+                        pair VARCHAR(20) NOT NULL,
+                        interval VARCHAR(10) NOT NULL,
+                        start_time BIGINT NOT NULL,
+                        done_until BIGINT NOT NULL,
+                        updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                        PRIMARY KEY (pair, interval)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS backfill_checkpoints;
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE trades ADD COLUMN exchange VARCHAR(20) NOT NULL DEFAULT 'poloniex';
+ALTER TABLE trades ALTER COLUMN exchange DROP DEFAULT;
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_tid_pair_key;
+ALTER TABLE trades ADD CONSTRAINT trades_exchange_pair_tid_key UNIQUE (exchange, pair, tid);
+DROP INDEX IF EXISTS idx_trades_pair_tid;
+DROP INDEX IF EXISTS idx_trades_pair_timestamp;
+CREATE INDEX idx_trades_exchange_pair_timestamp ON trades(exchange, pair, timestamp);
+
+ALTER TABLE klines ADD COLUMN exchange VARCHAR(20) NOT NULL DEFAULT 'poloniex';
+ALTER TABLE klines ALTER COLUMN exchange DROP DEFAULT;
+ALTER TABLE klines DROP CONSTRAINT IF EXISTS klines_pair_interval_utc_begin_key;
+ALTER TABLE klines ADD CONSTRAINT klines_exchange_pair_interval_utc_begin_key UNIQUE (exchange, pair, interval, utc_begin);
+DROP INDEX IF EXISTS idx_klines_pair_timeframe_utc;
+
+ALTER TABLE backfill_checkpoints ADD COLUMN exchange VARCHAR(20) NOT NULL DEFAULT 'poloniex';
+ALTER TABLE backfill_checkpoints ALTER COLUMN exchange DROP DEFAULT;
+ALTER TABLE backfill_checkpoints DROP CONSTRAINT IF EXISTS backfill_checkpoints_pkey;
+ALTER TABLE backfill_checkpoints ADD PRIMARY KEY (exchange, pair, interval);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Only the Poloniex data fits the old unique keys.
+DELETE FROM trades WHERE exchange <> 'poloniex';
+DELETE FROM klines WHERE exchange <> 'poloniex';
+DELETE FROM backfill_checkpoints WHERE exchange <> 'poloniex';
+
+ALTER TABLE backfill_checkpoints DROP CONSTRAINT IF EXISTS backfill_checkpoints_pkey;
+ALTER TABLE backfill_checkpoints ADD PRIMARY KEY (pair, interval);
+ALTER TABLE backfill_checkpoints DROP COLUMN exchange;
+
+ALTER TABLE klines DROP CONSTRAINT IF EXISTS klines_exchange_pair_interval_utc_begin_key;
+ALTER TABLE klines ADD CONSTRAINT klines_pair_interval_utc_begin_key UNIQUE (pair, interval, utc_begin);
+CREATE INDEX idx_klines_pair_timeframe_utc ON klines(pair, interval, utc_begin);
+ALTER TABLE klines DROP COLUMN exchange;
+
+DROP INDEX IF EXISTS idx_trades_exchange_pair_timestamp;
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_exchange_pair_tid_key;
+ALTER TABLE trades ADD CONSTRAINT trades_tid_pair_key UNIQUE (tid, pair);
+CREATE INDEX idx_trades_pair_tid ON trades(pair, tid);
+CREATE INDEX idx_trades_pair_timestamp ON trades(pair, timestamp);
+ALTER TABLE trades DROP COLUMN exchange;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE trades
+    ALTER COLUMN price TYPE NUMERIC,
+    ALTER COLUMN amount TYPE NUMERIC,
+    ALTER COLUMN quantity TYPE NUMERIC;
+
+ALTER TABLE klines
+    ALTER COLUMN open TYPE NUMERIC,
+    ALTER COLUMN high TYPE NUMERIC,
+    ALTER COLUMN low TYPE NUMERIC,
+    ALTER COLUMN close TYPE NUMERIC;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Values are rounded back to eight decimals.
+ALTER TABLE klines
+    ALTER COLUMN open TYPE DECIMAL(20, 8),
+    ALTER COLUMN high TYPE DECIMAL(20, 8),
+    ALTER COLUMN low TYPE DECIMAL(20, 8),
+    ALTER COLUMN close TYPE DECIMAL(20, 8);
+
+ALTER TABLE trades
+    ALTER COLUMN price TYPE DECIMAL(20, 8),
+    ALTER COLUMN amount TYPE DECIMAL(20, 8),
+    ALTER COLUMN quantity TYPE DECIMAL(20, 8);
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE klines
+    ADD COLUMN trade_count BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN vwap NUMERIC NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE klines
+    DROP COLUMN vwap,
+    DROP COLUMN trade_count;
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE klines
+    ADD COLUMN base_volume NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN quote_volume NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN first_trade_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN last_trade_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN is_closed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- volume_bs holds numbers in old rows and decimal strings in new ones; ->>
+-- returns the text of both.
+UPDATE klines SET
+    base_volume = COALESCE((volume_bs->>'buyBase')::numeric, 0) + COALESCE((volume_bs->>'sellBase')::numeric, 0),
+    quote_volume = COALESCE((volume_bs->>'buyQuote')::numeric, 0) + COALESCE((volume_bs->>'sellQuote')::numeric, 0),
+    is_closed = utc_end <= (EXTRACT(EPOCH FROM now()) * 1000)::bigint;
+
+UPDATE klines SET vwap = quote_volume / base_volume
+WHERE vwap = 0 AND base_volume > 0;
+
+-- Candles built from trades end at the start of the next candle, candles
+-- loaded from the exchange history one millisecond before it. Trade counts
+-- reported by the exchange are kept.
+UPDATE klines k SET
+    trade_count = CASE WHEN k.trade_count = 0 THEN s.trade_count ELSE k.trade_count END,
+    first_trade_id = s.first_trade_id,
+    last_trade_id = s.last_trade_id
+FROM (
+    SELECT kl.id,
+           count(*) AS trade_count,
+           (array_agg(t.tid ORDER BY t.timestamp, t.id))[1] AS first_trade_id,
+           (array_agg(t.tid ORDER BY t.timestamp DESC, t.id DESC))[1] AS last_trade_id
+    FROM klines kl
+    JOIN trades t ON t.exchange = kl.exchange
+                 AND t.pair = kl.pair
+                 AND t.timestamp >= kl.utc_begin
+                 AND t.timestamp < kl.utc_end + CASE WHEN kl.utc_end % 1000 = 999 THEN 1 ELSE 0 END
+    GROUP BY kl.id
+) s
+WHERE k.id = s.id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE klines
+    DROP COLUMN is_closed,
+    DROP COLUMN last_trade_id,
+    DROP COLUMN first_trade_id,
+    DROP COLUMN quote_volume,
+    DROP COLUMN base_volume;
+-- +goose StatementEnd
@@ -0,0 +1,86 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE trades RENAME TO trades_unpartitioned;
+ALTER TABLE trades_unpartitioned RENAME CONSTRAINT trades_pkey TO trades_unpartitioned_pkey;
+ALTER TABLE trades_unpartitioned RENAME CONSTRAINT trades_exchange_pair_tid_key TO trades_unpartitioned_exchange_pair_tid_key;
+DROP INDEX IF EXISTS idx_trades_exchange_pair_timestamp;
+
+-- Unique keys of a partitioned table must include the partition key.
+CREATE TABLE trades (
+    id BIGINT NOT NULL DEFAULT nextval('trades_id_seq'),
+    tid VARCHAR(255) NOT NULL,
+    pair VARCHAR(20) NOT NULL,
+    price NUMERIC NOT NULL,
+    amount NUMERIC NOT NULL,
+    quantity NUMERIC NOT NULL,
+    side VARCHAR(4) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    exchange VARCHAR(20) NOT NULL,
+    PRIMARY KEY (id, timestamp),
+    UNIQUE (exchange, pair, tid, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+CREATE INDEX idx_trades_exchange_pair_timestamp ON trades(exchange, pair, timestamp);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- One partition per calendar month (UTC) from the oldest stored trade up to
+-- two months ahead; the collector creates the later ones.
+DO $$
+DECLARE
+    month TIMESTAMP := date_trunc('month', COALESCE(
+        (SELECT to_timestamp(min(timestamp) / 1000.0) FROM trades_unpartitioned), now()) AT TIME ZONE 'UTC');
+    last_month TIMESTAMP := date_trunc('month', now() AT TIME ZONE 'UTC') + INTERVAL '2 months';
+BEGIN
+    WHILE month <= last_month LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF trades FOR VALUES FROM (%s) TO (%s)',
+            'trades_' || to_char(month, '"y"YYYY"m"MM'),
+            (EXTRACT(EPOCH FROM month AT TIME ZONE 'UTC') * 1000)::BIGINT,
+            (EXTRACT(EPOCH FROM (month + INTERVAL '1 month') AT TIME ZONE 'UTC') * 1000)::BIGINT);
+        month := month + INTERVAL '1 month';
+    END LOOP;
+END $$;
+
+-- Trades of months without a partition land here instead of being rejected;
+-- the collector moves them into their monthly partition.
+CREATE TABLE trades_default PARTITION OF trades DEFAULT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO trades (id, tid, pair, price, amount, quantity, side, timestamp, created_at, exchange)
+SELECT id, tid, pair, price, amount, quantity, side, timestamp, created_at, exchange FROM trades_unpartitioned;
+
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+DROP TABLE trades_unpartitioned;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE trades RENAME TO trades_partitioned;
+DROP INDEX IF EXISTS idx_trades_exchange_pair_timestamp;
+ALTER TABLE trades_partitioned RENAME CONSTRAINT trades_pkey TO trades_partitioned_pkey;
+ALTER TABLE trades_partitioned RENAME CONSTRAINT trades_exchange_pair_tid_timestamp_key TO trades_partitioned_exchange_pair_tid_timestamp_key;
+
+CREATE TABLE trades (
+    id BIGINT NOT NULL DEFAULT nextval('trades_id_seq') PRIMARY KEY,
+    tid VARCHAR(255) NOT NULL,
+    pair VARCHAR(20) NOT NULL,
+    price NUMERIC NOT NULL,
+    amount NUMERIC NOT NULL,
+    quantity NUMERIC NOT NULL,
+    side VARCHAR(4) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    exchange VARCHAR(20) NOT NULL,
+    UNIQUE (exchange, pair, tid)
+);
+CREATE INDEX idx_trades_exchange_pair_timestamp ON trades(exchange, pair, timestamp);
+
+INSERT INTO trades (id, tid, pair, price, amount, quantity, side, timestamp, created_at, exchange)
+SELECT id, tid, pair, price, amount, quantity, side, timestamp, created_at, exchange FROM trades_partitioned
+ON CONFLICT DO NOTHING;
+
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+DROP TABLE trades_partitioned;
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS timescaledb;
+
+-- Trade times are unix milliseconds; policies on integer time columns need
+-- the current time in the same unit.
+CREATE OR REPLACE FUNCTION unix_now_ms() RETURNS BIGINT
+    LANGUAGE SQL STABLE AS $$ SELECT (EXTRACT(EPOCH FROM now()) * 1000)::BIGINT $$;
+
+-- Unique keys of a hypertable must include the partitioning column.
+ALTER TABLE trades DROP CONSTRAINT trades_pkey;
+ALTER TABLE trades ADD PRIMARY KEY (id, timestamp);
+ALTER TABLE trades DROP CONSTRAINT trades_exchange_pair_tid_key;
+ALTER TABLE trades ADD CONSTRAINT trades_exchange_pair_tid_timestamp_key UNIQUE (exchange, pair, tid, timestamp);
+
+-- One chunk a day.
+SELECT create_hypertable('trades', 'timestamp', chunk_time_interval => BIGINT '86400000', migrate_data => TRUE);
+SELECT set_integer_now_func('trades', 'unix_now_ms');
+
+-- Trades older than a week are compressed, older than 90 days dropped. The
+-- candles built from them stay in the continuous aggregates.
+ALTER TABLE trades SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'exchange, pair',
+    timescaledb.compress_orderby = 'timestamp, tid'
+);
+SELECT add_compression_policy('trades', compress_after => BIGINT '604800000');
+SELECT add_retention_policy('trades', drop_after => BIGINT '7776000000');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT remove_retention_policy('trades', if_exists => TRUE);
+SELECT remove_compression_policy('trades', if_exists => TRUE);
+
+-- A hypertable cannot be turned back into a plain table, so the trades are
+-- copied into a new one.
+CREATE TABLE trades_plain (LIKE trades INCLUDING DEFAULTS);
+INSERT INTO trades_plain SELECT * FROM trades;
+ALTER SEQUENCE trades_id_seq OWNED BY NONE;
+DROP TABLE trades;
+ALTER TABLE trades_plain RENAME TO trades;
+ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+
+ALTER TABLE trades ADD PRIMARY KEY (id);
+ALTER TABLE trades ADD CONSTRAINT trades_exchange_pair_tid_key UNIQUE (exchange, pair, tid);
+CREATE INDEX idx_trades_exchange_pair_timestamp ON trades(exchange, pair, timestamp);
+CREATE INDEX idx_trades_pair_timestamp ON trades(pair, timestamp);
+
+DROP FUNCTION IF EXISTS unix_now_ms();
+-- +goose StatementEnd
@@ -0,0 +1,426 @@
+-- +goose NO TRANSACTION
+-- Continuous aggregates cannot be created inside a transaction.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_minute_5
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '300000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '300000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_minute_5', start_offset => BIGINT '86400000', end_offset => BIGINT '300000', schedule_interval => INTERVAL '5 minutes');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_minute_10
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '600000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '600000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_minute_10', start_offset => BIGINT '86400000', end_offset => BIGINT '600000', schedule_interval => INTERVAL '10 minutes');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_minute_15
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '900000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '900000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_minute_15', start_offset => BIGINT '86400000', end_offset => BIGINT '900000', schedule_interval => INTERVAL '15 minutes');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_minute_30
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '1800000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '1800000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_minute_30', start_offset => BIGINT '86400000', end_offset => BIGINT '1800000', schedule_interval => INTERVAL '30 minutes');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_hour_1
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '3600000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '3600000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_hour_1', start_offset => BIGINT '86400000', end_offset => BIGINT '3600000', schedule_interval => INTERVAL '1 hour');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_hour_2
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '7200000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '7200000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_hour_2', start_offset => BIGINT '86400000', end_offset => BIGINT '7200000', schedule_interval => INTERVAL '1 hour');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_hour_4
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '14400000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '14400000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_hour_4', start_offset => BIGINT '86400000', end_offset => BIGINT '14400000', schedule_interval => INTERVAL '1 hour');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_hour_6
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '21600000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '21600000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_hour_6', start_offset => BIGINT '86400000', end_offset => BIGINT '21600000', schedule_interval => INTERVAL '1 hour');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_hour_12
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '43200000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '43200000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_hour_12', start_offset => BIGINT '129600000', end_offset => BIGINT '43200000', schedule_interval => INTERVAL '1 hour');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_day_1
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '86400000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '86400000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_day_1', start_offset => BIGINT '259200000', end_offset => BIGINT '86400000', schedule_interval => INTERVAL '1 hour');
+
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_day_3
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '259200000', timestamp) AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '259200000', timestamp)
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_day_3', start_offset => BIGINT '777600000', end_offset => BIGINT '259200000', schedule_interval => INTERVAL '1 hour');
+
+-- Weeks start on Monday, four days after the unix epoch.
+-- +goose StatementBegin
+CREATE MATERIALIZED VIEW klines_week_1
+WITH (timescaledb.continuous, timescaledb.materialized_only = FALSE) AS
+SELECT exchange,
+       pair,
+       time_bucket(BIGINT '604800000', timestamp, BIGINT '345600000') AS utc_begin,
+       first(price, timestamp) AS open,
+       max(price) AS high,
+       min(price) AS low,
+       last(price, timestamp) AS close,
+       COALESCE(sum(quantity) FILTER (WHERE side = 'buy'), 0) AS buy_base,
+       COALESCE(sum(quantity) FILTER (WHERE side <> 'buy'), 0) AS sell_base,
+       COALESCE(sum(amount) FILTER (WHERE side = 'buy'), 0) AS buy_quote,
+       COALESCE(sum(amount) FILTER (WHERE side <> 'buy'), 0) AS sell_quote,
+       count(*) AS trade_count,
+       sum(quantity) AS base_volume,
+       sum(amount) AS quote_volume,
+       first(tid, timestamp) AS first_trade_id,
+       last(tid, timestamp) AS last_trade_id
+FROM trades
+GROUP BY exchange, pair, time_bucket(BIGINT '604800000', timestamp, BIGINT '345600000')
+WITH NO DATA;
+-- +goose StatementEnd
+
+SELECT add_continuous_aggregate_policy('klines_week_1', start_offset => BIGINT '1814400000', end_offset => BIGINT '604800000', schedule_interval => INTERVAL '1 hour');
+
+-- klines_timescale reads like klines: the candles of the aggregated intervals
+-- come from the continuous aggregates, the others from klines. The last
+-- bucket of an aggregate is computed from trades at query time.
+-- +goose StatementBegin
+CREATE VIEW klines_timescale AS
+SELECT exchange, pair, interval, open, high, low, close, utc_begin, utc_end, begin_dt, end_dt, volume_bs,
+       trade_count, vwap, base_volume, quote_volume, first_trade_id, last_trade_id, is_closed
+FROM klines
+WHERE interval NOT IN ('MINUTE_5', 'MINUTE_10', 'MINUTE_15', 'MINUTE_30', 'HOUR_1', 'HOUR_2', 'HOUR_4', 'HOUR_6', 'HOUR_12', 'DAY_1', 'DAY_3', 'WEEK_1')
+UNION ALL
+SELECT exchange, pair, 'MINUTE_5'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 300000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 300000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 300000 <= unix_now_ms()
+FROM klines_minute_5
+UNION ALL
+SELECT exchange, pair, 'MINUTE_10'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 600000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 600000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 600000 <= unix_now_ms()
+FROM klines_minute_10
+UNION ALL
+SELECT exchange, pair, 'MINUTE_15'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 900000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 900000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 900000 <= unix_now_ms()
+FROM klines_minute_15
+UNION ALL
+SELECT exchange, pair, 'MINUTE_30'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 1800000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 1800000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 1800000 <= unix_now_ms()
+FROM klines_minute_30
+UNION ALL
+SELECT exchange, pair, 'HOUR_1'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 3600000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 3600000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 3600000 <= unix_now_ms()
+FROM klines_hour_1
+UNION ALL
+SELECT exchange, pair, 'HOUR_2'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 7200000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 7200000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 7200000 <= unix_now_ms()
+FROM klines_hour_2
+UNION ALL
+SELECT exchange, pair, 'HOUR_4'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 14400000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 14400000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 14400000 <= unix_now_ms()
+FROM klines_hour_4
+UNION ALL
+SELECT exchange, pair, 'HOUR_6'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 21600000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 21600000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 21600000 <= unix_now_ms()
+FROM klines_hour_6
+UNION ALL
+SELECT exchange, pair, 'HOUR_12'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 43200000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 43200000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 43200000 <= unix_now_ms()
+FROM klines_hour_12
+UNION ALL
+SELECT exchange, pair, 'DAY_1'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 86400000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 86400000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 86400000 <= unix_now_ms()
+FROM klines_day_1
+UNION ALL
+SELECT exchange, pair, 'DAY_3'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 259200000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 259200000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 259200000 <= unix_now_ms()
+FROM klines_day_3
+UNION ALL
+SELECT exchange, pair, 'WEEK_1'::VARCHAR(10), open, high, low, close, utc_begin, utc_begin + 604800000,
+       to_timestamp(utc_begin / 1000.0), to_timestamp((utc_begin + 604800000) / 1000.0),
+       jsonb_build_object('buyBase', buy_base::TEXT, 'sellBase', sell_base::TEXT, 'buyQuote', buy_quote::TEXT, 'sellQuote', sell_quote::TEXT),
+       trade_count, CASE WHEN base_volume > 0 THEN quote_volume / base_volume ELSE 0 END, base_volume, quote_volume,
+       first_trade_id, last_trade_id, utc_begin + 604800000 <= unix_now_ms()
+FROM klines_week_1;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP VIEW IF EXISTS klines_timescale;
+DROP MATERIALIZED VIEW IF EXISTS klines_week_1;
+DROP MATERIALIZED VIEW IF EXISTS klines_day_3;
+DROP MATERIALIZED VIEW IF EXISTS klines_day_1;
+DROP MATERIALIZED VIEW IF EXISTS klines_hour_12;
+DROP MATERIALIZED VIEW IF EXISTS klines_hour_6;
+DROP MATERIALIZED VIEW IF EXISTS klines_hour_4;
+DROP MATERIALIZED VIEW IF EXISTS klines_hour_2;
+DROP MATERIALIZED VIEW IF EXISTS klines_hour_1;
+DROP MATERIALIZED VIEW IF EXISTS klines_minute_30;
+DROP MATERIALIZED VIEW IF EXISTS klines_minute_15;
+DROP MATERIALIZED VIEW IF EXISTS klines_minute_10;
+DROP MATERIALIZED VIEW IF EXISTS klines_minute_5;
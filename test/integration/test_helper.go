@@ -12,15 +12,36 @@ import (
 )
 
 type PostgresContainer struct {
-	Container testcontainers.Container
-	Pool      *pgxpool.Pool
+	Container  testcontainers.Container
+	Pool       *pgxpool.Pool
+	ConnString string
 }
 
-func NewPostgresContainer(t *testing.T) (*PostgresContainer, error) {
+type containerOptions struct {
+	image string
+}
+
+// ContainerOption configures the database container.
+type ContainerOption func(*containerOptions)
+
+// WithImage runs the database from image instead of plain Postgres, e.g.
+// from one with TimescaleDB.
+func WithImage(image string) ContainerOption {
+	return func(o *containerOptions) {
+		o.image = image
+	}
+}
+
+func NewPostgresContainer(t *testing.T, opts ...ContainerOption) (*PostgresContainer, error) {
 	ctx := context.Background()
 
+	o := containerOptions{image: "postgres:14-alpine"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	req := testcontainers.ContainerRequest{
-		Image:        "postgres:14-alpine",
+		Image:        o.image,
 		ExposedPorts: []string{"5432/tcp"},
 		WaitingFor: wait.ForAll(
 			wait.ForListeningPort("5432/tcp"),
@@ -95,8 +116,9 @@ func NewPostgresContainer(t *testing.T) (*PostgresContainer, error) {
 	}
 
 	return &PostgresContainer{
-		Container: container,
-		Pool:      pool,
+		Container:  container,
+		Pool:       pool,
+		ConnString: connString,
 	}, nil
 }
 
@@ -113,36 +135,72 @@ func applyMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 	migrations := []string{
 		`CREATE TABLE IF NOT EXISTS klines (
             id SERIAL PRIMARY KEY,
+            exchange VARCHAR(20) NOT NULL,
             pair VARCHAR(20) NOT NULL,
             interval VARCHAR(10) NOT NULL,
-            open DECIMAL(20, 8) NOT NULL,
-            high DECIMAL(20, 8) NOT NULL,
-            low DECIMAL(20, 8) NOT NULL,
-            close DECIMAL(20, 8) NOT NULL,
+            open NUMERIC NOT NULL,
+            high NUMERIC NOT NULL,
+            low NUMERIC NOT NULL,
+            close NUMERIC NOT NULL,
             utc_begin BIGINT NOT NULL,
             utc_end BIGINT NOT NULL,
             begin_dt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
             end_dt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
             volume_bs JSONB NOT NULL,
+            trade_count BIGINT NOT NULL DEFAULT 0,
+            vwap NUMERIC NOT NULL DEFAULT 0,
+            base_volume NUMERIC NOT NULL DEFAULT 0,
+            quote_volume NUMERIC NOT NULL DEFAULT 0,
+            first_trade_id VARCHAR(255) NOT NULL DEFAULT '',
+            last_trade_id VARCHAR(255) NOT NULL DEFAULT '',
+            is_closed BOOLEAN NOT NULL DEFAULT FALSE,
             created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
             updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-            UNIQUE(pair, interval, utc_begin)
+            UNIQUE(exchange, pair, interval, utc_begin)
         )`,
-		`CREATE INDEX IF NOT EXISTS idx_klines_pair_interval_utc ON klines(pair, interval, utc_begin)`,
 
 		`CREATE TABLE IF NOT EXISTS trades (
             id BIGSERIAL PRIMARY KEY,
+            exchange VARCHAR(20) NOT NULL,
             tid VARCHAR(255) NOT NULL,
             pair VARCHAR(20) NOT NULL,
-            price DECIMAL(20, 8) NOT NULL,
-            amount DECIMAL(20, 8) NOT NULL,
-            quantity DECIMAL(20, 8) NOT NULL,
+            price NUMERIC NOT NULL,
+            amount NUMERIC NOT NULL,
+            quantity NUMERIC NOT NULL,
             side VARCHAR(4) NOT NULL,
             timestamp BIGINT NOT NULL,
             created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-            UNIQUE(tid, pair)
+            UNIQUE(exchange, pair, tid)
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_trades_exchange_pair_timestamp ON trades(exchange, pair, timestamp)`,
+
+		`CREATE TABLE IF NOT EXISTS tickers (
+            id BIGSERIAL PRIMARY KEY,
+            pair VARCHAR(20) NOT NULL,
+            last DECIMAL(20, 8) NOT NULL,
+            bid DECIMAL(20, 8) NOT NULL,
+            ask DECIMAL(20, 8) NOT NULL,
+            open DECIMAL(20, 8) NOT NULL,
+            high DECIMAL(20, 8) NOT NULL,
+            low DECIMAL(20, 8) NOT NULL,
+            volume DECIMAL(30, 8) NOT NULL,
+            quote_volume DECIMAL(30, 8) NOT NULL,
+            change DECIMAL(20, 8) NOT NULL,
+            trade_count BIGINT NOT NULL,
+            timestamp BIGINT NOT NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE(pair, timestamp)
+        )`,
+
+		`CREATE TABLE IF NOT EXISTS backfill_checkpoints (
+            exchange VARCHAR(20) NOT NULL,
+            pair VARCHAR(20) NOT NULL,
+            interval VARCHAR(10) NOT NULL,
+            start_time BIGINT NOT NULL,
+            done_until BIGINT NOT NULL,
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (exchange, pair, interval)
         )`,
-		`CREATE INDEX IF NOT EXISTS idx_trades_pair_timestamp ON trades(pair, timestamp)`,
 	}
 
 	for _, migration := range migrations {
@@ -8,7 +8,9 @@ import (
 	context "context"
 	reflect "reflect"
 
+	instrument "github.com/Zmey56/poloniex-collector/internal/domain/instrument"
 	models "github.com/Zmey56/poloniex-collector/internal/domain/models"
+	timeframe "github.com/Zmey56/poloniex-collector/internal/domain/timeframe"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,6 +37,36 @@ func (m *MockTradeRepository) EXPECT() *MockTradeRepositoryMockRecorder {
 	return m.recorder
 }
 
+// GetLastTradeTime mocks base method.
+func (m *MockTradeRepository) GetLastTradeTime(ctx context.Context, pair string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastTradeTime", ctx, pair)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastTradeTime indicates an expected call of GetLastTradeTime.
+func (mr *MockTradeRepositoryMockRecorder) GetLastTradeTime(ctx, pair interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastTradeTime", reflect.TypeOf((*MockTradeRepository)(nil).GetLastTradeTime), ctx, pair)
+}
+
+// GetTradesByTimeRange mocks base method.
+func (m *MockTradeRepository) GetTradesByTimeRange(ctx context.Context, pair string, startTime, endTime int64, afterTid string, limit int) ([]models.RecentTrade, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTradesByTimeRange", ctx, pair, startTime, endTime, afterTid, limit)
+	ret0, _ := ret[0].([]models.RecentTrade)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTradesByTimeRange indicates an expected call of GetTradesByTimeRange.
+func (mr *MockTradeRepositoryMockRecorder) GetTradesByTimeRange(ctx, pair, startTime, endTime, afterTid, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTradesByTimeRange", reflect.TypeOf((*MockTradeRepository)(nil).GetTradesByTimeRange), ctx, pair, startTime, endTime, afterTid, limit)
+}
+
 // SaveTrade mocks base method.
 func (m *MockTradeRepository) SaveTrade(ctx context.Context, trade models.RecentTrade) error {
 	m.ctrl.T.Helper()
@@ -131,6 +163,21 @@ func (mr *MockKlineRepositoryMockRecorder) GetLastKline(ctx, pair, timeframe int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastKline", reflect.TypeOf((*MockKlineRepository)(nil).GetLastKline), ctx, pair, timeframe)
 }
 
+// GetLastKlineBefore mocks base method.
+func (m *MockKlineRepository) GetLastKlineBefore(ctx context.Context, pair, timeframe string, before int64) (*models.Kline, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastKlineBefore", ctx, pair, timeframe, before)
+	ret0, _ := ret[0].(*models.Kline)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastKlineBefore indicates an expected call of GetLastKlineBefore.
+func (mr *MockKlineRepositoryMockRecorder) GetLastKlineBefore(ctx, pair, timeframe, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastKlineBefore", reflect.TypeOf((*MockKlineRepository)(nil).GetLastKlineBefore), ctx, pair, timeframe, before)
+}
+
 // SaveKline mocks base method.
 func (m *MockKlineRepository) SaveKline(ctx context.Context, kline models.Kline) error {
 	m.ctrl.T.Helper()
@@ -145,6 +192,124 @@ func (mr *MockKlineRepositoryMockRecorder) SaveKline(ctx, kline interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveKline", reflect.TypeOf((*MockKlineRepository)(nil).SaveKline), ctx, kline)
 }
 
+// SaveKlines mocks base method.
+func (m *MockKlineRepository) SaveKlines(ctx context.Context, klines []models.Kline) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveKlines", ctx, klines)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveKlines indicates an expected call of SaveKlines.
+func (mr *MockKlineRepositoryMockRecorder) SaveKlines(ctx, klines interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveKlines", reflect.TypeOf((*MockKlineRepository)(nil).SaveKlines), ctx, klines)
+}
+
+// MockTickerRepository is a mock of TickerRepository interface.
+type MockTickerRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockTickerRepositoryMockRecorder
+}
+
+// MockTickerRepositoryMockRecorder is the mock recorder for MockTickerRepository.
+type MockTickerRepositoryMockRecorder struct {
+	mock *MockTickerRepository
+}
+
+// NewMockTickerRepository creates a new mock instance.
+func NewMockTickerRepository(ctrl *gomock.Controller) *MockTickerRepository {
+	mock := &MockTickerRepository{ctrl: ctrl}
+	mock.recorder = &MockTickerRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTickerRepository) EXPECT() *MockTickerRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetLastTicker mocks base method.
+func (m *MockTickerRepository) GetLastTicker(ctx context.Context, pair string) (*models.Ticker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastTicker", ctx, pair)
+	ret0, _ := ret[0].(*models.Ticker)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastTicker indicates an expected call of GetLastTicker.
+func (mr *MockTickerRepositoryMockRecorder) GetLastTicker(ctx, pair interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastTicker", reflect.TypeOf((*MockTickerRepository)(nil).GetLastTicker), ctx, pair)
+}
+
+// SaveTicker mocks base method.
+func (m *MockTickerRepository) SaveTicker(ctx context.Context, ticker models.Ticker) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTicker", ctx, ticker)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTicker indicates an expected call of SaveTicker.
+func (mr *MockTickerRepositoryMockRecorder) SaveTicker(ctx, ticker interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTicker", reflect.TypeOf((*MockTickerRepository)(nil).SaveTicker), ctx, ticker)
+}
+
+// MockCheckpointRepository is a mock of CheckpointRepository interface.
+type MockCheckpointRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockCheckpointRepositoryMockRecorder
+}
+
+// MockCheckpointRepositoryMockRecorder is the mock recorder for MockCheckpointRepository.
+type MockCheckpointRepositoryMockRecorder struct {
+	mock *MockCheckpointRepository
+}
+
+// NewMockCheckpointRepository creates a new mock instance.
+func NewMockCheckpointRepository(ctrl *gomock.Controller) *MockCheckpointRepository {
+	mock := &MockCheckpointRepository{ctrl: ctrl}
+	mock.recorder = &MockCheckpointRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCheckpointRepository) EXPECT() *MockCheckpointRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetCheckpoint mocks base method.
+func (m *MockCheckpointRepository) GetCheckpoint(ctx context.Context, pair, timeframe string) (*models.BackfillCheckpoint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCheckpoint", ctx, pair, timeframe)
+	ret0, _ := ret[0].(*models.BackfillCheckpoint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCheckpoint indicates an expected call of GetCheckpoint.
+func (mr *MockCheckpointRepositoryMockRecorder) GetCheckpoint(ctx, pair, timeframe interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckpoint", reflect.TypeOf((*MockCheckpointRepository)(nil).GetCheckpoint), ctx, pair, timeframe)
+}
+
+// SaveCheckpoint mocks base method.
+func (m *MockCheckpointRepository) SaveCheckpoint(ctx context.Context, checkpoint models.BackfillCheckpoint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCheckpoint", ctx, checkpoint)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCheckpoint indicates an expected call of SaveCheckpoint.
+func (mr *MockCheckpointRepositoryMockRecorder) SaveCheckpoint(ctx, checkpoint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCheckpoint", reflect.TypeOf((*MockCheckpointRepository)(nil).SaveCheckpoint), ctx, checkpoint)
+}
+
 // MockExchangeClient is a mock of ExchangeClient interface.
 type MockExchangeClient struct {
 	ctrl     *gomock.Controller
@@ -169,31 +334,136 @@ func (m *MockExchangeClient) EXPECT() *MockExchangeClientMockRecorder {
 }
 
 // GetHistoricalKlines mocks base method.
-func (m *MockExchangeClient) GetHistoricalKlines(ctx context.Context, pair, timeframe string, startTime, endTime int64) ([]models.Kline, error) {
+func (m *MockExchangeClient) GetHistoricalKlines(ctx context.Context, inst instrument.Instrument, tf timeframe.TimeFrame, startTime, endTime int64) ([]models.Kline, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetHistoricalKlines", ctx, pair, timeframe, startTime, endTime)
+	ret := m.ctrl.Call(m, "GetHistoricalKlines", ctx, inst, tf, startTime, endTime)
 	ret0, _ := ret[0].([]models.Kline)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetHistoricalKlines indicates an expected call of GetHistoricalKlines.
-func (mr *MockExchangeClientMockRecorder) GetHistoricalKlines(ctx, pair, timeframe, startTime, endTime interface{}) *gomock.Call {
+func (mr *MockExchangeClientMockRecorder) GetHistoricalKlines(ctx, inst, tf, startTime, endTime interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistoricalKlines", reflect.TypeOf((*MockExchangeClient)(nil).GetHistoricalKlines), ctx, inst, tf, startTime, endTime)
+}
+
+// GetHistoricalTrades mocks base method.
+func (m *MockExchangeClient) GetHistoricalTrades(ctx context.Context, inst instrument.Instrument, from, to int64) ([]models.RecentTrade, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistoricalTrades", ctx, inst, from, to)
+	ret0, _ := ret[0].([]models.RecentTrade)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistoricalTrades indicates an expected call of GetHistoricalTrades.
+func (mr *MockExchangeClientMockRecorder) GetHistoricalTrades(ctx, inst, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistoricalTrades", reflect.TypeOf((*MockExchangeClient)(nil).GetHistoricalTrades), ctx, inst, from, to)
+}
+
+// Name mocks base method.
+func (m *MockExchangeClient) Name() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Name")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Name indicates an expected call of Name.
+func (mr *MockExchangeClientMockRecorder) Name() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistoricalKlines", reflect.TypeOf((*MockExchangeClient)(nil).GetHistoricalKlines), ctx, pair, timeframe, startTime, endTime)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Name", reflect.TypeOf((*MockExchangeClient)(nil).Name))
 }
 
 // SubscribeToTrades mocks base method.
-func (m *MockExchangeClient) SubscribeToTrades(ctx context.Context, pairs []string) (<-chan models.RecentTrade, error) {
+func (m *MockExchangeClient) SubscribeToTrades(ctx context.Context, instruments []instrument.Instrument) (<-chan models.RecentTrade, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SubscribeToTrades", ctx, pairs)
+	ret := m.ctrl.Call(m, "SubscribeToTrades", ctx, instruments)
 	ret0, _ := ret[0].(<-chan models.RecentTrade)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SubscribeToTrades indicates an expected call of SubscribeToTrades.
-func (mr *MockExchangeClientMockRecorder) SubscribeToTrades(ctx, pairs interface{}) *gomock.Call {
+func (mr *MockExchangeClientMockRecorder) SubscribeToTrades(ctx, instruments interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeToTrades", reflect.TypeOf((*MockExchangeClient)(nil).SubscribeToTrades), ctx, instruments)
+}
+
+// MockTickerClient is a mock of TickerClient interface.
+type MockTickerClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockTickerClientMockRecorder
+}
+
+// MockTickerClientMockRecorder is the mock recorder for MockTickerClient.
+type MockTickerClientMockRecorder struct {
+	mock *MockTickerClient
+}
+
+// NewMockTickerClient creates a new mock instance.
+func NewMockTickerClient(ctrl *gomock.Controller) *MockTickerClient {
+	mock := &MockTickerClient{ctrl: ctrl}
+	mock.recorder = &MockTickerClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTickerClient) EXPECT() *MockTickerClientMockRecorder {
+	return m.recorder
+}
+
+// SubscribeToTickers mocks base method.
+func (m *MockTickerClient) SubscribeToTickers(ctx context.Context, pairs []string) (<-chan models.Ticker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeToTickers", ctx, pairs)
+	ret0, _ := ret[0].(<-chan models.Ticker)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeToTickers indicates an expected call of SubscribeToTickers.
+func (mr *MockTickerClientMockRecorder) SubscribeToTickers(ctx, pairs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeToTickers", reflect.TypeOf((*MockTickerClient)(nil).SubscribeToTickers), ctx, pairs)
+}
+
+// MockOrderBookClient is a mock of OrderBookClient interface.
+type MockOrderBookClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderBookClientMockRecorder
+}
+
+// MockOrderBookClientMockRecorder is the mock recorder for MockOrderBookClient.
+type MockOrderBookClientMockRecorder struct {
+	mock *MockOrderBookClient
+}
+
+// NewMockOrderBookClient creates a new mock instance.
+func NewMockOrderBookClient(ctrl *gomock.Controller) *MockOrderBookClient {
+	mock := &MockOrderBookClient{ctrl: ctrl}
+	mock.recorder = &MockOrderBookClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrderBookClient) EXPECT() *MockOrderBookClientMockRecorder {
+	return m.recorder
+}
+
+// SubscribeToOrderBook mocks base method.
+func (m *MockOrderBookClient) SubscribeToOrderBook(ctx context.Context, pairs []string, depth int) (<-chan models.OrderBook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeToOrderBook", ctx, pairs, depth)
+	ret0, _ := ret[0].(<-chan models.OrderBook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeToOrderBook indicates an expected call of SubscribeToOrderBook.
+func (mr *MockOrderBookClientMockRecorder) SubscribeToOrderBook(ctx, pairs, depth interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeToTrades", reflect.TypeOf((*MockExchangeClient)(nil).SubscribeToTrades), ctx, pairs)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeToOrderBook", reflect.TypeOf((*MockOrderBookClient)(nil).SubscribeToOrderBook), ctx, pairs, depth)
 }